@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+var errAFPacketUnsupported = errors.New("AF_PACKET capture is only supported on linux")
+
+// default ring of AF_PACKET capture, a frame holds a packet of max ip size
+const (
+	defaultAFPacketFrameSize = 1 << 16
+	defaultAFPacketBlockSize = 1 << 20
+	defaultAFPacketBlocks    = 64
+)
+
+// ARP hardware types of devices, as in /sys/class/net/<device>/type
+const (
+	arphrdEther    = 1
+	arphrdPPP      = 512
+	arphrdLoopback = 772
+	arphrdNone     = 65534 // tun devices
+)
+
+// link type of packets captured from device of the ARP hardware type. loopback frames have an ethernet header,
+// ppp and tun packets have no link header
+func afpacketLinkType(device string, hardwareType int) (layers.LinkType, error) {
+	switch hardwareType {
+	case arphrdEther, arphrdLoopback:
+		return layers.LinkTypeEthernet, nil
+	case arphrdPPP, arphrdNone:
+		return layers.LinkTypeRaw, nil
+	}
+	return 0, fmt.Errorf("AF_PACKET capture of device %s with hardware type %d is not supported", device,
+		hardwareType)
+}
+
+// afpacketConfig is the device, memory-mapped ring and fanout of AF_PACKET capture
+type afpacketConfig struct {
+	device    string // interface name, all interfaces(any) are not supported as their link types may differ
+	frameSize int    // max bytes of a captured packet
+	blockSize int    // must be a multiple of frame size and page size
+	blocks    int    // ring size is blocks * block size, per socket
+	// fanout group id. sockets of all processes in the same group share packets by flow hash, 0 for no fanout
+	fanout  uint16
+	sockets int    // sockets of this process joined to the fanout group, each read by its own goroutine
+	filter  string // bpf expression, empty for all packets
+}
+
+// afpacketStats is the kernel counters of AF_PACKET sockets since opened
+type afpacketStats struct {
+	packets      uint64 // received by sockets, including dropped ones
+	drops        uint64 // dropped by kernel since rings are full
+	queueFreezes uint64 // times a ring was frozen with all blocks in use
+}
+
+func (stats afpacketStats) format(format string) string {
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":         "afpacket",
+			"packets":      stats.packets,
+			"drops":        stats.drops,
+			"queueFreezes": stats.queueFreezes,
+		})
+		return string(data) + "\n"
+	}
+	return strings.Join([]string{"[afpacket]", "packets=" + strconv.FormatUint(stats.packets, 10),
+		"drops=" + strconv.FormatUint(stats.drops, 10),
+		"queue-freezes=" + strconv.FormatUint(stats.queueFreezes, 10)}, " ") + "\n"
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+// reads of sockets return after this timeout without packets, so readers can see they should stop
+const afpacketPollTimeout = 100 * time.Millisecond
+
+// AFPacketSource capture packets from AF_PACKET sockets with memory-mapped rings, which skips the copy and
+// syscall per packet of pcap. With fanout, the sockets share packets of the device by flow hash, so a
+// connection is always seen by the same socket
+type AFPacketSource struct {
+	handles  []*afpacket.TPacket
+	linkType layers.LinkType
+	// closed to stop readers, handles are closed after all readers returned
+	done      chan struct{}
+	readers   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// link type of device by its ARP hardware type. A socket bound to all interfaces gets packets of different link
+// types without telling them apart, so a device must be set
+func deviceLinkType(device string) (layers.LinkType, error) {
+	if device == "" || device == "any" {
+		return 0, errors.New("AF_PACKET capture requires a device, any is not supported")
+	}
+	data, err := ioutil.ReadFile(filepath.Join("/sys/class/net", device, "type"))
+	if err != nil {
+		return 0, err
+	}
+	hardwareType, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, err
+	}
+	return afpacketLinkType(device, hardwareType)
+}
+
+// open sockets of config, joined to the fanout group if set
+func openAFPacket(config afpacketConfig) (*AFPacketSource, error) {
+	linkType, err := deviceLinkType(config.device)
+	if err != nil {
+		return nil, err
+	}
+	var filter []bpf.RawInstruction
+	if config.filter != "" {
+		instructions, err := pcap.CompileBPFFilter(linkType, config.frameSize, config.filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, instruction := range instructions {
+			filter = append(filter, bpf.RawInstruction{Op: instruction.Code, Jt: instruction.Jt, Jf: instruction.Jf,
+				K: instruction.K})
+		}
+	}
+	var options = []interface{}{afpacket.OptFrameSize(config.frameSize), afpacket.OptBlockSize(config.blockSize),
+		afpacket.OptNumBlocks(config.blocks), afpacket.OptPollTimeout(afpacketPollTimeout),
+		afpacket.OptInterface(config.device)}
+	var source = &AFPacketSource{linkType: linkType, done: make(chan struct{})}
+	for i := 0; i < config.sockets; i++ {
+		handle, err := afpacket.NewTPacket(options...)
+		if err != nil {
+			source.close()
+			return nil, err
+		}
+		source.handles = append(source.handles, handle)
+		if filter != nil {
+			if err := handle.SetBPF(filter); err != nil {
+				source.close()
+				return nil, err
+			}
+		}
+		if config.fanout != 0 {
+			// defrag before hashing, so fragments of a packet go to the same socket
+			if err := handle.SetFanout(afpacket.FanoutHashWithDefrag, config.fanout); err != nil {
+				source.close()
+				return nil, err
+			}
+		}
+	}
+	return source, nil
+}
+
+// tcp segments of all sockets, each socket is read by its own goroutine until the source is closed
+func (source *AFPacketSource) segments(zeroCopy bool) chan *tcpSegment {
+	var channels []chan *tcpSegment
+	for _, handle := range source.handles {
+		segments := make(chan *tcpSegment, 1024)
+		source.readers.Add(1)
+		go source.read(handle, zeroCopy, segments)
+		channels = append(channels, segments)
+	}
+	if len(channels) == 1 {
+		return channels[0]
+	}
+	return mergeChannel(channels)
+}
+
+// read and decode packets of handle to segments. Zero copy data refers to the ring, it is only used before
+// the next read and never after the source is closed
+func (source *AFPacketSource) read(handle *afpacket.TPacket, zeroCopy bool, segments chan *tcpSegment) {
+	defer source.readers.Done()
+	defer close(segments)
+	decoder := newZeroCopyDecoder(source.linkType)
+	number := 0
+	for {
+		select {
+		case <-source.done:
+			return
+		default:
+		}
+		var data []byte
+		var ci gopacket.CaptureInfo
+		var err error
+		if zeroCopy {
+			data, ci, err = handle.ZeroCopyReadPacketData()
+		} else {
+			data, ci, err = handle.ReadPacketData()
+		}
+		if err == afpacket.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			logger.Warn("read AF_PACKET socket error:", err)
+			return
+		}
+		number++
+		segment := decoder.decode(data, ci.Timestamp)
+		if segment == nil {
+			continue
+		}
+		segment.number = number
+		select {
+		case segments <- segment:
+		case <-source.done:
+			return
+		}
+	}
+}
+
+// kernel counters summed over sockets
+func (source *AFPacketSource) stats() (afpacketStats, error) {
+	var total afpacketStats
+	for _, handle := range source.handles {
+		// counters of the tpacket version in use are set, the other is zero
+		v1, v3, err := handle.SocketStats()
+		if err != nil {
+			return total, err
+		}
+		total.packets += uint64(v1.Packets() + v3.Packets())
+		total.drops += uint64(v1.Drops() + v3.Drops())
+		total.queueFreezes += uint64(v3.QueueFreezes())
+	}
+	return total, nil
+}
+
+// stop readers, and close sockets after readers returned
+func (source *AFPacketSource) close() {
+	source.closeOnce.Do(func() {
+		close(source.done)
+		source.readers.Wait()
+		for _, handle := range source.handles {
+			handle.Close()
+		}
+	})
+}
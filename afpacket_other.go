@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// AFPacketSource is not available on this os
+type AFPacketSource struct{}
+
+func openAFPacket(config afpacketConfig) (*AFPacketSource, error) {
+	return nil, errAFPacketUnsupported
+}
+
+func (source *AFPacketSource) segments(zeroCopy bool) chan *tcpSegment {
+	return nil
+}
+
+func (source *AFPacketSource) stats() (afpacketStats, error) {
+	return afpacketStats{}, errAFPacketUnsupported
+}
+
+func (source *AFPacketSource) close() {
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAFPacketStatsFormat(t *testing.T) {
+	stats := afpacketStats{packets: 10, drops: 2, queueFreezes: 1}
+	assert.Equal(t, "[afpacket] packets=10 drops=2 queue-freezes=1\n", stats.format("text"))
+	assert.Equal(t, `{"drops":2,"packets":10,"queueFreezes":1,"type":"afpacket"}`+"\n", stats.format("json"))
+}
+
+func TestAFPacketLinkType(t *testing.T) {
+	linkType, err := afpacketLinkType("lo", arphrdLoopback)
+	assert.Nil(t, err)
+	assert.Equal(t, layers.LinkTypeEthernet, linkType)
+	linkType, err = afpacketLinkType("tun0", arphrdNone)
+	assert.Nil(t, err)
+	assert.Equal(t, layers.LinkTypeRaw, linkType)
+	_, err = afpacketLinkType("ib0", 32)
+	assert.EqualError(t, err, "AF_PACKET capture of device ib0 with hardware type 32 is not supported")
+}
+
+func TestAFPacketSource(t *testing.T) {
+	source, err := openAFPacket(afpacketConfig{device: "lo", frameSize: 1 << 12, blockSize: 1 << 16, blocks: 4,
+		sockets: 1})
+	if err != nil {
+		// not linux, or no permission to open packet sockets
+		t.Skip("AF_PACKET unavailable:", err)
+	}
+	defer source.close()
+	segments := source.segments(false)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer listener.Close()
+	port := layers.TCPPort(listener.Addr().(*net.TCPAddr).Port)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if !assert.Nil(t, err) {
+		return
+	}
+	conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	conn.Close()
+
+	var seen bool
+	deadline := time.After(5 * time.Second)
+	for !seen {
+		select {
+		case segment := <-segments:
+			seen = segment != nil && segment.tcp != nil && segment.tcp.DstPort == port
+		case <-deadline:
+			t.Fatal("no packet of the connection captured")
+		}
+	}
+	stats, err := source.stats()
+	assert.Nil(t, err)
+	assert.True(t, stats.packets > 0)
+
+	// closed while the reader is still polling, readers stop before sockets are closed
+	source.close()
+	for range segments {
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Benchmark measure throughput and peak heap memory of a capture run
+type Benchmark struct {
+	stats    *CaptureStats
+	start    time.Time
+	peakHeap uint64 // max sampled heap bytes in use, updated atomically
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// start measuring, heap memory is sampled every interval
+func startBenchmark(stats *CaptureStats, interval time.Duration) *Benchmark {
+	benchmark := &Benchmark{stats: stats, start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	benchmark.sample()
+	go func() {
+		defer close(benchmark.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				benchmark.sample()
+			case <-benchmark.stop:
+				return
+			}
+		}
+	}()
+	return benchmark
+}
+
+func (benchmark *Benchmark) sample() {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	for {
+		peak := atomic.LoadUint64(&benchmark.peakHeap)
+		if memStats.HeapInuse <= peak || atomic.CompareAndSwapUint64(&benchmark.peakHeap, peak, memStats.HeapInuse) {
+			return
+		}
+	}
+}
+
+// stop measuring, and return the report line. Should be called after all connections are handled
+func (benchmark *Benchmark) finish() string {
+	elapsed := time.Since(benchmark.start)
+	close(benchmark.stop)
+	<-benchmark.done
+	benchmark.sample()
+	packets := atomic.LoadInt64(&benchmark.stats.packets)
+	bytes := atomic.LoadInt64(&benchmark.stats.bytes)
+	seconds := elapsed.Seconds()
+	return fmt.Sprintf("[bench] packets=%d bytes=%d connections=%d exchanges=%d elapsed=%v "+
+		"packets/s=%.0f MB/s=%.2f peak-heap=%.1fMB\n",
+		packets, bytes, atomic.LoadInt64(&benchmark.stats.connections),
+		atomic.LoadInt64(&benchmark.stats.exchanges), elapsed.Round(time.Millisecond),
+		float64(packets)/seconds, float64(bytes)/seconds/(1<<20),
+		float64(atomic.LoadUint64(&benchmark.peakHeap))/(1<<20))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBenchmarkReport(t *testing.T) {
+	var fixture bytes.Buffer
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	writePcapStream(t, &fixture, [][]byte{
+		tcpPacketDataOf(t, 50000, true, 1000, 5000, "GET /a HTTP/1.1\r\n"),
+		tcpPacketDataOf(t, 50001, true, 3000, 7000, "GET /b HTTP/1.1\r\n"),
+		tcpPacketDataOf(t, 50000, true, 1017, 5000, "Host: example.com\r\n\r\n"),
+		tcpPacketDataOf(t, 50001, true, 3017, 7000, "Host: example.com\r\n\r\n"),
+		tcpPacketDataOf(t, 50000, false, 5000, 1038, response),
+		tcpPacketDataOf(t, 50001, false, 7000, 3038, response),
+		tcpPacketDataOf(t, 50000, true, 1038, 5027, ""),
+		tcpPacketDataOf(t, 50001, true, 3038, 7027, ""),
+	})
+	segments, err := pcapStreamSegments(&fixture, false)
+	assert.Nil(t, err)
+
+	handler, sink := newTestHTTPHandler(&Config{})
+	assembler := newTCPAssembler(handler, handler.printer)
+	stats := &CaptureStats{}
+	handler.stats = stats
+	assembler.stats = stats
+	benchmark := startBenchmark(stats, time.Millisecond)
+	capture(segments, assembler, 0, nil)
+	assembler.finishAll()
+	waitGroup.Wait()
+	report := benchmark.finish()
+
+	assert.Equal(t, 2, len(sink.exchanges))
+	matches := regexp.MustCompile(`^\[bench\] packets=8 bytes=130 connections=2 exchanges=2 elapsed=\S+ ` +
+		`packets/s=(\d+) MB/s=\d+\.\d\d peak-heap=(\d+\.\d)MB\n$`).FindStringSubmatch(report)
+	assert.NotNil(t, matches, report)
+	if matches != nil {
+		packetRate, _ := strconv.Atoi(matches[1])
+		assert.True(t, packetRate > 0)
+		peakHeap, _ := strconv.ParseFloat(matches[2], 64)
+		assert.True(t, peakHeap > 0)
+	}
+}
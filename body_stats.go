@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"httpdump/httpport"
+)
+
+// bodyStats is cheap metrics of a decoded body, for analytics of text apis
+type bodyStats struct {
+	bytes    int64 // size after content-encoding decoded
+	lines    int64 // a last line without line feed is also counted
+	jsonKeys int   // keys of top level json object, -1 if body is not a json object
+}
+
+// compute stats of decoded body in a single pass. json keys are counted by tracking nesting and strings,
+// without validating the json, so an invalid json object still get the keys seen
+func computeBodyStats(data []byte) bodyStats {
+	var stats = bodyStats{bytes: int64(len(data)), jsonKeys: -1}
+	var depth int
+	var inString, escaped bool
+	var started bool   // first non-space byte seen
+	var afterKey bool  // a string at depth 1 ended, it is a key if followed by colon
+	var expectKey bool // at depth 1, a string here is a key
+	for _, c := range data {
+		if c == '\n' {
+			stats.lines++
+		}
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+				afterKey = depth == 1 && expectKey
+			}
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		if !started {
+			started = true
+			if c != '{' {
+				// not a json object, only lines are counted
+				depth = -1
+				continue
+			}
+			stats.jsonKeys = 0
+		}
+		if depth < 0 {
+			continue
+		}
+		if afterKey {
+			afterKey = false
+			if c == ':' {
+				stats.jsonKeys++
+				expectKey = false
+				continue
+			}
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			expectKey = depth == 1
+		case '}', ']':
+			depth--
+		case ',':
+			expectKey = depth == 1
+		}
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		stats.lines++
+	}
+	return stats
+}
+
+// compute stats of decoded body, body is kept for later reading. nil if body is empty or can not be decoded.
+// stats of content decoded before the limit if decoded body exceeds it
+func (h *HTTPTrafficHandler) readBodyStats(body *io.ReadCloser, header httpport.Header) *bodyStats {
+	data, err := h.bufferBody(body, header)
+	if err != nil && err != errCompressionBomb || len(data) == 0 {
+		return nil
+	}
+	stats := computeBodyStats(data)
+	return &stats
+}
+
+func (stats *bodyStats) String() string {
+	result := fmt.Sprintf("bytes=%d lines=%d", stats.bytes, stats.lines)
+	if stats.jsonKeys >= 0 {
+		result += fmt.Sprintf(" json-keys=%d", stats.jsonKeys)
+	}
+	return result
+}
+
+func (stats *bodyStats) toMap() map[string]interface{} {
+	record := map[string]interface{}{"bytes": stats.bytes, "lines": stats.lines}
+	if stats.jsonKeys >= 0 {
+		record["jsonKeys"] = stats.jsonKeys
+	}
+	return record
+}
+
+// send a body stats record of exchange to printer, if any body has stats
+func (h *HTTPTrafficHandler) reportBodyStats(exchange *Exchange) {
+	request, response := exchange.requestBodyStats, exchange.responseBodyStats
+	if request == nil && response == nil {
+		return
+	}
+	if h.config.format == "json" {
+		record := map[string]interface{}{
+			"type": "body-stats",
+			"src":  exchange.key.srcString(),
+			"dst":  exchange.key.dstString(),
+		}
+		if request != nil {
+			record["request"] = request.toMap()
+		}
+		if response != nil {
+			record["response"] = response.toMap()
+		}
+		data, _ := json.Marshal(record)
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	var fields = []string{"[body-stats]", exchange.key.srcString(), "->", exchange.key.dstString(),
+		exchange.method, exchange.host + exchange.url}
+	if request != nil {
+		fields = append(fields, "request", request.String())
+	}
+	if response != nil {
+		fields = append(fields, "response", response.String())
+	}
+	h.printer.send(strings.Join(fields, " ") + "\n")
+}
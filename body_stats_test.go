@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeBodyStats(t *testing.T) {
+	body := "{\n  \"name\": \"a:b\",\n  \"tags\": [\"x\", \"y\"],\n  \"nested\": {\"inner\": 1, \"more\": {\"deep\": true}},\n" +
+		"  \"quote\\\"d\": null\n}\n"
+	assert.Equal(t, bodyStats{bytes: int64(len(body)), lines: 6, jsonKeys: 4}, computeBodyStats([]byte(body)))
+
+	// not json object
+	assert.Equal(t, bodyStats{bytes: 11, lines: 2, jsonKeys: -1}, computeBodyStats([]byte("line1\nline2")))
+	assert.Equal(t, bodyStats{bytes: 7, lines: 1, jsonKeys: -1}, computeBodyStats([]byte(`["a":1]`)))
+	// invalid json, keys seen are counted
+	assert.Equal(t, bodyStats{bytes: 14, lines: 1, jsonKeys: 2}, computeBodyStats([]byte(`{"a": 1, "b": `)))
+	assert.Equal(t, bodyStats{jsonKeys: -1}, computeBodyStats(nil))
+}
+
+func TestBodyStats(t *testing.T) {
+	body := "{\n\"id\": 1,\n\"items\": [{\"id\": 2}]\n}"
+	handler, sink := newTestHTTPHandler(&Config{bodyStats: true})
+	runConversation(handler, []testSegment{
+		{up: true, payload: "POST /items HTTP/1.1\r\nHost: example.com\r\nContent-Type: text/plain\r\nContent-Length: 11\r\n\r\n" +
+			"one\ntwo\nabc"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: " +
+			strconv.Itoa(len(body)) + "\r\n\r\n" + body},
+		{up: true, payload: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+
+	assert.Equal(t, 2, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, &bodyStats{bytes: 11, lines: 3, jsonKeys: -1}, exchange.requestBodyStats)
+	assert.Equal(t, &bodyStats{bytes: int64(len(body)), lines: 4, jsonKeys: 2}, exchange.responseBodyStats)
+	assert.Equal(t, int32(2), exchange.toProto().ResponseBodyStats.JsonKeys)
+	assert.Equal(t, int64(len(body)), exchange.responseBodySize)
+	assert.Nil(t, sink.exchanges[1].requestBodyStats)
+	assert.Nil(t, sink.exchanges[1].responseBodyStats)
+
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[body-stats]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[body-stats] 10.0.0.1:50000 -> 10.0.0.2:80 POST example.com/items request bytes=11 lines=3 " +
+		"response bytes=" + strconv.Itoa(len(body)) + " lines=4 json-keys=2\n"}, reports)
+}
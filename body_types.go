@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/google/gopacket/tcpassembly/tcpreader"
+	"httpdump/httpport"
+)
+
+// BodyTypeFilter select bodies to capture by Content-Type. Bodies not selected are drained
+// without buffering, so body features like digest verification and upload extraction skip them
+type BodyTypeFilter struct {
+	allow []string // media type patterns like text/*, empty for all types
+	deny  []string
+}
+
+// parse comma separated media type patterns. return nil if both are empty
+func parseBodyTypeFilter(allow string, deny string) *BodyTypeFilter {
+	filter := &BodyTypeFilter{allow: parseMediaTypes(allow), deny: parseMediaTypes(deny)}
+	if len(filter.allow) == 0 && len(filter.deny) == 0 {
+		return nil
+	}
+	return filter
+}
+
+func parseMediaTypes(value string) []string {
+	var types []string
+	for _, mediaType := range strings.Split(value, ",") {
+		if mediaType = strings.ToLower(strings.TrimSpace(mediaType)); mediaType != "" {
+			types = append(types, mediaType)
+		}
+	}
+	return types
+}
+
+// if body with the Content-Type header value should be captured. deny patterns take precedence.
+// body without Content-Type is only captured if no allow pattern set
+func (filter *BodyTypeFilter) match(contentType string) bool {
+	if filter == nil {
+		return true
+	}
+	mediaType, _ := parseContentType(contentType)
+	mediaType = strings.ToLower(mediaType)
+	if matchMediaType(mediaType, filter.deny) {
+		return false
+	}
+	return len(filter.allow) == 0 || matchMediaType(mediaType, filter.allow)
+}
+
+func matchMediaType(mediaType string, patterns []string) bool {
+	if mediaType == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if wildcardMatch(mediaType, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// drain body if its content type is not captured, the body size is still counted by exchange.
+// return if the body is skipped
+func (h *HTTPTrafficHandler) skipBody(body io.Reader, header httpport.Header) bool {
+	if h.config.bodyTypes.match(header.Get("Content-Type")) {
+		return false
+	}
+	tcpreader.DiscardBytesToEOF(body)
+	return true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyTypeFilter(t *testing.T) {
+	assert.Nil(t, parseBodyTypeFilter(" ", ""))
+	var all *BodyTypeFilter
+	assert.True(t, all.match("image/png"))
+
+	filter := parseBodyTypeFilter("application/json, Text/*", "text/csv")
+	assert.True(t, filter.match("application/json; charset=utf-8"))
+	assert.True(t, filter.match("text/html"))
+	assert.False(t, filter.match("text/csv"))
+	assert.False(t, filter.match("image/png"))
+	assert.False(t, filter.match(""))
+
+	filter = parseBodyTypeFilter("", "image/*,video/*")
+	assert.True(t, filter.match(""))
+	assert.True(t, filter.match("application/octet-stream"))
+	assert.False(t, filter.match("IMAGE/PNG"))
+}
+
+func TestSkipBodyByType(t *testing.T) {
+	md5Sum := md5.Sum([]byte("other"))
+	contentMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+	handler, sink := newTestHTTPHandler(&Config{verifyDigest: true,
+		bodyTypes: parseBodyTypeFilter("application/json,text/*", "")})
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /a.json HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-MD5: " + contentMD5 +
+			"\r\nContent-Length: 2\r\n\r\n{}"},
+		{up: true, payload: "GET /a.png HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Type: image/png\r\nContent-MD5: " + contentMD5 +
+			"\r\nContent-Length: " + strconv.Itoa(len(png)) + "\r\n\r\n" + png},
+		{up: true, payload: "GET /b.json HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+
+	assert.Equal(t, 3, len(sink.exchanges))
+	// json body is captured and verified
+	assert.True(t, sink.exchanges[0].responseDigestMismatch)
+	// png body is drained without verify, the following exchange is still parsed
+	assert.False(t, sink.exchanges[1].responseDigestMismatch)
+	assert.Equal(t, int64(len(png)), sink.exchanges[1].responseBodySize)
+	assert.Equal(t, 204, sink.exchanges[2].status)
+
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[digest]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, 1, len(reports))
+}
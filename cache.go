@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"httpdump/httpport"
+)
+
+// cacheInfo is the cacheability of a response by a shared cache(CDN, proxy), derived from cache headers
+type cacheInfo struct {
+	cacheable bool
+	maxAge    int64  // freshness lifetime in seconds, 0 if stale when stored or not cacheable
+	heuristic bool   // maxAge is estimated from Last-Modified, without explicit expiration
+	validator bool   // response has ETag or Last-Modified, so can be revalidated when stale
+	reason    string // why not cacheable, empty if cacheable
+}
+
+// status codes cacheable by default, which may be stored with heuristic freshness (RFC 9110 15.1)
+var heuristicCacheableStatus = map[int]bool{200: true, 203: true, 204: true, 206: true, 300: true, 301: true,
+	308: true, 404: true, 405: true, 410: true, 414: true, 501: true}
+
+// parse comma separated Cache-Control directives of all header values, to lower cased names and unquoted values
+func parseCacheControl(values []string) map[string]string {
+	var directives = map[string]string{}
+	for _, value := range values {
+		for _, directive := range splitQuoted(value, ',') {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, v := directive, ""
+			if idx := strings.IndexByte(directive, '='); idx >= 0 {
+				name, v = directive[:idx], unquote(strings.TrimSpace(directive[idx+1:]))
+			}
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := directives[name]; !ok {
+				// first one wins for duplicated directives
+				directives[name] = v
+			}
+		}
+	}
+	return directives
+}
+
+// delta-seconds value of directive. invalid values are taken as 0, i.e. stale
+func deltaSeconds(value string) int64 {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return seconds
+}
+
+// derive cacheability of the response of exchange by a shared cache (RFC 9111). Date header is taken as the
+// response time for Expires and Last-Modified, or the response start if Date is missing
+func computeCacheInfo(exchange *Exchange) *cacheInfo {
+	request, response := exchange.requestHeader, exchange.responseHeader
+	info := &cacheInfo{validator: response.Get("ETag") != "" || response.Get("Last-Modified") != ""}
+	directives := parseCacheControl(response["Cache-Control"])
+	_, sMaxAge := directives["s-maxage"]
+	_, maxAge := directives["max-age"]
+	_, public := directives["public"]
+	expires := response.Get("Expires")
+
+	switch {
+	case exchange.method != "GET" && exchange.method != "HEAD":
+		info.reason = "method"
+	case exchange.status < 200:
+		info.reason = "status"
+	case hasDirective(directives, "no-store") || hasDirective(parseCacheControl(request["Cache-Control"]), "no-store"):
+		info.reason = "no-store"
+	case hasUnqualified(directives, "private"):
+		// private with field names only forbids storing those fields
+		info.reason = "private"
+	case request.Get("Authorization") != "" && !public && !sMaxAge && !hasDirective(directives, "must-revalidate"):
+		info.reason = "authorization"
+	case !sMaxAge && !maxAge && expires == "" && !public && !heuristicCacheableStatus[exchange.status]:
+		info.reason = "status"
+	}
+	if info.reason != "" {
+		return info
+	}
+
+	date := exchange.responseStart
+	if t, err := httpport.ParseTime(response.Get("Date")); err == nil {
+		date = t
+	}
+	switch {
+	case sMaxAge:
+		// s-maxage overrides max-age and Expires for shared caches
+		info.maxAge = deltaSeconds(directives["s-maxage"])
+	case maxAge:
+		info.maxAge = deltaSeconds(directives["max-age"])
+	case expires != "":
+		// invalid Expires like "0" means already expired
+		if t, err := httpport.ParseTime(expires); err == nil && t.After(date) {
+			info.maxAge = int64(t.Sub(date) / time.Second)
+		}
+	default:
+		// a tenth of the time since last modified, as common caches do
+		if t, err := httpport.ParseTime(response.Get("Last-Modified")); err == nil && t.Before(date) {
+			info.maxAge = int64(date.Sub(t) / time.Second / 10)
+			info.heuristic = true
+		}
+	}
+	if hasUnqualified(directives, "no-cache") {
+		// may be stored, but must be revalidated before each reuse
+		info.maxAge = 0
+		info.heuristic = false
+	}
+	if info.maxAge == 0 && !info.validator {
+		// stale once stored and cannot be revalidated, no use to store
+		info.reason = "no-freshness"
+		return info
+	}
+	info.cacheable = true
+	return info
+}
+
+func hasDirective(directives map[string]string, name string) bool {
+	_, ok := directives[name]
+	return ok
+}
+
+// if directive is present without field names, e.g. private but not private="Set-Cookie"
+func hasUnqualified(directives map[string]string, name string) bool {
+	value, ok := directives[name]
+	return ok && value == ""
+}
+
+// compute cacheability of exchange with response, and send a cache record to printer
+func (h *HTTPTrafficHandler) reportCache(exchange *Exchange) {
+	if exchange.status == 0 {
+		return
+	}
+	info := computeCacheInfo(exchange)
+	exchange.cache = info
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":      "cache",
+			"src":       exchange.key.srcString(),
+			"dst":       exchange.key.dstString(),
+			"method":    exchange.method,
+			"url":       exchange.host + exchange.url,
+			"status":    exchange.status,
+			"cacheable": info.cacheable,
+			"maxAge":    info.maxAge,
+			"heuristic": info.heuristic,
+			"validator": info.validator,
+			"reason":    info.reason,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	var fields = []string{"[cache]", exchange.key.srcString(), "->", exchange.key.dstString(), exchange.method,
+		exchange.host + exchange.url, strconv.Itoa(exchange.status)}
+	if info.cacheable {
+		fields = append(fields, "cacheable", "max-age="+strconv.FormatInt(info.maxAge, 10))
+		if info.heuristic {
+			fields = append(fields, "heuristic")
+		}
+	} else {
+		fields = append(fields, "not-cacheable", "reason="+info.reason)
+	}
+	if info.validator {
+		fields = append(fields, "validator")
+	}
+	h.printer.send(strings.Join(fields, " ") + "\n")
+}
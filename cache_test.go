@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"httpdump/httpport"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheInfo(t *testing.T) {
+	sink, printer := runHTTPConversation(&Config{cacheInfo: true}, []testSegment{
+		{up: true, payload: "GET /logo.png HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nCache-Control: public, max-age=600\r\nETag: \"v1\"\r\n" +
+			"Content-Length: 0\r\n\r\n"},
+		{up: true, payload: "GET /account HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nCache-Control: no-store\r\nContent-Length: 0\r\n\r\n"},
+	})
+
+	if assert.Equal(t, 2, len(sink.exchanges)) {
+		assert.Equal(t, &cacheInfo{cacheable: true, maxAge: 600, validator: true}, sink.exchanges[0].cache)
+		assert.Equal(t, &cacheInfo{reason: "no-store"}, sink.exchanges[1].cache)
+		record := sink.exchanges[0].toProto()
+		assert.True(t, record.Cache.Cacheable)
+		assert.Equal(t, int64(600), record.Cache.MaxAge)
+		assert.Equal(t, "no-store", sink.exchanges[1].toProto().Cache.Reason)
+	}
+	var lines []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[cache]") {
+			lines = append(lines, msg)
+		}
+	}
+	assert.Equal(t, []string{
+		"[cache] 10.0.0.1:50000 -> 10.0.0.2:80 GET example.com/logo.png 200 cacheable max-age=600 validator\n",
+		"[cache] 10.0.0.1:50000 -> 10.0.0.2:80 GET example.com/account 200 not-cacheable reason=no-store\n",
+	}, lines)
+
+	// not set if not enabled
+	sink, _ = runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Nil(t, sink.exchanges[0].cache)
+		assert.Nil(t, sink.exchanges[0].toProto().Cache)
+	}
+}
+
+func TestComputeCacheInfo(t *testing.T) {
+	var date = "Mon, 01 Jan 2018 00:00:00 GMT"
+	var cases = []struct {
+		method   string
+		status   int
+		request  httpport.Header
+		response httpport.Header
+		expected cacheInfo
+	}{
+		// s-maxage overrides max-age for shared caches
+		{"GET", 200, nil, httpport.Header{"Cache-Control": {"max-age=60", "s-maxage=3600"}},
+			cacheInfo{cacheable: true, maxAge: 3600}},
+		{"GET", 200, nil, httpport.Header{"Cache-Control": {"private, max-age=60"}}, cacheInfo{reason: "private"}},
+		// only the named fields are private
+		{"GET", 200, nil, httpport.Header{"Cache-Control": {`private="Set-Cookie", max-age=60`}},
+			cacheInfo{cacheable: true, maxAge: 60}},
+		{"GET", 200, httpport.Header{"Cache-Control": {"no-store"}}, httpport.Header{"Cache-Control": {"max-age=60"}},
+			cacheInfo{reason: "no-store"}},
+		{"GET", 200, nil, httpport.Header{"Date": {date}, "Expires": {"Mon, 01 Jan 2018 01:00:00 GMT"}},
+			cacheInfo{cacheable: true, maxAge: 3600}},
+		{"GET", 200, nil, httpport.Header{"Date": {date}, "Expires": {"0"}}, cacheInfo{reason: "no-freshness"}},
+		{"GET", 200, nil, httpport.Header{"Date": {date}, "Last-Modified": {"Fri, 22 Dec 2017 00:00:00 GMT"}},
+			cacheInfo{cacheable: true, maxAge: 86400, heuristic: true, validator: true}},
+		// stored, but revalidated before reuse
+		{"GET", 200, nil, httpport.Header{"Cache-Control": {"no-cache, max-age=60"}, "Etag": {`"v1"`}},
+			cacheInfo{cacheable: true, validator: true}},
+		{"GET", 200, httpport.Header{"Authorization": {"Bearer x"}}, httpport.Header{"Cache-Control": {"max-age=60"}},
+			cacheInfo{reason: "authorization"}},
+		{"GET", 200, httpport.Header{"Authorization": {"Bearer x"}}, httpport.Header{"Cache-Control": {"s-maxage=60"}},
+			cacheInfo{cacheable: true, maxAge: 60}},
+		{"GET", 302, nil, httpport.Header{"Etag": {`"v1"`}}, cacheInfo{reason: "status", validator: true}},
+		{"GET", 302, nil, httpport.Header{"Cache-Control": {"max-age=60"}}, cacheInfo{cacheable: true, maxAge: 60}},
+		{"POST", 200, nil, httpport.Header{"Cache-Control": {"max-age=60"}}, cacheInfo{reason: "method"}},
+	}
+	for _, c := range cases {
+		exchange := &Exchange{method: c.method, status: c.status, requestHeader: c.request, responseHeader: c.response,
+			responseStart: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+		assert.Equal(t, &c.expected, computeCacheInfo(exchange), "%v", c.response)
+	}
+}
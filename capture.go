@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/ip4defrag"
+	"github.com/google/gopacket/layers"
+)
+
+// tcpSegment is a captured tcp packet to assemble, or a dns message of udp/tcp port 53 packet.
+// A tcp packet of dns keeps its tcp layer, so it is assembled as other tcp traffic when dns is not resolved
+type tcpSegment struct {
+	flow      gopacket.Flow
+	tcp       *layers.TCP
+	timestamp time.Time
+	dns       []byte // dns message if the packet is dns traffic, tcp is nil then for udp
+	number    int    // 1-based number of the packet in capture, of the last fragment for reassembled ip packets
+	ip        *ipFields
+}
+
+const dnsPort = 53
+
+// dns message in udp or tcp payload, nil if ports are not dns or tcp payload is not one whole message.
+// the message is copied, not aliased to packet data
+func dnsMessage(srcPort uint16, dstPort uint16, payload []byte, isTCP bool) []byte {
+	if srcPort != dnsPort && dstPort != dnsPort || len(payload) == 0 {
+		return nil
+	}
+	if isTCP {
+		// dns over tcp is prefixed by 2 bytes message length
+		if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != len(payload)-2 {
+			return nil
+		}
+		payload = payload[2:]
+	}
+	return append([]byte(nil), payload...)
+}
+
+// pick tcp/ip packets from packet channel
+func packetSegments(packets chan gopacket.Packet) chan *tcpSegment {
+	var segments = make(chan *tcpSegment, 1024)
+	go func() {
+		defer close(segments)
+		defragmenter := newIPDefragmenter()
+		number := 0
+		send := func(segment *tcpSegment) {
+			segment.number = number
+			segments <- segment
+		}
+		for packet := range packets {
+			if packet == nil {
+				return
+			}
+			number++
+			// the tcp layer is not decoded from a fragment, decode it when all fragments are received
+			if ip, ok := packet.NetworkLayer().(*layers.IPv4); ok && isIPv4Fragment(ip) {
+				if segment := defragmenter.defrag(ip, packet.Metadata().Timestamp); segment != nil {
+					send(segment)
+				}
+				continue
+			}
+			if packet.NetworkLayer() == nil || packet.TransportLayer() == nil {
+				continue
+			}
+			flow := packet.NetworkLayer().NetworkFlow()
+			timestamp := packet.Metadata().Timestamp
+			switch transport := packet.TransportLayer().(type) {
+			case *layers.UDP:
+				if message := dnsMessage(uint16(transport.SrcPort), uint16(transport.DstPort), transport.Payload,
+					false); message != nil {
+					send(&tcpSegment{flow: flow, timestamp: timestamp, dns: message})
+				}
+			case *layers.TCP:
+				var ip *ipFields
+				switch network := packet.NetworkLayer().(type) {
+				case *layers.IPv4:
+					ip = ipv4Fields(network)
+				case *layers.IPv6:
+					ip = ipv6Fields(network)
+				}
+				send(&tcpSegment{flow: flow, tcp: transport, timestamp: timestamp, ip: ip,
+					dns: dnsMessage(uint16(transport.SrcPort), uint16(transport.DstPort), transport.Payload, true)})
+			}
+		}
+	}()
+	return segments
+}
+
+// read tcp segments from a pcap stream, e.g. output of `tcpdump -w -` piped to stdin.
+// packets are read as they arrive, and the segment channel is closed when stream ends
+func pcapStreamSegments(stream io.Reader, zeroCopy bool) (chan *tcpSegment, error) {
+	reader, err := newPcapStreamReader(stream)
+	if err != nil {
+		return nil, err
+	}
+	if zeroCopy {
+		return zeroCopySegments(reader, reader.LinkType()), nil
+	}
+	packetSource := gopacket.NewPacketSource(reader, reader.LinkType())
+	return packetSegments(packetSource.Packets()), nil
+}
+
+// fragments not completed in this duration are discarded
+var fragmentTimeout = 30 * time.Second
+
+// ipDefragmenter reassemble fragmented ipv4 packets, and decode the tcp layer of reassembled packets
+type ipDefragmenter struct {
+	defragmenter *ip4defrag.IPv4Defragmenter
+	lastDiscard  time.Time
+}
+
+func newIPDefragmenter() *ipDefragmenter {
+	return &ipDefragmenter{defragmenter: ip4defrag.NewIPv4Defragmenter()}
+}
+
+// if the ip packet is a fragment of a larger one
+func isIPv4Fragment(ip *layers.IPv4) bool {
+	return ip.Flags&layers.IPv4MoreFragments != 0 || ip.FragOffset != 0
+}
+
+// add a fragment, return the tcp segment if all fragments of the packet are received, else return nil.
+// fragments are held until reassembled, so they should not refer to reused packet data
+func (d *ipDefragmenter) defrag(ip *layers.IPv4, timestamp time.Time) *tcpSegment {
+	if timestamp.Sub(d.lastDiscard) >= fragmentTimeout {
+		d.defragmenter.DiscardOlderThan(timestamp.Add(-fragmentTimeout))
+		d.lastDiscard = timestamp
+	}
+	packet, err := d.defragmenter.DefragIPv4WithTimestamp(ip, timestamp)
+	if err != nil {
+		logger.Debug("reassemble ip fragments error:", err)
+		return nil
+	}
+	if packet == nil || packet.Protocol != layers.IPProtocolTCP {
+		return nil
+	}
+	var tcp = &layers.TCP{}
+	if err := tcp.DecodeFromBytes(packet.Payload, gopacket.NilDecodeFeedback); err != nil {
+		logger.Debug("decode reassembled tcp packet error:", err)
+		return nil
+	}
+	return &tcpSegment{flow: packet.NetworkFlow(), tcp: tcp, timestamp: timestamp, ip: ipv4Fields(packet)}
+}
+
+// zeroCopyDecoder decode packets into reused layers, without copying packet data.
+// only tcp and udp over ipv4/ipv6 is decoded, with or without vlan tags
+type zeroCopyDecoder struct {
+	parser   *gopacket.DecodingLayerParser
+	ethernet layers.Ethernet
+	dot1q    layers.Dot1Q // reused for each tag of stacked vlan tags
+	linuxSLL layers.LinuxSLL
+	loopback layers.Loopback
+	ipv4     layers.IPv4
+	ipv6     layers.IPv6
+	tcp      layers.TCP
+	udp      layers.UDP
+	payload  gopacket.Payload
+	decoded  []gopacket.LayerType
+
+	defragmenter *ipDefragmenter
+}
+
+func newZeroCopyDecoder(linkType layers.LinkType) *zeroCopyDecoder {
+	decoder := &zeroCopyDecoder{defragmenter: newIPDefragmenter()}
+	decoder.parser = gopacket.NewDecodingLayerParser(linkLayerType(linkType), &decoder.ethernet, &decoder.dot1q,
+		&decoder.linuxSLL, &decoder.loopback, &decoder.ipv4, &decoder.ipv6, &decoder.tcp, &decoder.udp, &decoder.payload)
+	decoder.parser.IgnoreUnsupported = true
+	return decoder
+}
+
+// first layer type of packets with the link type
+func linkLayerType(linkType layers.LinkType) gopacket.LayerType {
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		return layers.LayerTypeEthernet
+	case layers.LinkTypeLinuxSLL:
+		return layers.LayerTypeLinuxSLL
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		return layers.LayerTypeLoopback
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4:
+		return layers.LayerTypeIPv4
+	case layers.LinkTypeIPv6:
+		return layers.LayerTypeIPv6
+	}
+	return linkType.LayerType()
+}
+
+// decode packet data, return nil if it is not a tcp/ip or dns packet.
+// data may be reused after decode, so the returned tcp layer do not refer to it
+func (decoder *zeroCopyDecoder) decode(data []byte, timestamp time.Time) *tcpSegment {
+	if err := decoder.parser.DecodeLayers(data, &decoder.decoded); err != nil {
+		return nil
+	}
+	var flow gopacket.Flow
+	var ip *ipFields
+	var isTCP, isUDP bool
+	for _, layerType := range decoder.decoded {
+		switch layerType {
+		case layers.LayerTypeIPv4:
+			if isIPv4Fragment(&decoder.ipv4) {
+				return decoder.defragmenter.defrag(copyIPv4(&decoder.ipv4), timestamp)
+			}
+			flow = decoder.ipv4.NetworkFlow()
+			ip = ipv4Fields(&decoder.ipv4)
+		case layers.LayerTypeIPv6:
+			flow = decoder.ipv6.NetworkFlow()
+			ip = ipv6Fields(&decoder.ipv6)
+		case layers.LayerTypeTCP:
+			isTCP = true
+		case layers.LayerTypeUDP:
+			isUDP = true
+		}
+	}
+	if flow == (gopacket.Flow{}) {
+		return nil
+	}
+	if isUDP {
+		message := dnsMessage(uint16(decoder.udp.SrcPort), uint16(decoder.udp.DstPort), decoder.udp.Payload, false)
+		if message == nil {
+			return nil
+		}
+		return &tcpSegment{flow: flow, timestamp: timestamp, dns: message}
+	}
+	if !isTCP {
+		return nil
+	}
+	return &tcpSegment{flow: flow, tcp: copyTCP(&decoder.tcp), timestamp: timestamp, ip: ip,
+		dns: dnsMessage(uint16(decoder.tcp.SrcPort), uint16(decoder.tcp.DstPort), decoder.tcp.Payload, true)}
+}
+
+// copy tcp layer, with payload and options not aliased to packet data
+func copyTCP(tcp *layers.TCP) *layers.TCP {
+	var copied = *tcp
+	copied.Contents = nil
+	copied.Payload = append([]byte(nil), tcp.Payload...)
+	copied.Options = make([]layers.TCPOption, len(tcp.Options))
+	for i, option := range tcp.Options {
+		option.OptionData = append([]byte(nil), option.OptionData...)
+		copied.Options[i] = option
+	}
+	copied.Padding = nil
+	return &copied
+}
+
+// copy ipv4 layer, with addresses and payload not aliased to packet data
+func copyIPv4(ip *layers.IPv4) *layers.IPv4 {
+	var copied = *ip
+	copied.Contents = nil
+	copied.Payload = append([]byte(nil), ip.Payload...)
+	copied.SrcIP = append(net.IP(nil), ip.SrcIP...)
+	copied.DstIP = append(net.IP(nil), ip.DstIP...)
+	copied.Options = make([]layers.IPv4Option, len(ip.Options))
+	for i, option := range ip.Options {
+		option.OptionData = append([]byte(nil), option.OptionData...)
+		copied.Options[i] = option
+	}
+	copied.Padding = nil
+	return &copied
+}
+
+// read tcp segments from source by zero copy read, and decode with reused layers
+func zeroCopySegments(source gopacket.ZeroCopyPacketDataSource, linkType layers.LinkType) chan *tcpSegment {
+	var segments = make(chan *tcpSegment, 1024)
+	go func() {
+		defer close(segments)
+		decoder := newZeroCopyDecoder(linkType)
+		number := 0
+		for {
+			data, ci, err := source.ZeroCopyReadPacketData()
+			if err == io.EOF || err == io.ErrUnexpectedEOF || err == io.ErrClosedPipe {
+				return
+			}
+			if err != nil {
+				// may be temporary error like read timeout, retry later
+				logger.Debug("read packet error:", err)
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			number++
+			if segment := decoder.decode(data, ci.Timestamp); segment != nil {
+				segment.number = number
+				segments <- segment
+			}
+		}
+	}()
+	return segments
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// serialize a ethernet/ipv4/tcp packet
+func tcpPacketData(t testing.TB, seq uint32, payload string) []byte {
+	return tcpPacketDataOf(t, 50000, true, seq, 5000, payload)
+}
+
+// serialize a tcp packet between 10.0.0.1:clientPort and 10.0.0.2:80, up for client to server
+func tcpPacketDataOf(t testing.TB, clientPort layers.TCPPort, up bool, seq uint32, ack uint32, payload string) []byte {
+	ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1},
+		DstIP: net.IP{10, 0, 0, 2}}
+	tcp := &layers.TCP{SrcPort: clientPort, DstPort: 80, Seq: seq, Ack: ack, ACK: true, Window: 1024,
+		Options: []layers.TCPOption{{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{5, 0xb4}}}}
+	if !up {
+		ethernet.SrcMAC, ethernet.DstMAC = ethernet.DstMAC, ethernet.SrcMAC
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		tcp.SrcPort, tcp.DstPort = tcp.DstPort, tcp.SrcPort
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ethernet, ip, tcp, gopacket.Payload(payload))
+	assert.Nil(t, err)
+	return buffer.Bytes()
+}
+
+// zero copy source return packets in one reused buffer
+type reusedBufferSource struct {
+	packets [][]byte
+	buffer  []byte
+}
+
+func (source *reusedBufferSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if len(source.packets) == 0 {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	data := source.buffer[:copy(source.buffer, source.packets[0])]
+	source.packets = source.packets[1:]
+	return data, gopacket.CaptureInfo{Timestamp: time.Unix(1514764800, 0)}, nil
+}
+
+func TestZeroCopySegments(t *testing.T) {
+	source := &reusedBufferSource{buffer: make([]byte, 65536), packets: [][]byte{
+		tcpPacketData(t, 1100, "second"),
+		tcpPacketData(t, 1000, "first "),
+		tcpPacketData(t, 1200, "overwrite buffer"),
+	}}
+	window := newReceiveWindow(4)
+	var count int
+	for segment := range zeroCopySegments(source, layers.LinkTypeEthernet) {
+		assert.Equal(t, "10.0.0.1", segment.flow.Src().String())
+		assert.Equal(t, "10.0.0.2", segment.flow.Dst().String())
+		assert.Equal(t, time.Unix(1514764800, 0), segment.timestamp)
+		window.insert(&TCPPacket{TCP: segment.tcp, timestamp: segment.timestamp})
+		count++
+	}
+	assert.Equal(t, 3, count)
+
+	// packets buffered in window keep their own payload and options, after the buffer is reused
+	var payloads []string
+	for i := 0; i < window.size; i++ {
+		packet := window.buffer[(window.start+i)%len(window.buffer)]
+		payloads = append(payloads, string(packet.Payload))
+		assert.Equal(t, &TCPOptions{MSS: 1460, WindowScale: -1}, parseTCPOptions(packet.TCP))
+	}
+	assert.Equal(t, []string{"first ", "second", "overwrite buffer"}, payloads)
+}
+
+func TestZeroCopyDecodeNonTCP(t *testing.T) {
+	ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1},
+		DstIP: net.IP{10, 0, 0, 2}}
+	udp := &layers.UDP{SrcPort: 5353, DstPort: 53}
+	buffer := gopacket.NewSerializeBuffer()
+	assert.Nil(t, gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true}, ethernet, ip, udp))
+	decoder := newZeroCopyDecoder(layers.LinkTypeEthernet)
+	assert.Nil(t, decoder.decode(buffer.Bytes(), time.Now()))
+	assert.Nil(t, decoder.decode([]byte{1, 2, 3}, time.Now()))
+}
+
+func TestZeroCopyDecodeVLAN(t *testing.T) {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1},
+		DstIP: net.IP{10, 0, 0, 2}}
+	tcp := &layers.TCP{SrcPort: 1234, DstPort: 80, Seq: 1000, ACK: true}
+	tcp.SetNetworkLayerForChecksum(ip)
+	for _, tags := range [][]uint16{{100}, {100, 200}} {
+		ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeDot1Q}
+		serialized := []gopacket.SerializableLayer{ethernet}
+		for i, tag := range tags {
+			dot1q := &layers.Dot1Q{VLANIdentifier: tag, Type: layers.EthernetTypeDot1Q}
+			if i == len(tags)-1 {
+				dot1q.Type = layers.EthernetTypeIPv4
+			}
+			serialized = append(serialized, dot1q)
+		}
+		serialized = append(serialized, ip, tcp, gopacket.Payload("GET / HTTP/1.1\r\n\r\n"))
+		buffer := gopacket.NewSerializeBuffer()
+		assert.Nil(t, gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true,
+			ComputeChecksums: true}, serialized...))
+
+		segment := newZeroCopyDecoder(layers.LinkTypeEthernet).decode(buffer.Bytes(), time.Now())
+		if assert.NotNil(t, segment, "tags %v", tags) {
+			assert.Equal(t, "10.0.0.1", segment.flow.Src().String())
+			assert.Equal(t, uint32(1000), segment.tcp.Seq)
+			assert.Equal(t, "GET / HTTP/1.1\r\n\r\n", string(segment.tcp.Payload))
+		}
+	}
+}
+
+func BenchmarkDecodePacket(b *testing.B) {
+	data := tcpPacketData(b, 1000, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+		_ = packet.NetworkLayer().NetworkFlow()
+		_ = packet.TransportLayer().(*layers.TCP)
+	}
+}
+
+func BenchmarkDecodeZeroCopy(b *testing.B) {
+	data := tcpPacketData(b, 1000, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	decoder := newZeroCopyDecoder(layers.LinkTypeEthernet)
+	timestamp := time.Now()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decoder.decode(data, timestamp)
+	}
+}
+
+// split a ethernet/ipv4/tcp packet to ip fragments, each carries at most size bytes of ip payload
+func fragmentPacketData(t testing.TB, data []byte, size int) [][]byte {
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	ethernet := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	ip := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	payload := append(ip.LayerPayload()[:0:0], ip.LayerPayload()...)
+	var fragments [][]byte
+	for offset := 0; offset < len(payload); offset += size {
+		end := offset + size
+		fragment := *ip
+		fragment.Id = 7
+		fragment.FragOffset = uint16(offset / 8)
+		fragment.Flags = layers.IPv4MoreFragments
+		if end >= len(payload) {
+			end = len(payload)
+			fragment.Flags = 0
+		}
+		buffer := gopacket.NewSerializeBuffer()
+		err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+			ethernet, &fragment, gopacket.Payload(payload[offset:end]))
+		assert.Nil(t, err)
+		fragments = append(fragments, buffer.Bytes())
+	}
+	return fragments
+}
+
+func TestIPFragments(t *testing.T) {
+	request := "GET /fragmented HTTP/1.1\r\nHost: example.com\r\nUser-Agent: " + strings.Repeat("a", 100) + "\r\n\r\n"
+	fragments := fragmentPacketData(t, tcpPacketData(t, 1000, request), 64)
+	assert.Equal(t, 3, len(fragments))
+
+	packets := make(chan gopacket.Packet, len(fragments))
+	for _, data := range fragments {
+		packets <- gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	}
+	close(packets)
+	var segments []*tcpSegment
+	for segment := range packetSegments(packets) {
+		segments = append(segments, segment)
+	}
+
+	source := &reusedBufferSource{buffer: make([]byte, 65536), packets: fragments}
+	for segment := range zeroCopySegments(source, layers.LinkTypeEthernet) {
+		segments = append(segments, segment)
+	}
+
+	assert.Equal(t, 2, len(segments))
+	for _, segment := range segments {
+		assert.Equal(t, "10.0.0.1", segment.flow.Src().String())
+		assert.Equal(t, uint32(1000), segment.tcp.Seq)
+		assert.Equal(t, request, string(segment.tcp.Payload))
+
+		assembler, handler := newTestAssembler()
+		assembler.assemble(segment.flow, segment.tcp, segment.timestamp)
+		assert.Equal(t, 1, len(handler.connections))
+	}
+}
+
+// write pcap stream of tcp packets, in little endian with microsecond timestamps
+func writePcapStream(t testing.TB, w io.Writer, packets [][]byte) {
+	timestamps := make([]time.Time, len(packets))
+	for i := range timestamps {
+		timestamps[i] = time.Unix(1514764800, 500000)
+	}
+	writePcapStreamAt(t, w, packets, timestamps)
+}
+
+// write pcap stream of tcp packets captured at timestamps
+func writePcapStreamAt(t testing.TB, w io.Writer, packets [][]byte, timestamps []time.Time) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], pcapMagicMicros)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65536)
+	binary.LittleEndian.PutUint32(header[20:], uint32(layers.LinkTypeEthernet))
+	w.Write(header)
+	for i, data := range packets {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], uint32(timestamps[i].Unix()))
+		binary.LittleEndian.PutUint32(record[4:], uint32(timestamps[i].Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(data)))
+		w.Write(record)
+		w.Write(data)
+	}
+}
+
+func TestPcapStreamSegments(t *testing.T) {
+	for _, zeroCopy := range []bool{false, true} {
+		reader, writer := io.Pipe()
+		go func() {
+			writePcapStream(t, writer, [][]byte{
+				tcpPacketData(t, 1000, "GET / HTTP/1.1\r\n"),
+				tcpPacketData(t, 1016, "Host: example.com\r\n\r\n"),
+			})
+			writer.Close()
+		}()
+
+		segments, err := pcapStreamSegments(reader, zeroCopy)
+		assert.Nil(t, err)
+		assembler, handler := newTestAssembler()
+		var payloads []string
+		for segment := range segments {
+			assert.Equal(t, time.Unix(1514764800, 500000), segment.timestamp)
+			assembler.assemble(segment.flow, segment.tcp, segment.timestamp)
+			payloads = append(payloads, string(segment.tcp.Payload))
+		}
+		assert.Equal(t, []string{"GET / HTTP/1.1\r\n", "Host: example.com\r\n\r\n"}, payloads)
+		assert.Equal(t, 1, len(handler.connections))
+	}
+
+	_, err := pcapStreamSegments(strings.NewReader("not a pcap stream, unknown magic"), false)
+	assert.NotNil(t, err)
+}
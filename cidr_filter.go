@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CIDRFilter match packets by src and dst ip against include and exclude ip ranges
+type CIDRFilter struct {
+	include []*net.IPNet // packet is processed only if src or dst ip is in one of them. empty for all
+	exclude []*net.IPNet // packet is dropped if src or dst ip is in one of them
+}
+
+// parse comma separated include and exclude cidr lists, like 10.0.0.0/8,fd00::/8. A bare ip is a single host
+// range. nil if both are empty
+func parseCIDRFilter(include string, exclude string) (*CIDRFilter, error) {
+	var filter = &CIDRFilter{}
+	var err error
+	if filter.include, err = parseCIDRList(include); err != nil {
+		return nil, err
+	}
+	if filter.exclude, err = parseCIDRList(exclude); err != nil {
+		return nil, err
+	}
+	if len(filter.include) == 0 && len(filter.exclude) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+func parseCIDRList(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(value, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid cidr: %s", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr: %s", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// if packet between the ips should be processed. nil filter match all packets
+func (filter *CIDRFilter) match(src net.IP, dst net.IP) bool {
+	if filter == nil {
+		return true
+	}
+	if containsIP(filter.exclude, src) || containsIP(filter.exclude, dst) {
+		return false
+	}
+	return len(filter.include) == 0 || containsIP(filter.include, src) || containsIP(filter.include, dst)
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
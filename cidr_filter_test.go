@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCIDRFilter(t *testing.T) {
+	filter, err := parseCIDRFilter("10.0.0.0/8, fd00::/8", "10.1.0.0/16,192.168.1.1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(filter.include))
+	assert.Equal(t, "192.168.1.1/32", filter.exclude[1].String())
+
+	filter, err = parseCIDRFilter("", " ")
+	assert.Nil(t, err)
+	assert.Nil(t, filter)
+	_, err = parseCIDRFilter("10.0.0.0/33", "")
+	assert.NotNil(t, err)
+	_, err = parseCIDRFilter("", "example.com")
+	assert.NotNil(t, err)
+}
+
+func TestCIDRFilterMatch(t *testing.T) {
+	filter, _ := parseCIDRFilter("10.0.0.0/8,fd00::/8", "10.1.0.0/16")
+	assert.True(t, filter.match(net.ParseIP("10.0.0.1"), net.ParseIP("8.8.8.8")))
+	assert.True(t, filter.match(net.ParseIP("8.8.8.8"), net.ParseIP("fd00::1")))
+	assert.False(t, filter.match(net.ParseIP("8.8.8.8"), net.ParseIP("1.1.1.1")))
+	// excluded even if included
+	assert.False(t, filter.match(net.ParseIP("10.0.0.1"), net.ParseIP("10.1.2.3")))
+
+	filter, _ = parseCIDRFilter("", "10.1.0.0/16")
+	assert.True(t, filter.match(net.ParseIP("8.8.8.8"), net.ParseIP("1.1.1.1")))
+	// raw 4 bytes ip of packet layers
+	assert.False(t, filter.match(net.IP{10, 1, 0, 5}, net.IP{1, 1, 1, 1}))
+	var none *CIDRFilter
+	assert.True(t, none.match(net.ParseIP("10.1.0.1"), net.ParseIP("10.1.0.2")))
+}
+
+func TestAssembleCIDRFilter(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	assembler.cidrFilter, _ = parseCIDRFilter("", "10.0.0.0/24")
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+	// inside excluded range
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	assert.Equal(t, 0, len(handler.connections))
+
+	// outside
+	assembler.assemble(ipv4Flow("192.168.1.5", "10.1.0.2"), clientPacket(1000, 5000, request), timestamp)
+	if assert.Equal(t, 1, len(handler.connections)) {
+		assert.Equal(t, "192.168.1.5:50000", handler.connections[0].clientID.String())
+	}
+}
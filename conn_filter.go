@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// default max exchanges held per connection by connection filter
+const defaultMaxHeld = 1000
+
+// ConnectionFilter match connections by how they ended, which is known only when connection ends.
+// Exchanges of a connection are held until then, and output only if the connection matches
+type ConnectionFilter struct {
+	reasons   map[string]bool // close reasons, any of them matches. empty for any reason
+	handshake int             // 1 for handshake completed, -1 for handshake not completed, 0 for either
+	maxHeld   int             // max exchanges held per connection, the oldest are evicted beyond it. 0 for unlimited
+}
+
+var closeReasons = map[string]bool{closeByFIN: true, closeByRST: true, closeByIdle: true, closeByLifetime: true,
+	closeByCaptureEnd: true}
+
+// parse comma separated conditions, close reasons and handshake | no-handshake, e.g. rst,handshake
+func parseConnectionFilter(value string) (*ConnectionFilter, error) {
+	filter := &ConnectionFilter{reasons: map[string]bool{}, maxHeld: defaultMaxHeld}
+	for _, term := range strings.Split(value, ",") {
+		term = strings.TrimSpace(term)
+		switch {
+		case term == "":
+		case closeReasons[term]:
+			filter.reasons[term] = true
+		case term == "handshake":
+			filter.handshake = 1
+		case term == "no-handshake":
+			filter.handshake = -1
+		default:
+			return nil, fmt.Errorf("invalid connection condition: %s", term)
+		}
+	}
+	return filter, nil
+}
+
+// if the ended connection matches all conditions
+func (filter *ConnectionFilter) match(info ConnectionInfo) bool {
+	if len(filter.reasons) > 0 && !filter.reasons[info.CloseReason] {
+		return false
+	}
+	if filter.handshake > 0 && !info.Handshake || filter.handshake < 0 && info.Handshake {
+		return false
+	}
+	return true
+}
+
+// hold exchange until connection ends, evict the oldest held one if exceeds max held
+func (h *HTTPTrafficHandler) holdExchange(exchange *Exchange, text string) {
+	if h.connectionFilter.maxHeld > 0 && len(h.held) >= h.connectionFilter.maxHeld {
+		h.held[0] = ringEntry{}
+		h.held = h.held[1:]
+		h.evicted++
+	}
+	h.held = append(h.held, ringEntry{exchange: exchange, text: text})
+}
+
+// output held exchanges if the ended connection matches, or discard them
+func (h *HTTPTrafficHandler) releaseHeld() {
+	if h.connectionFilter == nil {
+		return
+	}
+	held := h.held
+	h.held = nil
+	if !h.connectionFilter.match(h.connection.snapshot()) {
+		return
+	}
+	h.reportEvicted()
+	for _, entry := range held {
+		h.outputExchange(entry.exchange, entry.text)
+	}
+}
+
+// emit a record of exchanges evicted before the connection ends, which are not output
+func (h *HTTPTrafficHandler) reportEvicted() {
+	if h.evicted == 0 {
+		return
+	}
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":    "evicted",
+			"src":     h.key.srcString(),
+			"dst":     h.key.dstString(),
+			"evicted": h.evicted,
+			"max":     h.connectionFilter.maxHeld,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	h.printer.send(fmt.Sprintln("[evicted]", h.key.srcString(), "->", h.key.dstString(), h.evicted,
+		"exchanges evicted, beyond", h.connectionFilter.maxHeld, "exchanges held per connection"))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// feed one exchange on connection from client port, then close it by FIN or RST
+func runClosedConnection(assembler *TCPAssembler, port layers.TCPPort, handshake bool, reset bool) {
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	packet := func(up bool, seq uint32, ack uint32, payload string) *layers.TCP {
+		tcp := clientPacket(seq, ack, payload)
+		if !up {
+			tcp = serverPacket(seq, ack, payload)
+			tcp.DstPort = port
+		} else {
+			tcp.SrcPort = port
+		}
+		return tcp
+	}
+	send := func(tcp *layers.TCP) {
+		flow := testClientFlow
+		if tcp.SrcPort == 80 {
+			flow = testServerFlow
+		}
+		assembler.assemble(flow, tcp, timestamp)
+	}
+	request := "GET /" + port.String() + " HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	clientSeq, serverSeq := uint32(1000), uint32(5000)
+	if handshake {
+		syn := packet(true, clientSeq-1, 0, "")
+		syn.SYN, syn.ACK = true, false
+		send(syn)
+		synAck := packet(false, serverSeq-1, clientSeq, "")
+		synAck.SYN = true
+		send(synAck)
+		send(packet(true, clientSeq, serverSeq, ""))
+	}
+	send(packet(true, clientSeq, serverSeq, request))
+	clientSeq += uint32(len(request))
+	send(packet(false, serverSeq, clientSeq, response))
+	serverSeq += uint32(len(response))
+	send(packet(true, clientSeq, serverSeq, ""))
+	if reset {
+		rst := packet(true, clientSeq, serverSeq, "")
+		rst.RST = true
+		send(rst)
+		return
+	}
+	fin := packet(true, clientSeq, serverSeq, "")
+	fin.FIN = true
+	send(fin)
+	fin = packet(false, serverSeq, clientSeq+1, "")
+	fin.FIN = true
+	send(fin)
+}
+
+func TestConnectionFilter(t *testing.T) {
+	var cases = []struct {
+		filter string
+		urls   []string
+	}{
+		{"rst", []string{"/50002", "/50004"}},
+		{"fin,rst", []string{"/50001", "/50002", "/50003", "/50004"}},
+		{"rst,no-handshake", []string{"/50002"}},
+		{"handshake", []string{"/50003", "/50004"}},
+	}
+	for _, c := range cases {
+		handler, sink := newTestHTTPHandler(&Config{})
+		filter, err := parseConnectionFilter(c.filter)
+		assert.Nil(t, err)
+		handler.connectionFilter = filter
+		assembler := newTCPAssembler(handler, handler.printer)
+		runClosedConnection(assembler, 50001, false, false)
+		runClosedConnection(assembler, 50002, false, true)
+		runClosedConnection(assembler, 50003, true, false)
+		runClosedConnection(assembler, 50004, true, true)
+		assembler.finishAll()
+		waitGroup.Wait()
+
+		var urls []string
+		for _, exchange := range sink.exchanges {
+			urls = append(urls, exchange.url)
+		}
+		sort.Strings(urls)
+		assert.Equal(t, c.urls, urls, c.filter)
+	}
+
+	_, err := parseConnectionFilter("rst,reset")
+	assert.NotNil(t, err)
+}
+
+func TestConnectionFilterMaxHeld(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	filter, err := parseConnectionFilter("fin")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultMaxHeld, filter.maxHeld)
+	filter.maxHeld = 2
+	handler.connectionFilter = filter
+	var segments []testSegment
+	for _, path := range []string{"/1", "/2", "/3", "/4"} {
+		segments = append(segments, statusExchange(path, "200 OK")...)
+	}
+	runConversation(handler, segments)
+
+	var urls []string
+	for _, exchange := range sink.exchanges {
+		urls = append(urls, exchange.url)
+	}
+	assert.Equal(t, []string{"/3", "/4"}, urls)
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[evicted]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[evicted] 10.0.0.1:50000 -> 10.0.0.2:80 2 exchanges evicted, beyond 2 exchanges " +
+		"held per connection\n"}, reports)
+}
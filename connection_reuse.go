@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// connection disposition declared by exchange, close if either request or response asks to close
+func (exchange *Exchange) declaredDisposition() string {
+	if exchange.requestClose || exchange.responseClose {
+		return "close"
+	}
+	return "keep-alive"
+}
+
+// report the previous exchange as reused, and wait a following exchange for this one. http2 streams are
+// multiplexed, so they are not tracked
+func (h *HTTPTrafficHandler) trackReuse(exchange *Exchange) {
+	if !h.config.connectionReuse || exchange.proto == "HTTP/2.0" {
+		return
+	}
+	if h.reuseExchange != nil {
+		h.reportReuse(h.reuseExchange, true)
+	}
+	h.reuseExchange = exchange
+}
+
+// report the last exchange as not reused, when connection ends
+func (h *HTTPTrafficHandler) finishReuse() {
+	if h.reuseExchange != nil {
+		h.reportReuse(h.reuseExchange, false)
+		h.reuseExchange = nil
+	}
+}
+
+func (h *HTTPTrafficHandler) reportReuse(exchange *Exchange, reused bool) {
+	declared := exchange.declaredDisposition()
+	var closeReason string
+	if !reused {
+		closeReason = h.connection.closeReason()
+	}
+	if h.config.format == "json" {
+		record := map[string]interface{}{
+			"type":     "connection-reuse",
+			"src":      exchange.key.srcString(),
+			"dst":      exchange.key.dstString(),
+			"method":   exchange.method,
+			"url":      exchange.host + exchange.url,
+			"index":    exchange.index,
+			"declared": declared,
+			"reused":   reused,
+		}
+		if closeReason != "" {
+			record["closeReason"] = closeReason
+		}
+		data, _ := json.Marshal(record)
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	var fields = []string{"[connection-reuse]", exchange.key.srcString(), "->", exchange.key.dstString(),
+		exchange.method, exchange.host + exchange.url, "declared=" + declared, "reused=" + strconv.FormatBool(reused)}
+	if closeReason != "" {
+		fields = append(fields, "close="+closeReason)
+	}
+	h.printer.send(strings.Join(fields, " ") + "\n")
+}
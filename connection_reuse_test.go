@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionReuse(t *testing.T) {
+	_, printer := runHTTPConversation(&Config{connectionReuse: true}, []testSegment{
+		{up: true, payload: "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nConnection: keep-alive\r\nContent-Length: 2\r\n\r\nok",
+			delay: time.Millisecond},
+		{up: true, payload: "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n", delay: time.Millisecond},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 2\r\n\r\nok",
+			delay: time.Millisecond},
+	})
+	var records []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[connection-reuse]") {
+			records = append(records, msg)
+		}
+	}
+	assert.Equal(t, []string{
+		"[connection-reuse] 10.0.0.1:50000 -> 10.0.0.2:80 GET example.com/a declared=keep-alive reused=true\n",
+		"[connection-reuse] 10.0.0.1:50000 -> 10.0.0.2:80 GET example.com/b declared=close reused=false close=fin\n",
+	}, records)
+
+	// HTTP/1.0 closes connection without keep-alive
+	sink, _ := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /a HTTP/1.0\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nok", delay: time.Millisecond},
+	})
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Equal(t, "close", sink.exchanges[0].declaredDisposition())
+	}
+	sink, _ = runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /a HTTP/1.0\r\nHost: example.com\r\nConnection: keep-alive\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", delay: time.Millisecond},
+	})
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Equal(t, "keep-alive", sink.exchanges[0].declaredDisposition())
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConnectionSummaryMode decide if a summary record is emitted for each connection, and if exchange output is kept
+type ConnectionSummaryMode int
+
+const (
+	// SummaryOff emit no connection summary
+	SummaryOff ConnectionSummaryMode = iota
+	// SummaryAlongside emit connection summaries in addition to exchange output
+	SummaryAlongside
+	// SummaryOnly emit connection summaries instead of printed exchanges and their timing lines. Exchange records
+	// still go to sinks
+	SummaryOnly
+)
+
+func parseConnectionSummaryMode(value string) (ConnectionSummaryMode, error) {
+	switch value {
+	case "off":
+		return SummaryOff, nil
+	case "alongside":
+		return SummaryAlongside, nil
+	case "only":
+		return SummaryOnly, nil
+	}
+	return SummaryOff, fmt.Errorf("invalid connection summary mode: %s", value)
+}
+
+// connectionSummary collect exchanges of one connection, for the summary record emitted when connection ends
+type connectionSummary struct {
+	exchanges int
+	// time spans from request start to response end of exchanges, end is zero if response is not completed
+	intervals []exchangeInterval
+}
+
+type exchangeInterval struct {
+	start time.Time
+	end   time.Time
+}
+
+// start summary of connection, nil if summary is not enabled
+func (h *HTTPTrafficHandler) startSummary() *connectionSummary {
+	if h.config.connectionSummary == SummaryOff {
+		return nil
+	}
+	return &connectionSummary{}
+}
+
+func (summary *connectionSummary) add(exchange *Exchange) {
+	if summary == nil {
+		return
+	}
+	summary.exchanges++
+	summary.intervals = append(summary.intervals, exchangeInterval{start: exchange.requestStart,
+		end: exchange.responseEnd})
+}
+
+// max exchanges in flight at the same time, by requests sent before previous responses end, as pipelined or
+// multiplexed. Exchanges without completed response are in flight until connection ends
+func (summary *connectionSummary) peakConcurrency(end time.Time) int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	var events []event
+	for _, interval := range summary.intervals {
+		intervalEnd := interval.end
+		if intervalEnd.IsZero() || intervalEnd.Before(interval.start) {
+			intervalEnd = end
+		}
+		events = append(events, event{interval.start, 1}, event{intervalEnd, -1})
+	}
+	// an exchange ends before the one starting at the same time
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+	var current, peak int
+	for _, e := range events {
+		current += e.delta
+		if current > peak {
+			peak = current
+		}
+	}
+	return peak
+}
+
+// send the summary record of connection, after all its exchanges are written
+func (h *HTTPTrafficHandler) reportSummary() {
+	summary := h.summary
+	if summary == nil {
+		return
+	}
+	info := h.connection.snapshot()
+	duration := info.LastActivity.Sub(info.Created)
+	peak := summary.peakConcurrency(info.LastActivity)
+	if h.config.format == "json" {
+		record := map[string]interface{}{
+			"type":            "connection-summary",
+			"src":             h.key.srcString(),
+			"dst":             h.key.dstString(),
+			"exchanges":       summary.exchanges,
+			"upBytes":         info.UpBytes,
+			"downBytes":       info.DownBytes,
+			"start":           info.Created,
+			"duration":        duration.Seconds(),
+			"closeReason":     info.CloseReason,
+			"peakConcurrency": peak,
+		}
+		if intervals := info.Intervals; intervals.Count > 0 {
+			stats := map[string]interface{}{"count": intervals.Count, "min": intervals.Min.Seconds(),
+				"max": intervals.Max.Seconds(), "mean": intervals.Mean.Seconds()}
+			if intervals.Count > 1 {
+				stats["jitter"] = intervals.Jitter.Seconds()
+			}
+			record["packetIntervals"] = stats
+		}
+		data, _ := json.Marshal(record)
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	var fields = []string{"[connection-summary]", h.key.srcString(), "->", h.key.dstString(),
+		"exchanges=" + strconv.Itoa(summary.exchanges), "up=" + strconv.FormatInt(info.UpBytes, 10),
+		"down=" + strconv.FormatInt(info.DownBytes, 10), "duration=" + duration.String()}
+	if info.CloseReason != "" {
+		fields = append(fields, "close="+info.CloseReason)
+	}
+	fields = append(fields, "peak-concurrency="+strconv.Itoa(peak))
+	if intervals := info.Intervals; intervals.Count > 0 {
+		fields = append(fields, "interval-min="+intervals.Min.String(), "interval-max="+intervals.Max.String(),
+			"interval-mean="+intervals.Mean.String())
+		if intervals.Count > 1 {
+			fields = append(fields, "jitter="+intervals.Jitter.String())
+		}
+	}
+	h.printer.send(strings.Join(fields, " ") + "\n")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionSummary(t *testing.T) {
+	pipelined := "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\nGET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	request := "GET /c HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	segments := []testSegment{
+		{up: true, payload: pipelined},
+		{up: false, payload: response, delay: 10 * time.Millisecond},
+		{up: false, payload: response, delay: 10 * time.Millisecond},
+		{up: true, payload: request, delay: 10 * time.Millisecond},
+		{up: false, payload: response, delay: 10 * time.Millisecond},
+	}
+	for _, mode := range []ConnectionSummaryMode{SummaryAlongside, SummaryOnly} {
+		sink, printer := runHTTPConversation(&Config{connectionSummary: mode}, segments)
+		assert.Equal(t, 3, len(sink.exchanges))
+		var summaries []string
+		var printed bool
+		for len(printer.outputQueue) > 0 {
+			msg := <-printer.outputQueue
+			if strings.HasPrefix(msg, "[connection-summary]") {
+				summaries = append(summaries, msg)
+			} else if strings.TrimSpace(msg) != "" {
+				// timing lines of exchanges
+				printed = true
+			}
+		}
+		assert.Equal(t, []string{"[connection-summary] 10.0.0.1:50000 -> 10.0.0.2:80 exchanges=3 up=" +
+			strconv.Itoa(len(pipelined)+len(request)) + " down=" + strconv.Itoa(3*len(response)) +
+			" duration=40ms close=fin peak-concurrency=2 interval-min=10ms interval-max=10ms interval-mean=10ms " +
+			"jitter=0s\n"}, summaries)
+		assert.Equal(t, mode == SummaryAlongside, printed)
+	}
+
+	// not emitted if not enabled
+	_, printer := runHTTPConversation(&Config{}, segments)
+	for len(printer.outputQueue) > 0 {
+		assert.False(t, strings.HasPrefix(<-printer.outputQueue, "[connection-summary]"))
+	}
+
+	_, err := parseConnectionSummaryMode("sometimes")
+	assert.NotNil(t, err)
+}
+
+func TestPeakConcurrency(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	summary := &connectionSummary{}
+	assert.Equal(t, 0, summary.peakConcurrency(at(100)))
+	// sequential exchanges, the next starts when the previous ends
+	summary.intervals = []exchangeInterval{{at(0), at(10)}, {at(10), at(20)}}
+	assert.Equal(t, 1, summary.peakConcurrency(at(100)))
+	// the one without response is in flight until connection ends
+	summary.intervals = append(summary.intervals, exchangeInterval{at(5), time.Time{}},
+		exchangeInterval{at(50), at(60)})
+	assert.Equal(t, 2, summary.peakConcurrency(at(100)))
+}
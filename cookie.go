@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"httpdump/httpport"
+)
+
+// cookieRecord is a cookie in Cookie header of request, or in Set-Cookie header of response.
+// attributes are only set for Set-Cookie
+type cookieRecord struct {
+	name     string
+	value    string
+	path     string
+	domain   string
+	expires  string // as in header
+	maxAge   int    // 0 for not set, -1 for delete cookie now
+	secure   bool
+	httpOnly bool
+	sameSite string
+}
+
+// parse Cookie headers of request. values are replaced by *** if redacted
+func parseRequestCookies(header httpport.Header, redacted bool) []cookieRecord {
+	var cookies []cookieRecord
+	for _, cookie := range (&httpport.Request{Header: header}).Cookies() {
+		record := cookieRecord{name: cookie.Name, value: cookie.Value}
+		if redacted {
+			record.value = "***"
+		}
+		cookies = append(cookies, record)
+	}
+	return cookies
+}
+
+// parse all Set-Cookie headers of response. values are replaced by *** if redacted
+func parseResponseCookies(header httpport.Header, redacted bool) []cookieRecord {
+	var cookies []cookieRecord
+	for _, cookie := range (&httpport.Response{Header: header}).Cookies() {
+		record := cookieRecord{
+			name:     cookie.Name,
+			value:    cookie.Value,
+			path:     cookie.Path,
+			domain:   cookie.Domain,
+			expires:  cookie.RawExpires,
+			maxAge:   cookie.MaxAge,
+			secure:   cookie.Secure,
+			httpOnly: cookie.HttpOnly,
+		}
+		// the parser does not know SameSite, it is kept in unparsed attributes
+		for _, attr := range cookie.Unparsed {
+			if idx := strings.IndexByte(attr, '='); idx >= 0 && strings.EqualFold(attr[:idx], "SameSite") {
+				record.sameSite = attr[idx+1:]
+			} else if strings.EqualFold(attr, "SameSite") {
+				record.sameSite = "Lax"
+			}
+		}
+		if redacted {
+			record.value = "***"
+		}
+		cookies = append(cookies, record)
+	}
+	return cookies
+}
+
+// format cookie records of an exchange, one record per line
+func formatCookies(key ConnectionKey, header string, cookies []cookieRecord, format string) string {
+	var builder strings.Builder
+	for _, cookie := range cookies {
+		if format == "json" {
+			data, _ := json.Marshal(map[string]interface{}{
+				"type":     "cookie",
+				"src":      key.srcString(),
+				"dst":      key.dstString(),
+				"header":   header,
+				"name":     cookie.name,
+				"value":    cookie.value,
+				"path":     cookie.path,
+				"domain":   cookie.domain,
+				"expires":  cookie.expires,
+				"maxAge":   cookie.maxAge,
+				"secure":   cookie.secure,
+				"httpOnly": cookie.httpOnly,
+				"sameSite": cookie.sameSite,
+			})
+			builder.Write(data)
+			builder.WriteString("\n")
+			continue
+		}
+		var fields = []string{"[cookie]", key.srcString(), "->", key.dstString(), header, cookie.name + "=" + cookie.value}
+		if cookie.path != "" {
+			fields = append(fields, "path="+cookie.path)
+		}
+		if cookie.domain != "" {
+			fields = append(fields, "domain="+cookie.domain)
+		}
+		if cookie.expires != "" {
+			fields = append(fields, fmt.Sprintf("expires=%q", cookie.expires))
+		}
+		if cookie.maxAge != 0 {
+			fields = append(fields, fmt.Sprintf("max-age=%d", cookie.maxAge))
+		}
+		if cookie.secure {
+			fields = append(fields, "secure")
+		}
+		if cookie.httpOnly {
+			fields = append(fields, "httponly")
+		}
+		if cookie.sameSite != "" {
+			fields = append(fields, "samesite="+cookie.sameSite)
+		}
+		builder.WriteString(strings.Join(fields, " ") + "\n")
+	}
+	return builder.String()
+}
+
+// parse cookies of exchange before headers are redacted, and send cookie records to printer
+func (h *HTTPTrafficHandler) reportCookies(exchange *Exchange) {
+	exchange.requestCookies = parseRequestCookies(exchange.requestHeader, h.config.redactHeaders["cookie"])
+	exchange.responseCookies = parseResponseCookies(exchange.responseHeader, h.config.redactHeaders["set-cookie"])
+	output := formatCookies(exchange.key, "Cookie", exchange.requestCookies, h.config.format) +
+		formatCookies(exchange.key.reverse(), "Set-Cookie", exchange.responseCookies, h.config.format)
+	if output != "" {
+		h.printer.send(output)
+	}
+}
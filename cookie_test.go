@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCookies(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{parseCookies: true, redactHeaders: map[string]bool{"cookie": true}})
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /login HTTP/1.1\r\nHost: example.com\r\nCookie: theme=dark; session=abc\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\n" +
+			"Set-Cookie: session=xyz; Path=/; Domain=example.com; Secure; HttpOnly; SameSite=Strict\r\n" +
+			"Set-Cookie: lang=en; Expires=Wed, 21 Oct 2026 07:28:00 GMT; Max-Age=3600\r\n" +
+			"Content-Length: 0\r\n\r\n"},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, []cookieRecord{{name: "theme", value: "***"}, {name: "session", value: "***"}},
+		exchange.requestCookies)
+	assert.Equal(t, []cookieRecord{
+		{name: "session", value: "xyz", path: "/", domain: "example.com", secure: true, httpOnly: true,
+			sameSite: "Strict"},
+		{name: "lang", value: "en", expires: "Wed, 21 Oct 2026 07:28:00 GMT", maxAge: 3600},
+	}, exchange.responseCookies)
+	assert.Equal(t, "Strict", exchange.toProto().ResponseCookies[0].SameSite)
+	assert.Equal(t, []string{"Host: example.com", "Cookie: ***"}, exchange.requestHeaders)
+
+	var records []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[cookie]") {
+			records = append(records, strings.Split(strings.TrimSuffix(msg, "\n"), "\n")...)
+		}
+	}
+	assert.Equal(t, []string{
+		"[cookie] 10.0.0.1:50000 -> 10.0.0.2:80 Cookie theme=***",
+		"[cookie] 10.0.0.1:50000 -> 10.0.0.2:80 Cookie session=***",
+		"[cookie] 10.0.0.2:80 -> 10.0.0.1:50000 Set-Cookie session=xyz path=/ domain=example.com secure httponly samesite=Strict",
+		"[cookie] 10.0.0.2:80 -> 10.0.0.1:50000 Set-Cookie lang=en expires=\"Wed, 21 Oct 2026 07:28:00 GMT\" max-age=3600",
+	}, records)
+}
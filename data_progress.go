@@ -0,0 +1,35 @@
+package main
+
+// dataProgress track the end of payload received of each direction, to tell new data from retransmissions
+// and duplicated segments, e.g. captured twice on a SPAN port. Only new data advances timing info.
+// A segment after a gap is new data, and the segment filling the gap later is taken as retransmission
+type dataProgress struct {
+	end    [2]uint32 // seq after the highest payload byte received, indexed by up
+	endSet [2]bool
+}
+
+// move the end forward by the segment, return count of payload bytes not received before
+func (progress *dataProgress) advance(up bool, seq uint32, size int) int {
+	side := 0
+	if up {
+		side = 1
+	}
+	if size == 0 {
+		return 0
+	}
+	end := seq + uint32(size)
+	if !progress.endSet[side] {
+		progress.end[side] = end
+		progress.endSet[side] = true
+		return size
+	}
+	diff := compareTCPSeq(end, progress.end[side])
+	if diff <= 0 {
+		return 0
+	}
+	progress.end[side] = end
+	if diff > size {
+		return size
+	}
+	return diff
+}
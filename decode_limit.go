@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// errCompressionBomb is returned with the data decoded before the limit, if a decoded body exceeds the limit
+var errCompressionBomb = errors.New("decoded body exceeds limit, potential compression bomb")
+
+// errBodyTooLarge is returned if a body is larger than bytes buffered for it
+var errBodyTooLarge = errors.New("body too large to buffer")
+
+// default limits of decoded body, far above ratios of real text bodies
+const (
+	defaultMaxDecodeRatio = 1000
+	defaultMaxDecodeSize  = 64 << 20
+)
+
+// decodeLimit bound the size of a body decoded by content-encoding, so a small compressed body can not
+// expand enormously in memory
+type decodeLimit struct {
+	maxRatio int64 // max decoded size to encoded size, 0 for unlimited
+	maxSize  int64 // max decoded bytes, 0 for unlimited
+}
+
+// max decoded bytes of body with encoded size, -1 for unlimited
+func (limit decodeLimit) max(encoded int) int64 {
+	max := int64(-1)
+	if limit.maxRatio > 0 {
+		max = limit.maxRatio * int64(encoded)
+	}
+	if limit.maxSize > 0 && (max < 0 || limit.maxSize < max) {
+		max = limit.maxSize
+	}
+	return max
+}
+
+// read decoded content at most the max bytes, reading stops at one byte over it so memory is bounded.
+// data decoded before the limit is returned with errCompressionBomb if exceeded
+func readDecoded(reader io.Reader, max int64) ([]byte, error) {
+	if max < 0 {
+		return ioutil.ReadAll(reader)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(reader, max+1))
+	if int64(len(data)) > max {
+		return data[:max], errCompressionBomb
+	}
+	return data, err
+}
+
+// if a body decoded since last check exceeded the limit, report it and reset. return if exceeded
+func (h *HTTPTrafficHandler) checkCompressionBomb(ck ConnectionKey, message string, exchange *Exchange) bool {
+	if !h.compressionBomb {
+		return false
+	}
+	h.compressionBomb = false
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":    "compression-bomb",
+			"src":     ck.srcString(),
+			"dst":     ck.dstString(),
+			"message": message,
+			"method":  exchange.method,
+			"url":     exchange.host + exchange.url,
+		})
+		h.printer.send(string(data) + "\n")
+	} else {
+		h.printer.send(strings.Join([]string{"[compression-bomb]", ck.srcString(), "->", ck.dstString(),
+			exchange.method, exchange.host + exchange.url, message,
+			fmt.Sprintf("decoded body exceeds limit(ratio %d, size %d), decoding stopped",
+				h.config.decodeLimit.maxRatio, h.config.decodeLimit.maxSize)}, " ") + "\n")
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipData(data []byte) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestDecodeLimitMax(t *testing.T) {
+	assert.Equal(t, int64(-1), decodeLimit{}.max(10))
+	assert.Equal(t, int64(1000), decodeLimit{maxRatio: 100}.max(10))
+	assert.Equal(t, int64(500), decodeLimit{maxRatio: 100, maxSize: 500}.max(10))
+	assert.Equal(t, int64(500), decodeLimit{maxSize: 500}.max(10))
+}
+
+func TestDecodeContentLimit(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 8<<20)
+	encoded := gzipData(body)
+	limit := decodeLimit{maxRatio: 100}
+	max := limit.max(len(encoded))
+	assert.True(t, max < int64(len(body)))
+
+	decoded, err := decodeContent(encoded, "gzip", limit)
+	assert.Equal(t, errCompressionBomb, err)
+	// content decoded before the limit is kept, without buffering the whole body
+	assert.Equal(t, max, int64(len(decoded)))
+	assert.Equal(t, body[:max], decoded)
+	assert.True(t, int64(cap(decoded)) < 2*max+bytes.MinRead)
+
+	decoded, err = decodeContent(encoded, "gzip", decodeLimit{})
+	assert.Nil(t, err)
+	assert.Equal(t, len(body), len(decoded))
+	decoded, err = decodeContent(gzipData([]byte("hello")), "gzip", decodeLimit{maxRatio: 100, maxSize: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(decoded))
+}
+
+func TestCompressionBomb(t *testing.T) {
+	encoded := string(gzipData(bytes.Repeat([]byte("{}"), 1<<20)))
+	config := &Config{bodyStats: true, decodeLimit: decodeLimit{maxRatio: 100, maxSize: 64 << 20}}
+	sink, printer := runHTTPConversation(config, []testSegment{
+		{up: true, payload: "GET /data HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Encoding: gzip\r\n" +
+			"Content-Length: " + strconv.Itoa(len(encoded)) + "\r\n\r\n" + encoded},
+		{up: true, payload: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"},
+	})
+
+	assert.Equal(t, 2, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.True(t, exchange.responseCompressionBomb)
+	assert.False(t, exchange.requestCompressionBomb)
+	assert.True(t, exchange.toProto().ResponseCompressionBomb)
+	// stats of content decoded before the limit
+	assert.Equal(t, int64(100*len(encoded)), exchange.responseBodyStats.bytes)
+	assert.Equal(t, int64(len(encoded)), exchange.responseBodySize)
+	assert.False(t, sink.exchanges[1].responseCompressionBomb)
+
+	var reports []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[compression-bomb]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[compression-bomb] 10.0.0.2:80 -> 10.0.0.1:50000 GET example.com/data response " +
+		"decoded body exceeds limit(ratio 100, size 67108864), decoding stopped\n"}, reports)
+}
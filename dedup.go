@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExchangeSuppressor suppress exchanges with same request signature as one emitted within the window
+type ExchangeSuppressor struct {
+	lock    sync.Mutex
+	window  time.Duration
+	entries map[string]*suppressEntry
+	total   int // total suppressed exchanges
+	// capture time of the latest exchange, and wall-clock when it is seen, as clock for expiring entries
+	latest     time.Time
+	latestSeen time.Time
+	swept      time.Time // capture time entries were last expired
+}
+
+type suppressEntry struct {
+	emitted    time.Time // request time of the last emitted exchange
+	suppressed int       // suppressed since last emitted
+}
+
+func newExchangeSuppressor(window time.Duration) *ExchangeSuppressor {
+	return &ExchangeSuppressor{window: window, entries: map[string]*suppressEntry{}}
+}
+
+// request signature, by method, host, url path, and body hash if is set
+func requestSignature(exchange *Exchange) string {
+	path := exchange.url
+	if idx := strings.IndexByte(path, '?'); idx >= 0 {
+		path = path[:idx]
+	}
+	signature := exchange.method + " " + exchange.host + path
+	if exchange.requestBodyHash != "" {
+		signature += " body=" + exchange.requestBodyHash
+	}
+	return signature
+}
+
+// hash of request body for request signature
+func bodyHash(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// check if exchange should be suppressed. if it should be emitted, and exchanges of the same signature
+// were suppressed since last emitted, return the report of suppressed count
+func (suppressor *ExchangeSuppressor) suppress(exchange *Exchange, format string) (bool, string) {
+	signature := requestSignature(exchange)
+	suppressor.lock.Lock()
+	defer suppressor.lock.Unlock()
+	if exchange.requestStart.After(suppressor.latest) {
+		suppressor.latest = exchange.requestStart
+		suppressor.latestSeen = time.Now()
+	}
+	var report string
+	if exchange.requestStart.Sub(suppressor.swept) >= suppressor.window {
+		report = suppressor.expireLocked(exchange.requestStart, format)
+	}
+	entry := suppressor.entries[signature]
+	if entry != nil && exchange.requestStart.Sub(entry.emitted) < suppressor.window {
+		entry.suppressed++
+		suppressor.total++
+		return true, report
+	}
+	if entry != nil && entry.suppressed > 0 {
+		report += suppressReport(signature, entry.suppressed, format)
+	}
+	suppressor.entries[signature] = &suppressEntry{emitted: exchange.requestStart}
+	return false, report
+}
+
+// remove entries emitted a window before now, so signatures seen once do not stay forever. Return reports of
+// suppressed counts of removed entries, ordered by signature
+func (suppressor *ExchangeSuppressor) expire(now time.Time, format string) string {
+	suppressor.lock.Lock()
+	defer suppressor.lock.Unlock()
+	return suppressor.expireLocked(now, format)
+}
+
+func (suppressor *ExchangeSuppressor) expireLocked(now time.Time, format string) string {
+	suppressor.swept = now
+	var signatures []string
+	for signature, entry := range suppressor.entries {
+		if now.Sub(entry.emitted) < suppressor.window {
+			continue
+		}
+		if entry.suppressed > 0 {
+			signatures = append(signatures, signature)
+		} else {
+			delete(suppressor.entries, signature)
+		}
+	}
+	sort.Strings(signatures)
+	var buffer strings.Builder
+	for _, signature := range signatures {
+		buffer.WriteString(suppressReport(signature, suppressor.entries[signature].suppressed, format))
+		delete(suppressor.entries, signature)
+	}
+	return buffer.String()
+}
+
+// current time by capture timestamps: capture time of the latest exchange, plus wall-clock elapsed since
+func (suppressor *ExchangeSuppressor) now() time.Time {
+	suppressor.lock.Lock()
+	defer suppressor.lock.Unlock()
+	if suppressor.latest.IsZero() {
+		return time.Time{}
+	}
+	return suppressor.latest.Add(time.Since(suppressor.latestSeen))
+}
+
+// expire entries and send suppressed counts every window, so counts are reported even if no more exchanges of
+// the signature come, until stop is closed. done is closed when it returns
+func runSuppressReports(suppressor *ExchangeSuppressor, printer *Printer, format string, stop <-chan struct{},
+	done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(suppressor.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if now := suppressor.now(); !now.IsZero() {
+				if report := suppressor.expire(now, format); report != "" {
+					printer.send(report)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func suppressReport(signature string, count int, format string) string {
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{"type": "suppressed", "signature": signature, "count": count})
+		return string(data) + "\n"
+	}
+	return "[suppressed] " + signature + " count=" + strconv.Itoa(count) + "\n"
+}
+
+// report suppressed counts not reported yet, ordered by signature, and the total count
+func (suppressor *ExchangeSuppressor) format(format string) string {
+	suppressor.lock.Lock()
+	defer suppressor.lock.Unlock()
+	var signatures []string
+	for signature, entry := range suppressor.entries {
+		if entry.suppressed > 0 {
+			signatures = append(signatures, signature)
+		}
+	}
+	sort.Strings(signatures)
+	var buffer strings.Builder
+	for _, signature := range signatures {
+		buffer.WriteString(suppressReport(signature, suppressor.entries[signature].suppressed, format))
+	}
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{"type": "suppressed", "total": suppressor.total})
+		buffer.Write(data)
+		buffer.WriteString("\n")
+	} else {
+		buffer.WriteString("[suppressed] total=" + strconv.Itoa(suppressor.total) + "\n")
+	}
+	return buffer.String()
+}
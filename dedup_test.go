@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuppressDuplicatedExchanges(t *testing.T) {
+	var segments []testSegment
+	for i := 0; i < 5; i++ {
+		segments = append(segments, statusExchange("/healthz", "200 OK")...)
+		segments[len(segments)-2].delay = time.Second
+	}
+	segments = append(segments, statusExchange("/users", "200 OK")...)
+	segments = append(segments, statusExchange("/healthz?ts=1", "200 OK")...)
+	// after the window
+	segments = append(segments, statusExchange("/healthz", "200 OK")...)
+	segments[len(segments)-2].delay = time.Minute
+
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.suppressor = newExchangeSuppressor(30 * time.Second)
+	runConversation(handler, segments)
+	var urls []string
+	for _, exchange := range sink.exchanges {
+		urls = append(urls, exchange.url)
+	}
+	assert.Equal(t, []string{"/healthz", "/users", "/healthz"}, urls)
+
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[suppressed]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[suppressed] GET example.com/healthz count=5\n"}, reports)
+	assert.Equal(t, "[suppressed] total=5\n", handler.suppressor.format("text"))
+}
+
+func TestSuppressByBody(t *testing.T) {
+	post := func(body string) []testSegment {
+		return []testSegment{
+			{up: true, payload: "POST /ping HTTP/1.1\r\nHost: example.com\r\nContent-Length: 1\r\n\r\n" + body},
+			{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+		}
+	}
+	var segments []testSegment
+	segments = append(segments, post("a")...)
+	segments = append(segments, post("a")...)
+	segments = append(segments, post("b")...)
+
+	handler, sink := newTestHTTPHandler(&Config{dedupBody: true})
+	handler.suppressor = newExchangeSuppressor(time.Minute)
+	runConversation(handler, segments)
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, int64(1), sink.exchanges[1].requestBodySize)
+	assert.Equal(t, "[suppressed] POST example.com/ping body="+bodyHash([]byte("a"))+" count=1\n"+
+		"[suppressed] total=1\n", handler.suppressor.format("text"))
+}
+
+func TestSuppressorExpire(t *testing.T) {
+	suppressor := newExchangeSuppressor(time.Minute)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	exchange := func(path string, requestStart time.Time) *Exchange {
+		return &Exchange{method: "GET", host: "example.com", url: path, requestStart: requestStart}
+	}
+	for i := 0; i < 100; i++ {
+		suppressor.suppress(exchange("/users/"+strconv.Itoa(i), start), "text")
+	}
+	suppressor.suppress(exchange("/users/1", start.Add(time.Second)), "text")
+	suppressor.suppress(exchange("/healthz", start.Add(30*time.Second)), "text")
+	assert.Equal(t, 101, len(suppressor.entries))
+
+	// entries a window old are removed, with their suppressed counts reported
+	suppressed, report := suppressor.suppress(exchange("/orders", start.Add(time.Minute)), "text")
+	assert.False(t, suppressed)
+	assert.Equal(t, "[suppressed] GET example.com/users/1 count=1\n", report)
+	assert.Equal(t, 2, len(suppressor.entries))
+
+	assert.Equal(t, "", suppressor.expire(start.Add(time.Minute+time.Second), "text"))
+	assert.Equal(t, 2, len(suppressor.entries))
+	suppressor.suppress(exchange("/orders", start.Add(time.Minute+time.Second)), "text")
+	assert.Equal(t, `{"count":1,"signature":"GET example.com/orders","type":"suppressed"}`+"\n",
+		suppressor.expire(start.Add(2*time.Minute), "json"))
+	assert.Equal(t, 0, len(suppressor.entries))
+	assert.Equal(t, "[suppressed] total=2\n", suppressor.format("text"))
+}
+
+func TestRunSuppressReports(t *testing.T) {
+	suppressor := newExchangeSuppressor(10 * time.Millisecond)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	exchange := &Exchange{method: "GET", host: "example.com", url: "/healthz", requestStart: start}
+	suppressor.suppress(exchange, "text")
+	suppressor.suppress(exchange, "text")
+
+	printer := &Printer{outputQueue: make(chan string, 16)}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go runSuppressReports(suppressor, printer, "text", stop, done)
+	select {
+	case msg := <-printer.outputQueue:
+		assert.Equal(t, "[suppressed] GET example.com/healthz count=1\n", msg)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no suppressed report")
+	}
+	close(stop)
+	<-done
+	assert.Equal(t, 0, len(suppressor.entries))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"httpdump/httpport"
+)
+
+// bodyDigest is one digest of body declared in headers
+type bodyDigest struct {
+	header    string // the header declared this digest
+	algorithm string // lower case algorithm name
+	value     []byte
+}
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// parse digests in Content-MD5, Digest(rfc 3230) and Content-Digest(rfc 9530) headers.
+// digests of unsupported algorithms or with malformed value are ignored
+func parseDigests(header httpport.Header) []bodyDigest {
+	var digests []bodyDigest
+	if value := header.Get("Content-MD5"); value != "" {
+		if data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value)); err == nil {
+			digests = append(digests, bodyDigest{header: "Content-MD5", algorithm: "md5", value: data})
+		}
+	}
+	for _, name := range []string{"Digest", "Content-Digest"} {
+		for _, value := range header[name] {
+			for _, item := range strings.Split(value, ",") {
+				idx := strings.IndexByte(item, '=')
+				if idx < 0 {
+					continue
+				}
+				algorithm := strings.ToLower(strings.TrimSpace(item[:idx]))
+				if digestAlgorithms[algorithm] == nil {
+					continue
+				}
+				// Content-Digest values are byte sequences, enclosed by colons
+				encoded := strings.Trim(strings.TrimSpace(item[idx+1:]), ":")
+				data, err := base64.StdEncoding.DecodeString(encoded)
+				if err != nil {
+					continue
+				}
+				digests = append(digests, bodyDigest{header: name, algorithm: algorithm, value: data})
+			}
+		}
+	}
+	return digests
+}
+
+func (digest bodyDigest) match(data []byte) bool {
+	h := digestAlgorithms[digest.algorithm]()
+	h.Write(data)
+	return bytes.Equal(h.Sum(nil), digest.value)
+}
+
+// verify body by digest headers, return the headers whose digest mismatch.
+// digest is computed over the body as sent, and over the decoded body if content-encoding is set,
+// a digest matches either of them is accepted. The body is kept for later printing.
+// If decoded body exceeds the limit, only the body as sent is verified, and errCompressionBomb is returned
+func verifyBodyDigests(body *io.ReadCloser, header httpport.Header, limit decodeLimit) ([]string, error) {
+	digests := parseDigests(header)
+	if len(digests) == 0 {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil
+	}
+	decoded, decodeErr := decodeContent(data, header.Get("Content-Encoding"), limit)
+	if decodeErr != nil {
+		decoded = data
+	}
+
+	var mismatched []string
+	for _, digest := range digests {
+		if !digest.match(data) && !digest.match(decoded) {
+			mismatched = append(mismatched, digest.header+"("+digest.algorithm+")")
+		}
+	}
+	if decodeErr == errCompressionBomb {
+		return mismatched, decodeErr
+	}
+	return mismatched, nil
+}
+
+// verify body digest of request or response, report mismatch. return if mismatched
+func (h *HTTPTrafficHandler) verifyDigest(ck ConnectionKey, message string, body *io.ReadCloser,
+	header httpport.Header) bool {
+	mismatched, err := verifyBodyDigests(body, header, h.config.decodeLimit)
+	if err == errCompressionBomb {
+		h.compressionBomb = true
+	}
+	if len(mismatched) == 0 {
+		return false
+	}
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":    "digest",
+			"src":     ck.srcString(),
+			"dst":     ck.dstString(),
+			"message": message,
+			"headers": mismatched,
+		})
+		h.printer.send(string(data) + "\n")
+	} else {
+		h.printer.send(strings.Join([]string{"[digest]", ck.srcString(), "->", ck.dstString(), message,
+			"body digest mismatch:", strings.Join(mismatched, ", ")}, " ") + "\n")
+	}
+	return true
+}
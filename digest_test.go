@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyDigest(t *testing.T) {
+	md5Sum := md5.Sum([]byte("hello"))
+	contentMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	sha256Sum := sha256.Sum256([]byte("world"))
+	sha256Digest := base64.StdEncoding.EncodeToString(sha256Sum[:])
+	handler, sink := newTestHTTPHandler(&Config{verifyDigest: true})
+	runConversation(handler, []testSegment{
+		{up: true, payload: "POST /a HTTP/1.1\r\nHost: example.com\r\nContent-MD5: " + contentMD5 +
+			"\r\nContent-Length: 5\r\n\r\nhello"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-MD5: " + contentMD5 + "\r\nContent-Length: 5\r\n\r\nhallo"},
+		{up: true, payload: "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nDigest: SHA-256=" + sha256Digest + "\r\n" +
+			"Content-Digest: sha-256=:" + sha256Digest + ":\r\nContent-Length: 5\r\n\r\nworld"},
+	})
+
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.False(t, sink.exchanges[0].requestDigestMismatch)
+	assert.True(t, sink.exchanges[0].responseDigestMismatch)
+	assert.True(t, sink.exchanges[0].toProto().ResponseDigestMismatch)
+	assert.Equal(t, int64(5), sink.exchanges[0].responseBodySize)
+	assert.False(t, sink.exchanges[1].responseDigestMismatch)
+
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[digest]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[digest] 10.0.0.2:80 -> 10.0.0.1:50000 response body digest mismatch: Content-MD5(md5)\n"},
+		reports)
+}
+
+func TestVerifyDigestDecodeLimit(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 1<<20)
+	encoded := string(gzipData(body))
+	md5Sum := md5.Sum(body)
+	config := &Config{verifyDigest: true, decodeLimit: decodeLimit{maxRatio: 100}}
+	sink, _ := runHTTPConversation(config, []testSegment{
+		{up: true, payload: "GET /data HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-MD5: " +
+			base64.StdEncoding.EncodeToString(md5Sum[:]) + "\r\nContent-Length: " + strconv.Itoa(len(encoded)) +
+			"\r\n\r\n" + encoded},
+	})
+
+	assert.Equal(t, 1, len(sink.exchanges))
+	// decoding stops at the limit, so the digest of decoded body is not verified
+	assert.True(t, sink.exchanges[0].responseCompressionBomb)
+	assert.True(t, sink.exchanges[0].responseDigestMismatch)
+	assert.Equal(t, int64(len(encoded)), sink.exchanges[0].responseBodySize)
+}
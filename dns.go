@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// max number of ips whose resolved names are kept, names of new ips are not recorded when exceeded
+const maxDNSNames = 100000
+
+// DNSResolver record names resolved by captured dns responses, so server ips of http connections can be
+// correlated to the host names looked up for them. Responses are added from the capture goroutine,
+// and looked up from connection goroutines
+type DNSResolver struct {
+	lock    sync.RWMutex
+	names   map[string]string // ip to query name, the latest response wins
+	printer *Printer
+	format  string
+}
+
+func newDNSResolver(printer *Printer, format string) *DNSResolver {
+	return &DNSResolver{names: make(map[string]string), printer: printer, format: format}
+}
+
+// dnsAnswer is the resolve result of a captured dns response
+type dnsAnswer struct {
+	name  string   // query name
+	ips   []string // A and AAAA records, with CNAME chain followed by resolver
+	rcode layers.DNSResponseCode
+}
+
+// parse dns response message, return false if it is not a response to a query
+func parseDNSAnswer(message []byte) (dnsAnswer, bool) {
+	var dns layers.DNS
+	if err := dns.DecodeFromBytes(message, gopacket.NilDecodeFeedback); err != nil {
+		logger.Debug("decode dns message error:", err)
+		return dnsAnswer{}, false
+	}
+	if !dns.QR || len(dns.Questions) == 0 {
+		return dnsAnswer{}, false
+	}
+	answer := dnsAnswer{name: strings.ToLower(string(dns.Questions[0].Name)), rcode: dns.ResponseCode}
+	for _, record := range dns.Answers {
+		if record.Type == layers.DNSTypeA || record.Type == layers.DNSTypeAAAA {
+			answer.ips = append(answer.ips, record.IP.String())
+		}
+	}
+	return answer, true
+}
+
+// record ips resolved by a captured dns message, and send a dns record to printer
+func (resolver *DNSResolver) handle(segment *tcpSegment) {
+	answer, ok := parseDNSAnswer(segment.dns)
+	if !ok || len(answer.ips) == 0 && answer.rcode == layers.DNSResponseCodeNoErr {
+		return
+	}
+	resolver.lock.Lock()
+	for _, ip := range answer.ips {
+		if _, ok := resolver.names[ip]; ok || len(resolver.names) < maxDNSNames {
+			resolver.names[ip] = answer.name
+		}
+	}
+	resolver.lock.Unlock()
+	resolver.printer.send(answer.format(segment.flow.Src().String(), segment.flow.Dst().String(), resolver.format))
+}
+
+// name resolved to ip by captured dns responses, empty if not found
+func (resolver *DNSResolver) lookup(ip string) string {
+	resolver.lock.RLock()
+	defer resolver.lock.RUnlock()
+	return resolver.names[ip]
+}
+
+func (answer dnsAnswer) format(src string, dst string, format string) string {
+	if format == "json" {
+		var ips = answer.ips
+		if ips == nil {
+			ips = []string{}
+		}
+		record := map[string]interface{}{
+			"type": "dns",
+			"src":  src,
+			"dst":  dst,
+			"name": answer.name,
+			"ips":  ips,
+		}
+		if answer.rcode != layers.DNSResponseCodeNoErr {
+			record["rcode"] = answer.rcode.String()
+		}
+		data, _ := json.Marshal(record)
+		return string(data) + "\n"
+	}
+	var result = answer.rcode.String()
+	if answer.rcode == layers.DNSResponseCodeNoErr {
+		result = strings.Join(answer.ips, ", ")
+	}
+	return strings.Join([]string{"[dns]", src, "->", dst, answer.name, result}, " ") + "\n"
+}
+
+// set the host name which the server ip of exchange was resolved from, and send a record to printer if found
+func (h *HTTPTrafficHandler) correlateDNS(exchange *Exchange) {
+	exchange.resolvedName = h.dns.lookup(exchange.key.dst.ip)
+	if exchange.resolvedName == "" {
+		return
+	}
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type": "resolved",
+			"src":  exchange.key.srcString(),
+			"dst":  exchange.key.dstString(),
+			"name": exchange.resolvedName,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	h.printer.send(strings.Join([]string{"[resolved]", exchange.key.srcString(), "->", exchange.key.dstString(),
+		exchange.resolvedName}, " ") + "\n")
+}
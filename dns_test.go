@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// dns response message of query name, with a CNAME and the A records
+func dnsResponseMessage(t *testing.T, name string, rcode layers.DNSResponseCode, ips ...net.IP) []byte {
+	dns := &layers.DNS{ID: 1, QR: true, OpCode: layers.DNSOpCodeQuery, RD: true, RA: true, ResponseCode: rcode,
+		Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}}
+	if len(ips) > 0 {
+		dns.Answers = append(dns.Answers, layers.DNSResourceRecord{Name: []byte(name), Type: layers.DNSTypeCNAME,
+			Class: layers.DNSClassIN, TTL: 60, CNAME: []byte("cdn.example.net")})
+	}
+	for _, ip := range ips {
+		dns.Answers = append(dns.Answers, layers.DNSResourceRecord{Name: []byte("cdn.example.net"),
+			Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: ip})
+	}
+	buffer := gopacket.NewSerializeBuffer()
+	assert.Nil(t, dns.SerializeTo(buffer, gopacket.SerializeOptions{FixLengths: true}))
+	return buffer.Bytes()
+}
+
+// udp packet from resolver 10.0.0.53 to client 10.0.0.1
+func dnsPacketData(t *testing.T, message []byte) []byte {
+	ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 53},
+		DstIP: net.IP{10, 0, 0, 1}}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 40000}
+	udp.SetNetworkLayerForChecksum(ip)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ethernet, ip, udp, gopacket.Payload(message))
+	assert.Nil(t, err)
+	return buffer.Bytes()
+}
+
+func TestDNSCorrelation(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: www.example.com\r\n\r\n"
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	for _, zeroCopy := range []bool{false, true} {
+		handler, sink := newTestHTTPHandler(&Config{})
+		handler.dns = newDNSResolver(handler.printer, "")
+		assembler := newTCPAssembler(handler, handler.printer)
+		assembler.dns = handler.dns
+
+		packets := [][]byte{
+			dnsPacketData(t, dnsResponseMessage(t, "WWW.example.com", layers.DNSResponseCodeNoErr,
+				net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 3})),
+			tcpPacketDataOf(t, 50000, true, 1000, 5000, request),
+			tcpPacketDataOf(t, 50000, false, 5000, 1000+uint32(len(request)), response),
+			tcpPacketDataOf(t, 50000, true, 1000+uint32(len(request)), 5000+uint32(len(response)), ""),
+		}
+		var segments chan *tcpSegment
+		if zeroCopy {
+			segments = zeroCopySegments(&reusedBufferSource{buffer: make([]byte, 65536), packets: packets},
+				layers.LinkTypeEthernet)
+		} else {
+			source := make(chan gopacket.Packet, len(packets))
+			for _, data := range packets {
+				source <- gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+			}
+			close(source)
+			segments = packetSegments(source)
+		}
+		capture(segments, assembler, time.Minute, nil)
+		assembler.finishAll()
+		waitGroup.Wait()
+
+		assert.Equal(t, 1, len(sink.exchanges))
+		assert.Equal(t, "www.example.com", sink.exchanges[0].resolvedName)
+		assert.Equal(t, "www.example.com", sink.exchanges[0].toProto().ResolvedName)
+		var lines []string
+		for len(handler.printer.outputQueue) > 0 {
+			if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[dns]") || strings.HasPrefix(msg, "[resolved]") {
+				lines = append(lines, msg)
+			}
+		}
+		assert.Equal(t, []string{
+			"[dns] 10.0.0.53 -> 10.0.0.1 www.example.com 10.0.0.2, 10.0.0.3\n",
+			"[resolved] 10.0.0.1:50000 -> 10.0.0.2:80 www.example.com\n",
+		}, lines)
+	}
+}
+
+func TestDNSMessage(t *testing.T) {
+	message := dnsResponseMessage(t, "example.com", layers.DNSResponseCodeNXDomain)
+	assert.Nil(t, dnsMessage(40000, 80, message, false))
+	assert.Equal(t, message, dnsMessage(53, 40000, message, false))
+
+	// dns over tcp has length prefix
+	var prefixed = make([]byte, 2, len(message)+2)
+	binary.BigEndian.PutUint16(prefixed, uint16(len(message)))
+	prefixed = append(prefixed, message...)
+	assert.Equal(t, message, dnsMessage(53, 40000, prefixed, true))
+	assert.Nil(t, dnsMessage(53, 40000, prefixed[:len(prefixed)-1], true))
+
+	answer, ok := parseDNSAnswer(message)
+	assert.True(t, ok)
+	assert.Equal(t, "[dns] 10.0.0.53 -> 10.0.0.1 example.com Non-Existent Domain\n",
+		answer.format("10.0.0.53", "10.0.0.1", ""))
+	assert.Equal(t, `{"dst":"10.0.0.1","ips":[],"name":"example.com","rcode":"Non-Existent Domain","src":"10.0.0.53","type":"dns"}`+"\n",
+		answer.format("10.0.0.53", "10.0.0.1", "json"))
+}
+
+// tcp traffic on port 53 is assembled as other tcp traffic when dns is not resolved
+func TestTCPPort53WithoutDNS(t *testing.T) {
+	// a request whose first two bytes "GE" are also the dns over tcp length prefix of the rest
+	head := "GET /"
+	tail := " HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	request := head + strings.Repeat("a", int(binary.BigEndian.Uint16([]byte("GE")))+2-len(head)-len(tail)) + tail
+	assert.NotNil(t, dnsMessage(53, 80, []byte(request), true))
+	packets := [][]byte{tcpPacketDataOf(t, 53, true, 1000, 5000, request)}
+	for _, zeroCopy := range []bool{false, true} {
+		var segments chan *tcpSegment
+		if zeroCopy {
+			segments = zeroCopySegments(&reusedBufferSource{buffer: make([]byte, 65536), packets: packets},
+				layers.LinkTypeEthernet)
+		} else {
+			source := make(chan gopacket.Packet, len(packets))
+			for _, data := range packets {
+				source <- gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+			}
+			close(source)
+			segments = packetSegments(source)
+		}
+		assembler, handler := newTestAssembler()
+		capture(segments, assembler, time.Minute, nil)
+		assert.Equal(t, 1, len(handler.connections), "zero copy %v", zeroCopy)
+	}
+}
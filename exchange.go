@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"httpdump/httpport"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exchange is the record of one http request and its response, passed to exchange sinks
+type Exchange struct {
+	key              ConnectionKey
+	index            int // 1-based index of exchange in the connection
+	method           string
+	url              string
+	host             string
+	proto            string   // protocol version of request, like HTTP/1.1
+	status           int      // 0 if response is not captured
+	requestHeaders   []string // raw header lines, in wire order
+	responseHeaders  []string
+	requestStart     time.Time
+	requestEnd       time.Time
+	responseStart    time.Time
+	responseEnd      time.Time
+	requestBodySize  int64
+	responseBodySize int64
+	// connection closed before body completed, body size is less than declared
+	requestBodyShort  bool
+	responseBodyShort bool
+	// body size of 206 Partial Content response differs from the range size in Content-Range
+	responseRangeMismatch bool
+	// reason of connection close, if exchange is not completed because connection closed
+	closeReason string
+	// request or response asks to close connection after exchange, by Connection: close or HTTP/1.0 without
+	// keep-alive
+	requestClose  bool
+	responseClose bool
+	// parsed Cookie and Set-Cookie headers, set only if cookie parsing is enabled
+	requestCookies  []cookieRecord
+	responseCookies []cookieRecord
+	// Link header values of 103 Early Hints responses preceding the final response
+	earlyHints []string
+	// canonical header map
+	requestHeader  httpport.Header
+	responseHeader httpport.Header
+	// keep header names as on wire in header fields, instead of canonicalize them
+	rawHeaderNames bool
+	// how header fields are represented in records
+	headerNormalization HeaderNormalization
+	// hash of request body, set only if duplicate suppression by body is enabled
+	requestBodyHash string
+	// fields and extracted files of multipart/form-data request, set only if file extraction is enabled
+	formFields []formField
+	uploads    []uploadedFile
+	// body does not match Content-MD5 or Digest headers, set only if digest verification is enabled
+	requestDigestMismatch  bool
+	responseDigestMismatch bool
+	// country and ASN of public src and dst ips, set only if geoip enrichment is enabled
+	srcGeo *geoInfo
+	dstGeo *geoInfo
+	// proxy hops in Forwarded or X-Forwarded-For headers, set only if forwarded parsing is enabled
+	forwardedHops []forwardedHop
+	// host name the dst ip was resolved from by captured dns responses, set only if dns capture is enabled
+	resolvedName string
+	// response body starts with a status line, responses of pipelined requests may be out of order
+	orderViolation bool
+	// http or https inferred from the first payload of connection, empty if unknown
+	scheme string
+	// capture time of the first packet of connection, tells apart connections reusing the same ports
+	connectionStart time.Time
+	// decoded request body, set only if a sink needs it
+	requestBodyData []byte
+	// decoded response body, set only if diff of repeated exchanges is enabled
+	responseBodyData []byte
+	// body data is transcoded to utf-8 from the charset of Content-Type
+	requestBodyTranscoded  bool
+	responseBodyTranscoded bool
+	// metrics of decoded bodies, set only if body stats is enabled and body is not empty
+	requestBodyStats  *bodyStats
+	responseBodyStats *bodyStats
+	// header and body bytes on wire, set only if message bytes is enabled
+	requestBytes  *messageBytes
+	responseBytes *messageBytes
+	// cacheability of response by a shared cache, set only if cache info is enabled and response is captured
+	cache *cacheInfo
+	// body decoded for inspection exceeded the decode limit, decoding stopped
+	requestCompressionBomb  bool
+	responseCompressionBomb bool
+	// local processes owning the sockets of src and dst, set only if process association is enabled
+	srcProcess *processInfo
+	dstProcess *processInfo
+
+	requestBody  *countReader
+	responseBody *countReader
+}
+
+// ExchangeSink receive exchange records. sinks are called from multiple connection goroutines
+type ExchangeSink interface {
+	write(exchange *Exchange) error
+	io.Closer
+}
+
+// create exchange when request header is parsed. request body is counted when it is read
+func newExchange(key ConnectionKey, index int, req *httpport.Request, stream *NetworkStream) *Exchange {
+	exchange := &Exchange{
+		key:            key,
+		index:          index,
+		method:         req.Method,
+		url:            req.RequestURI,
+		host:           req.Host,
+		proto:          req.Proto,
+		requestClose:   req.Close,
+		requestHeaders: req.RawHeaders,
+		requestHeader:  req.Header,
+		requestStart:   stream.lastTimestamp,
+		requestBody:    &countReader{ReadCloser: req.Body},
+	}
+	req.Body = exchange.requestBody
+	return exchange
+}
+
+// called when request body is read
+func (exchange *Exchange) requestDone(stream *NetworkStream) {
+	exchange.requestEnd = stream.lastTimestamp
+	exchange.requestBodySize = exchange.requestBody.count
+	exchange.requestBodyShort = exchange.requestBody.short
+}
+
+// set response when response header is parsed. response body is counted when it is read
+func (exchange *Exchange) setResponse(resp *httpport.Response, stream *NetworkStream) {
+	exchange.status = resp.StatusCode
+	exchange.responseClose = resp.Close
+	exchange.responseHeaders = resp.RawHeaders
+	exchange.responseHeader = resp.Header
+	exchange.responseStart = stream.lastTimestamp
+	exchange.responseBody = &countReader{ReadCloser: resp.Body}
+	resp.Body = exchange.responseBody
+}
+
+// keep preload hints of a 103 Early Hints response
+func (exchange *Exchange) addEarlyHints(resp *httpport.Response) {
+	exchange.earlyHints = append(exchange.earlyHints, resp.Header["Link"]...)
+}
+
+// called when response body is read
+func (exchange *Exchange) responseDone(stream *NetworkStream) {
+	exchange.responseEnd = stream.lastTimestamp
+	exchange.responseBodySize = exchange.responseBody.count
+	exchange.responseBodyShort = exchange.responseBody.short
+	if exchange.status == 206 && exchange.method != "HEAD" {
+		// body is only the requested range, not the full resource.
+		// multipart/byteranges body has no Content-Range header, and is not checked
+		if size, ok := contentRangeSize(exchange.responseHeader.Get("Content-Range")); ok {
+			exchange.responseRangeMismatch = exchange.responseBodySize != size
+		}
+	}
+}
+
+// size of range in Content-Range header, e.g. "bytes 0-499/1234" for 500 bytes
+func contentRangeSize(contentRange string) (int64, bool) {
+	contentRange = strings.TrimSpace(contentRange)
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, false
+	}
+	spec := strings.TrimSpace(contentRange[len("bytes "):])
+	if idx := strings.IndexByte(spec, '/'); idx >= 0 {
+		spec = spec[:idx]
+	}
+	idx := strings.IndexByte(spec, '-')
+	if idx < 0 {
+		// unsatisfied range, "bytes */1234"
+		return 0, false
+	}
+	first, err1 := strconv.ParseInt(spec[:idx], 10, 64)
+	last, err2 := strconv.ParseInt(spec[idx+1:], 10, 64)
+	if err1 != nil || err2 != nil || first < 0 || last < first {
+		return 0, false
+	}
+	return last - first + 1, true
+}
+
+// headerField is one header name and value, in wire order
+type headerField struct {
+	name  string
+	value string
+}
+
+// request headers in wire order, normalized by header normalization
+func (exchange *Exchange) requestHeaderFields() []headerField {
+	return normalizeHeaderFields(parseHeaderFields(exchange.requestHeaders, exchange.rawHeaderNames),
+		exchange.headerNormalization)
+}
+
+// response headers in wire order, normalized by header normalization
+func (exchange *Exchange) responseHeaderFields() []headerField {
+	return normalizeHeaderFields(parseHeaderFields(exchange.responseHeaders, exchange.rawHeaderNames),
+		exchange.headerNormalization)
+}
+
+// raw view of headers, one field per header line as on wire. nil if headers are not normalized
+func (exchange *Exchange) rawHeaderFields() (request []headerField, response []headerField) {
+	if exchange.headerNormalization == HeadersRaw {
+		return nil, nil
+	}
+	return parseHeaderFields(exchange.requestHeaders, exchange.rawHeaderNames),
+		parseHeaderFields(exchange.responseHeaders, exchange.rawHeaderNames)
+}
+
+// split raw header lines to fields. names are kept verbatim if raw is true, or else canonicalized
+func parseHeaderFields(rawHeaders []string, raw bool) []headerField {
+	var fields = make([]headerField, 0, len(rawHeaders))
+	for _, header := range rawHeaders {
+		idx := strings.IndexByte(header, ':')
+		if idx < 0 {
+			continue
+		}
+		name := header[:idx]
+		if !raw {
+			name = httpport.CanonicalHeaderKey(strings.TrimSpace(name))
+		}
+		fields = append(fields, headerField{name, strings.TrimSpace(header[idx+1:])})
+	}
+	return fields
+}
+
+// copy of header map, with values of headers in names replaced by ***. names should be lower cased
+func redactHeaderMap(header httpport.Header, names map[string]bool) httpport.Header {
+	if len(names) == 0 || header == nil {
+		return header
+	}
+	var redacted = make(httpport.Header, len(header))
+	for name, values := range header {
+		if names[strings.ToLower(name)] {
+			values = []string{"***"}
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// replace values of headers in names with ***. names should be lower cased
+func redactHeaders(rawHeaders []string, names map[string]bool) []string {
+	if len(names) == 0 {
+		return rawHeaders
+	}
+	var headers = make([]string, 0, len(rawHeaders))
+	for _, header := range rawHeaders {
+		idx := strings.IndexByte(header, ':')
+		if idx > 0 && names[strings.ToLower(strings.TrimSpace(header[:idx]))] {
+			header = header[:idx+1] + " ***"
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// IndexRange is a range of exchange index in connection, inclusive
+type IndexRange struct {
+	first int
+	last  int // 0 for unlimited
+}
+
+// parse index range like 3-5, 3-, -5 or 3
+func parseIndexRange(value string) (*IndexRange, error) {
+	var indexRange = &IndexRange{first: 1}
+	var err error
+	first, last := value, value
+	if strings.TrimSpace(value) == "-" {
+		return nil, fmt.Errorf("invalid exchange index range: %s", value)
+	}
+	if idx := strings.IndexByte(value, '-'); idx >= 0 {
+		first, last = value[:idx], value[idx+1:]
+	}
+	if first = strings.TrimSpace(first); first != "" {
+		if indexRange.first, err = strconv.Atoi(first); err != nil || indexRange.first < 1 {
+			return nil, fmt.Errorf("invalid exchange index range: %s", value)
+		}
+	}
+	if last = strings.TrimSpace(last); last != "" {
+		if indexRange.last, err = strconv.Atoi(last); err != nil || indexRange.last < indexRange.first {
+			return nil, fmt.Errorf("invalid exchange index range: %s", value)
+		}
+	}
+	return indexRange, nil
+}
+
+// if index is in the range. nil range contains all index
+func (indexRange *IndexRange) contains(index int) bool {
+	if indexRange == nil {
+		return true
+	}
+	return index >= indexRange.first && (indexRange.last == 0 || index <= indexRange.last)
+}
+
+// countReader count bytes read from the underlying body reader
+type countReader struct {
+	io.ReadCloser
+	count int64
+	short bool // body reader reach EOF before declared length
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.count += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		r.short = true
+	}
+	return n, err
+}
@@ -0,0 +1,1458 @@
+// Protobuf schema for exchange records, used by protobuf output.
+// Regenerate exchange.pb.go by: protoc --go_out=. --go_opt=paths=source_relative exchange.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        v3.21.12
+// source: exchange.proto
+
+package main
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// HeaderField is one http header line
+type HeaderField struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (x *HeaderField) Reset() {
+	*x = HeaderField{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HeaderField) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeaderField) ProtoMessage() {}
+
+func (x *HeaderField) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeaderField.ProtoReflect.Descriptor instead.
+func (*HeaderField) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *HeaderField) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *HeaderField) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+// UploadedFile is a file part of multipart/form-data request, extracted to disk
+type UploadedFile struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Field       string `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Filename    string `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"` // filename declared in request
+	ContentType string `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Path        string `protobuf:"bytes,4,opt,name=path,proto3" json:"path,omitempty"` // path of extracted file, empty if not written because of size cap
+	Size        int64  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	Truncated   bool   `protobuf:"varint,6,opt,name=truncated,proto3" json:"truncated,omitempty"` // only part of file is written because of size cap
+}
+
+func (x *UploadedFile) Reset() {
+	*x = UploadedFile{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UploadedFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadedFile) ProtoMessage() {}
+
+func (x *UploadedFile) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadedFile.ProtoReflect.Descriptor instead.
+func (*UploadedFile) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UploadedFile) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *UploadedFile) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *UploadedFile) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *UploadedFile) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *UploadedFile) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *UploadedFile) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+// Cookie is a cookie of Cookie or Set-Cookie header. attributes are only set for Set-Cookie
+type Cookie struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name     string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value    string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Path     string `protobuf:"bytes,3,opt,name=path,proto3" json:"path,omitempty"`
+	Domain   string `protobuf:"bytes,4,opt,name=domain,proto3" json:"domain,omitempty"`
+	Expires  string `protobuf:"bytes,5,opt,name=expires,proto3" json:"expires,omitempty"`              // as in header
+	MaxAge   int32  `protobuf:"varint,6,opt,name=max_age,json=maxAge,proto3" json:"max_age,omitempty"` // 0 for not set, -1 for delete cookie now
+	Secure   bool   `protobuf:"varint,7,opt,name=secure,proto3" json:"secure,omitempty"`
+	HttpOnly bool   `protobuf:"varint,8,opt,name=http_only,json=httpOnly,proto3" json:"http_only,omitempty"`
+	SameSite string `protobuf:"bytes,9,opt,name=same_site,json=sameSite,proto3" json:"same_site,omitempty"`
+}
+
+func (x *Cookie) Reset() {
+	*x = Cookie{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Cookie) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Cookie) ProtoMessage() {}
+
+func (x *Cookie) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Cookie.ProtoReflect.Descriptor instead.
+func (*Cookie) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Cookie) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Cookie) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *Cookie) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Cookie) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *Cookie) GetExpires() string {
+	if x != nil {
+		return x.Expires
+	}
+	return ""
+}
+
+func (x *Cookie) GetMaxAge() int32 {
+	if x != nil {
+		return x.MaxAge
+	}
+	return 0
+}
+
+func (x *Cookie) GetSecure() bool {
+	if x != nil {
+		return x.Secure
+	}
+	return false
+}
+
+func (x *Cookie) GetHttpOnly() bool {
+	if x != nil {
+		return x.HttpOnly
+	}
+	return false
+}
+
+func (x *Cookie) GetSameSite() string {
+	if x != nil {
+		return x.SameSite
+	}
+	return ""
+}
+
+// GeoInfo is country and autonomous system of an ip, from MaxMind DB
+type GeoInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Country      string `protobuf:"bytes,1,opt,name=country,proto3" json:"country,omitempty"` // ISO 3166-1 country code
+	Asn          uint32 `protobuf:"varint,2,opt,name=asn,proto3" json:"asn,omitempty"`
+	Organization string `protobuf:"bytes,3,opt,name=organization,proto3" json:"organization,omitempty"`
+}
+
+func (x *GeoInfo) Reset() {
+	*x = GeoInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GeoInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GeoInfo) ProtoMessage() {}
+
+func (x *GeoInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GeoInfo.ProtoReflect.Descriptor instead.
+func (*GeoInfo) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GeoInfo) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *GeoInfo) GetAsn() uint32 {
+	if x != nil {
+		return x.Asn
+	}
+	return 0
+}
+
+func (x *GeoInfo) GetOrganization() string {
+	if x != nil {
+		return x.Organization
+	}
+	return ""
+}
+
+// ForwardedHop is a proxy hop in Forwarded or X-Forwarded-For header
+type ForwardedHop struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	For   string `protobuf:"bytes,1,opt,name=for,proto3" json:"for,omitempty"`     // client of the hop
+	By    string `protobuf:"bytes,2,opt,name=by,proto3" json:"by,omitempty"`       // only in Forwarded
+	Proto string `protobuf:"bytes,3,opt,name=proto,proto3" json:"proto,omitempty"` // only in Forwarded
+	Host  string `protobuf:"bytes,4,opt,name=host,proto3" json:"host,omitempty"`   // only in Forwarded
+}
+
+func (x *ForwardedHop) Reset() {
+	*x = ForwardedHop{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ForwardedHop) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForwardedHop) ProtoMessage() {}
+
+func (x *ForwardedHop) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForwardedHop.ProtoReflect.Descriptor instead.
+func (*ForwardedHop) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ForwardedHop) GetFor() string {
+	if x != nil {
+		return x.For
+	}
+	return ""
+}
+
+func (x *ForwardedHop) GetBy() string {
+	if x != nil {
+		return x.By
+	}
+	return ""
+}
+
+func (x *ForwardedHop) GetProto() string {
+	if x != nil {
+		return x.Proto
+	}
+	return ""
+}
+
+func (x *ForwardedHop) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+type BodyStats struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Bytes    int64 `protobuf:"varint,1,opt,name=bytes,proto3" json:"bytes,omitempty"` // size after content-encoding decoded
+	Lines    int64 `protobuf:"varint,2,opt,name=lines,proto3" json:"lines,omitempty"`
+	JsonKeys int32 `protobuf:"varint,3,opt,name=json_keys,json=jsonKeys,proto3" json:"json_keys,omitempty"` // keys of top level json object, -1 if body is not a json object
+}
+
+func (x *BodyStats) Reset() {
+	*x = BodyStats{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BodyStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BodyStats) ProtoMessage() {}
+
+func (x *BodyStats) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BodyStats.ProtoReflect.Descriptor instead.
+func (*BodyStats) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BodyStats) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *BodyStats) GetLines() int64 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+func (x *BodyStats) GetJsonKeys() int32 {
+	if x != nil {
+		return x.JsonKeys
+	}
+	return 0
+}
+
+type MessageBytes struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Header int64 `protobuf:"varint,1,opt,name=header,proto3" json:"header,omitempty"` // start line, header lines and the blank line
+	Body   int64 `protobuf:"varint,2,opt,name=body,proto3" json:"body,omitempty"`
+}
+
+func (x *MessageBytes) Reset() {
+	*x = MessageBytes{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MessageBytes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageBytes) ProtoMessage() {}
+
+func (x *MessageBytes) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageBytes.ProtoReflect.Descriptor instead.
+func (*MessageBytes) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *MessageBytes) GetHeader() int64 {
+	if x != nil {
+		return x.Header
+	}
+	return 0
+}
+
+func (x *MessageBytes) GetBody() int64 {
+	if x != nil {
+		return x.Body
+	}
+	return 0
+}
+
+type CacheInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Cacheable bool   `protobuf:"varint,1,opt,name=cacheable,proto3" json:"cacheable,omitempty"`
+	MaxAge    int64  `protobuf:"varint,2,opt,name=max_age,json=maxAge,proto3" json:"max_age,omitempty"` // freshness lifetime in seconds
+	Heuristic bool   `protobuf:"varint,3,opt,name=heuristic,proto3" json:"heuristic,omitempty"`         // max_age is estimated from Last-Modified
+	Validator bool   `protobuf:"varint,4,opt,name=validator,proto3" json:"validator,omitempty"`         // has ETag or Last-Modified
+	Reason    string `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`                // why not cacheable: method | status | no-store | private | authorization | no-freshness
+}
+
+func (x *CacheInfo) Reset() {
+	*x = CacheInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CacheInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheInfo) ProtoMessage() {}
+
+func (x *CacheInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheInfo.ProtoReflect.Descriptor instead.
+func (*CacheInfo) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CacheInfo) GetCacheable() bool {
+	if x != nil {
+		return x.Cacheable
+	}
+	return false
+}
+
+func (x *CacheInfo) GetMaxAge() int64 {
+	if x != nil {
+		return x.MaxAge
+	}
+	return 0
+}
+
+func (x *CacheInfo) GetHeuristic() bool {
+	if x != nil {
+		return x.Heuristic
+	}
+	return false
+}
+
+func (x *CacheInfo) GetValidator() bool {
+	if x != nil {
+		return x.Validator
+	}
+	return false
+}
+
+func (x *CacheInfo) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// ProcessInfo is the local process owning the socket of an endpoint
+type ProcessInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pid  int32  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"` // command name
+}
+
+func (x *ProcessInfo) Reset() {
+	*x = ProcessInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProcessInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessInfo) ProtoMessage() {}
+
+func (x *ProcessInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessInfo.ProtoReflect.Descriptor instead.
+func (*ProcessInfo) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ProcessInfo) GetPid() int32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *ProcessInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// ExchangeRecord is one http request and its response
+type ExchangeRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Src             string         `protobuf:"bytes,1,opt,name=src,proto3" json:"src,omitempty"` // client ip:port
+	Dst             string         `protobuf:"bytes,2,opt,name=dst,proto3" json:"dst,omitempty"` // server ip:port
+	Method          string         `protobuf:"bytes,3,opt,name=method,proto3" json:"method,omitempty"`
+	Url             string         `protobuf:"bytes,4,opt,name=url,proto3" json:"url,omitempty"`
+	Host            string         `protobuf:"bytes,5,opt,name=host,proto3" json:"host,omitempty"`
+	Status          int32          `protobuf:"varint,6,opt,name=status,proto3" json:"status,omitempty"` // 0 if response is not captured
+	RequestHeaders  []*HeaderField `protobuf:"bytes,7,rep,name=request_headers,json=requestHeaders,proto3" json:"request_headers,omitempty"`
+	ResponseHeaders []*HeaderField `protobuf:"bytes,8,rep,name=response_headers,json=responseHeaders,proto3" json:"response_headers,omitempty"`
+	// capture timestamps, as unix nano seconds
+	RequestStart     int64 `protobuf:"varint,9,opt,name=request_start,json=requestStart,proto3" json:"request_start,omitempty"`
+	RequestEnd       int64 `protobuf:"varint,10,opt,name=request_end,json=requestEnd,proto3" json:"request_end,omitempty"`
+	ResponseStart    int64 `protobuf:"varint,11,opt,name=response_start,json=responseStart,proto3" json:"response_start,omitempty"`
+	ResponseEnd      int64 `protobuf:"varint,12,opt,name=response_end,json=responseEnd,proto3" json:"response_end,omitempty"`
+	RequestBodySize  int64 `protobuf:"varint,13,opt,name=request_body_size,json=requestBodySize,proto3" json:"request_body_size,omitempty"`
+	ResponseBodySize int64 `protobuf:"varint,14,opt,name=response_body_size,json=responseBodySize,proto3" json:"response_body_size,omitempty"`
+	// body is shorter than declared, because connection closed before body completed
+	RequestBodyShort  bool `protobuf:"varint,15,opt,name=request_body_short,json=requestBodyShort,proto3" json:"request_body_short,omitempty"`
+	ResponseBodyShort bool `protobuf:"varint,16,opt,name=response_body_short,json=responseBodyShort,proto3" json:"response_body_short,omitempty"`
+	// Link header values of 103 Early Hints responses preceding the final response
+	EarlyHints []string `protobuf:"bytes,17,rep,name=early_hints,json=earlyHints,proto3" json:"early_hints,omitempty"`
+	// non-file fields and file parts of multipart/form-data request, if file extraction is enabled
+	FormFields []*HeaderField  `protobuf:"bytes,18,rep,name=form_fields,json=formFields,proto3" json:"form_fields,omitempty"`
+	Uploads    []*UploadedFile `protobuf:"bytes,19,rep,name=uploads,proto3" json:"uploads,omitempty"`
+	// body does not match Content-MD5 or Digest headers, if digest verification is enabled
+	RequestDigestMismatch  bool `protobuf:"varint,20,opt,name=request_digest_mismatch,json=requestDigestMismatch,proto3" json:"request_digest_mismatch,omitempty"`
+	ResponseDigestMismatch bool `protobuf:"varint,21,opt,name=response_digest_mismatch,json=responseDigestMismatch,proto3" json:"response_digest_mismatch,omitempty"`
+	// body size of 206 Partial Content response differs from the range size in Content-Range
+	ResponseRangeMismatch bool `protobuf:"varint,22,opt,name=response_range_mismatch,json=responseRangeMismatch,proto3" json:"response_range_mismatch,omitempty"`
+	// fin | rst | idle | max-lifetime | capture-end, if exchange is not completed because connection closed
+	CloseReason string `protobuf:"bytes,23,opt,name=close_reason,json=closeReason,proto3" json:"close_reason,omitempty"`
+	// parsed Cookie and Set-Cookie headers, if cookie parsing is enabled
+	RequestCookies  []*Cookie `protobuf:"bytes,24,rep,name=request_cookies,json=requestCookies,proto3" json:"request_cookies,omitempty"`
+	ResponseCookies []*Cookie `protobuf:"bytes,25,rep,name=response_cookies,json=responseCookies,proto3" json:"response_cookies,omitempty"`
+	// country and ASN of public src and dst ips, if geoip enrichment is enabled
+	SrcGeo *GeoInfo `protobuf:"bytes,26,opt,name=src_geo,json=srcGeo,proto3" json:"src_geo,omitempty"`
+	DstGeo *GeoInfo `protobuf:"bytes,27,opt,name=dst_geo,json=dstGeo,proto3" json:"dst_geo,omitempty"`
+	// proxy hops in Forwarded or X-Forwarded-For headers, the originating client first, if forwarded parsing is enabled
+	ForwardedHops []*ForwardedHop `protobuf:"bytes,28,rep,name=forwarded_hops,json=forwardedHops,proto3" json:"forwarded_hops,omitempty"`
+	// host name the dst ip was resolved from by captured dns responses, if dns capture is enabled
+	ResolvedName string `protobuf:"bytes,29,opt,name=resolved_name,json=resolvedName,proto3" json:"resolved_name,omitempty"`
+	// metrics of decoded bodies, if body stats is enabled and body is not empty
+	RequestBodyStats  *BodyStats `protobuf:"bytes,30,opt,name=request_body_stats,json=requestBodyStats,proto3" json:"request_body_stats,omitempty"`
+	ResponseBodyStats *BodyStats `protobuf:"bytes,31,opt,name=response_body_stats,json=responseBodyStats,proto3" json:"response_body_stats,omitempty"`
+	// response body starts with a status line, responses of pipelined requests may be out of order
+	OrderViolation bool `protobuf:"varint,32,opt,name=order_violation,json=orderViolation,proto3" json:"order_violation,omitempty"`
+	// http or https inferred from the first bytes of connection regardless of port, empty if unknown
+	Scheme string `protobuf:"bytes,33,opt,name=scheme,proto3" json:"scheme,omitempty"`
+	// bytes on wire of header block and body including chunk framing, if message bytes is enabled
+	RequestBytes  *MessageBytes `protobuf:"bytes,34,opt,name=request_bytes,json=requestBytes,proto3" json:"request_bytes,omitempty"`
+	ResponseBytes *MessageBytes `protobuf:"bytes,35,opt,name=response_bytes,json=responseBytes,proto3" json:"response_bytes,omitempty"`
+	// cacheability of response by a shared cache, if cache info is enabled and response is captured
+	Cache *CacheInfo `protobuf:"bytes,36,opt,name=cache,proto3" json:"cache,omitempty"`
+	// body decoded for inspection exceeded the decode ratio or size limit, a potential compression bomb
+	RequestCompressionBomb  bool `protobuf:"varint,37,opt,name=request_compression_bomb,json=requestCompressionBomb,proto3" json:"request_compression_bomb,omitempty"`
+	ResponseCompressionBomb bool `protobuf:"varint,38,opt,name=response_compression_bomb,json=responseCompressionBomb,proto3" json:"response_compression_bomb,omitempty"`
+	// local processes owning the sockets of src and dst, if process association is enabled and found
+	SrcProcess *ProcessInfo `protobuf:"bytes,39,opt,name=src_process,json=srcProcess,proto3" json:"src_process,omitempty"`
+	DstProcess *ProcessInfo `protobuf:"bytes,40,opt,name=dst_process,json=dstProcess,proto3" json:"dst_process,omitempty"`
+	// header lines as on wire, if headers are normalized
+	RawRequestHeaders  []*HeaderField `protobuf:"bytes,41,rep,name=raw_request_headers,json=rawRequestHeaders,proto3" json:"raw_request_headers,omitempty"`
+	RawResponseHeaders []*HeaderField `protobuf:"bytes,42,rep,name=raw_response_headers,json=rawResponseHeaders,proto3" json:"raw_response_headers,omitempty"`
+}
+
+func (x *ExchangeRecord) Reset() {
+	*x = ExchangeRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_exchange_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExchangeRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExchangeRecord) ProtoMessage() {}
+
+func (x *ExchangeRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_exchange_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExchangeRecord.ProtoReflect.Descriptor instead.
+func (*ExchangeRecord) Descriptor() ([]byte, []int) {
+	return file_exchange_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ExchangeRecord) GetSrc() string {
+	if x != nil {
+		return x.Src
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetDst() string {
+	if x != nil {
+		return x.Dst
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *ExchangeRecord) GetRequestHeaders() []*HeaderField {
+	if x != nil {
+		return x.RequestHeaders
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetResponseHeaders() []*HeaderField {
+	if x != nil {
+		return x.ResponseHeaders
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetRequestStart() int64 {
+	if x != nil {
+		return x.RequestStart
+	}
+	return 0
+}
+
+func (x *ExchangeRecord) GetRequestEnd() int64 {
+	if x != nil {
+		return x.RequestEnd
+	}
+	return 0
+}
+
+func (x *ExchangeRecord) GetResponseStart() int64 {
+	if x != nil {
+		return x.ResponseStart
+	}
+	return 0
+}
+
+func (x *ExchangeRecord) GetResponseEnd() int64 {
+	if x != nil {
+		return x.ResponseEnd
+	}
+	return 0
+}
+
+func (x *ExchangeRecord) GetRequestBodySize() int64 {
+	if x != nil {
+		return x.RequestBodySize
+	}
+	return 0
+}
+
+func (x *ExchangeRecord) GetResponseBodySize() int64 {
+	if x != nil {
+		return x.ResponseBodySize
+	}
+	return 0
+}
+
+func (x *ExchangeRecord) GetRequestBodyShort() bool {
+	if x != nil {
+		return x.RequestBodyShort
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetResponseBodyShort() bool {
+	if x != nil {
+		return x.ResponseBodyShort
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetEarlyHints() []string {
+	if x != nil {
+		return x.EarlyHints
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetFormFields() []*HeaderField {
+	if x != nil {
+		return x.FormFields
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetUploads() []*UploadedFile {
+	if x != nil {
+		return x.Uploads
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetRequestDigestMismatch() bool {
+	if x != nil {
+		return x.RequestDigestMismatch
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetResponseDigestMismatch() bool {
+	if x != nil {
+		return x.ResponseDigestMismatch
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetResponseRangeMismatch() bool {
+	if x != nil {
+		return x.ResponseRangeMismatch
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetCloseReason() string {
+	if x != nil {
+		return x.CloseReason
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetRequestCookies() []*Cookie {
+	if x != nil {
+		return x.RequestCookies
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetResponseCookies() []*Cookie {
+	if x != nil {
+		return x.ResponseCookies
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetSrcGeo() *GeoInfo {
+	if x != nil {
+		return x.SrcGeo
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetDstGeo() *GeoInfo {
+	if x != nil {
+		return x.DstGeo
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetForwardedHops() []*ForwardedHop {
+	if x != nil {
+		return x.ForwardedHops
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetResolvedName() string {
+	if x != nil {
+		return x.ResolvedName
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetRequestBodyStats() *BodyStats {
+	if x != nil {
+		return x.RequestBodyStats
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetResponseBodyStats() *BodyStats {
+	if x != nil {
+		return x.ResponseBodyStats
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetOrderViolation() bool {
+	if x != nil {
+		return x.OrderViolation
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetScheme() string {
+	if x != nil {
+		return x.Scheme
+	}
+	return ""
+}
+
+func (x *ExchangeRecord) GetRequestBytes() *MessageBytes {
+	if x != nil {
+		return x.RequestBytes
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetResponseBytes() *MessageBytes {
+	if x != nil {
+		return x.ResponseBytes
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetCache() *CacheInfo {
+	if x != nil {
+		return x.Cache
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetRequestCompressionBomb() bool {
+	if x != nil {
+		return x.RequestCompressionBomb
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetResponseCompressionBomb() bool {
+	if x != nil {
+		return x.ResponseCompressionBomb
+	}
+	return false
+}
+
+func (x *ExchangeRecord) GetSrcProcess() *ProcessInfo {
+	if x != nil {
+		return x.SrcProcess
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetDstProcess() *ProcessInfo {
+	if x != nil {
+		return x.DstProcess
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetRawRequestHeaders() []*HeaderField {
+	if x != nil {
+		return x.RawRequestHeaders
+	}
+	return nil
+}
+
+func (x *ExchangeRecord) GetRawResponseHeaders() []*HeaderField {
+	if x != nil {
+		return x.RawResponseHeaders
+	}
+	return nil
+}
+
+var File_exchange_proto protoreflect.FileDescriptor
+
+var file_exchange_proto_rawDesc = []byte{
+	0x0a, 0x0e, 0x65, 0x78, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x12, 0x08, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x22, 0x37, 0x0a, 0x0b, 0x48, 0x65,
+	0x61, 0x64, 0x65, 0x72, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x22, 0xa9, 0x01, 0x0a, 0x0c, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x65, 0x64,
+	0x46, 0x69, 0x6c, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x69,
+	0x6c, 0x65, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x66, 0x69,
+	0x6c, 0x65, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e,
+	0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f,
+	0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74,
+	0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x12, 0x0a,
+	0x04, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x73, 0x69, 0x7a,
+	0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x22,
+	0xe3, 0x01, 0x0a, 0x06, 0x43, 0x6f, 0x6f, 0x6b, 0x69, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14,
+	0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x64, 0x6f, 0x6d, 0x61,
+	0x69, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x6f, 0x6d, 0x61, 0x69, 0x6e,
+	0x12, 0x18, 0x0a, 0x07, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x12, 0x17, 0x0a, 0x07, 0x6d, 0x61,
+	0x78, 0x5f, 0x61, 0x67, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x6d, 0x61, 0x78,
+	0x41, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x63, 0x75, 0x72, 0x65, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x06, 0x73, 0x65, 0x63, 0x75, 0x72, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x68,
+	0x74, 0x74, 0x70, 0x5f, 0x6f, 0x6e, 0x6c, 0x79, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08,
+	0x68, 0x74, 0x74, 0x70, 0x4f, 0x6e, 0x6c, 0x79, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x61, 0x6d, 0x65,
+	0x5f, 0x73, 0x69, 0x74, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x61, 0x6d,
+	0x65, 0x53, 0x69, 0x74, 0x65, 0x22, 0x59, 0x0a, 0x07, 0x47, 0x65, 0x6f, 0x49, 0x6e, 0x66, 0x6f,
+	0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x61, 0x73,
+	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x61, 0x73, 0x6e, 0x12, 0x22, 0x0a, 0x0c,
+	0x6f, 0x72, 0x67, 0x61, 0x6e, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0c, 0x6f, 0x72, 0x67, 0x61, 0x6e, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x22, 0x5a, 0x0a, 0x0c, 0x46, 0x6f, 0x72, 0x77, 0x61, 0x72, 0x64, 0x65, 0x64, 0x48, 0x6f, 0x70,
+	0x12, 0x10, 0x0a, 0x03, 0x66, 0x6f, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x66,
+	0x6f, 0x72, 0x12, 0x0e, 0x0a, 0x02, 0x62, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
+	0x62, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x22, 0x54, 0x0a, 0x09,
+	0x42, 0x6f, 0x64, 0x79, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x79, 0x74,
+	0x65, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x12,
+	0x14, 0x0a, 0x05, 0x6c, 0x69, 0x6e, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05,
+	0x6c, 0x69, 0x6e, 0x65, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x6a, 0x73, 0x6f, 0x6e, 0x5f, 0x6b, 0x65,
+	0x79, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x6a, 0x73, 0x6f, 0x6e, 0x4b, 0x65,
+	0x79, 0x73, 0x22, 0x3a, 0x0a, 0x0c, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x42, 0x79, 0x74,
+	0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x6f,
+	0x64, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x22, 0x96,
+	0x01, 0x0a, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1c, 0x0a, 0x09,
+	0x63, 0x61, 0x63, 0x68, 0x65, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x09, 0x63, 0x61, 0x63, 0x68, 0x65, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x6d, 0x61,
+	0x78, 0x5f, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6d, 0x61, 0x78,
+	0x41, 0x67, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x68, 0x65, 0x75, 0x72, 0x69, 0x73, 0x74, 0x69, 0x63,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x68, 0x65, 0x75, 0x72, 0x69, 0x73, 0x74, 0x69,
+	0x63, 0x12, 0x1c, 0x0a, 0x09, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x6f, 0x72, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x6f, 0x72, 0x12,
+	0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x33, 0x0a, 0x0b, 0x50, 0x72, 0x6f, 0x63, 0x65,
+	0x73, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0xc6, 0x0f, 0x0a,
+	0x0e, 0x45, 0x78, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12,
+	0x10, 0x0a, 0x03, 0x73, 0x72, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x72,
+	0x63, 0x12, 0x10, 0x0a, 0x03, 0x64, 0x73, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
+	0x64, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x75,
+	0x72, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x12, 0x12, 0x0a,
+	0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x6f, 0x73,
+	0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x3e, 0x0a, 0x0f, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x07, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x15, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x48, 0x65,
+	0x61, 0x64, 0x65, 0x72, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x0e, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x40, 0x0a, 0x10, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x08, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x48,
+	0x65, 0x61, 0x64, 0x65, 0x72, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x0f, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x72,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x0c, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x53, 0x74, 0x61, 0x72, 0x74,
+	0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x65, 0x6e, 0x64, 0x18,
+	0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x45, 0x6e,
+	0x64, 0x12, 0x25, 0x0a, 0x0e, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x73, 0x74,
+	0x61, 0x72, 0x74, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x65, 0x6e, 0x64, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b,
+	0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x45, 0x6e, 0x64, 0x12, 0x2a, 0x0a, 0x11, 0x72,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x5f, 0x73, 0x69, 0x7a, 0x65,
+	0x18, 0x0d, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x42,
+	0x6f, 0x64, 0x79, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x2c, 0x0a, 0x12, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x0e, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x10, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x6f, 0x64,
+	0x79, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x2c, 0x0a, 0x12, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x5f, 0x62, 0x6f, 0x64, 0x79, 0x5f, 0x73, 0x68, 0x6f, 0x72, 0x74, 0x18, 0x0f, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x10, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x42, 0x6f, 0x64, 0x79, 0x53, 0x68,
+	0x6f, 0x72, 0x74, 0x12, 0x2e, 0x0a, 0x13, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f,
+	0x62, 0x6f, 0x64, 0x79, 0x5f, 0x73, 0x68, 0x6f, 0x72, 0x74, 0x18, 0x10, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x11, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x53, 0x68,
+	0x6f, 0x72, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x61, 0x72, 0x6c, 0x79, 0x5f, 0x68, 0x69, 0x6e,
+	0x74, 0x73, 0x18, 0x11, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x65, 0x61, 0x72, 0x6c, 0x79, 0x48,
+	0x69, 0x6e, 0x74, 0x73, 0x12, 0x36, 0x0a, 0x0b, 0x66, 0x6f, 0x72, 0x6d, 0x5f, 0x66, 0x69, 0x65,
+	0x6c, 0x64, 0x73, 0x18, 0x12, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x68, 0x74, 0x74, 0x70,
+	0x64, 0x75, 0x6d, 0x70, 0x2e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x46, 0x69, 0x65, 0x6c, 0x64,
+	0x52, 0x0a, 0x66, 0x6f, 0x72, 0x6d, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12, 0x30, 0x0a, 0x07,
+	0x75, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x73, 0x18, 0x13, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e,
+	0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x65,
+	0x64, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x07, 0x75, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x73, 0x12, 0x36,
+	0x0a, 0x17, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74,
+	0x5f, 0x6d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x18, 0x14, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x15, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x4d, 0x69,
+	0x73, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x12, 0x38, 0x0a, 0x18, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x5f, 0x6d, 0x69, 0x73, 0x6d, 0x61, 0x74,
+	0x63, 0x68, 0x18, 0x15, 0x20, 0x01, 0x28, 0x08, 0x52, 0x16, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x4d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68,
+	0x12, 0x36, 0x0a, 0x17, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x72, 0x61, 0x6e,
+	0x67, 0x65, 0x5f, 0x6d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x18, 0x16, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x15, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x61, 0x6e, 0x67, 0x65,
+	0x4d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6c, 0x6f, 0x73,
+	0x65, 0x5f, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x17, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b,
+	0x63, 0x6c, 0x6f, 0x73, 0x65, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x39, 0x0a, 0x0f, 0x72,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x63, 0x6f, 0x6f, 0x6b, 0x69, 0x65, 0x73, 0x18, 0x18,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e,
+	0x43, 0x6f, 0x6f, 0x6b, 0x69, 0x65, 0x52, 0x0e, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x43,
+	0x6f, 0x6f, 0x6b, 0x69, 0x65, 0x73, 0x12, 0x3b, 0x0a, 0x10, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x5f, 0x63, 0x6f, 0x6f, 0x6b, 0x69, 0x65, 0x73, 0x18, 0x19, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x10, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x43, 0x6f, 0x6f, 0x6b,
+	0x69, 0x65, 0x52, 0x0f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x6f, 0x6b,
+	0x69, 0x65, 0x73, 0x12, 0x2a, 0x0a, 0x07, 0x73, 0x72, 0x63, 0x5f, 0x67, 0x65, 0x6f, 0x18, 0x1a,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e,
+	0x47, 0x65, 0x6f, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x06, 0x73, 0x72, 0x63, 0x47, 0x65, 0x6f, 0x12,
+	0x2a, 0x0a, 0x07, 0x64, 0x73, 0x74, 0x5f, 0x67, 0x65, 0x6f, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x11, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x47, 0x65, 0x6f, 0x49,
+	0x6e, 0x66, 0x6f, 0x52, 0x06, 0x64, 0x73, 0x74, 0x47, 0x65, 0x6f, 0x12, 0x3d, 0x0a, 0x0e, 0x66,
+	0x6f, 0x72, 0x77, 0x61, 0x72, 0x64, 0x65, 0x64, 0x5f, 0x68, 0x6f, 0x70, 0x73, 0x18, 0x1c, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x46,
+	0x6f, 0x72, 0x77, 0x61, 0x72, 0x64, 0x65, 0x64, 0x48, 0x6f, 0x70, 0x52, 0x0d, 0x66, 0x6f, 0x72,
+	0x77, 0x61, 0x72, 0x64, 0x65, 0x64, 0x48, 0x6f, 0x70, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x72, 0x65,
+	0x73, 0x6f, 0x6c, 0x76, 0x65, 0x64, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x1d, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x64, 0x4e, 0x61, 0x6d, 0x65, 0x12,
+	0x41, 0x0a, 0x12, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x5f,
+	0x73, 0x74, 0x61, 0x74, 0x73, 0x18, 0x1e, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x68, 0x74,
+	0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x42, 0x6f, 0x64, 0x79, 0x53, 0x74, 0x61, 0x74, 0x73,
+	0x52, 0x10, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x42, 0x6f, 0x64, 0x79, 0x53, 0x74, 0x61,
+	0x74, 0x73, 0x12, 0x43, 0x0a, 0x13, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x62,
+	0x6f, 0x64, 0x79, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x73, 0x18, 0x1f, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x13, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x42, 0x6f, 0x64, 0x79, 0x53,
+	0x74, 0x61, 0x74, 0x73, 0x52, 0x11, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x6f,
+	0x64, 0x79, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x6f, 0x72, 0x64, 0x65, 0x72,
+	0x5f, 0x76, 0x69, 0x6f, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x20, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x0e, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x56, 0x69, 0x6f, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x16, 0x0a, 0x06, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x18, 0x21, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x12, 0x3b, 0x0a, 0x0d, 0x72, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x22, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x42, 0x79, 0x74, 0x65, 0x73, 0x52, 0x0c, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x3d, 0x0a, 0x0e, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x23, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e,
+	0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x42, 0x79, 0x74, 0x65, 0x73, 0x52, 0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42,
+	0x79, 0x74, 0x65, 0x73, 0x12, 0x29, 0x0a, 0x05, 0x63, 0x61, 0x63, 0x68, 0x65, 0x18, 0x24, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x43,
+	0x61, 0x63, 0x68, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x05, 0x63, 0x61, 0x63, 0x68, 0x65, 0x12,
+	0x38, 0x0a, 0x18, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x63, 0x6f, 0x6d, 0x70, 0x72,
+	0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x5f, 0x62, 0x6f, 0x6d, 0x62, 0x18, 0x25, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x16, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x42, 0x6f, 0x6d, 0x62, 0x12, 0x3a, 0x0a, 0x19, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f,
+	0x6e, 0x5f, 0x62, 0x6f, 0x6d, 0x62, 0x18, 0x26, 0x20, 0x01, 0x28, 0x08, 0x52, 0x17, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f,
+	0x6e, 0x42, 0x6f, 0x6d, 0x62, 0x12, 0x36, 0x0a, 0x0b, 0x73, 0x72, 0x63, 0x5f, 0x70, 0x72, 0x6f,
+	0x63, 0x65, 0x73, 0x73, 0x18, 0x27, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x68, 0x74, 0x74,
+	0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x49, 0x6e, 0x66,
+	0x6f, 0x52, 0x0a, 0x73, 0x72, 0x63, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x12, 0x36, 0x0a,
+	0x0b, 0x64, 0x73, 0x74, 0x5f, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x18, 0x28, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x15, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x50, 0x72,
+	0x6f, 0x63, 0x65, 0x73, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x0a, 0x64, 0x73, 0x74, 0x50, 0x72,
+	0x6f, 0x63, 0x65, 0x73, 0x73, 0x12, 0x45, 0x0a, 0x13, 0x72, 0x61, 0x77, 0x5f, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x29, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x15, 0x2e, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x48, 0x65,
+	0x61, 0x64, 0x65, 0x72, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x11, 0x72, 0x61, 0x77, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x47, 0x0a, 0x14,
+	0x72, 0x61, 0x77, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x68, 0x65, 0x61,
+	0x64, 0x65, 0x72, 0x73, 0x18, 0x2a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x68, 0x74, 0x74,
+	0x70, 0x64, 0x75, 0x6d, 0x70, 0x2e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x46, 0x69, 0x65, 0x6c,
+	0x64, 0x52, 0x12, 0x72, 0x61, 0x77, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65,
+	0x61, 0x64, 0x65, 0x72, 0x73, 0x42, 0x1e, 0x5a, 0x1c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x6c, 0x69, 0x72, 0x2f, 0x68, 0x74, 0x74, 0x70, 0x64, 0x75, 0x6d, 0x70,
+	0x3b, 0x6d, 0x61, 0x69, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_exchange_proto_rawDescOnce sync.Once
+	file_exchange_proto_rawDescData = file_exchange_proto_rawDesc
+)
+
+func file_exchange_proto_rawDescGZIP() []byte {
+	file_exchange_proto_rawDescOnce.Do(func() {
+		file_exchange_proto_rawDescData = protoimpl.X.CompressGZIP(file_exchange_proto_rawDescData)
+	})
+	return file_exchange_proto_rawDescData
+}
+
+var file_exchange_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_exchange_proto_goTypes = []interface{}{
+	(*HeaderField)(nil),    // 0: httpdump.HeaderField
+	(*UploadedFile)(nil),   // 1: httpdump.UploadedFile
+	(*Cookie)(nil),         // 2: httpdump.Cookie
+	(*GeoInfo)(nil),        // 3: httpdump.GeoInfo
+	(*ForwardedHop)(nil),   // 4: httpdump.ForwardedHop
+	(*BodyStats)(nil),      // 5: httpdump.BodyStats
+	(*MessageBytes)(nil),   // 6: httpdump.MessageBytes
+	(*CacheInfo)(nil),      // 7: httpdump.CacheInfo
+	(*ProcessInfo)(nil),    // 8: httpdump.ProcessInfo
+	(*ExchangeRecord)(nil), // 9: httpdump.ExchangeRecord
+}
+var file_exchange_proto_depIdxs = []int32{
+	0,  // 0: httpdump.ExchangeRecord.request_headers:type_name -> httpdump.HeaderField
+	0,  // 1: httpdump.ExchangeRecord.response_headers:type_name -> httpdump.HeaderField
+	0,  // 2: httpdump.ExchangeRecord.form_fields:type_name -> httpdump.HeaderField
+	1,  // 3: httpdump.ExchangeRecord.uploads:type_name -> httpdump.UploadedFile
+	2,  // 4: httpdump.ExchangeRecord.request_cookies:type_name -> httpdump.Cookie
+	2,  // 5: httpdump.ExchangeRecord.response_cookies:type_name -> httpdump.Cookie
+	3,  // 6: httpdump.ExchangeRecord.src_geo:type_name -> httpdump.GeoInfo
+	3,  // 7: httpdump.ExchangeRecord.dst_geo:type_name -> httpdump.GeoInfo
+	4,  // 8: httpdump.ExchangeRecord.forwarded_hops:type_name -> httpdump.ForwardedHop
+	5,  // 9: httpdump.ExchangeRecord.request_body_stats:type_name -> httpdump.BodyStats
+	5,  // 10: httpdump.ExchangeRecord.response_body_stats:type_name -> httpdump.BodyStats
+	6,  // 11: httpdump.ExchangeRecord.request_bytes:type_name -> httpdump.MessageBytes
+	6,  // 12: httpdump.ExchangeRecord.response_bytes:type_name -> httpdump.MessageBytes
+	7,  // 13: httpdump.ExchangeRecord.cache:type_name -> httpdump.CacheInfo
+	8,  // 14: httpdump.ExchangeRecord.src_process:type_name -> httpdump.ProcessInfo
+	8,  // 15: httpdump.ExchangeRecord.dst_process:type_name -> httpdump.ProcessInfo
+	0,  // 16: httpdump.ExchangeRecord.raw_request_headers:type_name -> httpdump.HeaderField
+	0,  // 17: httpdump.ExchangeRecord.raw_response_headers:type_name -> httpdump.HeaderField
+	18, // [18:18] is the sub-list for method output_type
+	18, // [18:18] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
+}
+
+func init() { file_exchange_proto_init() }
+func file_exchange_proto_init() {
+	if File_exchange_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_exchange_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HeaderField); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UploadedFile); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Cookie); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GeoInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ForwardedHop); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BodyStats); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MessageBytes); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CacheInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProcessInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_exchange_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExchangeRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_exchange_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_exchange_proto_goTypes,
+		DependencyIndexes: file_exchange_proto_depIdxs,
+		MessageInfos:      file_exchange_proto_msgTypes,
+	}.Build()
+	File_exchange_proto = out.File
+	file_exchange_proto_rawDesc = nil
+	file_exchange_proto_goTypes = nil
+	file_exchange_proto_depIdxs = nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"httpdump/httpport"
+)
+
+// bodies larger than this are not kept for diff, only their sizes and hashes are compared
+const diffMaxBody = 1 << 20
+
+// text bodies are diffed by lines if product of their line counts is not larger than this
+const diffMaxLineCells = 1 << 20
+
+// default headers not compared, which changes on every response
+const defaultDiffIgnoreHeaders = "Date,Age,Expires"
+
+// ExchangeDiffer group exchanges by request signature, and diff status, headers and response body of repeats
+// against the first occurrence. It is shared by all connection goroutines
+type ExchangeDiffer struct {
+	lock    sync.Mutex
+	ignored map[string]bool // canonical names of headers not compared
+	first   map[string]*diffBase
+}
+
+// diffBase is the first occurrence of a request signature
+type diffBase struct {
+	status         int
+	requestHeader  httpport.Header
+	responseHeader httpport.Header
+	body           []byte // decoded response body, nil if larger than diffMaxBody
+	bodySize       int
+	bodyHash       string
+	repeats        int // occurrences including the first one
+}
+
+// diffChange is an added(+), removed(-) or changed(~) header, json value or text line
+type diffChange struct {
+	kind byte
+	name string // header name, json path like $.items[0].id, or line number of text
+	from string // value in the first occurrence, json encoded for json values
+	to   string
+}
+
+// exchangeDiff is the differences of a repeat to the first occurrence of its signature
+type exchangeDiff struct {
+	signature       string
+	repeat          int // 1-based occurrence of the signature, 2 for the first repeat
+	statusFrom      int
+	statusTo        int
+	requestHeaders  []diffChange
+	responseHeaders []diffChange
+	body            []diffChange
+}
+
+// differ ignore headers in comma separated list
+func newExchangeDiffer(ignoreHeaders string) *ExchangeDiffer {
+	var ignored = map[string]bool{}
+	for _, name := range strings.Split(ignoreHeaders, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			ignored[httpport.CanonicalHeaderKey(name)] = true
+		}
+	}
+	return &ExchangeDiffer{ignored: ignored, first: map[string]*diffBase{}}
+}
+
+// add exchange with response. first occurrence of signature is kept, nil is returned for it and for
+// repeats without differences
+func (differ *ExchangeDiffer) add(exchange *Exchange) *exchangeDiff {
+	if exchange.status == 0 {
+		return nil
+	}
+	signature := requestSignature(exchange)
+	differ.lock.Lock()
+	base := differ.first[signature]
+	if base == nil {
+		base = &diffBase{status: exchange.status, requestHeader: exchange.requestHeader,
+			responseHeader: exchange.responseHeader, bodySize: len(exchange.responseBodyData),
+			bodyHash: bodyHash(exchange.responseBodyData), repeats: 1}
+		if len(exchange.responseBodyData) <= diffMaxBody {
+			base.body = exchange.responseBodyData
+		}
+		differ.first[signature] = base
+		differ.lock.Unlock()
+		return nil
+	}
+	base.repeats++
+	repeat := base.repeats
+	differ.lock.Unlock()
+
+	// base is not modified after added, so it is diffed without lock
+	diff := &exchangeDiff{signature: signature, repeat: repeat, statusFrom: base.status, statusTo: exchange.status}
+	diff.requestHeaders = differ.diffHeaders(base.requestHeader, exchange.requestHeader)
+	diff.responseHeaders = differ.diffHeaders(base.responseHeader, exchange.responseHeader)
+	diff.body = diffBody(base, exchange.responseBodyData)
+	if diff.statusFrom == diff.statusTo && len(diff.requestHeaders) == 0 && len(diff.responseHeaders) == 0 &&
+		len(diff.body) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// added, removed and changed headers ordered by name. values of a header are compared joined
+func (differ *ExchangeDiffer) diffHeaders(from httpport.Header, to httpport.Header) []diffChange {
+	var names []string
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var changes []diffChange
+	for _, name := range names {
+		if differ.ignored[name] {
+			continue
+		}
+		fromValues, inFrom := from[name]
+		toValues, inTo := to[name]
+		fromValue, toValue := strings.Join(fromValues, ", "), strings.Join(toValues, ", ")
+		switch {
+		case !inFrom:
+			changes = append(changes, diffChange{kind: '+', name: name, to: toValue})
+		case !inTo:
+			changes = append(changes, diffChange{kind: '-', name: name, from: fromValue})
+		case fromValue != toValue:
+			changes = append(changes, diffChange{kind: '~', name: name, from: fromValue, to: toValue})
+		}
+	}
+	return changes
+}
+
+// diff response bodies by json values if both are json, or by lines if both are text.
+// other bodies are compared by size and hash
+func diffBody(base *diffBase, body []byte) []diffChange {
+	if base.bodySize == len(body) && base.bodyHash == bodyHash(body) {
+		return nil
+	}
+	sizeChange := []diffChange{{kind: '~', name: "size", from: strconv.Itoa(base.bodySize) + " bytes",
+		to: strconv.Itoa(len(body)) + " bytes"}}
+	if base.body == nil && base.bodySize > 0 || len(body) > diffMaxBody {
+		return sizeChange
+	}
+	var fromValue, toValue interface{}
+	if json.Unmarshal(base.body, &fromValue) == nil && json.Unmarshal(body, &toValue) == nil {
+		var changes []diffChange
+		diffJSON("$", fromValue, toValue, &changes)
+		return changes
+	}
+	if !utf8.Valid(base.body) || !utf8.Valid(body) {
+		return sizeChange
+	}
+	if changes, ok := diffLines(string(base.body), string(body)); ok {
+		return changes
+	}
+	return sizeChange
+}
+
+// append changes of json values at path, object keys are visited in order
+func diffJSON(path string, from interface{}, to interface{}, changes *[]diffChange) {
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if fromIsObject && toIsObject {
+		var keys []string
+		for key := range fromObject {
+			keys = append(keys, key)
+		}
+		for key := range toObject {
+			if _, ok := fromObject[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fromValue, inFrom := fromObject[key]
+			toValue, inTo := toObject[key]
+			keyPath := path + "." + key
+			switch {
+			case !inFrom:
+				*changes = append(*changes, diffChange{kind: '+', name: keyPath, to: jsonString(toValue)})
+			case !inTo:
+				*changes = append(*changes, diffChange{kind: '-', name: keyPath, from: jsonString(fromValue)})
+			default:
+				diffJSON(keyPath, fromValue, toValue, changes)
+			}
+		}
+		return
+	}
+	fromArray, fromIsArray := from.([]interface{})
+	toArray, toIsArray := to.([]interface{})
+	if fromIsArray && toIsArray {
+		for i := 0; i < len(fromArray) || i < len(toArray); i++ {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(fromArray):
+				*changes = append(*changes, diffChange{kind: '+', name: itemPath, to: jsonString(toArray[i])})
+			case i >= len(toArray):
+				*changes = append(*changes, diffChange{kind: '-', name: itemPath, from: jsonString(fromArray[i])})
+			default:
+				diffJSON(itemPath, fromArray[i], toArray[i], changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, diffChange{kind: '~', name: path, from: jsonString(from), to: jsonString(to)})
+	}
+}
+
+func jsonString(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// removed and added lines by longest common subsequence, named by 1-based line numbers in their own text.
+// false if texts have too many lines to diff
+func diffLines(from string, to string) ([]diffChange, bool) {
+	a, b := strings.Split(from, "\n"), strings.Split(to, "\n")
+	if len(a)*len(b) > diffMaxLineCells {
+		return nil, false
+	}
+	// lcs[i][j] is length of common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var changes []diffChange
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j >= len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			changes = append(changes, diffChange{kind: '-', name: "line " + strconv.Itoa(i+1), from: a[i]})
+			i++
+		default:
+			changes = append(changes, diffChange{kind: '+', name: "line " + strconv.Itoa(j+1), to: b[j]})
+			j++
+		}
+	}
+	return changes, true
+}
+
+func (change diffChange) String() string {
+	switch change.kind {
+	case '+':
+		return "+ " + change.name + ": " + change.to
+	case '-':
+		return "- " + change.name + ": " + change.from
+	}
+	return "~ " + change.name + ": " + change.from + " -> " + change.to
+}
+
+func diffChangesToMap(changes []diffChange) map[string]interface{} {
+	var added, removed, changed = map[string]interface{}{}, map[string]interface{}{}, map[string]interface{}{}
+	for _, change := range changes {
+		switch change.kind {
+		case '+':
+			added[change.name] = change.to
+		case '-':
+			removed[change.name] = change.from
+		default:
+			changed[change.name] = map[string]string{"from": change.from, "to": change.to}
+		}
+	}
+	return map[string]interface{}{"added": added, "removed": removed, "changed": changed}
+}
+
+// diff record of exchange, one line for each difference under the title line in text format
+func (diff *exchangeDiff) format(key ConnectionKey, format string) string {
+	if format == "json" {
+		record := map[string]interface{}{
+			"type":      "diff",
+			"src":       key.srcString(),
+			"dst":       key.dstString(),
+			"signature": diff.signature,
+			"repeat":    diff.repeat,
+		}
+		if diff.statusFrom != diff.statusTo {
+			record["status"] = map[string]int{"from": diff.statusFrom, "to": diff.statusTo}
+		}
+		if len(diff.requestHeaders) > 0 {
+			record["requestHeaders"] = diffChangesToMap(diff.requestHeaders)
+		}
+		if len(diff.responseHeaders) > 0 {
+			record["responseHeaders"] = diffChangesToMap(diff.responseHeaders)
+		}
+		if len(diff.body) > 0 {
+			record["body"] = diffChangesToMap(diff.body)
+		}
+		data, _ := json.Marshal(record)
+		return string(data) + "\n"
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString("[diff] " + diff.signature + " repeat=" + strconv.Itoa(diff.repeat) + " " + key.srcString() +
+		" -> " + key.dstString() + "\n")
+	if diff.statusFrom != diff.statusTo {
+		buffer.WriteString("  status ~ " + strconv.Itoa(diff.statusFrom) + " -> " + strconv.Itoa(diff.statusTo) + "\n")
+	}
+	for _, section := range []struct {
+		name    string
+		changes []diffChange
+	}{{"request-header", diff.requestHeaders}, {"response-header", diff.responseHeaders}, {"body", diff.body}} {
+		for _, change := range section.changes {
+			buffer.WriteString("  " + section.name + " " + change.String() + "\n")
+		}
+	}
+	return buffer.String()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonResponse(headers string, body string) string {
+	return "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n" + headers + "Content-Length: " +
+		strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
+
+func TestExchangeDiff(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.differ = newExchangeDiffer(defaultDiffIgnoreHeaders)
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /users/1?v=1 HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: jsonResponse("Date: Mon, 01 Jan 2018 00:00:00 GMT\r\nX-Version: 1\r\nX-Old: a\r\n",
+			`{"name":"alice","tags":["a"],"age":30}`)},
+		{up: true, payload: "GET /users/1?v=2 HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: jsonResponse("Date: Mon, 01 Jan 2018 00:00:01 GMT\r\nX-Version: 2\r\n",
+			`{"name":"bob","tags":["a","b"],"age":30}`)},
+		// same as the first one except ignored Date header
+		{up: true, payload: "GET /users/1 HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: jsonResponse("Date: Mon, 01 Jan 2018 00:00:02 GMT\r\nX-Version: 1\r\nX-Old: a\r\n",
+			`{"name":"alice","tags":["a"],"age":30}`)},
+		{up: true, payload: "GET /other HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\n\r\n"},
+	})
+	assert.Equal(t, 4, len(sink.exchanges))
+
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[diff]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[diff] GET example.com/users/1 repeat=2 10.0.0.1:50000 -> 10.0.0.2:80\n" +
+		"  response-header ~ Content-Length: 38 -> 40\n" +
+		"  response-header - X-Old: a\n" +
+		"  response-header ~ X-Version: 1 -> 2\n" +
+		"  body ~ $.name: \"alice\" -> \"bob\"\n" +
+		"  body + $.tags[1]: \"b\"\n"}, reports)
+}
+
+func TestExchangeDiffCharset(t *testing.T) {
+	handler, _ := newTestHTTPHandler(&Config{transcodeCharset: true})
+	handler.differ = newExchangeDiffer(defaultDiffIgnoreHeaders)
+	latin1 := func(body string) string {
+		return "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=ISO-8859-1\r\nContent-Length: " +
+			strconv.Itoa(len(body)) + "\r\n\r\n" + body
+	}
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /menu HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: latin1("th\xe9\n")},
+		{up: true, payload: "GET /menu HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: latin1("caf\xe9\n")},
+	})
+
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[diff]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[diff] GET example.com/menu repeat=2 10.0.0.1:50000 -> 10.0.0.2:80\n" +
+		"  response-header ~ Content-Length: 4 -> 5\n" +
+		"  body - line 1: thé\n" +
+		"  body + line 1: café\n"}, reports)
+}
+
+func diffExchange(status int, body string) *Exchange {
+	return &Exchange{method: "GET", host: "example.com", url: "/page", status: status, responseBodyData: []byte(body)}
+}
+
+func TestExchangeDiffFormat(t *testing.T) {
+	differ := newExchangeDiffer("")
+	assert.Nil(t, differ.add(diffExchange(200, "<html>\n<p>hello</p>\n</html>")))
+	// exchanges without response are not grouped
+	assert.Nil(t, differ.add(diffExchange(0, "")))
+
+	repeat := diffExchange(404, "<html>\n<p>not found</p>\n</html>")
+	diff := differ.add(repeat)
+	assert.Equal(t, 2, diff.repeat)
+	assert.Equal(t, []diffChange{{kind: '-', name: "line 2", from: "<p>hello</p>"},
+		{kind: '+', name: "line 2", to: "<p>not found</p>"}}, diff.body)
+
+	var record map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(diff.format(repeat.key, "json")), &record))
+	assert.Equal(t, "diff", record["type"])
+	assert.Equal(t, map[string]interface{}{"from": float64(200), "to": float64(404)}, record["status"])
+	assert.Equal(t, map[string]interface{}{"line 2": "<p>hello</p>"},
+		record["body"].(map[string]interface{})["removed"])
+	assert.Nil(t, record["responseHeaders"])
+
+	// binary bodies are compared by size
+	assert.Equal(t, []diffChange{{kind: '~', name: "size", from: "27 bytes", to: "3 bytes"}},
+		differ.add(diffExchange(200, "\xff\xfe\x00")).body)
+}
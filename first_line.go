@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// messageHead is first line and body framing of a http message, read without full header parsing
+type messageHead struct {
+	line          string // request line or status line, as on wire without CRLF
+	contentLength int64  // -1 if not set
+	chunked       bool
+}
+
+var errHeadTooLarge = errors.New("message head too large")
+
+// max bytes of message head in first line mode
+var maxHeadSize = 1 << 20
+
+// read first line and header lines of a message. only Content-Length and Transfer-Encoding headers are looked at
+func readMessageHead(reader *bufio.Reader) (*messageHead, error) {
+	head := &messageHead{contentLength: -1}
+	var size int
+	for first := true; ; first = false {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && !first {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if size += len(line); size > maxHeadSize {
+			return nil, errHeadTooLarge
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if first {
+			head.line = line
+			continue
+		}
+		if line == "" {
+			return head, nil
+		}
+		idx := strings.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+		name := strings.TrimSpace(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		if strings.EqualFold(name, "Content-Length") {
+			if length, err := strconv.ParseInt(value, 10, 64); err == nil && length >= 0 {
+				head.contentLength = length
+			}
+		} else if strings.EqualFold(name, "Transfer-Encoding") && strings.Contains(strings.ToLower(value), "chunked") {
+			head.chunked = true
+		}
+	}
+}
+
+// status code in status line, 0 if invalid
+func (head *messageHead) status() int {
+	fields := strings.Fields(head.line)
+	if len(fields) < 2 {
+		return 0
+	}
+	status, _ := strconv.Atoi(fields[1])
+	return status
+}
+
+// method in request line
+func (head *messageHead) method() string {
+	if idx := strings.IndexByte(head.line, ' '); idx > 0 {
+		return head.line[:idx]
+	}
+	return head.line
+}
+
+// skip message body. request without length has no body, response without length ends at connection close
+func skipMessageBody(reader *bufio.Reader, head *messageHead, request bool) error {
+	if head.chunked {
+		return skipChunkedBody(reader)
+	}
+	if head.contentLength >= 0 {
+		_, err := reader.Discard(int(head.contentLength))
+		return err
+	}
+	if !request {
+		_, err := io.Copy(ioutil.Discard, reader)
+		return err
+	}
+	return nil
+}
+
+func skipChunkedBody(reader *bufio.Reader) error {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if idx := strings.IndexByte(line, ';'); idx >= 0 {
+			line = line[:idx]
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+		if err != nil || size < 0 {
+			return errors.New("invalid chunk size: " + line)
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := reader.Discard(int(size) + 2); err != nil {
+			return err
+		}
+	}
+	// trailers
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.TrimRight(line, "\r\n") == "" {
+			return nil
+		}
+	}
+}
+
+// if response to the request has no body
+func bodyless(method string, status int) bool {
+	return method == "HEAD" || status/100 == 1 || status == 204 || status == 304 ||
+		method == "CONNECT" && status/100 == 2
+}
+
+// read only request lines and status lines of exchanges, skip headers and bodies
+func (h *HTTPTrafficHandler) handleFirstLines(requestReader *bufio.Reader, responseReader *bufio.Reader) {
+	for {
+		request, err := readMessageHead(requestReader)
+		if err != nil {
+			if err != io.EOF {
+				logger.Debug("read request line error:", err)
+			}
+			return
+		}
+		if err := skipMessageBody(requestReader, request, true); err != nil {
+			h.printFirstLines(request.line, "")
+			return
+		}
+
+		// informational responses are skipped, except switching protocols
+		var response *messageHead
+		for {
+			response, err = readMessageHead(responseReader)
+			if err != nil || response.status()/100 != 1 || response.status() == 101 {
+				break
+			}
+		}
+		if err != nil {
+			h.printFirstLines(request.line, "")
+			return
+		}
+		h.printFirstLines(request.line, response.line)
+		status := response.status()
+		if status == 101 || request.method() == "CONNECT" && status/100 == 2 {
+			// following traffic is not http
+			return
+		}
+		if !bodyless(request.method(), status) {
+			if err := skipMessageBody(responseReader, response, false); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// print request line and status line of one exchange. statusLine is empty if response is not captured
+func (h *HTTPTrafficHandler) printFirstLines(requestLine string, statusLine string) {
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":         "line",
+			"src":          h.key.srcString(),
+			"dst":          h.key.dstString(),
+			"request_line": requestLine,
+			"status_line":  statusLine,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	if statusLine == "" {
+		statusLine = "(no response)"
+	}
+	h.printer.send(strings.Join([]string{"[line]", h.key.srcString(), "->", h.key.dstString(), requestLine, "|",
+		statusLine}, " ") + "\n")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstLines(t *testing.T) {
+	sink, printer := runHTTPConversation(&Config{firstLine: true}, []testSegment{
+		{up: true, payload: "GET /pat"},
+		{up: true, payload: "h?q=1 HT"},
+		{up: true, payload: "TP/1.1\r\nHost: example.com\r\nContent-Length: 3\r\n\r\nabc"},
+		{up: false, payload: "HTTP/1.1 100 Continue\r\n\r\nHTTP/1."},
+		{up: false, payload: "1 200 OK\r"},
+		{up: false, payload: "\nContent-Length: 2\r\n\r\nok"},
+		{up: true, payload: "HEAD /head HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n"},
+		{up: true, payload: "GET /chunked HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 404 Not Found\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n"},
+		{up: true, payload: "GET /last HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+	})
+	assert.Empty(t, sink.exchanges)
+
+	var lines []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[line]") {
+			lines = append(lines, msg)
+		}
+	}
+	assert.Equal(t, []string{
+		"[line] 10.0.0.1:50000 -> 10.0.0.2:80 GET /path?q=1 HTTP/1.1 | HTTP/1.1 200 OK\n",
+		"[line] 10.0.0.1:50000 -> 10.0.0.2:80 HEAD /head HTTP/1.1 | HTTP/1.1 200 OK\n",
+		"[line] 10.0.0.1:50000 -> 10.0.0.2:80 GET /chunked HTTP/1.1 | HTTP/1.1 404 Not Found\n",
+		"[line] 10.0.0.1:50000 -> 10.0.0.2:80 GET /last HTTP/1.1 | (no response)\n",
+	}, lines)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"httpdump/httpport"
+)
+
+// forwardedHop is a proxy hop in Forwarded or X-Forwarded-For header, the originating client first
+type forwardedHop struct {
+	forNode string // client of the hop, ip, "[ipv6]:port", "unknown" or obfuscated identifier
+	by      string // interface where the request came in to the proxy, only in Forwarded
+	proto   string // only in Forwarded
+	host    string // only in Forwarded
+}
+
+// parse proxy hops of request. Forwarded(RFC 7239) is used if present, else X-Forwarded-For.
+// Redacted headers are not parsed
+func parseForwardedHops(header httpport.Header, redacted map[string]bool) []forwardedHop {
+	if values := header["Forwarded"]; len(values) > 0 && !redacted["forwarded"] {
+		return parseForwarded(values)
+	}
+	if values := header["X-Forwarded-For"]; len(values) > 0 && !redacted["x-forwarded-for"] {
+		return parseXForwardedFor(values)
+	}
+	return nil
+}
+
+// parse comma separated ips of X-Forwarded-For headers
+func parseXForwardedFor(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, node := range strings.Split(value, ",") {
+			if node = strings.TrimSpace(node); node != "" {
+				hops = append(hops, forwardedHop{forNode: node})
+			}
+		}
+	}
+	return hops
+}
+
+// parse Forwarded headers, like: for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https;by=203.0.113.60.
+// Elements are separated by comma, pairs in element by semicolon, and values may be quoted strings
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			var hop forwardedHop
+			for _, pair := range splitQuoted(element, ';') {
+				idx := strings.IndexByte(pair, '=')
+				if idx < 0 {
+					continue
+				}
+				name := strings.ToLower(strings.TrimSpace(pair[:idx]))
+				v := unquote(strings.TrimSpace(pair[idx+1:]))
+				switch name {
+				case "for":
+					hop.forNode = v
+				case "by":
+					hop.by = v
+				case "proto":
+					hop.proto = v
+				case "host":
+					hop.host = v
+				}
+			}
+			if hop != (forwardedHop{}) {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// split value by sep, sep in quoted strings are kept
+func splitQuoted(value string, sep byte) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// unquote quoted-string, value not quoted is returned as is
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var builder strings.Builder
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+		builder.WriteByte(value[i])
+	}
+	return builder.String()
+}
+
+// parse proxy hops of exchange before headers are redacted, and send the chain to printer
+func (h *HTTPTrafficHandler) reportForwarded(exchange *Exchange) {
+	exchange.forwardedHops = parseForwardedHops(exchange.requestHeader, h.config.redactHeaders)
+	if len(exchange.forwardedHops) > 0 {
+		h.printer.send(formatForwarded(exchange.key, exchange.forwardedHops, h.config.format))
+	}
+}
+
+// format hops as chain from the originating client to the tcp source
+func formatForwarded(key ConnectionKey, hops []forwardedHop, format string) string {
+	if format == "json" {
+		var chain []map[string]string
+		for _, hop := range hops {
+			chain = append(chain, map[string]string{"for": hop.forNode, "by": hop.by, "proto": hop.proto,
+				"host": hop.host})
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":   "forwarded",
+			"src":    key.srcString(),
+			"dst":    key.dstString(),
+			"client": hops[0].forNode,
+			"hops":   chain,
+		})
+		return string(data) + "\n"
+	}
+	var nodes []string
+	for _, hop := range hops {
+		node := hop.forNode
+		if node == "" {
+			node = "-"
+		}
+		var attrs []string
+		if hop.proto != "" {
+			attrs = append(attrs, "proto="+hop.proto)
+		}
+		if hop.host != "" {
+			attrs = append(attrs, "host="+hop.host)
+		}
+		if hop.by != "" {
+			attrs = append(attrs, "by="+hop.by)
+		}
+		if len(attrs) > 0 {
+			node += "(" + strings.Join(attrs, " ") + ")"
+		}
+		nodes = append(nodes, node)
+	}
+	nodes = append(nodes, key.srcString())
+	return "[forwarded] " + key.srcString() + " -> " + key.dstString() + " chain: " +
+		strings.Join(nodes, " => ") + "\n"
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseXForwardedForChain(t *testing.T) {
+	header := map[string][]string{
+		"X-Forwarded-For": {"203.0.113.7, 198.51.100.2", " 192.0.2.10 ,,"},
+	}
+	hops := parseForwardedHops(header, nil)
+	assert.Equal(t, []forwardedHop{{forNode: "203.0.113.7"}, {forNode: "198.51.100.2"}, {forNode: "192.0.2.10"}}, hops)
+
+	// redacted header is not parsed
+	assert.Nil(t, parseForwardedHops(header, map[string]bool{"x-forwarded-for": true}))
+}
+
+func TestParseForwarded(t *testing.T) {
+	header := map[string][]string{
+		"Forwarded": {`for=192.0.2.43;proto=http, for="[2001:db8:cafe::17]:4711";proto=https;by=203.0.113.60`,
+			`For="_hidden;x,y";host="example.com"`, `unknown-token`},
+		"X-Forwarded-For": {"10.0.0.9"},
+	}
+	hops := parseForwardedHops(header, nil)
+	assert.Equal(t, []forwardedHop{
+		{forNode: "192.0.2.43", proto: "http"},
+		{forNode: "[2001:db8:cafe::17]:4711", proto: "https", by: "203.0.113.60"},
+		{forNode: "_hidden;x,y", host: "example.com"},
+	}, hops)
+
+	assert.Equal(t, []string{`a="x,\"y"`, " b"}, splitQuoted(`a="x,\"y", b`, ','))
+	assert.Equal(t, `x,"y`, unquote(`"x,\"y"`))
+}
+
+func TestReportForwarded(t *testing.T) {
+	sink, printer := runHTTPConversation(&Config{parseForwarded: true}, []testSegment{
+		{up: true, payload: "GET /a HTTP/1.1\r\nHost: example.com\r\n" +
+			"X-Forwarded-For: 203.0.113.7, 198.51.100.2\r\nX-Forwarded-For: 192.0.2.10\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		{up: true, payload: "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+	})
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, []forwardedHop{{forNode: "203.0.113.7"}, {forNode: "198.51.100.2"}, {forNode: "192.0.2.10"}},
+		sink.exchanges[0].forwardedHops)
+	assert.Nil(t, sink.exchanges[1].forwardedHops)
+
+	record := sink.exchanges[0].toProto()
+	assert.Equal(t, 3, len(record.ForwardedHops))
+	assert.Equal(t, "203.0.113.7", record.ForwardedHops[0].For)
+
+	var lines []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[forwarded]") {
+			lines = append(lines, msg)
+		}
+	}
+	assert.Equal(t, []string{"[forwarded] 10.0.0.1:50000 -> 10.0.0.2:80 chain: " +
+		"203.0.113.7 => 198.51.100.2 => 192.0.2.10 => 10.0.0.1:50000\n"}, lines)
+
+	assert.Equal(t, "[forwarded] 10.0.0.1:50000 -> 10.0.0.2:80 chain: 192.0.2.43(proto=https by=203.0.113.60) => 10.0.0.1:50000\n",
+		formatForwarded(sink.exchanges[0].key, []forwardedHop{{forNode: "192.0.2.43", proto: "https", by: "203.0.113.60"}}, "text"))
+}
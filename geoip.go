@@ -0,0 +1,198 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// geoInfo is country and autonomous system of an ip
+type geoInfo struct {
+	country      string // ISO 3166-1 country code
+	asn          uint32
+	organization string // organization of the autonomous system
+}
+
+func (info *geoInfo) String() string {
+	var fields []string
+	if info.country != "" {
+		fields = append(fields, info.country)
+	}
+	if info.asn != 0 {
+		fields = append(fields, fmt.Sprintf("AS%d", info.asn))
+	}
+	if info.organization != "" {
+		fields = append(fields, info.organization)
+	}
+	return strings.Join(fields, " ")
+}
+
+// geoDatabase lookup geo info of ip
+type geoDatabase interface {
+	// return false if ip is not found
+	lookup(ip net.IP) (geoInfo, bool)
+}
+
+// GeoIPEnricher lookup geo info of public endpoint ips, with a bounded cache of recent ips.
+// It is shared by all connection goroutines
+type GeoIPEnricher struct {
+	databases []geoDatabase // results of databases are merged, e.g. a country db and an asn db
+	capacity  int
+	lock      sync.Mutex
+	cache     map[string]*list.Element
+	recent    *list.List // of *geoCacheEntry, most recently used at front
+}
+
+type geoCacheEntry struct {
+	ip   string
+	info *geoInfo // nil if not found
+}
+
+// open MaxMind DB files. Files failed to open are skipped with warnings, return nil if no db is available
+func newGeoIPEnricher(paths []string, capacity int) *GeoIPEnricher {
+	var databases []geoDatabase
+	for _, path := range paths {
+		db, err := openMaxMindDB(path)
+		if err != nil {
+			logger.Warn("open geoip db", path, "error:", err, ", skipped")
+			continue
+		}
+		databases = append(databases, db)
+	}
+	if len(databases) == 0 {
+		return nil
+	}
+	return newGeoIPEnricherWithDatabases(databases, capacity)
+}
+
+func newGeoIPEnricherWithDatabases(databases []geoDatabase, capacity int) *GeoIPEnricher {
+	return &GeoIPEnricher{
+		databases: databases,
+		capacity:  capacity,
+		cache:     map[string]*list.Element{},
+		recent:    list.New(),
+	}
+}
+
+// geo info of ip. return nil for private, loopback and other non-public ips, or ip not found
+func (enricher *GeoIPEnricher) lookup(ip string) *geoInfo {
+	enricher.lock.Lock()
+	defer enricher.lock.Unlock()
+	if element, ok := enricher.cache[ip]; ok {
+		enricher.recent.MoveToFront(element)
+		return element.Value.(*geoCacheEntry).info
+	}
+	info := enricher.lookupDatabases(ip)
+	enricher.cache[ip] = enricher.recent.PushFront(&geoCacheEntry{ip: ip, info: info})
+	if enricher.capacity > 0 && enricher.recent.Len() > enricher.capacity {
+		oldest := enricher.recent.Back()
+		enricher.recent.Remove(oldest)
+		delete(enricher.cache, oldest.Value.(*geoCacheEntry).ip)
+	}
+	return info
+}
+
+func (enricher *GeoIPEnricher) lookupDatabases(ip string) *geoInfo {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || !isPublicIP(parsed) {
+		return nil
+	}
+	var result geoInfo
+	var found bool
+	for _, db := range enricher.databases {
+		info, ok := db.lookup(parsed)
+		if !ok {
+			continue
+		}
+		found = true
+		if result.country == "" {
+			result.country = info.country
+		}
+		if result.asn == 0 {
+			result.asn = info.asn
+			result.organization = info.organization
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &result
+}
+
+// private ip ranges not covered by net.IP methods
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"), // carrier-grade nat
+	mustParseCIDR("fc00::/7"),      // unique local
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// if ip is a global unicast ip, not in private ranges
+func isPublicIP(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup geo info of exchange endpoints, and send a geoip record to printer if any is found
+func (h *HTTPTrafficHandler) enrichGeo(exchange *Exchange) {
+	exchange.srcGeo = h.geoip.lookup(exchange.key.src.ip)
+	exchange.dstGeo = h.geoip.lookup(exchange.key.dst.ip)
+	if exchange.srcGeo == nil && exchange.dstGeo == nil {
+		return
+	}
+	h.printer.send(formatGeo(exchange.key, exchange.srcGeo, exchange.dstGeo, h.config.format))
+}
+
+func formatGeo(key ConnectionKey, srcGeo *geoInfo, dstGeo *geoInfo, format string) string {
+	if format == "json" {
+		record := map[string]interface{}{
+			"type": "geoip",
+			"src":  key.srcString(),
+			"dst":  key.dstString(),
+		}
+		if srcGeo != nil {
+			record["srcGeo"] = srcGeo.toMap()
+		}
+		if dstGeo != nil {
+			record["dstGeo"] = dstGeo.toMap()
+		}
+		data, _ := json.Marshal(record)
+		return string(data) + "\n"
+	}
+	var fields = []string{"[geoip]", key.srcString()}
+	if srcGeo != nil {
+		fields = append(fields, "("+srcGeo.String()+")")
+	}
+	fields = append(fields, "->", key.dstString())
+	if dstGeo != nil {
+		fields = append(fields, "("+dstGeo.String()+")")
+	}
+	return strings.Join(fields, " ") + "\n"
+}
+
+func (info *geoInfo) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"country":      info.country,
+		"asn":          info.asn,
+		"organization": info.organization,
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubGeoDatabase lookup geo info from a map, and counts lookups
+type stubGeoDatabase struct {
+	records map[string]geoInfo
+	lookups int
+}
+
+func (db *stubGeoDatabase) lookup(ip net.IP) (geoInfo, bool) {
+	db.lookups++
+	info, ok := db.records[ip.String()]
+	return info, ok
+}
+
+func TestGeoIPEnrichment(t *testing.T) {
+	countries := &stubGeoDatabase{records: map[string]geoInfo{
+		"8.8.8.8":     {country: "US"},
+		"203.0.113.7": {country: "AU"},
+	}}
+	asns := &stubGeoDatabase{records: map[string]geoInfo{
+		"8.8.8.8": {asn: 15169, organization: "GOOGLE"},
+	}}
+	h := newTestTrafficHandler()
+	h.geoip = newGeoIPEnricherWithDatabases([]geoDatabase{countries, asns}, 16)
+
+	exchange := &Exchange{key: ConnectionKey{Endpoint{"203.0.113.7", 50000}, Endpoint{"8.8.8.8", 80}}}
+	h.enrichGeo(exchange)
+	assert.Equal(t, &geoInfo{country: "AU"}, exchange.srcGeo)
+	assert.Equal(t, &geoInfo{country: "US", asn: 15169, organization: "GOOGLE"}, exchange.dstGeo)
+	assert.Equal(t, "[geoip] 203.0.113.7:50000 (AU) -> 8.8.8.8:80 (US AS15169 GOOGLE)\n", <-h.printer.outputQueue)
+
+	record := exchange.toProto()
+	assert.Equal(t, "AU", record.SrcGeo.Country)
+	assert.Equal(t, uint32(15169), record.DstGeo.Asn)
+	assert.Equal(t, "GOOGLE", record.DstGeo.Organization)
+
+	// private ips are not looked up, and no record printed
+	exchange = &Exchange{key: ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"192.168.1.1", 80}}}
+	h.enrichGeo(exchange)
+	assert.Nil(t, exchange.srcGeo)
+	assert.Nil(t, exchange.dstGeo)
+	assert.Equal(t, 0, len(h.printer.outputQueue))
+	assert.Equal(t, 2, countries.lookups)
+
+	h.config.format = "json"
+	exchange = &Exchange{key: ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"8.8.8.8", 443}}}
+	h.enrichGeo(exchange)
+	msg := <-h.printer.outputQueue
+	assert.True(t, strings.HasPrefix(msg, `{"dst":"8.8.8.8:443","dstGeo":{"asn":15169,"country":"US","organization":"GOOGLE"}`))
+	assert.NotContains(t, msg, "srcGeo")
+	// served from cache
+	assert.Equal(t, 2, countries.lookups)
+}
+
+func TestGeoIPCacheBounded(t *testing.T) {
+	db := &stubGeoDatabase{records: map[string]geoInfo{"8.8.8.8": {country: "US"}}}
+	enricher := newGeoIPEnricherWithDatabases([]geoDatabase{db}, 2)
+
+	assert.Equal(t, "US", enricher.lookup("8.8.8.8").country)
+	assert.Nil(t, enricher.lookup("1.1.1.1")) // not found is cached too
+	assert.Equal(t, "US", enricher.lookup("8.8.8.8").country)
+	assert.Equal(t, 2, db.lookups)
+
+	// evicts least recently used 1.1.1.1
+	assert.Nil(t, enricher.lookup("9.9.9.9"))
+	assert.Equal(t, 2, enricher.recent.Len())
+	assert.Equal(t, 2, len(enricher.cache))
+	enricher.lookup("8.8.8.8")
+	assert.Equal(t, 3, db.lookups)
+	enricher.lookup("1.1.1.1")
+	assert.Equal(t, 4, db.lookups)
+}
+
+func TestGeoIPDatabaseAbsent(t *testing.T) {
+	assert.Nil(t, newGeoIPEnricher([]string{"testdata/not-exists.mmdb"}, 16))
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, ip := range []string{"8.8.8.8", "203.0.113.7", "2001:4860:4860::8888"} {
+		assert.True(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"10.1.2.3", "172.20.0.1", "192.168.0.1", "127.0.0.1", "100.64.0.1",
+		"169.254.0.1", "::1", "fd00::1", "fe80::1", "224.0.0.1"} {
+		assert.False(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+}
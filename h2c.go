@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+
+	"httpdump/httpport"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// hop-by-hop headers of the upgrade request, not part of the request of stream 1
+var h2cUpgradeHeaders = map[string]bool{"connection": true, "upgrade": true, "http2-settings": true, "host": true}
+
+// if the request is upgraded to http2 over cleartext(h2c) by the response
+func isH2CUpgrade(req *httpport.Request, resp *httpport.Response) bool {
+	return resp.StatusCode == 101 && containsToken(req.Header.Get("Upgrade"), "h2c") &&
+		containsToken(resp.Header.Get("Upgrade"), "h2c")
+}
+
+// if comma separated header value contains the token, case-insensitively
+func containsToken(value string, token string) bool {
+	for _, item := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// after 101 Switching Protocols to h2c, following traffic is http2. The upgrade request is the request of
+// stream 1, whose response is sent by server in http2 frames. Client sends the connection preface before frames
+func (h *HTTPTrafficHandler) handleH2CUpgrade(connection *TCPConnection, req *httpport.Request, exchange *Exchange,
+	requestReader *bufio.Reader, responseReader *bufio.Reader) {
+	h.reportUpgrade(exchange, "h2c")
+	if isHTTP2Preface(requestReader) {
+		requestReader.Discard(len(http2Preface))
+	}
+	conn := newHTTP2Connection(h)
+	// streams are indexed after the upgrade exchange
+	conn.count = exchange.index
+	stream := conn.stream(1)
+	conn.setRequest(stream, upgradeRequestFields(req), exchange.requestStart)
+	stream.requestEnd = exchange.requestEnd
+	stream.requestBodySize = exchange.requestBodySize
+	stream.requestDone = true
+	conn.run(connection, requestReader, responseReader)
+}
+
+// header fields of http2 request converted from the upgrade request
+func upgradeRequestFields(req *httpport.Request) []hpack.HeaderField {
+	var fields = []hpack.HeaderField{{Name: ":method", Value: req.Method}, {Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: req.Host}, {Name: ":path", Value: req.RequestURI}}
+	for _, line := range req.RawHeaders {
+		idx := strings.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:idx]))
+		if h2cUpgradeHeaders[name] {
+			continue
+		}
+		fields = append(fields, hpack.HeaderField{Name: name, Value: strings.TrimSpace(line[idx+1:])})
+	}
+	return fields
+}
+
+// report the connection switched protocol by the exchange
+func (h *HTTPTrafficHandler) reportUpgrade(exchange *Exchange, protocol string) {
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":     "upgrade",
+			"src":      h.key.srcString(),
+			"dst":      h.key.dstString(),
+			"protocol": protocol,
+			"url":      exchange.host + exchange.url,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	h.printer.send("[upgrade] " + h.key.srcString() + " -> " + h.key.dstString() + " protocol=" + protocol +
+		" url=" + exchange.host + exchange.url + "\n")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestH2CUpgrade(t *testing.T) {
+	var clientBuffer, serverBuffer bytes.Buffer
+	clientEncoder := hpack.NewEncoder(&clientBuffer)
+	serverEncoder := hpack.NewEncoder(&serverBuffer)
+
+	upgrade := "GET /a HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\n" +
+		"HTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\nUser-Agent: test\r\n\r\n"
+	switched := "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"
+	// response of the upgrade request is on stream 1
+	response := []byte(switched)
+	response = append(response, http2FrameBytes(http2FrameSettings, 0, 0, nil)...)
+	response = append(response, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders, 1,
+		http2HeaderBlock(serverEncoder, &serverBuffer, ":status", "200", "content-type", "text/plain"))...)
+	response = append(response, http2FrameBytes(http2FrameData, http2FlagEndStream, 1, []byte("hello"))...)
+
+	request := []byte(http2Preface)
+	request = append(request, http2FrameBytes(http2FrameSettings, 0, 0, nil)...)
+	request = append(request, http2FrameBytes(http2FrameSettings, http2FlagAck, 0, nil)...)
+	request = append(request, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders|http2FlagEndStream, 3,
+		http2HeaderBlock(clientEncoder, &clientBuffer, ":method", "GET", ":scheme", "http",
+			":authority", "example.com", ":path", "/b"))...)
+	following := http2FrameBytes(http2FrameSettings, http2FlagAck, 0, nil)
+	following = append(following, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders|http2FlagEndStream, 3,
+		http2HeaderBlock(serverEncoder, &serverBuffer, ":status", "404"))...)
+
+	sink, printer := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: upgrade},
+		// the first http2 frames are in the same segment as the 101 response
+		{up: false, payload: string(response)},
+		{up: true, payload: string(request)},
+		{up: false, payload: string(following)},
+	})
+
+	var upgrades []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[upgrade]") {
+			upgrades = append(upgrades, msg)
+		}
+	}
+	assert.Equal(t, []string{"[upgrade] 10.0.0.1:50000 -> 10.0.0.2:80 protocol=h2c url=example.com/a\n"}, upgrades)
+
+	if !assert.Equal(t, 3, len(sink.exchanges)) {
+		return
+	}
+	exchanges := sink.exchanges
+	sort.Slice(exchanges, func(i, j int) bool {
+		return exchanges[i].index < exchanges[j].index
+	})
+	handshake, upgraded, next := exchanges[0], exchanges[1], exchanges[2]
+	assert.Equal(t, 1, handshake.index)
+	assert.Equal(t, 101, handshake.status)
+
+	// the upgrade request with its http2 response
+	assert.Equal(t, 2, upgraded.index)
+	assert.Equal(t, "GET", upgraded.method)
+	assert.Equal(t, "example.com", upgraded.host)
+	assert.Equal(t, "/a", upgraded.url)
+	assert.Equal(t, 200, upgraded.status)
+	assert.Equal(t, []string{"user-agent: test"}, upgraded.requestHeaders)
+	assert.Equal(t, "text/plain", upgraded.responseHeader.Get("Content-Type"))
+	assert.Equal(t, int64(5), upgraded.responseBodySize)
+
+	assert.Equal(t, 3, next.index)
+	assert.Equal(t, "/b", next.url)
+	assert.Equal(t, 404, next.status)
+}
+
+func TestContainsToken(t *testing.T) {
+	assert.True(t, containsToken("websocket, H2C", "h2c"))
+	assert.False(t, containsToken("h2", "h2c"))
+}
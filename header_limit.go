@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+)
+
+var errHeaderTooLarge = errors.New("header too large")
+
+// default max bytes of a message header block, as net/http server
+const defaultMaxHeaderBytes = 1 << 20
+
+// limit bytes read from underlying reader while parsing the header block of the message marked. Reading stops
+// at max plus the buffer size of buffered reader(data read ahead), so an oversized header is not buffered unbounded.
+// max <= 0 for unlimited
+func (r *recordReader) limitHeader(max int, buffered *bufio.Reader) {
+	r.limit = 0
+	if max > 0 {
+		r.limit = r.start + int64(max) + int64(buffered.Size())
+	}
+}
+
+// remove the header limit, and check the header block just parsed does not exceed max bytes
+func (r *recordReader) checkHeader(max int, buffered *bufio.Reader, err error) error {
+	r.limit = 0
+	if err == nil && max > 0 && r.position(buffered)-r.start > int64(max) {
+		return errHeaderTooLarge
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"httpdump/httpport"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderLimit(t *testing.T) {
+	// header block never ends, reading stops at the limit
+	data := "GET / HTTP/1.1\r\nX-Large: " + strings.Repeat("a", 1<<20)
+	recorder := &recordReader{reader: strings.NewReader(data)}
+	reader := bufio.NewReader(recorder)
+	recorder.mark(reader)
+	recorder.limitHeader(1024, reader)
+	_, err := httpport.ReadRequest(reader)
+	assert.Equal(t, errHeaderTooLarge, recorder.checkHeader(1024, reader, err))
+	assert.True(t, recorder.count <= int64(1024+reader.Size()), recorder.count)
+
+	// header within the read ahead slop is checked by consumed bytes
+	for _, c := range []struct {
+		max int
+		err error
+	}{{64, errHeaderTooLarge}, {4096, nil}, {0, nil}} {
+		data := "GET / HTTP/1.1\r\nX-Large: " + strings.Repeat("a", 100) + "\r\n\r\n"
+		recorder := &recordReader{reader: strings.NewReader(data)}
+		reader := bufio.NewReader(recorder)
+		recorder.mark(reader)
+		recorder.limitHeader(c.max, reader)
+		_, err := httpport.ReadRequest(reader)
+		assert.Equal(t, c.err, recorder.checkHeader(c.max, reader, err))
+		assert.Equal(t, int64(0), recorder.limit)
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	large := "GET /large HTTP/1.1\r\nHost: example.com\r\nX-Large: " + strings.Repeat("a", 64*1024) + "\r\n\r\n"
+	// data after the oversized message is discarded, not parsed
+	following := "GET /next HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	var segments []testSegment
+	for i := 0; i < len(large); i += 1400 {
+		end := i + 1400
+		if end > len(large) {
+			end = len(large)
+		}
+		segments = append(segments, testSegment{up: true, payload: large[i:end]})
+	}
+	segments = append(segments, testSegment{up: true, payload: following})
+	segments = append(segments, testSegment{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"})
+
+	sink, printer := runHTTPConversation(&Config{maxHeaderBytes: 8192}, segments)
+	assert.Equal(t, 0, len(sink.exchanges))
+	var errors []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[error]") {
+			errors = append(errors, msg)
+		}
+	}
+	if assert.Equal(t, 1, len(errors)) {
+		assert.True(t, strings.HasPrefix(errors[0],
+			"[error] 10.0.0.1:50000 -> 10.0.0.2:80 parse request error: header too large, at offset "), errors[0])
+	}
+
+	// oversized response header
+	sink, printer = runHTTPConversation(&Config{maxHeaderBytes: 1024}, []testSegment{
+		{up: true, payload: following},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nX-Large: " + strings.Repeat("a", 2048) + "\r\n\r\n"},
+	})
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Equal(t, 0, sink.exchanges[0].status)
+	}
+	var found bool
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.Contains(msg, "parse response error: header too large") {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
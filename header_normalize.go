@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"httpdump/httpport"
+)
+
+// HeaderNormalization decide how header fields are represented in exchange records
+type HeaderNormalization int
+
+const (
+	// HeadersRaw keep one field per header line as on wire. Folded lines are unfolded by the parser
+	HeadersRaw HeaderNormalization = iota
+	// HeadersJoin merge fields of the same name to one field at the first position, with values comma joined
+	HeadersJoin
+	// HeadersList split comma separated values of list headers to one field per value
+	HeadersList
+)
+
+func parseHeaderNormalization(value string) (HeaderNormalization, error) {
+	switch value {
+	case "raw":
+		return HeadersRaw, nil
+	case "join":
+		return HeadersJoin, nil
+	case "list":
+		return HeadersList, nil
+	}
+	return HeadersRaw, fmt.Errorf("invalid header normalization: %s", value)
+}
+
+// headers whose value is a comma separated list by spec, so split by HeadersList.
+// Headers like Set-Cookie and Expires have commas inside values, and are never split or joined
+var listHeaders = map[string]bool{
+	"Accept": true, "Accept-Charset": true, "Accept-Encoding": true, "Accept-Language": true,
+	"Accept-Ranges": true, "Allow": true, "Cache-Control": true, "Connection": true, "Content-Encoding": true,
+	"Content-Language": true, "If-Match": true, "If-None-Match": true, "Pragma": true, "Te": true,
+	"Trailer": true, "Transfer-Encoding": true, "Upgrade": true, "Vary": true, "Via": true,
+	"X-Forwarded-For": true,
+}
+
+// headers not joined by HeadersJoin, since their values can not be combined by commas
+var unjoinableHeaders = map[string]bool{"Set-Cookie": true, "Cookie": true}
+
+// normalize fields by mode, and replace runs of spaces and tabs in values by a single space.
+// fields are returned as is for HeadersRaw
+func normalizeHeaderFields(fields []headerField, mode HeaderNormalization) []headerField {
+	if mode == HeadersRaw {
+		return fields
+	}
+	var normalized = make([]headerField, 0, len(fields))
+	var positions = map[string]int{} // position of joined field by canonical name
+	for _, field := range fields {
+		value := collapseSpaces(field.value)
+		name := httpport.CanonicalHeaderKey(field.name)
+		switch {
+		case mode == HeadersJoin && !unjoinableHeaders[name]:
+			if idx, ok := positions[name]; ok {
+				normalized[idx].value += ", " + value
+				continue
+			}
+			positions[name] = len(normalized)
+			normalized = append(normalized, headerField{field.name, value})
+		case mode == HeadersList && listHeaders[name]:
+			for _, item := range splitHeaderList(value) {
+				normalized = append(normalized, headerField{field.name, item})
+			}
+		default:
+			normalized = append(normalized, headerField{field.name, value})
+		}
+	}
+	return normalized
+}
+
+func collapseSpaces(value string) string {
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == '\t' }), " ")
+}
+
+// split comma separated list, commas in quoted strings are not separators. empty items are dropped
+func splitHeaderList(value string) []string {
+	var items []string
+	var start int
+	var quoted, escaped bool
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			if item := strings.TrimSpace(value[start:i]); item != "" {
+				items = append(items, item)
+			}
+			start = i + 1
+		}
+	}
+	if item := strings.TrimSpace(value[start:]); item != "" {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHeaders(t *testing.T) {
+	segments := []testSegment{
+		{up: true, payload: "GET / HTTP/1.1\r\nHost: example.com\r\nX-Long: first\r\n   second\r\n\tthird\r\n" +
+			"Accept: text/html,  application/json\r\nX-Multi: 1\r\nAccept: */*\r\nX-Multi: 2\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n" +
+			"Cache-Control: no-cache, private=\"a, b\"\r\n\r\n"},
+	}
+
+	// folded header is unfolded even without normalization
+	sink, _ := runHTTPConversation(&Config{}, segments)
+	exchange := sink.exchanges[0]
+	assert.Equal(t, headerField{"X-Long", "first second third"}, exchange.requestHeaderFields()[1])
+	assert.Equal(t, headerField{"Accept", "text/html,  application/json"}, exchange.requestHeaderFields()[2])
+	assert.Nil(t, exchange.toProto().RawRequestHeaders)
+
+	sink, _ = runHTTPConversation(&Config{headerNormalization: HeadersJoin}, segments)
+	exchange = sink.exchanges[0]
+	assert.Equal(t, []headerField{{"Host", "example.com"}, {"X-Long", "first second third"},
+		{"Accept", "text/html, application/json, */*"}, {"X-Multi", "1, 2"}}, exchange.requestHeaderFields())
+	assert.Equal(t, []headerField{{"Set-Cookie", "a=1"}, {"Set-Cookie", "b=2"},
+		{"Cache-Control", `no-cache, private="a, b"`}}, exchange.responseHeaderFields())
+	// raw view is kept in record
+	record := exchange.toProto()
+	assert.Equal(t, 6, len(record.RawRequestHeaders))
+	assert.Equal(t, "text/html,  application/json", record.RawRequestHeaders[2].Value)
+	assert.Equal(t, 4, len(record.RequestHeaders))
+
+	sink, _ = runHTTPConversation(&Config{headerNormalization: HeadersList}, segments)
+	exchange = sink.exchanges[0]
+	assert.Equal(t, []headerField{{"Host", "example.com"}, {"X-Long", "first second third"},
+		{"Accept", "text/html"}, {"Accept", "application/json"}, {"X-Multi", "1"}, {"Accept", "*/*"},
+		{"X-Multi", "2"}}, exchange.requestHeaderFields())
+	assert.Equal(t, []headerField{{"Set-Cookie", "a=1"}, {"Set-Cookie", "b=2"},
+		{"Cache-Control", "no-cache"}, {"Cache-Control", `private="a, b"`}}, exchange.responseHeaderFields())
+}
+
+func TestParseHeaderNormalization(t *testing.T) {
+	mode, err := parseHeaderNormalization("list")
+	assert.NoError(t, err)
+	assert.Equal(t, HeadersList, mode)
+	_, err = parseHeaderNormalization("fold")
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/tcpassembly/tcpreader"
+
+	"httpdump/httpport"
+)
+
+// if payload starts with a HTTP/0.9 simple request line, e.g. "GET /index.html" without http version.
+// the response of a simple request is the bare body until connection close, without status line and headers
+func isHTTP09Request(payload []byte) bool {
+	end := bytes.IndexByte(payload, '\n')
+	if end < 0 || !bytes.HasPrefix(payload, []byte("GET ")) {
+		return false
+	}
+	uri := bytes.TrimRight(payload[len("GET "):end], "\r")
+	return len(uri) > 0 && bytes.IndexByte(uri, ' ') < 0
+}
+
+// if buffered data of reader starts with a HTTP/0.9 simple request line.
+// request line split across segments is not detected
+func peekHTTP09Request(reader *bufio.Reader) bool {
+	if _, err := reader.Peek(1); err != nil {
+		return false
+	}
+	data, _ := reader.Peek(reader.Buffered())
+	return isHTTP09Request(data)
+}
+
+// handle a HTTP/0.9 simple request and its response. The response is reported with status 200 and no headers,
+// its body is all data server sent until connection close. No more exchanges follow on the connection
+func (h *HTTPTrafficHandler) handleHTTP09(connection *TCPConnection, index int, firstByte time.Time,
+	requestRecorder *recordReader, requestReader *bufio.Reader, responseRecorder *recordReader,
+	responseReader *bufio.Reader) {
+	line, _ := requestReader.ReadString('\n')
+	line = strings.TrimRight(line, "\r\n")
+	req := &httpport.Request{Method: "GET", RequestURI: line[len("GET "):], Proto: "HTTP/0.9", RequestLine: line,
+		Header: httpport.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}
+	filtered := h.config.host != "" || h.config.uri != "" && !wildcardMatch(req.RequestURI, h.config.uri) ||
+		!h.config.exchangeRange.contains(index)
+
+	exchange := newExchange(h.key, index, req, connection.upStream)
+	exchange.scheme = connection.scheme()
+	exchange.requestBytes = h.readHeaderBytes(requestRecorder, requestReader)
+	if !filtered {
+		h.printRequest(req)
+		h.writeLine("")
+	}
+	exchange.requestDone(connection.upStream)
+	exchange.requestBytes.bodyDone(requestRecorder, requestReader)
+	h.transcript.writeMessage(true, index, exchange.requestStart, requestReader)
+	if h.config.slowRequest > 0 {
+		h.checkSlowRequest(exchange, firstByte, connection.upStream)
+	}
+
+	responseRecorder.mark(responseReader)
+	if _, err := responseReader.Peek(1); err != nil {
+		// connection closed without response
+		if !filtered {
+			h.writeExchange(exchange)
+		}
+		return
+	}
+	resp := &httpport.Response{Status: "200 OK", StatusCode: 200, Proto: "HTTP/0.9", Header: httpport.Header{},
+		ContentLength: -1, Body: ioutil.NopCloser(responseReader)}
+	exchange.setResponse(resp, connection.downStream)
+	exchange.responseBytes = h.readHeaderBytes(responseRecorder, responseReader)
+	if !filtered {
+		h.printResponse(resp)
+		if h.config.statusFilter.match(resp.StatusCode) {
+			h.flushBuffer()
+		}
+	} else {
+		tcpreader.DiscardBytesToEOF(resp.Body)
+	}
+	exchange.responseDone(connection.downStream)
+	exchange.responseBytes.bodyDone(responseRecorder, responseReader)
+	h.transcript.writeMessage(false, index, exchange.responseStart, responseReader)
+	if !filtered {
+		h.writeExchange(exchange)
+	}
+}
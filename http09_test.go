@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsHTTP09Request(t *testing.T) {
+	assert.True(t, isHTTP09Request([]byte("GET /\r\n")))
+	assert.True(t, isHTTP09Request([]byte("GET /index.html\n")))
+	assert.False(t, isHTTP09Request([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+	assert.False(t, isHTTP09Request([]byte("GET /index.html")))
+	assert.False(t, isHTTP09Request([]byte("POST /\r\n")))
+	assert.False(t, isHTTP09Request([]byte("GET \r\n")))
+}
+
+func TestHTTP09(t *testing.T) {
+	body := "<html>hello</html>\n"
+	segments := []testSegment{
+		{up: true, payload: "GET /\r\n"},
+		{up: false, payload: body},
+		{up: false, payload: body},
+	}
+	sink, _ := runHTTPConversation(&Config{http09: true}, segments)
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		exchange := sink.exchanges[0]
+		assert.Equal(t, "GET", exchange.method)
+		assert.Equal(t, "/", exchange.url)
+		assert.Equal(t, 200, exchange.status)
+		assert.Equal(t, 0, len(exchange.responseHeaders))
+		assert.Equal(t, int64(2*len(body)), exchange.responseBodySize)
+		assert.Equal(t, "", exchange.closeReason)
+	}
+
+	// request without response
+	sink, _ = runHTTPConversation(&Config{http09: true}, segments[:1])
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Equal(t, 0, sink.exchanges[0].status)
+	}
+
+	// not detected as http if disabled
+	sink, _ = runHTTPConversation(&Config{}, segments)
+	assert.Equal(t, 0, len(sink.exchanges))
+}
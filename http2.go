@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"httpdump/httpport"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// client connection preface of http2 with prior knowledge(h2c)
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// http2 frame types
+const (
+	http2FrameData         = 0x0
+	http2FrameHeaders      = 0x1
+	http2FrameRSTStream    = 0x3
+	http2FrameSettings     = 0x4
+	http2FramePushPromise  = 0x5
+	http2FrameContinuation = 0x9
+)
+
+// http2 frame flags
+const (
+	http2FlagEndStream  = 0x1
+	http2FlagAck        = 0x1
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+)
+
+// range of SETTINGS_MAX_FRAME_SIZE, the initial value is the min
+const (
+	http2DefaultFrameSize = 1 << 14
+	http2MaxFrameSize     = 1<<24 - 1
+)
+
+var errHTTP2Frame = errors.New("malformed http2 frame")
+var errHTTP2FrameSize = errors.New("http2 frame exceeds max frame size")
+
+// http2Frame is a http2 frame, with payload
+type http2Frame struct {
+	frameType byte
+	flags     byte
+	streamID  uint32
+	payload   []byte
+}
+
+// read a frame with payload not longer than maxSize
+func readHTTP2Frame(reader *bufio.Reader, maxSize uint32) (*http2Frame, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	if length > int(maxSize) {
+		return nil, errHTTP2FrameSize
+	}
+	frame := &http2Frame{
+		frameType: header[3],
+		flags:     header[4],
+		streamID:  binary.BigEndian.Uint32(header[5:9]) & 0x7fffffff,
+		payload:   make([]byte, length),
+	}
+	if _, err := io.ReadFull(reader, frame.payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+// remove padding of DATA, HEADERS and PUSH_PROMISE frame payload
+func (frame *http2Frame) unpadded() ([]byte, error) {
+	payload := frame.payload
+	if frame.flags&http2FlagPadded == 0 {
+		return payload, nil
+	}
+	if len(payload) < 1 || int(payload[0]) > len(payload)-1 {
+		return nil, errHTTP2Frame
+	}
+	return payload[1 : len(payload)-int(payload[0])], nil
+}
+
+// if request stream starts with http2 connection preface
+func isHTTP2Preface(reader *bufio.Reader) bool {
+	// peek method first, to not block on short http/1 requests
+	if data, err := reader.Peek(3); err != nil || string(data) != "PRI" {
+		return false
+	}
+	data, err := reader.Peek(len(http2Preface))
+	return err == nil && string(data) == http2Preface
+}
+
+// http2Stream is a request/response exchange on a http2 stream, being reconstructed
+type http2Stream struct {
+	id               uint32
+	index            int // 1-based index of stream in connection, by order of request header received
+	requestHeaders   []hpack.HeaderField
+	responseHeaders  []hpack.HeaderField
+	requestBodySize  int64
+	responseBodySize int64
+	requestStart     time.Time
+	requestEnd       time.Time
+	responseStart    time.Time
+	responseEnd      time.Time
+	requestDone      bool // END_STREAM received from client, or stream reset
+	responseDone     bool // END_STREAM received from server, or stream reset
+}
+
+// http2Connection is state of streams of a http2 connection, shared by readers of the two directions.
+// streams are emitted in order of completion, when END_STREAM of both sides are received
+type http2Connection struct {
+	lock    sync.Mutex
+	h       *HTTPTrafficHandler
+	streams map[uint32]*http2Stream
+	count   int // streams with request received
+	// SETTINGS_HEADER_TABLE_SIZE sent by the peer of each direction, which limits dynamic table size of the encoder
+	tableSize [2]uint32
+	// SETTINGS_MAX_FRAME_SIZE sent by the peer of each direction, which limits frame payload of the sender
+	frameSize [2]uint32
+}
+
+// http2Reader read frames of one direction of a http2 connection
+type http2Reader struct {
+	connection *http2Connection
+	fromClient bool
+	reader     *bufio.Reader
+	stream     *NetworkStream
+	decoder    *hpack.Decoder
+	tableSize  uint32
+	// header block being received, continued by CONTINUATION frames
+	headerBlock     []byte
+	headerStream    uint32
+	headerEndStream bool
+	promisedStream  uint32 // promised stream id if header block is of PUSH_PROMISE, else 0
+}
+
+// parse http2 connection with prior knowledge, emit exchange of each stream when it completes
+func (h *HTTPTrafficHandler) handleHTTP2(connection *TCPConnection, requestReader *bufio.Reader,
+	responseReader *bufio.Reader) {
+	requestReader.Discard(len(http2Preface))
+	newHTTP2Connection(h).run(connection, requestReader, responseReader)
+}
+
+func newHTTP2Connection(h *HTTPTrafficHandler) *http2Connection {
+	return &http2Connection{h: h, streams: map[uint32]*http2Stream{}, tableSize: [2]uint32{4096, 4096},
+		frameSize: [2]uint32{http2DefaultFrameSize, http2DefaultFrameSize}}
+}
+
+// read frames of both directions after the connection preface, until the connection ends
+func (conn *http2Connection) run(connection *TCPConnection, requestReader *bufio.Reader, responseReader *bufio.Reader) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		conn.newReader(true, requestReader, connection.upStream).run()
+	}()
+	conn.newReader(false, responseReader, connection.downStream).run()
+	wg.Wait()
+	conn.flush()
+}
+
+func (conn *http2Connection) newReader(fromClient bool, reader *bufio.Reader, stream *NetworkStream) *http2Reader {
+	return &http2Reader{
+		connection: conn,
+		fromClient: fromClient,
+		reader:     reader,
+		stream:     stream,
+		decoder:    hpack.NewDecoder(4096, nil),
+		tableSize:  4096,
+	}
+}
+
+// read frames until stream ends. the remaining data is discarded if frames are malformed
+func (r *http2Reader) run() {
+	for {
+		frame, err := readHTTP2Frame(r.reader, r.connection.allowedFrameSize(r.fromClient))
+		if err == errHTTP2FrameSize {
+			logger.Warn("read http2 frame error:", err)
+			return
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.Debug("read http2 frame error:", err)
+			}
+			return
+		}
+		if err := r.handleFrame(frame); err != nil {
+			logger.Warn("parse http2 frame error:", err)
+			return
+		}
+	}
+}
+
+func (r *http2Reader) handleFrame(frame *http2Frame) error {
+	if r.headerBlock != nil && frame.frameType != http2FrameContinuation {
+		return errors.New("header block not ended before frame type " + strconv.Itoa(int(frame.frameType)))
+	}
+	switch frame.frameType {
+	case http2FrameHeaders:
+		payload, err := frame.unpadded()
+		if err != nil {
+			return err
+		}
+		if frame.flags&http2FlagPriority != 0 {
+			if len(payload) < 5 {
+				return errHTTP2Frame
+			}
+			payload = payload[5:]
+		}
+		r.headerStream = frame.streamID
+		r.headerEndStream = frame.flags&http2FlagEndStream != 0
+		r.promisedStream = 0
+		return r.addHeaderBlock(payload, frame.flags&http2FlagEndHeaders != 0)
+	case http2FramePushPromise:
+		payload, err := frame.unpadded()
+		if err != nil {
+			return err
+		}
+		if len(payload) < 4 {
+			return errHTTP2Frame
+		}
+		r.headerStream = frame.streamID
+		r.headerEndStream = false
+		r.promisedStream = binary.BigEndian.Uint32(payload[:4]) & 0x7fffffff
+		return r.addHeaderBlock(payload[4:], frame.flags&http2FlagEndHeaders != 0)
+	case http2FrameContinuation:
+		if r.headerBlock == nil || frame.streamID != r.headerStream {
+			return errors.New("unexpected CONTINUATION frame")
+		}
+		return r.addHeaderBlock(frame.payload, frame.flags&http2FlagEndHeaders != 0)
+	case http2FrameData:
+		payload, err := frame.unpadded()
+		if err != nil {
+			return err
+		}
+		r.connection.onData(r, frame.streamID, len(payload), frame.flags&http2FlagEndStream != 0)
+	case http2FrameRSTStream:
+		r.connection.onReset(frame.streamID)
+	case http2FrameSettings:
+		if frame.flags&http2FlagAck == 0 {
+			r.connection.onSettings(r.fromClient, frame.payload)
+		}
+	}
+	return nil
+}
+
+// collect header block fragment, decode the block when ended
+func (r *http2Reader) addHeaderBlock(fragment []byte, end bool) error {
+	r.headerBlock = append(r.headerBlock, fragment...)
+	if len(r.headerBlock) > maxHeadSize {
+		return errHeadTooLarge
+	}
+	if !end {
+		return nil
+	}
+	block := r.headerBlock
+	r.headerBlock = nil
+	if tableSize := r.connection.allowedTableSize(r.fromClient); tableSize != r.tableSize {
+		r.tableSize = tableSize
+		r.decoder.SetAllowedMaxDynamicTableSize(tableSize)
+	}
+	// header block is always decoded, to keep the dynamic table in sync with the encoder
+	fields, err := r.decoder.DecodeFull(block)
+	if err != nil {
+		return err
+	}
+	if r.promisedStream != 0 {
+		r.connection.onPushPromise(r, r.promisedStream, fields)
+	} else {
+		r.connection.onHeaders(r, r.headerStream, fields, r.headerEndStream)
+	}
+	return nil
+}
+
+// max dynamic table size allowed for decoder of the direction
+func (conn *http2Connection) allowedTableSize(fromClient bool) uint32 {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	// the table size of client encoder is set by server settings, and vice versa
+	if fromClient {
+		return conn.tableSize[1]
+	}
+	return conn.tableSize[0]
+}
+
+// max frame payload allowed for frames of the direction
+func (conn *http2Connection) allowedFrameSize(fromClient bool) uint32 {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if fromClient {
+		return conn.frameSize[1]
+	}
+	return conn.frameSize[0]
+}
+
+func (conn *http2Connection) onSettings(fromClient bool, payload []byte) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	for i := 0; i+6 <= len(payload); i += 6 {
+		id := binary.BigEndian.Uint16(payload[i:])
+		value := binary.BigEndian.Uint32(payload[i+2:])
+		if id == 0x1 { // SETTINGS_HEADER_TABLE_SIZE
+			if fromClient {
+				conn.tableSize[0] = value
+			} else {
+				conn.tableSize[1] = value
+			}
+		}
+		// SETTINGS_MAX_FRAME_SIZE, values out of range are protocol errors and ignored
+		if id == 0x5 && value >= http2DefaultFrameSize && value <= http2MaxFrameSize {
+			if fromClient {
+				conn.frameSize[0] = value
+			} else {
+				conn.frameSize[1] = value
+			}
+		}
+	}
+}
+
+// get stream by id, create if not exists. Should be called with lock held
+func (conn *http2Connection) stream(id uint32) *http2Stream {
+	stream := conn.streams[id]
+	if stream == nil {
+		stream = &http2Stream{id: id}
+		conn.streams[id] = stream
+	}
+	return stream
+}
+
+// set request headers of stream. Should be called with lock held
+func (conn *http2Connection) setRequest(stream *http2Stream, fields []hpack.HeaderField, timestamp time.Time) {
+	conn.count++
+	stream.index = conn.count
+	stream.requestHeaders = fields
+	stream.requestStart = timestamp
+}
+
+func (conn *http2Connection) onHeaders(r *http2Reader, id uint32, fields []hpack.HeaderField, endStream bool) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	stream := conn.stream(id)
+	timestamp := r.stream.lastTimestamp
+	if r.fromClient {
+		if stream.requestHeaders == nil {
+			conn.setRequest(stream, fields, timestamp)
+		}
+		// else is trailers
+	} else if stream.responseHeaders == nil || http2Status(stream.responseHeaders)/100 == 1 {
+		// informational responses are replaced by the final response
+		stream.responseHeaders = fields
+		stream.responseStart = timestamp
+	}
+	if endStream {
+		conn.endStream(r, stream)
+	} else {
+		// the stream may be ended by server, before request headers are read from the lagged client side
+		conn.tryEmit(stream)
+	}
+}
+
+// request of pushed stream is sent by server, and is already complete
+func (conn *http2Connection) onPushPromise(r *http2Reader, promised uint32, fields []hpack.HeaderField) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	stream := conn.stream(promised)
+	conn.setRequest(stream, fields, r.stream.lastTimestamp)
+	stream.requestEnd = r.stream.lastTimestamp
+	stream.requestDone = true
+	conn.tryEmit(stream)
+}
+
+func (conn *http2Connection) onData(r *http2Reader, id uint32, size int, endStream bool) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	stream := conn.stream(id)
+	if r.fromClient {
+		stream.requestBodySize += int64(size)
+	} else {
+		stream.responseBodySize += int64(size)
+	}
+	if endStream {
+		conn.endStream(r, stream)
+	}
+}
+
+// stream is aborted, no more frames on both sides
+func (conn *http2Connection) onReset(id uint32) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	stream := conn.stream(id)
+	stream.requestDone = true
+	stream.responseDone = true
+	conn.tryEmit(stream)
+}
+
+// one side of the stream ends, emit the stream if both sides ended. Should be called with lock held
+func (conn *http2Connection) endStream(r *http2Reader, stream *http2Stream) {
+	if r.fromClient {
+		stream.requestDone = true
+		stream.requestEnd = r.stream.lastTimestamp
+	} else {
+		stream.responseDone = true
+		stream.responseEnd = r.stream.lastTimestamp
+	}
+	conn.tryEmit(stream)
+}
+
+// emit the stream if request received, and both sides ended. Should be called with lock held
+func (conn *http2Connection) tryEmit(stream *http2Stream) {
+	if stream.requestHeaders != nil && stream.requestDone && stream.responseDone {
+		conn.emit(stream)
+	}
+}
+
+// emit streams not completed when connection ends, by order of request received
+func (conn *http2Connection) flush() {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	var streams []*http2Stream
+	for _, stream := range conn.streams {
+		streams = append(streams, stream)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].index < streams[j].index
+	})
+	for _, stream := range streams {
+		conn.emit(stream)
+	}
+}
+
+// send exchange of the stream to sinks, and forget the stream. Should be called with lock held
+func (conn *http2Connection) emit(stream *http2Stream) {
+	delete(conn.streams, stream.id)
+	if stream.requestHeaders == nil {
+		// stream without request, e.g. request headers not captured
+		return
+	}
+	h := conn.h
+	exchange := stream.toExchange(h.key)
+	if h.config.host != "" && !wildcardMatch(exchange.host, h.config.host) ||
+		h.config.uri != "" && !wildcardMatch(exchange.url, h.config.uri) ||
+		!h.config.exchangeRange.contains(exchange.index) {
+		return
+	}
+	h.writeExchange(exchange)
+}
+
+// status code of response header fields, 0 if not set
+func http2Status(fields []hpack.HeaderField) int {
+	for _, field := range fields {
+		if field.Name == ":status" {
+			status, _ := strconv.Atoi(field.Value)
+			return status
+		}
+	}
+	return 0
+}
+
+func (stream *http2Stream) toExchange(key ConnectionKey) *Exchange {
+	exchange := &Exchange{
+		key:              key,
+		index:            stream.index,
+		proto:            "HTTP/2.0",
+		status:           http2Status(stream.responseHeaders),
+		requestStart:     stream.requestStart,
+		requestEnd:       stream.requestEnd,
+		responseStart:    stream.responseStart,
+		responseEnd:      stream.responseEnd,
+		requestBodySize:  stream.requestBodySize,
+		responseBodySize: stream.responseBodySize,
+	}
+	for _, field := range stream.requestHeaders {
+		switch field.Name {
+		case ":method":
+			exchange.method = field.Value
+		case ":path":
+			exchange.url = field.Value
+		case ":authority":
+			exchange.host = field.Value
+		}
+	}
+	exchange.requestHeaders, exchange.requestHeader = http2HeaderLines(stream.requestHeaders)
+	if stream.responseHeaders != nil {
+		exchange.responseHeaders, exchange.responseHeader = http2HeaderLines(stream.responseHeaders)
+	}
+	return exchange
+}
+
+// header lines and header map of regular header fields, pseudo headers are skipped
+func http2HeaderLines(fields []hpack.HeaderField) ([]string, httpport.Header) {
+	var lines []string
+	var header = httpport.Header{}
+	for _, field := range fields {
+		if field.IsPseudo() {
+			continue
+		}
+		lines = append(lines, field.Name+": "+field.Value)
+		header.Add(field.Name, field.Value)
+	}
+	return lines, header
+}
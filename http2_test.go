@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2/hpack"
+)
+
+// build a http2 frame
+func http2FrameBytes(frameType byte, flags byte, streamID uint32, payload []byte) []byte {
+	var header [9]byte
+	header[0], header[1], header[2] = byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload))
+	header[3] = frameType
+	header[4] = flags
+	binary.BigEndian.PutUint32(header[5:], streamID)
+	return append(header[:], payload...)
+}
+
+// encode header fields with encoder, in name value pairs
+func http2HeaderBlock(encoder *hpack.Encoder, buffer *bytes.Buffer, pairs ...string) []byte {
+	buffer.Reset()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		encoder.WriteField(hpack.HeaderField{Name: pairs[i], Value: pairs[i+1]})
+	}
+	return append([]byte(nil), buffer.Bytes()...)
+}
+
+func parseTestFrame(t *testing.T, data []byte) *http2Frame {
+	frame, err := readHTTP2Frame(bufio.NewReader(bytes.NewReader(data)), http2MaxFrameSize)
+	assert.Nil(t, err)
+	return frame
+}
+
+func TestHTTP2StreamsEmittedByCompletion(t *testing.T) {
+	h := newTestTrafficHandler()
+	sink := &memorySink{}
+	h.sinks = []ExchangeSink{sink}
+	conn := newHTTP2Connection(h)
+	client := conn.newReader(true, nil, &NetworkStream{})
+	server := conn.newReader(false, nil, &NetworkStream{})
+
+	var clientBuffer, serverBuffer bytes.Buffer
+	clientEncoder := hpack.NewEncoder(&clientBuffer)
+	serverEncoder := hpack.NewEncoder(&serverBuffer)
+
+	slowRequest := http2HeaderBlock(clientEncoder, &clientBuffer, ":method", "GET", ":scheme", "http",
+		":authority", "example.com", ":path", "/slow", "user-agent", "test")
+	// padded, with priority
+	fastRequest := append([]byte{2, 0, 0, 0, 1, 16},
+		http2HeaderBlock(clientEncoder, &clientBuffer, ":method", "POST", ":scheme", "http",
+			":authority", "example.com", ":path", "/fast", "user-agent", "test")...)
+	fastRequest = append(fastRequest, 0, 0)
+	slowResponse := http2HeaderBlock(serverEncoder, &serverBuffer, ":status", "200", "content-type", "text/plain")
+	fastResponse := http2HeaderBlock(serverEncoder, &serverBuffer, ":status", "201", "content-type", "text/plain")
+
+	steps := []struct {
+		reader *http2Reader
+		frame  []byte
+	}{
+		{client, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders|http2FlagEndStream, 1, slowRequest)},
+		{client, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders|http2FlagPadded|http2FlagPriority, 3, fastRequest)},
+		{server, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders, 1, slowResponse)},
+		{server, http2FrameBytes(http2FrameData, 0, 1, []byte("he"))},
+		{client, http2FrameBytes(http2FrameData, http2FlagEndStream, 3, []byte("abc"))},
+		{server, http2FrameBytes(http2FrameHeaders, 0, 3, fastResponse[:1])},
+		{server, http2FrameBytes(http2FrameContinuation, http2FlagEndHeaders, 3, fastResponse[1:])},
+		{server, http2FrameBytes(http2FrameData, http2FlagEndStream, 3, []byte("ok"))},
+	}
+	for _, step := range steps {
+		assert.Nil(t, step.reader.handleFrame(parseTestFrame(t, step.frame)))
+	}
+	// stream 3 completes first, though it starts later
+	assert.Equal(t, 1, len(sink.exchanges))
+
+	assert.Nil(t, server.handleFrame(parseTestFrame(t,
+		http2FrameBytes(http2FrameData, http2FlagEndStream, 1, []byte("llo")))))
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Empty(t, conn.streams)
+
+	fast, slow := sink.exchanges[0], sink.exchanges[1]
+	assert.Equal(t, "POST", fast.method)
+	assert.Equal(t, "/fast", fast.url)
+	assert.Equal(t, "example.com", fast.host)
+	assert.Equal(t, 2, fast.index)
+	assert.Equal(t, 201, fast.status)
+	assert.Equal(t, int64(3), fast.requestBodySize)
+	assert.Equal(t, int64(2), fast.responseBodySize)
+	assert.Equal(t, []string{"user-agent: test"}, fast.requestHeaders)
+	assert.Equal(t, []string{"content-type: text/plain"}, fast.responseHeaders)
+
+	assert.Equal(t, "GET", slow.method)
+	assert.Equal(t, "/slow", slow.url)
+	assert.Equal(t, 1, slow.index)
+	assert.Equal(t, 200, slow.status)
+	assert.Equal(t, int64(0), slow.requestBodySize)
+	assert.Equal(t, int64(5), slow.responseBodySize)
+	assert.Equal(t, "text/plain", slow.responseHeader.Get("Content-Type"))
+}
+
+func TestHTTP2Connection(t *testing.T) {
+	var clientBuffer, serverBuffer bytes.Buffer
+	clientEncoder := hpack.NewEncoder(&clientBuffer)
+	serverEncoder := hpack.NewEncoder(&serverBuffer)
+
+	request := []byte(http2Preface)
+	request = append(request, http2FrameBytes(http2FrameSettings, 0, 0, nil)...)
+	request = append(request, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders|http2FlagEndStream, 1,
+		http2HeaderBlock(clientEncoder, &clientBuffer, ":method", "GET", ":scheme", "http",
+			":authority", "example.com", ":path", "/a"))...)
+	request = append(request, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders|http2FlagEndStream, 3,
+		http2HeaderBlock(clientEncoder, &clientBuffer, ":method", "GET", ":scheme", "http",
+			":authority", "example.com", ":path", "/b"))...)
+
+	response := http2FrameBytes(http2FrameSettings, 0, 0, nil)
+	response = append(response, http2FrameBytes(http2FrameSettings, http2FlagAck, 0, nil)...)
+	response = append(response, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders, 3,
+		http2HeaderBlock(serverEncoder, &serverBuffer, ":status", "404"))...)
+	response = append(response, http2FrameBytes(http2FrameHeaders, http2FlagEndHeaders, 1,
+		http2HeaderBlock(serverEncoder, &serverBuffer, ":status", "200"))...)
+	response = append(response, http2FrameBytes(http2FrameData, 0, 1, []byte("abc"))...)
+	response = append(response, http2FrameBytes(http2FrameData, http2FlagEndStream, 3, nil)...)
+	response = append(response, http2FrameBytes(http2FrameRSTStream, 0, 1, []byte{0, 0, 0, 8})...)
+
+	sink, _ := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: string(request)},
+		{up: false, payload: string(response)},
+	})
+	assert.Equal(t, 2, len(sink.exchanges))
+	statuses := map[string]int{}
+	for _, exchange := range sink.exchanges {
+		statuses[exchange.url] = exchange.status
+	}
+	assert.Equal(t, map[string]int{"/a": 200, "/b": 404}, statuses)
+}
+
+func TestHTTP2MaxFrameSize(t *testing.T) {
+	conn := newHTTP2Connection(newTestTrafficHandler())
+	// client allows frames up to 32768 bytes from server, server keeps the default
+	settings := []byte{0, 5, 0, 0, 0x80, 0}
+	// out of range value is ignored
+	settings = append(settings, 0, 5, 0, 0, 0, 1)
+	conn.onSettings(true, settings)
+	assert.Equal(t, uint32(http2DefaultFrameSize), conn.allowedFrameSize(true))
+	assert.Equal(t, uint32(32768), conn.allowedFrameSize(false))
+
+	frame := http2FrameBytes(http2FrameData, 0, 1, make([]byte, 20000))
+	_, err := readHTTP2Frame(bufio.NewReader(bytes.NewReader(frame)), conn.allowedFrameSize(true))
+	assert.Equal(t, errHTTP2FrameSize, err)
+	parsed, err := readHTTP2Frame(bufio.NewReader(bytes.NewReader(frame)), conn.allowedFrameSize(false))
+	assert.Nil(t, err)
+	assert.Equal(t, 20000, len(parsed.payload))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"httpdump/httpport"
+)
+
+// max length of file name made from method and path, without the extension
+const maxHTTPFileName = 100
+
+// HTTPFileSink write request of each exchange to a .http file in dir, in the format of VS Code REST Client
+// and JetBrains HTTP Client, so it can be executed by them directly
+type HTTPFileSink struct {
+	dir string
+}
+
+func newHTTPFileSink(dir string) (*HTTPFileSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &HTTPFileSink{dir: dir}, nil
+}
+
+// headers not written, body length and framing is set by the client tools, and body is written decoded
+var skipHTTPFileHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Content-Encoding":  true,
+}
+
+func (sink *HTTPFileSink) write(exchange *Exchange) error {
+	f, err := createUnique(sink.dir, httpFileName(exchange.method, exchange.url))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(formatHTTPFile(exchange))
+	return err
+}
+
+// Close do nothing, files are closed when written
+func (sink *HTTPFileSink) Close() error {
+	return nil
+}
+
+// file name from method and url path, with chars unsafe for file system replaced
+func httpFileName(method string, url string) string {
+	if idx := strings.IndexAny(url, "?#"); idx >= 0 {
+		url = url[:idx]
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '_'
+	}, method+"_"+strings.Trim(url, "/"))
+	name = strings.TrimRight(name, "_")
+	if len(name) > maxHTTPFileName {
+		name = name[:maxHTTPFileName]
+	}
+	if name == "" {
+		name = "request"
+	}
+	return name + ".http"
+}
+
+// request line with absolute url, headers, a blank line, then body
+func formatHTTPFile(exchange *Exchange) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# %s -> %s %s\n", exchange.key.srcString(), exchange.key.dstString(),
+		exchange.requestStart.Format(time.RFC3339Nano))
+	body := exchange.requestBodyData
+	if !utf8.Valid(body) {
+		fmt.Fprintf(&builder, "# binary body of %d bytes omitted\n", len(body))
+		body = nil
+	}
+	url := exchange.url
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		scheme := exchange.scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		url = scheme + "://" + exchange.host + url
+	}
+	fmt.Fprintf(&builder, "%s %s HTTP/1.1\n", exchange.method, url)
+	for _, header := range exchange.requestHeaderFields() {
+		name := httpport.CanonicalHeaderKey(header.name)
+		if skipHTTPFileHeaders[name] {
+			continue
+		}
+		if name == "Content-Type" && exchange.requestBodyTranscoded {
+			header.value = utf8ContentType(header.value)
+		}
+		fmt.Fprintf(&builder, "%s: %s\n", header.name, header.value)
+	}
+	if len(body) > 0 {
+		builder.WriteString("\n")
+		builder.Write(body)
+		if body[len(body)-1] != '\n' {
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
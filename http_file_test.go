@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"httpdump/httpport"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPFileName(t *testing.T) {
+	assert.Equal(t, "GET_api_users_1.http", httpFileName("GET", "/api/users/1?token=x"))
+	assert.Equal(t, "GET.http", httpFileName("GET", "/"))
+	assert.Equal(t, "POST_a_b____c.http", httpFileName("POST", "/a b/../c"))
+	assert.Equal(t, maxHTTPFileName+len(".http"), len(httpFileName("GET", "/"+strings.Repeat("a", 200))))
+}
+
+func TestHTTPFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	body := `{"name": "alice"}`
+	handler, _ := newTestHTTPHandler(&Config{keepRequestBody: true, redactHeaders: parseNameSet("authorization")})
+	sink, err := newHTTPFileSink(filepath.Join(dir, "requests"))
+	assert.Nil(t, err)
+	handler.sinks = append(handler.sinks, sink)
+	runConversation(handler, []testSegment{
+		{up: true, payload: "POST /api/users?debug=1 HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\n" +
+			"Authorization: Bearer secret\r\nContent-Length: 17\r\n\r\n" + body},
+		{up: false, payload: "HTTP/1.1 201 Created\r\nContent-Length: 0\r\n\r\n"},
+		{up: true, payload: "POST /api/users HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"},
+	})
+
+	files, err := filepath.Glob(filepath.Join(dir, "requests", "*"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "requests", "POST_api_users-1.http"),
+		filepath.Join(dir, "requests", "POST_api_users.http")}, files)
+
+	data, err := ioutil.ReadFile(files[1])
+	assert.Nil(t, err)
+	content := string(data)
+	assert.True(t, strings.HasPrefix(content, "# 10.0.0.1:50000 -> 10.0.0.2:80 2018-01-01T"), content)
+	assert.Contains(t, content, "\nPOST http://example.com/api/users?debug=1 HTTP/1.1\nHost: example.com\n"+
+		"Content-Type: application/json\nAuthorization: ***\n\n"+body+"\n")
+
+	// comment lines are skipped by the tools, the rest is a request
+	var lines []string
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	req, err := httpport.ReadRequest(bufio.NewReader(strings.NewReader(strings.Join(lines, ""))))
+	assert.Nil(t, err)
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "example.com", req.Host)
+	assert.Equal(t, "/api/users", req.URL.Path)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Empty(t, req.Header.Get("Content-Length"))
+
+	// body transcoded to utf-8 only if enabled
+	latin1 := "POST /notes HTTP/1.1\r\nHost: example.com\r\nContent-Type: text/plain; charset=ISO-8859-1\r\n" +
+		"Content-Length: 4\r\n\r\ncaf\xe9"
+	for _, transcode := range []bool{false, true} {
+		handler, _ = newTestHTTPHandler(&Config{keepRequestBody: true, transcodeCharset: transcode})
+		sink, err = newHTTPFileSink(filepath.Join(dir, "notes", strconv.FormatBool(transcode)))
+		assert.Nil(t, err)
+		handler.sinks = append(handler.sinks, sink)
+		runConversation(handler, []testSegment{
+			{up: true, payload: latin1},
+			{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+		})
+		data, err = ioutil.ReadFile(filepath.Join(dir, "notes", strconv.FormatBool(transcode), "POST_notes.http"))
+		assert.Nil(t, err)
+		if transcode {
+			assert.Contains(t, string(data), "\nContent-Type: text/plain; charset=utf-8\n\ncafé\n")
+		} else {
+			assert.Contains(t, string(data), "# binary body of 4 bytes omitted\n")
+			assert.Contains(t, string(data), "\nContent-Type: text/plain; charset=ISO-8859-1\n")
+		}
+	}
+
+	// scheme inferred from connection
+	assert.Contains(t, formatHTTPFile(&Exchange{method: "GET", url: "/", host: "example.com", scheme: "https"}),
+		"\nGET https://example.com/ HTTP/1.1\n")
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	"strings"
+	"time"
 
 	"bufio"
 	"github.com/google/gopacket/tcpassembly/tcpreader"
@@ -37,17 +38,52 @@ func (ck *ConnectionKey) dstString() string {
 
 // HTTPConnectionHandler impl ConnectionHandler
 type HTTPConnectionHandler struct {
-	config  *Config
-	printer *Printer
+	config        *Config
+	printer       *Printer
+	sinks         []ExchangeSink
+	statusCounter *StatusCounter
+	aggregator    *URLAggregator      // nil for not aggregate exchanges by url template
+	top           *TopExchanges       // nil for not ranking exchanges
+	differ        *ExchangeDiffer     // nil for not diffing repeated exchanges
+	suppressor    *ExchangeSuppressor // nil for not suppress duplicated exchanges
+	stats         *CaptureStats       // nil for not collecting stats
+	extractor     *FileExtractor      // nil for not extract uploaded files
+	unpaired      *UnpairedCounter    // nil for emitting exchanges without response
+	limit         *ExchangeLimit      // nil for unlimited
+	geoip         *GeoIPEnricher      // nil for no geoip enrichment
+	inventory     *EndpointInventory  // nil for not collecting endpoint inventory
+	dns           *DNSResolver        // nil for not correlating server ips with captured dns
+	ring          *ExchangeRing       // nil for output exchanges directly
+	// nil for output exchanges without waiting connection end
+	connectionFilter *ConnectionFilter
+	transcripts      *TranscriptWriter // nil for not writing connection transcripts
+	processes        *ProcessResolver  // nil for not associating local processes
 }
 
 func (handler *HTTPConnectionHandler) handle(src Endpoint, dst Endpoint, connection *TCPConnection) {
 	ck := ConnectionKey{src, dst}
 	trafficHandler := &HTTPTrafficHandler{
-		key:     ck,
-		buffer:  new(bytes.Buffer),
-		config:  handler.config,
-		printer: handler.printer,
+		key:              ck,
+		buffer:           new(bytes.Buffer),
+		config:           handler.config,
+		printer:          handler.printer,
+		sinks:            handler.sinks,
+		statusCounter:    handler.statusCounter,
+		aggregator:       handler.aggregator,
+		top:              handler.top,
+		differ:           handler.differ,
+		suppressor:       handler.suppressor,
+		stats:            handler.stats,
+		extractor:        handler.extractor,
+		unpaired:         handler.unpaired,
+		limit:            handler.limit,
+		geoip:            handler.geoip,
+		inventory:        handler.inventory,
+		dns:              handler.dns,
+		ring:             handler.ring,
+		connectionFilter: handler.connectionFilter,
+		transcripts:      handler.transcripts,
+		processes:        handler.processes,
 	}
 	waitGroup.Add(1)
 	go trafficHandler.handle(connection)
@@ -57,44 +93,187 @@ func (handler *HTTPConnectionHandler) finish() {
 	//handler.printer.finish()
 }
 
+// print status counts and aggregations, and close exchange sinks. should be called after all connections are handled
+func (handler *HTTPConnectionHandler) closeSinks() {
+	if handler.statusCounter != nil {
+		handler.printer.send(handler.statusCounter.format(handler.config.format))
+	}
+	if handler.aggregator != nil {
+		handler.printer.send(handler.aggregator.format(handler.config.format))
+	}
+	if handler.top != nil {
+		handler.printer.send(handler.top.format(handler.config.format))
+	}
+	if handler.suppressor != nil {
+		handler.printer.send(handler.suppressor.format(handler.config.format))
+	}
+	if handler.unpaired != nil {
+		handler.printer.send(handler.unpaired.format(handler.config.format))
+	}
+	if handler.ring != nil {
+		handler.printer.send(handler.ring.format(handler.config.format))
+	}
+	if handler.inventory != nil {
+		handler.printer.send(handler.inventory.format(handler.config.format))
+	}
+	for _, sink := range handler.sinks {
+		if err := sink.Close(); err != nil {
+			logger.Warn("close output error:", err)
+		}
+	}
+}
+
 // HTTPTrafficHandler parse a http connection traffic and send to printer
 type HTTPTrafficHandler struct {
-	key     ConnectionKey
-	buffer  *bytes.Buffer
-	config  *Config
-	printer *Printer
+	key           ConnectionKey
+	buffer        *bytes.Buffer
+	config        *Config
+	printer       *Printer
+	sinks         []ExchangeSink
+	statusCounter *StatusCounter
+	aggregator    *URLAggregator      // nil for not aggregate exchanges by url template
+	top           *TopExchanges       // nil for not ranking exchanges
+	differ        *ExchangeDiffer     // nil for not diffing repeated exchanges
+	suppressor    *ExchangeSuppressor // nil for not suppress duplicated exchanges
+	stats         *CaptureStats       // nil for not collecting stats
+	extractor     *FileExtractor      // nil for not extract uploaded files
+	unpaired      *UnpairedCounter    // nil for emitting exchanges without response
+	limit         *ExchangeLimit      // nil for unlimited
+	geoip         *GeoIPEnricher      // nil for no geoip enrichment
+	inventory     *EndpointInventory  // nil for not collecting endpoint inventory
+	dns           *DNSResolver        // nil for not correlating server ips with captured dns
+	ring          *ExchangeRing       // nil for output exchanges directly
+	// nil for output exchanges without waiting connection end
+	connectionFilter *ConnectionFilter
+	held             []ringEntry // exchanges held until connection ends
+	evicted          int         // held exchanges evicted beyond max held of connection filter
+	connection       *TCPConnection
+	transcripts      *TranscriptWriter     // nil for not writing connection transcripts
+	transcript       *connectionTranscript // transcript of the connection being handled
+	processes        *ProcessResolver      // nil for not associating local processes
+	// local processes owning the sockets of src and dst, nil if not found yet
+	srcProcess *processInfo
+	dstProcess *processInfo
+	// process record of the connection is sent
+	processReported bool
+	// exchanges not tracked because the connection exceeds max exchanges in flight
+	capped int
+	// tracked exchanges whose response had not ended when the latest request started
+	inFlight []*Exchange
+	// a body decoded since last check exceeded the decode limit
+	compressionBomb bool
+	summary         *connectionSummary // nil for not summarizing the connection
+	// last exchange whether the connection is reused after it is not known yet
+	reuseExchange *Exchange
 }
 
 // read http request/response stream, and do output
 func (h *HTTPTrafficHandler) handle(connection *TCPConnection) {
 	defer waitGroup.Done()
+	h.connection = connection
+	h.summary = h.startSummary()
+	// after held exchanges are released, all exchanges of connection are written
+	defer h.reportSummary()
+	defer h.finishReuse()
+	// after remaining data is discarded, connection has ended
+	defer h.releaseHeld()
+	defer h.reportCapped()
 	defer connection.upStream.Close()
 	defer connection.downStream.Close()
 	// filter by args setting
 
-	requestReader := bufio.NewReader(connection.upStream)
+	requestRecorder := &recordReader{reader: connection.upStream}
+	requestReader := bufio.NewReader(requestRecorder)
 	defer tcpreader.DiscardBytesToEOF(requestReader)
-	responseReader := bufio.NewReader(connection.downStream)
+	responseRecorder := &recordReader{reader: connection.downStream}
+	responseReader := bufio.NewReader(responseRecorder)
 	defer tcpreader.DiscardBytesToEOF(responseReader)
+	if h.config.firstLine {
+		h.handleFirstLines(requestReader, responseReader)
+		return
+	}
+	h.transcript = h.startTranscript(connection, requestRecorder, responseRecorder)
+	defer h.transcript.close("")
+	if isHTTP2Preface(requestReader) {
+		h.transcript.close("switched to http2")
+		h.handleHTTP2(connection, requestReader, responseReader)
+		return
+	}
 
-	for {
+	for index := 1; ; index++ {
 		h.buffer = new(bytes.Buffer)
 		filtered := false
+		requestRecorder.mark(requestReader)
+		var firstByte time.Time
+		if h.config.slowRequest > 0 {
+			firstByte = firstByteTimestamp(requestReader, connection.upStream)
+		}
+		if h.config.http09 && peekHTTP09Request(requestReader) {
+			h.handleHTTP09(connection, index, firstByte, requestRecorder, requestReader, responseRecorder,
+				responseReader)
+			break
+		}
+		if h.config.strictLineEndings {
+			if err := checkLineEndings(requestReader); err != nil {
+				logger.Warn("Error parsing HTTP requests:", err)
+				h.reportParseError(h.key, "parse request error", err, requestRecorder, requestReader)
+				break
+			}
+		}
+		requestRecorder.limitHeader(h.config.maxHeaderBytes, requestReader)
 		req, err := httpport.ReadRequest(requestReader)
+		err = requestRecorder.checkHeader(h.config.maxHeaderBytes, requestReader, err)
 
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			logger.Warn("Error parsing HTTP requests:", err)
+			if err == io.ErrUnexpectedEOF && h.config.slowRequest > 0 {
+				h.checkSlowRequest(nil, firstByte, connection.upStream)
+			}
+			if err != io.ErrUnexpectedEOF {
+				// headers rejected by the parser, like conflicting Content-Length values, are still checked
+				h.reportSmuggling(h.key, requestRecorder.headerLines(requestReader))
+				h.reportParseError(h.key, "parse request error", err, requestRecorder, requestReader)
+			}
 			break
 		}
+		h.reportSmuggling(h.key, req.RawHeaders)
 		if h.config.host != "" && !wildcardMatch(req.Host, h.config.host) {
 			filtered = true
 		}
 		if h.config.uri != "" && !wildcardMatch(req.RequestURI, h.config.uri) {
 			filtered = true
 		}
+		if !h.config.exchangeRange.contains(index) {
+			filtered = true
+		}
+
+		exchange := newExchange(h.key, index, req, connection.upStream)
+		if !filtered && h.config.maxConnExchanges > 0 && h.capExchange(exchange) {
+			// not tracked, so exchanges waiting for response of the connection are bounded
+			filtered = true
+			h.capped++
+		}
+		exchange.scheme = connection.scheme()
+		exchange.requestBytes = h.readHeaderBytes(requestRecorder, requestReader)
+		var rpcRequests []jsonRPCRequest
+		// skipped body is drained before buffered by any body feature
+		if !filtered && !h.skipBody(req.Body, req.Header) {
+			if h.config.jsonRPC {
+				rpcRequests = h.readJSONRPCRequests(req)
+			}
+			if h.suppressor != nil && h.config.dedupBody {
+				data, _ := h.bufferBody(&req.Body, req.Header)
+				exchange.requestBodyHash = bodyHash(data)
+			}
+			if h.extractor != nil {
+				h.extractUploads(req, exchange)
+			}
+			h.inspectBody(exchange, true, &req.Body, req.Header)
+		}
+		exchange.requestCompressionBomb = h.checkCompressionBomb(h.key, "request", exchange)
 
 		if !filtered {
 			h.printRequest(req)
@@ -102,30 +281,60 @@ func (h *HTTPTrafficHandler) handle(connection *TCPConnection) {
 		} else {
 			tcpreader.DiscardBytesToEOF(req.Body)
 		}
+		exchange.requestDone(connection.upStream)
+		exchange.requestBytes.bodyDone(requestRecorder, requestReader)
+		h.transcript.writeMessage(true, index, exchange.requestStart, requestReader)
+		if h.config.slowRequest > 0 {
+			h.checkSlowRequest(exchange, firstByte, connection.upStream)
+		}
 
 		// if is websocket request,  by header: Upgrade: websocket
 		websocket := req.Header.Get("Upgrade") == "websocket"
 		expectContinue := req.Header.Get("Expect") == "100-continue"
 
-		resp, err := httpport.ReadResponse(responseReader, nil)
+		resp, err := h.readFinalResponse(responseReader, responseRecorder, req, exchange)
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			logger.Debug("Error parsing HTTP requests: unexpected end, ", err, connection.clientID)
+			if !filtered {
+				h.writeExchange(exchange)
+			}
+			if h.config.unidirectional {
+				// response direction is ended or not captured, following requests are still parsed
+				continue
+			}
 			break
 		}
 		if err != nil {
 			logger.Warn("Error parsing HTTP response:", err, connection.clientID)
+			h.reportSmuggling(h.key.reverse(), responseRecorder.headerLines(responseReader))
+			h.reportParseError(h.key.reverse(), "parse response error", err, responseRecorder, responseReader)
+			if !filtered {
+				h.writeExchange(exchange)
+			}
 			break
 		}
-		if !filtered {
-			h.printResponse(resp)
-			h.printer.send(h.buffer.String())
-		} else {
-			tcpreader.DiscardBytesToEOF(resp.Body)
+		interim := expectContinue && resp.StatusCode == 100
+		h.handleResponse(connection, index, req, resp, exchange, filtered, interim, rpcRequests, responseRecorder,
+			responseReader)
+
+		if isTunnelEstablished(req, resp) {
+			// following traffic is tunneled, mostly tls, not http any more
+			h.transcript.close("switched to tunnel")
+			h.handleTunnel(req, requestReader, responseReader)
+			break
+		}
+
+		if isH2CUpgrade(req, resp) {
+			// following traffic is http2, started mid-stream
+			h.transcript.close("switched to h2c")
+			h.handleH2CUpgrade(connection, req, exchange, requestReader, responseReader)
+			break
 		}
 
 		if websocket {
 			if resp.StatusCode == 101 && resp.Header.Get("Upgrade") == "websocket" {
 				// change to handle websocket
+				h.transcript.close("switched to websocket")
 				h.handleWebsocket(requestReader, responseReader)
 				break
 			}
@@ -134,7 +343,7 @@ func (h *HTTPTrafficHandler) handle(connection *TCPConnection) {
 		if expectContinue {
 			if resp.StatusCode == 100 {
 				// read next response, the real response
-				resp, err := httpport.ReadResponse(responseReader, nil)
+				resp, err := h.readFinalResponse(responseReader, responseRecorder, req, exchange)
 				if err == io.EOF {
 					logger.Warn("Error parsing HTTP requests: unexpected end, ", err)
 					break
@@ -146,21 +355,432 @@ func (h *HTTPTrafficHandler) handle(connection *TCPConnection) {
 				}
 				if err != nil {
 					logger.Warn("Error parsing HTTP response:", err, connection.clientID)
+					h.reportSmuggling(h.key.reverse(), responseRecorder.headerLines(responseReader))
+					h.reportParseError(h.key.reverse(), "parse response error", err, responseRecorder, responseReader)
 					break
 				}
-				if !filtered {
-					h.printResponse(resp)
-					h.printer.send(h.buffer.String())
-				} else {
-					tcpreader.DiscardBytesToEOF(resp.Body)
-				}
+				h.handleResponse(connection, index, req, resp, exchange, filtered, false, rpcRequests,
+					responseRecorder, responseReader)
 			} else if resp.StatusCode == 417 {
 
 			}
 		}
 	}
 
-	h.printer.send(h.buffer.String())
+	h.flushBuffer()
+}
+
+// body features of a tracked request or response, each may read or buffer the body.
+// Results are set to the request or response fields of exchange by direction
+func (h *HTTPTrafficHandler) inspectBody(exchange *Exchange, up bool, body *io.ReadCloser, header httpport.Header) {
+	ck, message, keepBody := h.key, "request", h.config.keepRequestBody
+	if !up {
+		ck, message, keepBody = h.key.reverse(), "response", h.differ != nil
+	}
+	var digestMismatch, transcoded bool
+	var stats *bodyStats
+	var data []byte
+	if h.config.verifyDigest {
+		digestMismatch = h.verifyDigest(ck, message, body, header)
+	}
+	if h.config.bodyStats {
+		stats = h.readBodyStats(body, header)
+	}
+	if keepBody || h.config.jsonFilter != nil {
+		data, _ = h.bufferBody(body, header)
+		if h.config.transcodeCharset {
+			// kept body is emitted in utf-8, transcoded from the charset of Content-Type
+			_, charset := parseContentType(header.Get("Content-Type"))
+			var decoded string
+			if decoded, transcoded = decodeCharset(data, charset); transcoded {
+				data = []byte(decoded)
+			}
+		}
+	}
+	if up {
+		exchange.requestDigestMismatch, exchange.requestBodyStats, exchange.requestBodyData = digestMismatch, stats, data
+		exchange.requestBodyTranscoded = transcoded
+	} else {
+		exchange.responseDigestMismatch, exchange.responseBodyStats, exchange.responseBodyData = digestMismatch, stats,
+			data
+		exchange.responseBodyTranscoded = transcoded
+	}
+}
+
+// read and print response of exchange, and write exchange if response is final. An interim response is
+// 100 Continue of a request expecting it, the final response follows on the same exchange
+func (h *HTTPTrafficHandler) handleResponse(connection *TCPConnection, index int, req *httpport.Request,
+	resp *httpport.Response, exchange *Exchange, filtered bool, interim bool, rpcRequests []jsonRPCRequest,
+	responseRecorder *recordReader, responseReader *bufio.Reader) {
+	exchange.setResponse(resp, connection.downStream)
+	exchange.responseBytes = h.readHeaderBytes(responseRecorder, responseReader)
+	h.checkResponseBody(responseReader, req, resp, exchange)
+	h.reportSmuggling(h.key.reverse(), resp.RawHeaders)
+	if !filtered && !h.skipBody(resp.Body, resp.Header) {
+		h.inspectBody(exchange, false, &resp.Body, resp.Header)
+	}
+	if rpcRequests != nil && !interim {
+		h.reportJSONRPC(rpcRequests, resp)
+	}
+	exchange.responseCompressionBomb = h.checkCompressionBomb(h.key.reverse(), "response", exchange)
+	if !filtered {
+		h.printResponse(resp)
+		if h.config.statusFilter.match(resp.StatusCode) || interim {
+			h.flushBuffer()
+		}
+	} else {
+		tcpreader.DiscardBytesToEOF(resp.Body)
+	}
+	exchange.responseDone(connection.downStream)
+	exchange.responseBytes.bodyDone(responseRecorder, responseReader)
+	h.transcript.writeMessage(false, index, exchange.responseStart, responseReader)
+	if req.Method == "HEAD" && !interim {
+		h.checkAfterHEAD(responseReader, exchange)
+	}
+	if !filtered && !interim {
+		h.writeExchange(exchange)
+	}
+}
+
+// send printed messages of exchange to printer. Exchanges are not printed in inventory or summary only mode,
+// and are held with exchange records in ring mode or by connection filter
+func (h *HTTPTrafficHandler) flushBuffer() {
+	if h.inventory == nil && h.config.connectionSummary != SummaryOnly && h.ring == nil && h.connectionFilter == nil {
+		h.printer.send(h.buffer.String())
+	}
+}
+
+// read response, skip 103 Early Hints responses before the final response, and attach their hints to exchange
+func (h *HTTPTrafficHandler) readFinalResponse(reader *bufio.Reader, recorder *recordReader, req *httpport.Request,
+	exchange *Exchange) (*httpport.Response, error) {
+	for {
+		recorder.mark(reader)
+		if h.config.strictLineEndings {
+			if err := checkLineEndings(reader); err != nil {
+				return nil, err
+			}
+		}
+		recorder.limitHeader(h.config.maxHeaderBytes, reader)
+		resp, err := httpport.ReadResponse(reader, req)
+		err = recorder.checkHeader(h.config.maxHeaderBytes, reader, err)
+		if err != nil || resp.StatusCode != 103 {
+			return resp, err
+		}
+		exchange.addEarlyHints(resp)
+		tcpreader.DiscardBytesToEOF(resp.Body)
+	}
+}
+
+// send exchange record to all sinks
+func (h *HTTPTrafficHandler) writeExchange(exchange *Exchange) {
+	if h.connection != nil {
+		exchange.connectionStart = h.connection.createTimestamp
+	}
+	if h.connection != nil && (exchange.status == 0 || exchange.requestBodyShort || exchange.responseBodyShort) {
+		// exchange is cut by connection close
+		exchange.closeReason = h.connection.closeReason()
+		if h.config.warnReset && exchange.closeReason == closeByRST {
+			h.reportAborted(exchange)
+		}
+	}
+	h.trackReuse(exchange)
+	if h.unpaired != nil && exchange.status == 0 {
+		// request is held until response is parsed, discard it since connection ended without response
+		h.unpaired.add()
+		return
+	}
+	if h.statusCounter != nil {
+		// discarded requests are counted by unpaired only, not as no-response
+		h.statusCounter.count(exchange.status)
+	}
+	if !h.config.statusFilter.match(exchange.status) || !h.config.jsonFilter.match(exchange) {
+		return
+	}
+	h.summary.add(exchange)
+	if h.aggregator != nil {
+		h.aggregator.add(exchange)
+	}
+	if h.top != nil {
+		h.top.add(exchange)
+	}
+	if h.differ != nil {
+		if diff := h.differ.add(exchange); diff != nil {
+			h.printer.send(diff.format(exchange.key, h.config.format))
+		}
+	}
+	if h.inventory != nil {
+		h.inventory.add(exchange)
+	}
+	if h.suppressor != nil {
+		suppressed, report := h.suppressor.suppress(exchange, h.config.format)
+		if suppressed {
+			return
+		}
+		if report != "" {
+			h.printer.send(report)
+		}
+	}
+	if h.limit != nil && !h.limit.take() {
+		return
+	}
+	if h.config.parseCookies {
+		h.reportCookies(exchange)
+	}
+	if h.geoip != nil {
+		h.enrichGeo(exchange)
+	}
+	if h.processes != nil {
+		h.enrichProcess(exchange)
+	}
+	if h.config.parseForwarded {
+		h.reportForwarded(exchange)
+	}
+	if h.dns != nil {
+		h.correlateDNS(exchange)
+	}
+	if h.config.bodyStats {
+		h.reportBodyStats(exchange)
+	}
+	if h.config.messageBytes {
+		h.reportMessageBytes(exchange)
+	}
+	if h.config.cacheInfo {
+		h.reportCache(exchange)
+	}
+	exchange.requestHeaders = redactHeaders(exchange.requestHeaders, h.config.redactHeaders)
+	exchange.responseHeaders = redactHeaders(exchange.responseHeaders, h.config.redactHeaders)
+	exchange.requestHeader = redactHeaderMap(exchange.requestHeader, h.config.redactHeaders)
+	exchange.responseHeader = redactHeaderMap(exchange.responseHeader, h.config.redactHeaders)
+	exchange.rawHeaderNames = h.config.rawHeaders
+	exchange.headerNormalization = h.config.headerNormalization
+	if h.stats != nil {
+		h.stats.addExchanges(1)
+	}
+	if h.connectionFilter != nil {
+		h.holdExchange(exchange, h.buffer.String())
+		return
+	}
+	if h.ring != nil {
+		h.ring.add(exchange, h.buffer.String(), h.emitExchange)
+		return
+	}
+	h.writeSinks(exchange)
+}
+
+// output exchange released by connection filter
+func (h *HTTPTrafficHandler) outputExchange(exchange *Exchange, text string) {
+	if h.ring != nil {
+		h.ring.add(exchange, text, h.emitExchange)
+		return
+	}
+	h.emitExchange(exchange, text)
+}
+
+// output printed text and record of exchange held by ring or connection filter
+func (h *HTTPTrafficHandler) emitExchange(exchange *Exchange, text string) {
+	if h.inventory == nil && h.config.connectionSummary != SummaryOnly {
+		h.printer.send(text)
+	}
+	h.writeSinks(exchange)
+}
+
+func (h *HTTPTrafficHandler) writeSinks(exchange *Exchange) {
+	for _, sink := range h.sinks {
+		if err := sink.write(exchange); err != nil {
+			logger.Warn("write exchange record error:", err)
+		}
+	}
+}
+
+// if exchange should not be tracked, as max exchanges are in flight when its request starts: requests pipelined
+// before previous responses end, or whose response is not captured. Exchanges within the max are tracked
+func (h *HTTPTrafficHandler) capExchange(exchange *Exchange) bool {
+	inFlight := h.inFlight[:0]
+	for _, tracked := range h.inFlight {
+		if tracked.responseEnd.IsZero() || tracked.responseEnd.After(exchange.requestStart) {
+			inFlight = append(inFlight, tracked)
+		}
+	}
+	h.inFlight = inFlight
+	if len(inFlight) >= h.config.maxConnExchanges {
+		return true
+	}
+	h.inFlight = append(h.inFlight, exchange)
+	return false
+}
+
+// emit a record of exchanges not tracked because the connection exceeds max exchanges in flight
+func (h *HTTPTrafficHandler) reportCapped() {
+	if h.capped == 0 {
+		return
+	}
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":    "capped",
+			"src":     h.key.srcString(),
+			"dst":     h.key.dstString(),
+			"skipped": h.capped,
+			"max":     h.config.maxConnExchanges,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	h.printer.send(fmt.Sprintln("[capped]", h.key.srcString(), "->", h.key.dstString(), h.capped,
+		"exchanges skipped, beyond", h.config.maxConnExchanges, "exchanges in flight per connection"))
+}
+
+// emit a warning record of exchange whose connection is reset with request in flight
+func (h *HTTPTrafficHandler) reportAborted(exchange *Exchange) {
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":   "aborted",
+			"src":    h.key.srcString(),
+			"dst":    h.key.dstString(),
+			"method": exchange.method,
+			"url":    exchange.host + exchange.url,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	h.printer.send(fmt.Sprintln("[aborted]", h.key.srcString(), "->", h.key.dstString(), exchange.method,
+		exchange.host+exchange.url, "connection reset with request in flight"))
+}
+
+// emit a security warning record if message headers look like a request smuggling attempt
+func (h *HTTPTrafficHandler) reportSmuggling(ck ConnectionKey, rawHeaders []string) {
+	for _, indicator := range smugglingIndicators(rawHeaders) {
+		if h.config.format == "json" {
+			data, _ := json.Marshal(map[string]interface{}{
+				"type":      "security",
+				"src":       ck.srcString(),
+				"dst":       ck.dstString(),
+				"indicator": indicator,
+			})
+			h.printer.send(string(data) + "\n")
+			continue
+		}
+		h.printer.send(fmt.Sprintln("[security]", ck.srcString(), "->", ck.dstString(), indicator))
+	}
+}
+
+// check raw header lines for classic request smuggling vectors: Content-Length coexisting with
+// chunked Transfer-Encoding, and duplicated Content-Length headers.
+// Raw headers are used since the parser drops Content-Length when Transfer-Encoding is present.
+func smugglingIndicators(rawHeaders []string) []string {
+	var contentLengths []string
+	var chunked bool
+	for _, header := range rawHeaders {
+		idx := strings.IndexByte(header, ':')
+		if idx < 0 {
+			continue
+		}
+		name := strings.TrimSpace(header[:idx])
+		value := strings.TrimSpace(header[idx+1:])
+		if strings.EqualFold(name, "Content-Length") {
+			contentLengths = append(contentLengths, value)
+		} else if strings.EqualFold(name, "Transfer-Encoding") && strings.Contains(strings.ToLower(value), "chunked") {
+			chunked = true
+		}
+	}
+
+	var indicators []string
+	if chunked && len(contentLengths) > 0 {
+		indicators = append(indicators, "both Content-Length and Transfer-Encoding: chunked present")
+	}
+	if len(contentLengths) > 1 {
+		kind := "duplicated"
+		for _, value := range contentLengths[1:] {
+			if value != contentLengths[0] {
+				kind = "conflicting"
+			}
+		}
+		indicators = append(indicators, kind+" Content-Length headers: "+strings.Join(contentLengths, ", "))
+	}
+	return indicators
+}
+
+// read request body as json-rpc calls. the body is kept for later printing
+func (h *HTTPTrafficHandler) readJSONRPCRequests(req *httpport.Request) []jsonRPCRequest {
+	data, err := h.bufferBodyWithin(&req.Body, req.Header, h.jsonRPCMaxBody())
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	requests, err := parseJSONRPCRequests(data)
+	if err != nil {
+		return nil
+	}
+	return requests
+}
+
+// pair json-rpc calls with response body by id, and send to printer
+func (h *HTTPTrafficHandler) reportJSONRPC(requests []jsonRPCRequest, resp *httpport.Response) {
+	data, _ := h.bufferBodyWithin(&resp.Body, resp.Header, h.jsonRPCMaxBody())
+	// responses is empty if body is not json-rpc or too large, then all calls are reported without response
+	responses, _ := parseJSONRPCResponses(data)
+	for _, pair := range pairJSONRPC(requests, responses) {
+		h.printer.send(pair.format(h.key, h.config.format))
+	}
+}
+
+// read all body content, replace body with a reader of the read content so it can be read again.
+// return content decoded by content-encoding. If decoded content exceeds the limit, content decoded before
+// the limit is returned with errCompressionBomb
+func (h *HTTPTrafficHandler) bufferBody(body *io.ReadCloser, header httpport.Header) ([]byte, error) {
+	return h.bufferBodyWithin(body, header, -1)
+}
+
+// json-rpc bodies are buffered at most the max decode size, -1 for unlimited
+func (h *HTTPTrafficHandler) jsonRPCMaxBody() int64 {
+	if h.config.decodeLimit.maxSize > 0 {
+		return h.config.decodeLimit.maxSize
+	}
+	return -1
+}
+
+// buffer body as bufferBody, if it is at most max bytes, -1 for unlimited. A larger body is not buffered,
+// errBodyTooLarge is returned and body can still be read as a whole
+func (h *HTTPTrafficHandler) bufferBodyWithin(body *io.ReadCloser, header httpport.Header, max int64) ([]byte,
+	error) {
+	var data []byte
+	var err error
+	if max < 0 {
+		data, err = ioutil.ReadAll(*body)
+	} else if data, err = ioutil.ReadAll(io.LimitReader(*body, max+1)); int64(len(data)) > max {
+		*body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), *body), *body}
+		return nil, errBodyTooLarge
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeContent(data, header.Get("Content-Encoding"), h.config.decodeLimit)
+	if err == errCompressionBomb {
+		h.compressionBomb = true
+	}
+	return decoded, err
+}
+
+// decode body content by content-encoding, support gzip and deflate. decoded size is bounded by limit
+func decodeContent(data []byte, contentEncoding string, limit decodeLimit) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	if contentEncoding == "" || contentEncoding == "identity" {
+		return data, nil
+	} else if strings.Contains(contentEncoding, "gzip") {
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	} else if strings.Contains(contentEncoding, "deflate") {
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	} else {
+		return nil, fmt.Errorf("unsupport Content-Encoding: %s", contentEncoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readDecoded(reader, limit.max(len(data)))
 }
 
 func (h *HTTPTrafficHandler) handleWebsocket(requestReader *bufio.Reader, responseReader *bufio.Reader) {
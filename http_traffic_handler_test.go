@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"httpdump/httpport"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTrafficHandler() *HTTPTrafficHandler {
+	return &HTTPTrafficHandler{
+		key:     ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"10.0.0.2", 80}},
+		config:  &Config{},
+		printer: &Printer{outputQueue: make(chan string, 16)},
+	}
+}
+
+func TestSmugglingContentLengthWithChunked(t *testing.T) {
+	data := "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n" +
+		"Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n"
+	req, err := httpport.ReadRequest(bufio.NewReader(strings.NewReader(data)))
+	assert.Nil(t, err)
+
+	h := newTestTrafficHandler()
+	h.reportSmuggling(h.key, req.RawHeaders)
+	assert.Equal(t, 1, len(h.printer.outputQueue))
+	msg := <-h.printer.outputQueue
+	assert.True(t, strings.HasPrefix(msg, "[security] 10.0.0.1:50000 -> 10.0.0.2:80"))
+	assert.Contains(t, msg, "Transfer-Encoding: chunked")
+}
+
+func TestSmugglingDuplicatedContentLength(t *testing.T) {
+	data := "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 3\r\n" +
+		"Content-Length: 3\r\n\r\nabc"
+	req, err := httpport.ReadRequest(bufio.NewReader(strings.NewReader(data)))
+	assert.Nil(t, err)
+
+	h := newTestTrafficHandler()
+	h.reportSmuggling(h.key, req.RawHeaders)
+	assert.Equal(t, 1, len(h.printer.outputQueue))
+	assert.Contains(t, <-h.printer.outputQueue, "duplicated Content-Length headers: 3, 3")
+
+	indicators := smugglingIndicators([]string{"Content-Length: 3", "content-length: 5", "Transfer-Encoding: chunked"})
+	assert.Equal(t, 2, len(indicators))
+	assert.Empty(t, smugglingIndicators([]string{"Content-Length: 3", "Host: example.com"}))
+}
+
+func TestSmugglingConflictingContentLength(t *testing.T) {
+	// the parser rejects the request, indicators are still reported from the header lines read
+	segments := []testSegment{{up: true, payload: "POST /upload HTTP/1.1\r\nHost: example.com\r\n" +
+		"Content-Length: 3\r\nContent-Length: 30\r\n\r\nabc"}}
+	for _, format := range []string{"text", "json"} {
+		_, printer := runHTTPConversation(&Config{format: format}, segments)
+		var records []string
+		for len(printer.outputQueue) > 0 {
+			if msg := <-printer.outputQueue; strings.Contains(msg, "security") {
+				records = append(records, msg)
+			}
+		}
+		if format == "json" {
+			assert.Equal(t, []string{`{"dst":"10.0.0.2:80","indicator":"conflicting Content-Length headers: 3, 30",` +
+				`"src":"10.0.0.1:50000","type":"security"}` + "\n"}, records)
+		} else {
+			assert.Equal(t, []string{"[security] 10.0.0.1:50000 -> 10.0.0.2:80 conflicting Content-Length headers: " +
+				"3, 30\n"}, records)
+		}
+	}
+}
+
+// collect exchange records in memory
+type memorySink struct {
+	lock      sync.Mutex
+	exchanges []*Exchange
+}
+
+func (sink *memorySink) write(exchange *Exchange) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.exchanges = append(sink.exchanges, exchange)
+	return nil
+}
+
+func (sink *memorySink) Close() error {
+	return nil
+}
+
+// testSegment is one tcp segment of a test conversation
+type testSegment struct {
+	up      bool // client to server
+	payload string
+	delay   time.Duration // delay since previous segment
+}
+
+func newTestHTTPHandler(config *Config) (*HTTPConnectionHandler, *memorySink) {
+	sink := &memorySink{}
+	printer := &Printer{outputQueue: make(chan string, 1024)}
+	return &HTTPConnectionHandler{config: config, printer: printer, sinks: []ExchangeSink{sink}}, sink
+}
+
+// feed a tcp conversation to assembler with a http connection handler, wait all connections handled.
+// each segment get acked by peer before next segment is sent
+func runHTTPConversation(config *Config, segments []testSegment) (*memorySink, *Printer) {
+	handler, sink := newTestHTTPHandler(config)
+	runConversation(handler, segments)
+	return sink, handler.printer
+}
+
+// feed a tcp conversation to assembler, and wait all connections handled
+func runConversation(handler ConnectionHandler, segments []testSegment) *TCPAssembler {
+	printer := &Printer{outputQueue: make(chan string, 1024)}
+	var config *Config
+	if httpHandler, ok := handler.(*HTTPConnectionHandler); ok {
+		printer = httpHandler.printer
+		config = httpHandler.config
+	}
+	assembler := newTCPAssembler(handler, printer)
+	if config != nil {
+		configureAssembler(assembler, config)
+	}
+
+	clientSeq, serverSeq := uint32(1000), uint32(5000)
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, segment := range segments {
+		timestamp = timestamp.Add(segment.delay)
+		if segment.up {
+			assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, segment.payload), timestamp)
+			clientSeq += uint32(len(segment.payload))
+			assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, ""), timestamp)
+		} else {
+			assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, segment.payload), timestamp)
+			serverSeq += uint32(len(segment.payload))
+			assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, ""), timestamp)
+		}
+	}
+	fin := clientPacket(clientSeq, serverSeq, "")
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, timestamp)
+	fin = serverPacket(serverSeq, clientSeq+1, "")
+	fin.FIN = true
+	assembler.assemble(testServerFlow, fin, timestamp)
+	assembler.finishAll()
+	waitGroup.Wait()
+	return assembler
+}
+
+func TestExchangeRecord(t *testing.T) {
+	sink, _ := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "POST /users HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\n"},
+		{up: true, payload: "hello", delay: time.Millisecond},
+		{up: false, payload: "HTTP/1.1 201 Created\r\nContent-Length: 10\r\n\r\n", delay: 10 * time.Millisecond},
+		{up: false, payload: "0123456789", delay: time.Millisecond},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, "10.0.0.1:50000", exchange.key.srcString())
+	assert.Equal(t, "POST", exchange.method)
+	assert.Equal(t, "/users", exchange.url)
+	assert.Equal(t, "example.com", exchange.host)
+	assert.Equal(t, 201, exchange.status)
+	assert.Equal(t, int64(5), exchange.requestBodySize)
+	assert.Equal(t, int64(10), exchange.responseBodySize)
+	assert.Equal(t, time.Millisecond, exchange.requestEnd.Sub(exchange.requestStart))
+	assert.Equal(t, 10*time.Millisecond, exchange.responseStart.Sub(exchange.requestEnd))
+	assert.Equal(t, time.Millisecond, exchange.responseEnd.Sub(exchange.responseStart))
+}
+
+func TestExchangeBodyShort(t *testing.T) {
+	sink, _ := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /download HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n"},
+		{up: false, payload: strings.Repeat("a", 40)},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, 200, exchange.status)
+	assert.Equal(t, int64(40), exchange.responseBodySize)
+	assert.True(t, exchange.responseBodyShort)
+	assert.False(t, exchange.requestBodyShort)
+}
+
+func TestPartialContent(t *testing.T) {
+	sink, _ := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /video HTTP/1.1\r\nHost: example.com\r\nRange: bytes=100-109\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 206 Partial Content\r\nContent-Range: bytes 100-109/5000\r\n" +
+			"Content-Length: 10\r\n\r\n0123456789"},
+		{up: true, payload: "GET /video HTTP/1.1\r\nHost: example.com\r\nRange: bytes=0-99\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 206 Partial Content\r\nContent-Range: bytes 0-99/5000\r\n" +
+			"Content-Length: 10\r\n\r\n0123456789"},
+	})
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, 206, sink.exchanges[0].status)
+	assert.Equal(t, int64(10), sink.exchanges[0].responseBodySize)
+	assert.False(t, sink.exchanges[0].responseBodyShort)
+	assert.False(t, sink.exchanges[0].responseRangeMismatch)
+	assert.True(t, sink.exchanges[1].responseRangeMismatch)
+	assert.True(t, sink.exchanges[1].toProto().ResponseRangeMismatch)
+
+	size, ok := contentRangeSize("bytes 0-499/*")
+	assert.True(t, ok)
+	assert.Equal(t, int64(500), size)
+	_, ok = contentRangeSize("bytes */5000")
+	assert.False(t, ok)
+}
+
+func TestConnectTunnel(t *testing.T) {
+	hello := clientHelloRecord(t, "secure.example.com", nil)
+	sink, printer := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "CONNECT secure.example.com:443 HTTP/1.1\r\nHost: secure.example.com:443\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 Connection Established\r\n\r\n"},
+		{up: true, payload: string(hello)},
+		{up: false, payload: "\x16\x03\x03\x00\x02\x02\x00"},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, "CONNECT", sink.exchanges[0].method)
+	assert.Equal(t, 200, sink.exchanges[0].status)
+
+	var tunnels []string
+	for len(printer.outputQueue) > 0 {
+		msg := <-printer.outputQueue
+		if strings.HasPrefix(msg, "[tunnel]") {
+			tunnels = append(tunnels, msg)
+		}
+		assert.NotContains(t, msg, "[security]")
+	}
+	assert.Equal(t, []string{"[tunnel] 10.0.0.1:50000 -> 10.0.0.2:80 target=secure.example.com:443 " +
+		"sni=secure.example.com\n"}, tunnels)
+}
+
+func TestEarlyHints(t *testing.T) {
+	sink, _ := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /page HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\n" +
+			"Link: </script.js>; rel=preload; as=script\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nbody"},
+		{up: true, payload: "GET /next HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+	assert.Equal(t, 2, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, 200, exchange.status)
+	assert.Equal(t, int64(4), exchange.responseBodySize)
+	assert.Equal(t, []string{"</style.css>; rel=preload; as=style", "</script.js>; rel=preload; as=script"},
+		exchange.earlyHints)
+	assert.Equal(t, []string{"</style.css>; rel=preload; as=style", "</script.js>; rel=preload; as=script"},
+		exchange.toProto().EarlyHints)
+	assert.Equal(t, 204, sink.exchanges[1].status)
+	assert.Empty(t, sink.exchanges[1].earlyHints)
+}
+
+// requests of paths sent before any response, then responses each a millisecond after the previous one
+func pipelinedExchanges(paths ...string) []testSegment {
+	var segments []testSegment
+	for _, path := range paths {
+		segments = append(segments, testSegment{up: true, payload: "GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n"})
+	}
+	for range paths {
+		segments = append(segments, testSegment{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+			delay: time.Millisecond})
+	}
+	return segments
+}
+
+func TestMaxConnExchanges(t *testing.T) {
+	var paths []string
+	for i := 1; i <= 10; i++ {
+		paths = append(paths, "/item/"+strconv.Itoa(i))
+	}
+	sink, printer := runHTTPConversation(&Config{maxConnExchanges: 3}, pipelinedExchanges(paths...))
+	if assert.Equal(t, 3, len(sink.exchanges)) {
+		assert.Equal(t, "/item/3", sink.exchanges[2].url)
+	}
+	var records []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[capped]") {
+			records = append(records, msg)
+		}
+	}
+	assert.Equal(t, []string{"[capped] 10.0.0.1:50000 -> 10.0.0.2:80 7 exchanges skipped, beyond 3 exchanges in flight per connection\n"},
+		records)
+
+	sink, _ = runHTTPConversation(&Config{maxConnExchanges: 10}, pipelinedExchanges(paths...))
+	assert.Equal(t, 10, len(sink.exchanges))
+
+	// sequential exchanges are not in flight at the same time
+	var segments []testSegment
+	for _, path := range paths {
+		segments = append(segments, statusExchange(path, "200 OK")...)
+	}
+	segments = append(segments, pipelinedExchanges("/a", "/b", "/c", "/d")...)
+	sink, _ = runHTTPConversation(&Config{maxConnExchanges: 3}, segments)
+	if assert.Equal(t, 13, len(sink.exchanges)) {
+		assert.Equal(t, "/item/10", sink.exchanges[9].url)
+		assert.Equal(t, "/c", sink.exchanges[12].url)
+	}
+}
+
+func TestExchangeRange(t *testing.T) {
+	var segments []testSegment
+	for i := 1; i <= 10; i++ {
+		segments = append(segments, statusExchange("/item/"+strconv.Itoa(i), "200 OK")...)
+	}
+	indexRange, err := parseIndexRange("3-5")
+	assert.Nil(t, err)
+	sink, _ := runHTTPConversation(&Config{exchangeRange: indexRange}, segments)
+	assert.Equal(t, 3, len(sink.exchanges))
+	for i, exchange := range sink.exchanges {
+		assert.Equal(t, i+3, exchange.index)
+		assert.Equal(t, "/item/"+strconv.Itoa(i+3), exchange.url)
+	}
+
+	indexRange, _ = parseIndexRange("9-")
+	sink, _ = runHTTPConversation(&Config{exchangeRange: indexRange}, segments)
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, "/item/9", sink.exchanges[0].url)
+
+	indexRange, _ = parseIndexRange("-2")
+	assert.True(t, indexRange.contains(1))
+	assert.False(t, indexRange.contains(3))
+	indexRange, _ = parseIndexRange("4")
+	assert.False(t, indexRange.contains(3))
+	assert.True(t, indexRange.contains(4))
+	assert.False(t, indexRange.contains(5))
+	for _, value := range []string{"0-3", "5-3", "a-b", "-"} {
+		_, err = parseIndexRange(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestParseErrorRecord(t *testing.T) {
+	first := "GET /ok HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	sink, printer := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: first},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		{up: true, payload: "GET /bad HTTP/1.1\r\nHost: example.com\r\nthis is not a header\r\n\r\n"},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+
+	var errors []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[error]") {
+			errors = append(errors, msg)
+		}
+	}
+	assert.Equal(t, 1, len(errors))
+	assert.True(t, strings.HasPrefix(errors[0], "[error] 10.0.0.1:50000 -> 10.0.0.2:80 parse request error: "))
+	assert.Contains(t, errors[0], "malformed MIME header line: this is not a header")
+	assert.Contains(t, errors[0], "at offset "+strconv.Itoa(len(first))+`: "GET /bad HTTP/1.1\r\nHost: example.com\r\nthis is not a header\r\n"`)
+}
+
+func TestRawHeaders(t *testing.T) {
+	segments := []testSegment{
+		{up: true, payload: "GET / HTTP/1.1\r\nhost: example.com\r\nX-FoO-bar: 1\r\nAccept: */*\r\nx-foo-BAR: 2\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\nSERVER: test\r\n\r\n"},
+	}
+	sink, _ := runHTTPConversation(&Config{rawHeaders: true}, segments)
+	assert.Equal(t, 1, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, []headerField{{"host", "example.com"}, {"X-FoO-bar", "1"}, {"Accept", "*/*"}, {"x-foo-BAR", "2"}},
+		exchange.requestHeaderFields())
+	assert.Equal(t, []headerField{{"SERVER", "test"}}, exchange.responseHeaderFields())
+	// canonical map is kept alongside
+	assert.Equal(t, []string{"1", "2"}, exchange.requestHeader["X-Foo-Bar"])
+	assert.Equal(t, "X-FoO-bar", exchange.toProto().RequestHeaders[1].Name)
+
+	sink, _ = runHTTPConversation(&Config{}, segments)
+	assert.Equal(t, []headerField{{"Host", "example.com"}, {"X-Foo-Bar", "1"}, {"Accept", "*/*"}, {"X-Foo-Bar", "2"}},
+		sink.exchanges[0].requestHeaderFields())
+}
+
+func TestSOCKS5Tunnel(t *testing.T) {
+	segments := []testSegment{
+		// greeting with no-auth and username/password methods, server select username/password
+		{up: true, payload: "\x05\x02\x00\x02"},
+		{up: false, payload: "\x05\x02"},
+		{up: true, payload: "\x01\x04user\x04pass"},
+		{up: false, payload: "\x01\x00"},
+		// connect api.example.com:8080, with http request in same segment
+		{up: true, payload: "\x05\x01\x00\x03\x0fapi.example.com\x1f\x90" +
+			"GET /v1/items HTTP/1.1\r\nHost: api.example.com:8080\r\n\r\n"},
+		{up: false, payload: "\x05\x00\x00\x01\x00\x00\x00\x00\x00\x00"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n[]"},
+	}
+	sink, printer := runHTTPConversation(&Config{socks5: true}, segments)
+	assert.Equal(t, 1, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, "/v1/items", exchange.url)
+	assert.Equal(t, "api.example.com:8080", exchange.host)
+	assert.Equal(t, 200, exchange.status)
+	assert.Equal(t, int64(2), exchange.responseBodySize)
+
+	var records []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[socks5]") {
+			records = append(records, msg)
+		}
+	}
+	assert.Equal(t, []string{"[socks5] 10.0.0.1:50000 -> 10.0.0.2:80 target=api.example.com:8080\n"}, records)
+
+	// not parsed without the option
+	sink, _ = runHTTPConversation(&Config{}, segments)
+	assert.Empty(t, sink.exchanges)
+}
+
+// retransmitted handshake segments are not parsed again
+func TestSOCKS5Retransmission(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{socks5: true})
+	assembler := newTCPAssembler(handler, handler.printer)
+	configureAssembler(assembler, handler.config)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	greeting := "\x05\x01\x00"
+	connect := "\x05\x01\x00\x01\xc0\xa8\x00\x01\x00\x50"
+	request := "GET / HTTP/1.1\r\nHost: 192.168.0.1\r\n\r\n"
+	reply := "\x05\x00\x00\x01\x00\x00\x00\x00\x00\x00"
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	clientSeq := uint32(1000)
+	serverSeq := uint32(5000)
+	assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, greeting), start)
+	assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, greeting), start)
+	clientSeq += uint32(len(greeting))
+	assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, "\x05\x00"), start)
+	assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, "\x05\x00"), start)
+	serverSeq += 2
+	assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, connect), start)
+	// retransmission overlapping the connect request, with the http request
+	assembler.assemble(testClientFlow, clientPacket(clientSeq+4, serverSeq, connect[4:]+request), start)
+	clientSeq += uint32(len(connect + request))
+	assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, reply), start)
+	serverSeq += uint32(len(reply))
+	assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, response), start)
+	serverSeq += uint32(len(response))
+	fin := clientPacket(clientSeq, serverSeq, "")
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, start)
+	fin = serverPacket(serverSeq, clientSeq+1, "")
+	fin.FIN = true
+	assembler.assemble(testServerFlow, fin, start)
+	assembler.finishAll()
+	waitGroup.Wait()
+
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Equal(t, "/", sink.exchanges[0].url)
+		assert.Equal(t, 204, sink.exchanges[0].status)
+	}
+	var records []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[socks5]") {
+			records = append(records, msg)
+		}
+	}
+	assert.Equal(t, []string{"[socks5] 10.0.0.1:50000 -> 10.0.0.2:80 target=192.168.0.1:80\n"}, records)
+}
+
+func TestSOCKS5Handshake(t *testing.T) {
+	handshake := &socks5Handshake{}
+	rest, err := handshake.feed([]byte("\x05\x01\x00\x05\x01\x00"))
+	assert.Nil(t, err)
+	assert.Nil(t, rest)
+	rest, err = handshake.feed([]byte("\x01\xc0\xa8\x00\x01\x00\x50GET"))
+	assert.Nil(t, err)
+	assert.Equal(t, "GET", string(rest))
+	assert.Equal(t, "192.168.0.1:80", handshake.target)
+
+	handshake = &socks5Handshake{}
+	_, err = handshake.feed([]byte("\x05\x01\x00\x05\x02\x00\x01"))
+	assert.Equal(t, errNotSOCKS5, err)
+	_, err = (&socks5Handshake{}).feed([]byte("GET / HTTP/1.1\r\n"))
+	assert.Equal(t, errNotSOCKS5, err)
+}
+
+// with json format every record is a json line, so output streamed to a collector is valid NDJSON
+func TestJSONRecords(t *testing.T) {
+	handler, _ := newTestHTTPHandler(&Config{format: "json", warnReset: true, maxConnExchanges: 2})
+	handler.statusCounter = &StatusCounter{}
+	handler.aggregator = newURLAggregator(nil)
+	handler.top, _ = newTopExchanges(2, topByTTFB)
+	handler.suppressor = newExchangeSuppressor(time.Minute)
+	handler.ring, _ = newExchangeRing(10, 0, nil, "", 0)
+	// the third pipelined exchange is beyond max exchanges in flight of connection
+	runConversation(handler, pipelinedExchanges("/same", "/same", "/same"))
+
+	assembler := newTCPAssembler(handler, handler.printer)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET /slow HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), start)
+	assembler.assemble(testServerFlow, serverPacket(5000, 1000+uint32(len(request)), ""), start)
+	rst := serverPacket(5000, 1000+uint32(len(request)), "")
+	rst.RST = true
+	assembler.assemble(testServerFlow, rst, start)
+	assembler.finishAll()
+	waitGroup.Wait()
+	handler.closeSinks()
+
+	var types = map[string]bool{}
+	for len(handler.printer.outputQueue) > 0 {
+		msg := <-handler.printer.outputQueue
+		for _, line := range strings.SplitAfter(msg, "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]interface{}
+			if !assert.Nil(t, json.Unmarshal([]byte(line), &record), line) {
+				continue
+			}
+			if recordType, ok := record["type"].(string); ok {
+				types[recordType] = true
+			}
+		}
+	}
+	for _, recordType := range []string{"aborted", "capped", "status", "aggregate", "top", "suppressed", "ring"} {
+		assert.True(t, types[recordType], recordType)
+	}
+}
+
+func TestRequireResponse(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.unpaired = &UnpairedCounter{}
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /paired HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"},
+		{up: true, payload: "GET /unpaired HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, "/paired", sink.exchanges[0].url)
+	assert.Equal(t, 200, sink.exchanges[0].status)
+	assert.Equal(t, "[unpaired] 1 requests discarded without response\n", handler.unpaired.format("text"))
+
+	// exchanges without response are emitted by default
+	sink, _ = runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /unpaired HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, 0, sink.exchanges[0].status)
+}
+
+func TestResetWithRequestInFlight(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{warnReset: true})
+	assembler := newTCPAssembler(handler, handler.printer)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET /slow HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), start)
+	assembler.assemble(testServerFlow, serverPacket(5000, 1000+uint32(len(request)), ""), start)
+	rst := serverPacket(5000, 1000+uint32(len(request)), "")
+	rst.RST = true
+	assembler.assemble(testServerFlow, rst, start)
+	assembler.finishAll()
+	waitGroup.Wait()
+
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, 0, sink.exchanges[0].status)
+	assert.Equal(t, closeByRST, sink.exchanges[0].closeReason)
+	assert.Equal(t, closeByRST, sink.exchanges[0].toProto().CloseReason)
+	var warnings []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[aborted]") {
+			warnings = append(warnings, msg)
+		}
+	}
+	assert.Equal(t, []string{"[aborted] 10.0.0.1:50000 -> 10.0.0.2:80 GET example.com/slow connection reset with request in flight\n"},
+		warnings)
+
+	// completed exchanges have no close reason
+	sink, _ = runHTTPConversation(&Config{}, statusExchange("/done", "200 OK"))
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, "", sink.exchanges[0].closeReason)
+}
+
+func TestUnidirectionalRequests(t *testing.T) {
+	config := &Config{unidirectional: true}
+	handler, sink := newTestHTTPHandler(config)
+	assembler := newTCPAssembler(handler, handler.printer)
+	configureAssembler(assembler, config)
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	seq := uint32(1000)
+	for _, payload := range []string{
+		"POST /users HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhel",
+		"lo",
+		"GET /users/1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	} {
+		// server never acks, as its direction is not captured
+		assembler.assemble(testClientFlow, clientPacket(seq, 5000, payload), timestamp)
+		seq += uint32(len(payload))
+		timestamp = timestamp.Add(time.Millisecond)
+	}
+	fin := clientPacket(seq, 5000, "")
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, timestamp)
+	assembler.flushOlderThan(timestamp.Add(time.Minute))
+	waitGroup.Wait()
+
+	exchanges := sink.exchanges
+	assert.Equal(t, 2, len(exchanges))
+	assert.Equal(t, "POST", exchanges[0].method)
+	assert.Equal(t, "/users", exchanges[0].url)
+	assert.Equal(t, int64(5), exchanges[0].requestBodySize)
+	assert.Equal(t, "/users/1", exchanges[1].url)
+	assert.Equal(t, 0, exchanges[1].status)
+}
+
+func TestFastOpenRequest(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	assembler := newTCPAssembler(handler, handler.printer)
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET /first HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	// request data in SYN with cookie, SYN takes seq 999 and data starts at 1000
+	syn := clientPacket(999, 0, request)
+	syn.SYN, syn.ACK = true, false
+	assembler.assemble(testClientFlow, syn, timestamp)
+	clientSeq := uint32(1000 + len(request))
+	synAck := serverPacket(4999, clientSeq, "")
+	synAck.SYN = true
+	assembler.assemble(testServerFlow, synAck, timestamp)
+	assembler.assemble(testServerFlow, serverPacket(5000, clientSeq, response), timestamp)
+	serverSeq := uint32(5000 + len(response))
+	// the next request follows data of SYN without gap
+	next := "GET /second HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, next), timestamp)
+	clientSeq += uint32(len(next))
+	assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, response), timestamp)
+	serverSeq += uint32(len(response))
+	fin := clientPacket(clientSeq, serverSeq, "")
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, timestamp)
+	fin = serverPacket(serverSeq, clientSeq+1, "")
+	fin.FIN = true
+	assembler.assemble(testServerFlow, fin, timestamp)
+	assembler.assemble(testClientFlow, clientPacket(clientSeq+1, serverSeq+1, ""), timestamp)
+	waitGroup.Wait()
+
+	if assert.Equal(t, 2, len(sink.exchanges)) {
+		assert.Equal(t, "/first", sink.exchanges[0].url)
+		assert.Equal(t, 200, sink.exchanges[0].status)
+		assert.Equal(t, "/second", sink.exchanges[1].url)
+		assert.Equal(t, 200, sink.exchanges[1].status)
+	}
+	// no gap between SYN data and the following segment
+	for len(handler.printer.outputQueue) > 0 {
+		assert.False(t, strings.HasPrefix(<-handler.printer.outputQueue, "[lost]"))
+	}
+}
@@ -509,10 +509,21 @@ func fixLength(isResponse bool, status int, requestMethod string, header Header,
 	case 204, 304:
 		return 0, nil
 	}
+	// a successful CONNECT response turns the connection into a tunnel, there is no body
+	if isResponse && requestMethod == "CONNECT" && status/100 == 2 {
+		return 0, nil
+	}
 
 	if len(contentLens) > 1 {
 		// harden against HTTP request smuggling. See RFC 7230.
-		return 0, errors.New("http: message cannot contain multiple Content-Length headers")
+		// Identical duplicated values are tolerated, same as later net/http releases.
+		first := strings.TrimSpace(contentLens[0])
+		for _, ct := range contentLens[1:] {
+			if first != strings.TrimSpace(ct) {
+				return 0, errors.New("http: message cannot contain multiple Content-Length headers")
+			}
+		}
+		contentLens = contentLens[:1]
 	}
 
 	// Logic based on Transfer-Encoding
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointInventory collect the distinct set of method, host and url template of requests seen
+type EndpointInventory struct {
+	lock      sync.Mutex
+	rules     []URLTemplateRule
+	endpoints map[endpointSignature]*endpointEntry
+}
+
+type endpointSignature struct {
+	method string
+	host   string // lower cased
+	path   string // url template
+}
+
+type endpointEntry struct {
+	firstSeen time.Time // capture time of the earliest request
+	hits      int
+}
+
+func newEndpointInventory(rules []URLTemplateRule) *EndpointInventory {
+	if len(rules) == 0 {
+		rules = defaultURLTemplateRules
+	}
+	return &EndpointInventory{rules: rules, endpoints: map[endpointSignature]*endpointEntry{}}
+}
+
+func (inventory *EndpointInventory) add(exchange *Exchange) {
+	signature := endpointSignature{
+		method: exchange.method,
+		host:   strings.ToLower(exchange.host),
+		path:   applyURLTemplate(inventory.rules, exchange.url),
+	}
+	inventory.lock.Lock()
+	defer inventory.lock.Unlock()
+	entry := inventory.endpoints[signature]
+	if entry == nil {
+		entry = &endpointEntry{firstSeen: exchange.requestStart}
+		inventory.endpoints[signature] = entry
+	} else if exchange.requestStart.Before(entry.firstSeen) {
+		// exchanges are emitted by connections concurrently, not in order of request time
+		entry.firstSeen = exchange.requestStart
+	}
+	entry.hits++
+}
+
+// one line for each endpoint, ordered by host, path and method
+func (inventory *EndpointInventory) format(format string) string {
+	inventory.lock.Lock()
+	defer inventory.lock.Unlock()
+	var signatures []endpointSignature
+	for signature := range inventory.endpoints {
+		signatures = append(signatures, signature)
+	}
+	sort.Slice(signatures, func(i, j int) bool {
+		a, b := signatures[i], signatures[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		return a.method < b.method
+	})
+	var buffer strings.Builder
+	for _, signature := range signatures {
+		entry := inventory.endpoints[signature]
+		firstSeen := entry.firstSeen.UTC().Format(time.RFC3339Nano)
+		if format == "json" {
+			data, _ := json.Marshal(map[string]interface{}{
+				"type":      "inventory",
+				"method":    signature.method,
+				"host":      signature.host,
+				"path":      signature.path,
+				"hits":      entry.hits,
+				"firstSeen": firstSeen,
+			})
+			buffer.Write(data)
+			buffer.WriteString("\n")
+			continue
+		}
+		buffer.WriteString("[inventory] " + signature.method + " " + signature.host + signature.path +
+			" hits=" + strconv.Itoa(entry.hits) + " first-seen=" + firstSeen + "\n")
+	}
+	return buffer.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointInventory(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.inventory = newEndpointInventory(nil)
+	response := testSegment{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"}
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /users/1 HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		response,
+		{up: true, payload: "GET /users/2?page=3 HTTP/1.1\r\nHost: EXAMPLE.com\r\n\r\n", delay: time.Second},
+		response,
+		{up: true, payload: "POST /users/3 HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n", delay: time.Second},
+		response,
+		{up: true, payload: "GET /users/me HTTP/1.1\r\nHost: example.com\r\n\r\n", delay: time.Second},
+		response,
+		{up: true, payload: "GET /users/4 HTTP/1.1\r\nHost: api.example.com\r\n\r\n", delay: time.Second},
+		response,
+		{up: true, payload: "GET /users/5 HTTP/1.1\r\nHost: example.com\r\n\r\n", delay: time.Second},
+		response,
+	})
+	// exchanges are still written to sinks
+	assert.Equal(t, 6, len(sink.exchanges))
+
+	var printed []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.Contains(msg, "HTTP/1.1 200 OK") {
+			printed = append(printed, msg)
+		}
+	}
+	// exchanges are not printed in inventory mode
+	assert.Empty(t, printed)
+
+	assert.Equal(t, "[inventory] GET api.example.com/users/{id} hits=1 first-seen=2018-01-01T00:00:04Z\n"+
+		"[inventory] GET example.com/users/me hits=1 first-seen=2018-01-01T00:00:03Z\n"+
+		"[inventory] GET example.com/users/{id} hits=3 first-seen=2018-01-01T00:00:00Z\n"+
+		"[inventory] POST example.com/users/{id} hits=1 first-seen=2018-01-01T00:00:02Z\n",
+		handler.inventory.format("text"))
+	assert.True(t, strings.HasPrefix(handler.inventory.format("json"),
+		`{"firstSeen":"2018-01-01T00:00:04Z","hits":1,"host":"api.example.com","method":"GET","path":"/users/{id}","type":"inventory"}`+"\n"))
+}
+
+func TestEndpointInventoryFirstSeen(t *testing.T) {
+	inventory := newEndpointInventory([]URLTemplateRule{mustURLTemplateRule(t, "/v[0-9]+/=/{version}/")})
+	base := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	// emitted out of order by different connections
+	inventory.add(&Exchange{method: "GET", host: "example.com", url: "/v2/items", requestStart: base.Add(time.Minute)})
+	inventory.add(&Exchange{method: "GET", host: "example.com", url: "/v1/items", requestStart: base})
+	assert.Equal(t, "[inventory] GET example.com/{version}/items hits=2 first-seen=2018-01-01T00:00:00Z\n",
+		inventory.format("text"))
+}
+
+func mustURLTemplateRule(t *testing.T, value string) URLTemplateRule {
+	rule, err := parseURLTemplateRule(value)
+	assert.Nil(t, err)
+	return rule
+}
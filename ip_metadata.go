@@ -0,0 +1,46 @@
+package main
+
+import "github.com/google/gopacket/layers"
+
+// ipFields is the ip header fields of a captured packet recorded on connections
+type ipFields struct {
+	tos uint8  // ToS of ipv4, or traffic class of ipv6. DSCP is the high 6 bits
+	ttl uint8  // TTL of ipv4, or hop limit of ipv6
+	id  uint16 // identification of ipv4, 0 for ipv6 which has no id in fixed header
+}
+
+func ipv4Fields(ip *layers.IPv4) *ipFields {
+	return &ipFields{tos: ip.TOS, ttl: ip.TTL, id: ip.Id}
+}
+
+func ipv6Fields(ip *layers.IPv6) *ipFields {
+	return &ipFields{tos: ip.TrafficClass, ttl: ip.HopLimit}
+}
+
+// IPMetadata is ip layer metadata of packets of one direction: fields of the first packet, and whether any
+// later packet differs. DSCP or TTL changes mid-connection hint remarking or route changes, while IP ID
+// changing per packet is normal for most stacks
+type IPMetadata struct {
+	Packets    int64 // packets with ip layer captured, 0 if ip layer is unknown
+	DSCP       uint8
+	TTL        uint8
+	ID         uint16
+	DSCPVaries bool
+	TTLVaries  bool
+	IDVaries   bool
+}
+
+func (metadata *IPMetadata) add(ip *ipFields) {
+	if ip == nil {
+		return
+	}
+	dscp := ip.tos >> 2
+	if metadata.Packets == 0 {
+		metadata.DSCP, metadata.TTL, metadata.ID = dscp, ip.ttl, ip.id
+	} else {
+		metadata.DSCPVaries = metadata.DSCPVaries || dscp != metadata.DSCP
+		metadata.TTLVaries = metadata.TTLVaries || ip.ttl != metadata.TTL
+		metadata.IDVaries = metadata.IDVaries || ip.id != metadata.ID
+	}
+	metadata.Packets++
+}
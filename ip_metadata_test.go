@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// serialize a ethernet/ipv4/tcp packet between 10.0.0.1:50000 and 10.0.0.2:80 with ip header fields
+func ipPacketData(t testing.TB, up bool, tos uint8, ttl uint8, id uint16, tcp *layers.TCP, payload string) []byte {
+	ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TOS: tos, TTL: ttl, Id: id, Protocol: layers.IPProtocolTCP,
+		SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	tcp.SrcPort, tcp.DstPort = 50000, 80
+	if !up {
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		tcp.SrcPort, tcp.DstPort = tcp.DstPort, tcp.SrcPort
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ethernet, ip, tcp, gopacket.Payload(payload))
+	assert.Nil(t, err)
+	return buffer.Bytes()
+}
+
+func TestIPMetadata(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+	data := [][]byte{
+		// client marks EF(DSCP 46) with ECN bits set, which are not part of DSCP
+		ipPacketData(t, true, 0xb8|0x01, 64, 100, &layers.TCP{Seq: 999, SYN: true}, ""),
+		ipPacketData(t, false, 0, 57, 0, &layers.TCP{Seq: 4999, Ack: 1000, SYN: true, ACK: true}, ""),
+		ipPacketData(t, true, 0xb8, 64, 101, &layers.TCP{Seq: 1000, Ack: 5000, ACK: true}, request),
+		// route of server changed
+		ipPacketData(t, false, 0, 58, 0, &layers.TCP{Seq: 5000, Ack: 1000 + uint32(len(request)), ACK: true}, response),
+	}
+
+	packets := make(chan gopacket.Packet, len(data))
+	for _, packet := range data {
+		packets <- gopacket.NewPacket(packet, layers.LayerTypeEthernet, gopacket.Default)
+	}
+	close(packets)
+	var segments []*tcpSegment
+	for segment := range packetSegments(packets) {
+		segments = append(segments, segment)
+	}
+	decoder := newZeroCopyDecoder(layers.LinkTypeEthernet)
+	for i, packet := range data {
+		segment := decoder.decode(packet, time.Now())
+		assert.Equal(t, segments[i].ip, segment.ip)
+	}
+	assert.Equal(t, &ipFields{tos: 0xb9, ttl: 64, id: 100}, segments[0].ip)
+
+	assembler, handler := newTestAssembler()
+	for _, segment := range segments {
+		assembler.assembleIPPacket(segment.flow, segment.ip, segment.tcp, segment.timestamp, segment.number)
+	}
+	info := handler.connections[0].snapshot()
+	assert.Equal(t, IPMetadata{Packets: 2, DSCP: 46, TTL: 64, ID: 100, IDVaries: true}, info.ClientIP)
+	assert.Equal(t, IPMetadata{Packets: 2, DSCP: 0, TTL: 57, TTLVaries: true}, info.ServerIP)
+
+	// ip layer is unknown
+	var metadata IPMetadata
+	metadata.add(nil)
+	metadata.add(ipv6Fields(&layers.IPv6{TrafficClass: 0x28, HopLimit: 128}))
+	assert.Equal(t, IPMetadata{Packets: 1, DSCP: 10, TTL: 128}, metadata)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONFilter match exchanges whose request or response body is json, with values selected by a json path
+// satisfying a comparison. The path supports $ for the root, .name and ['name'] for object members, [n] for array
+// items with negative n counting from the end, and .* or [*] for all members or items. Without comparison,
+// a body matches if the path selects any value. Bodies not json never match
+type JSONFilter struct {
+	path  []jsonPathStep
+	op    string      // one of == != < <= > >=, empty for existence only
+	value interface{} // literal compared to, decoded as json values
+}
+
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// operators by length, so <= is found before <
+var jsonFilterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parse expression like $.error.code == 'RATE_LIMIT'. String literals are single or double quoted, other
+// literals are json numbers, true, false and null
+func parseJSONFilter(expression string) (*JSONFilter, error) {
+	pathText, op, literal := splitJSONFilter(expression)
+	filter := &JSONFilter{op: op}
+	var err error
+	if filter.path, err = parseJSONPath(pathText); err != nil {
+		return nil, err
+	}
+	if op == "" {
+		return filter, nil
+	}
+	if filter.value, err = parseJSONLiteral(literal); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// split expression at the first operator outside quotes
+func splitJSONFilter(expression string) (string, string, string) {
+	var quote byte
+	for i := 0; i < len(expression); i++ {
+		c := expression[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"':
+			quote = c
+			continue
+		}
+		for _, op := range jsonFilterOps {
+			if strings.HasPrefix(expression[i:], op) {
+				return strings.TrimSpace(expression[:i]), op, strings.TrimSpace(expression[i+len(op):])
+			}
+		}
+	}
+	return strings.TrimSpace(expression), "", ""
+}
+
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path should start with $: %s", path)
+	}
+	var steps []jsonPathStep
+	for rest := path[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("empty member name in json path: %s", path)
+			}
+			steps = append(steps, jsonPathStep{name: name, wildcard: name == "*"})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in json path: %s", path)
+			}
+			selector := strings.TrimSpace(rest[1:end])
+			if selector == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else if name, err := parseJSONLiteral(selector); err == nil && isQuoted(selector) {
+				steps = append(steps, jsonPathStep{name: name.(string)})
+			} else if index, err := strconv.Atoi(selector); err == nil {
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			} else {
+				return nil, fmt.Errorf("invalid selector [%s] in json path: %s", selector, path)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid json path: %s", path)
+		}
+	}
+	return steps, nil
+}
+
+func isQuoted(value string) bool {
+	return len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0]
+}
+
+// single quoted string, or a json value
+func parseJSONLiteral(literal string) (interface{}, error) {
+	if strings.HasPrefix(literal, "'") {
+		if !isQuoted(literal) {
+			return nil, fmt.Errorf("unclosed string literal: %s", literal)
+		}
+		inner := literal[1 : len(literal)-1]
+		inner = strings.Replace(inner, `\'`, `'`, -1)
+		inner = strings.Replace(inner, `"`, `\"`, -1)
+		literal = `"` + inner + `"`
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(literal), &value); err != nil {
+		return nil, fmt.Errorf("invalid literal %s: %v", literal, err)
+	}
+	return value, nil
+}
+
+// if exchange should be output, true if filter is nil
+func (filter *JSONFilter) match(exchange *Exchange) bool {
+	if filter == nil {
+		return true
+	}
+	return filter.matchBody(exchange.requestBodyData) || filter.matchBody(exchange.responseBodyData)
+}
+
+func (filter *JSONFilter) matchBody(body []byte) bool {
+	var document interface{}
+	if len(body) == 0 || json.Unmarshal(body, &document) != nil {
+		return false
+	}
+	for _, value := range selectJSONPath(document, filter.path) {
+		if filter.op == "" || compareJSON(value, filter.op, filter.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// values selected by path
+func selectJSONPath(document interface{}, path []jsonPathStep) []interface{} {
+	var values = []interface{}{document}
+	for _, step := range path {
+		var selected []interface{}
+		for _, value := range values {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, member := range v {
+						selected = append(selected, member)
+					}
+				} else if member, ok := v[step.name]; ok && !step.isIndex {
+					selected = append(selected, member)
+				}
+			case []interface{}:
+				if step.wildcard {
+					selected = append(selected, v...)
+				} else if step.isIndex {
+					index := step.index
+					if index < 0 {
+						index += len(v)
+					}
+					if index >= 0 && index < len(v) {
+						selected = append(selected, v[index])
+					}
+				}
+			}
+		}
+		values = selected
+	}
+	return values
+}
+
+// compare json values. numbers and strings are ordered, other values only support == and !=
+func compareJSON(value interface{}, op string, literal interface{}) bool {
+	var order int
+	switch v := value.(type) {
+	case float64:
+		l, ok := literal.(float64)
+		if !ok {
+			return op == "!="
+		}
+		order = compareOrder(v < l, v > l)
+	case string:
+		l, ok := literal.(string)
+		if !ok {
+			return op == "!="
+		}
+		order = compareOrder(v < l, v > l)
+	default:
+		equal := jsonString(value) == jsonString(literal)
+		switch op {
+		case "==":
+			return equal
+		case "!=":
+			return !equal
+		}
+		return false
+	}
+	switch op {
+	case "==":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	}
+	return order >= 0
+}
+
+func compareOrder(less bool, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
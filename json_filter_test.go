@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonExchange(path string, contentType string, body string) []testSegment {
+	return []testSegment{
+		{up: true, payload: "GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 429 Too Many Requests\r\nContent-Type: " + contentType + "\r\nContent-Length: " +
+			strconv.Itoa(len(body)) + "\r\n\r\n" + body},
+	}
+}
+
+func TestJSONFilter(t *testing.T) {
+	var segments []testSegment
+	segments = append(segments, jsonExchange("/quota", "application/json", `{"error":{"code":"QUOTA"}}`)...)
+	segments = append(segments, jsonExchange("/limited", "application/json",
+		`{"error":{"code":"RATE_LIMIT","retry":3}}`)...)
+	segments = append(segments, jsonExchange("/text", "text/plain", `error.code == RATE_LIMIT`)...)
+	segments = append(segments, jsonExchange("/empty", "application/json", ``)...)
+	segments = append(segments, jsonExchange("/array", "application/json", `[{"error":{"code":"RATE_LIMIT"}}]`)...)
+
+	filter, err := parseJSONFilter("$.error.code == 'RATE_LIMIT'")
+	assert.Nil(t, err)
+	sink, _ := runHTTPConversation(&Config{jsonFilter: filter}, segments)
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, "/limited", sink.exchanges[0].url)
+
+	filter, _ = parseJSONFilter("$[*].error.code")
+	sink, _ = runHTTPConversation(&Config{jsonFilter: filter}, segments)
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, "/array", sink.exchanges[0].url)
+
+	// request body
+	filter, _ = parseJSONFilter(`$.user.id >= 10`)
+	body := `{"user":{"id":12}}`
+	sink, _ = runHTTPConversation(&Config{jsonFilter: filter}, []testSegment{
+		{up: true, payload: "POST /users HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\n" +
+			"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+	assert.Equal(t, 1, len(sink.exchanges))
+}
+
+func TestJSONFilterMatchBody(t *testing.T) {
+	body := []byte(`{"items":[{"id":1,"tags":["a"]},{"id":2,"tags":[]}],"name":"it's","ok":true,"next":null}`)
+	for expression, expected := range map[string]bool{
+		"$.items":                 true,
+		"$.missing":               false,
+		"$.items[1].id == 2":      true,
+		"$.items[-1].id == 2":     true,
+		"$.items[2].id":           false,
+		"$.items[*].id > 1":       true,
+		"$.items[*].id > 2":       false,
+		"$['items'][0]['id'] < 2": true,
+		`$.name == 'it\'s'`:       true,
+		`$.name == "it's"`:        true,
+		"$.name != 'it'":          true,
+		"$.ok == true":            true,
+		"$.next == null":          true,
+		"$.ok == 1":               false,
+		"$.*[0].tags[0] == 'a'":   true,
+	} {
+		filter, err := parseJSONFilter(expression)
+		assert.Nil(t, err, expression)
+		assert.Equal(t, expected, filter.matchBody(body), expression)
+	}
+	filter, _ := parseJSONFilter("$.a")
+	assert.False(t, filter.matchBody([]byte("not json")))
+
+	for _, expression := range []string{"items", "$.items[", "$.items[x]", "$..id", "$.name == 'abc", "$.a == abc"} {
+		_, err := parseJSONFilter(expression)
+		assert.NotNil(t, err, expression)
+	}
+}
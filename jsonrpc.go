@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonRPCRequest is one json-rpc call in http request body
+type jsonRPCRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// jsonRPCResponse is one json-rpc result in http response body
+type jsonRPCResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// jsonRPCPair is a json-rpc call matched with its response by id. response is nil for notifications,
+// or if server do not response the call
+type jsonRPCPair struct {
+	ID       string
+	Method   string
+	Response *jsonRPCResponse
+}
+
+// parse json-rpc body, which may be a single object or a batch array
+func parseJSONRPCBody(body []byte, v interface{}) error {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		body = append(append([]byte{'['}, body...), ']')
+	}
+	return json.Unmarshal(body, v)
+}
+
+func parseJSONRPCRequests(body []byte) ([]jsonRPCRequest, error) {
+	var requests []jsonRPCRequest
+	err := parseJSONRPCBody(body, &requests)
+	return requests, err
+}
+
+func parseJSONRPCResponses(body []byte) ([]jsonRPCResponse, error) {
+	var responses []jsonRPCResponse
+	err := parseJSONRPCBody(body, &responses)
+	return responses, err
+}
+
+// format id as raw json value, so 1 and "1" are different ids. Empty if id is absent, as of notifications,
+// a null id is kept as null
+func jsonRPCID(id json.RawMessage) string {
+	return string(bytes.TrimSpace(id))
+}
+
+// pair json-rpc responses with requests by id. batch responses may be in any order
+func pairJSONRPC(requests []jsonRPCRequest, responses []jsonRPCResponse) []jsonRPCPair {
+	var responseMap = map[string]*jsonRPCResponse{}
+	for i := range responses {
+		if id := jsonRPCID(responses[i].ID); id != "" {
+			responseMap[id] = &responses[i]
+		}
+	}
+	var pairs []jsonRPCPair
+	for _, request := range requests {
+		id := jsonRPCID(request.ID)
+		pair := jsonRPCPair{ID: id, Method: request.Method}
+		if id != "" {
+			pair.Response = responseMap[id]
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+func (pair jsonRPCPair) status() string {
+	if pair.Response == nil {
+		if pair.ID == "" {
+			return "notification"
+		}
+		return "no-response"
+	}
+	if pair.Response.Error != nil {
+		return "error"
+	}
+	return "result"
+}
+
+// format pair as one output line
+func (pair jsonRPCPair) format(ck ConnectionKey, format string) string {
+	if format == "json" {
+		record := map[string]interface{}{
+			"type":   "jsonrpc",
+			"src":    ck.srcString(),
+			"dst":    ck.dstString(),
+			"id":     json.RawMessage(pair.ID),
+			"method": pair.Method,
+			"status": pair.status(),
+		}
+		if pair.ID == "" {
+			record["id"] = nil
+		}
+		if pair.Response != nil && pair.Response.Error != nil {
+			record["error"] = pair.Response.Error
+		}
+		data, _ := json.Marshal(record)
+		return string(data) + "\n"
+	}
+	var fields = []string{"[jsonrpc]", ck.srcString(), "->", ck.dstString(), "method=" + pair.Method,
+		"id=" + pair.ID, "status=" + pair.status()}
+	if pair.Response != nil && pair.Response.Error != nil {
+		fields = append(fields, fmt.Sprintf("error=%d:%s", pair.Response.Error.Code, pair.Response.Error.Message))
+	}
+	return strings.Join(fields, " ") + "\n"
+}
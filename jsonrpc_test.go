@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"httpdump/httpport"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairJSONRPCBatch(t *testing.T) {
+	requests, err := parseJSONRPCRequests([]byte(`[
+		{"jsonrpc":"2.0","method":"eth_blockNumber","id":1},
+		{"jsonrpc":"2.0","method":"eth_getBalance","params":["0x1","latest"],"id":"2"},
+		{"jsonrpc":"2.0","method":"eth_subscribe"},
+		{"jsonrpc":"2.0","method":"eth_gasPrice","id":null}
+	]`))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(requests))
+
+	// batch response may be in any order
+	responses, err := parseJSONRPCResponses([]byte(`[
+		{"jsonrpc":"2.0","id":"2","error":{"code":-32602,"message":"invalid params"}},
+		{"jsonrpc":"2.0","id":1,"result":"0x10"},
+		{"jsonrpc":"2.0","id":null,"result":"0x1"}
+	]`))
+	assert.Nil(t, err)
+
+	pairs := pairJSONRPC(requests, responses)
+	assert.Equal(t, 4, len(pairs))
+	assert.Equal(t, "eth_blockNumber", pairs[0].Method)
+	assert.Equal(t, "1", pairs[0].ID)
+	assert.Equal(t, `"0x10"`, string(pairs[0].Response.Result))
+	assert.Equal(t, "result", pairs[0].status())
+	assert.Equal(t, "eth_getBalance", pairs[1].Method)
+	assert.Equal(t, `"2"`, pairs[1].ID)
+	assert.Equal(t, -32602, pairs[1].Response.Error.Code)
+	assert.Equal(t, "error", pairs[1].status())
+	assert.Nil(t, pairs[2].Response)
+	assert.Equal(t, "notification", pairs[2].status())
+	// a null id is not a notification
+	assert.Equal(t, "null", pairs[3].ID)
+	assert.Equal(t, "result", pairs[3].status())
+}
+
+func TestReportJSONRPC(t *testing.T) {
+	h := newTestTrafficHandler()
+	h.config.jsonRPC = true
+	reqBody := `{"jsonrpc":"2.0","method":"eth_chainId","id":7}`
+	req, err := httpport.ReadRequest(bufio.NewReader(strings.NewReader("POST / HTTP/1.1\r\nHost: node\r\n" +
+		"Content-Type: application/json\r\nContent-Length: " + strconv.Itoa(len(reqBody)) + "\r\n\r\n" + reqBody)))
+	assert.Nil(t, err)
+	requests := h.readJSONRPCRequests(req)
+	assert.Equal(t, 1, len(requests))
+
+	respBody := `{"jsonrpc":"2.0","id":7,"result":"0x1"}`
+	resp, err := httpport.ReadResponse(bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\n"+
+		"Content-Type: application/json\r\nContent-Length: "+strconv.Itoa(len(respBody))+"\r\n\r\n"+respBody)), nil)
+	assert.Nil(t, err)
+	h.reportJSONRPC(requests, resp)
+	assert.Equal(t, "[jsonrpc] 10.0.0.1:50000 -> 10.0.0.2:80 method=eth_chainId id=7 status=result\n",
+		<-h.printer.outputQueue)
+
+	// body larger than max decode size is not parsed, and is still read as a whole
+	h.config.decodeLimit.maxSize = int64(len(reqBody) - 1)
+	req, err = httpport.ReadRequest(bufio.NewReader(strings.NewReader("POST / HTTP/1.1\r\nHost: node\r\n" +
+		"Content-Type: application/json\r\nContent-Length: " + strconv.Itoa(len(reqBody)) + "\r\n\r\n" + reqBody)))
+	assert.Nil(t, err)
+	assert.Nil(t, h.readJSONRPCRequests(req))
+	data, err := ioutil.ReadAll(req.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, reqBody, string(data))
+}
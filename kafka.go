@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaMessage is one record to produce
+type kafkaMessage struct {
+	key       []byte
+	value     []byte
+	timestamp time.Time
+}
+
+// kafkaProducer send messages to a topic, partitioned by message key
+type kafkaProducer interface {
+	produce(topic string, messages []kafkaMessage) error
+	io.Closer
+}
+
+// kafkaWriter produce messages with kafka-go writer. Messages are partitioned by murmur2 hash of key, the same as
+// the default partitioner of java client. Retries and batching are done by KafkaSink, so the writer makes one
+// attempt and sends what it is given at once
+type kafkaWriter struct {
+	writer *kafka.Writer
+}
+
+func newKafkaWriter(brokers []string, timeout time.Duration) *kafkaWriter {
+	return &kafkaWriter{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Murmur2Balancer{},
+		MaxAttempts:  1,
+		BatchSize:    maxKafkaBatch,
+		BatchTimeout: time.Millisecond,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		RequiredAcks: kafka.RequireOne,
+	}}
+}
+
+func (producer *kafkaWriter) produce(topic string, messages []kafkaMessage) error {
+	var records = make([]kafka.Message, len(messages))
+	for i, message := range messages {
+		records[i] = kafka.Message{Topic: topic, Key: message.key, Value: message.value, Time: message.timestamp}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), producer.writer.WriteTimeout)
+	defer cancel()
+	return producer.writer.WriteMessages(ctx, records...)
+}
+
+func (producer *kafkaWriter) Close() error {
+	return producer.writer.Close()
+}
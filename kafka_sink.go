@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultKafkaQueue = 10000
+	maxKafkaBatch     = 500
+	kafkaLinger       = 100 * time.Millisecond
+	kafkaTimeout      = 10 * time.Second
+)
+
+// KafkaSink publish exchange records to a kafka topic, as json or protobuf ExchangeRecord messages keyed by
+// connection id, so exchanges of a connection go to the same partition.
+// Records are queued and sent in batches in background. When queue is full the oldest record is dropped,
+// so an unreachable broker never blocks the capture path. Failed batches are retried until the sink is closed,
+// so a record may be delivered more than once
+type KafkaSink struct {
+	producer  kafkaProducer
+	topic     string
+	format    string // json or protobuf
+	queue     []kafkaMessage
+	maxQueue  int
+	dropped   int // dropped because queue is full
+	failed    int // not delivered when sink is closed
+	delivered int
+	closed    bool
+	lock      sync.Mutex
+	cond      *sync.Cond
+	done      chan struct{}
+}
+
+// parse kafka output setting like kafka://broker1:9092,broker2:9092/topic
+func parseKafkaOutput(output string) (brokers []string, topic string, ok bool) {
+	if !strings.HasPrefix(output, "kafka://") {
+		return nil, "", false
+	}
+	output = output[len("kafka://"):]
+	idx := strings.IndexByte(output, '/')
+	if idx <= 0 || idx == len(output)-1 {
+		return nil, "", false
+	}
+	return strings.Split(output[:idx], ","), output[idx+1:], true
+}
+
+func newKafkaSink(producer kafkaProducer, topic string, format string, maxQueue int) *KafkaSink {
+	sink := &KafkaSink{producer: producer, topic: topic, format: format, maxQueue: maxQueue, done: make(chan struct{})}
+	sink.cond = sync.NewCond(&sink.lock)
+	go sink.sendBackground()
+	return sink
+}
+
+// queue the exchange record, never blocks
+func (sink *KafkaSink) write(exchange *Exchange) error {
+	record := exchange.toProto()
+	var value []byte
+	var err error
+	if sink.format == "protobuf" {
+		value, err = proto.Marshal(record)
+	} else {
+		value, err = protojson.Marshal(record)
+	}
+	if err != nil {
+		return err
+	}
+	message := kafkaMessage{key: []byte(exchange.key.srcString() + "-" + exchange.key.dstString()), value: value,
+		timestamp: exchange.requestStart}
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.closed {
+		return nil
+	}
+	if len(sink.queue) >= sink.maxQueue {
+		// drop oldest
+		sink.queue[0] = kafkaMessage{}
+		sink.queue = sink.queue[1:]
+		sink.dropped++
+	}
+	sink.queue = append(sink.queue, message)
+	sink.cond.Signal()
+	return nil
+}
+
+// take queued messages up to max batch size, wait if queue is empty. return nil if sink is closed and queue is empty
+func (sink *KafkaSink) nextBatch() []kafkaMessage {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	for len(sink.queue) == 0 && !sink.closed {
+		sink.cond.Wait()
+	}
+	n := len(sink.queue)
+	if n == 0 {
+		return nil
+	}
+	if n > maxKafkaBatch {
+		n = maxKafkaBatch
+	}
+	batch := make([]kafkaMessage, n)
+	copy(batch, sink.queue)
+	for i := 0; i < n; i++ {
+		sink.queue[i] = kafkaMessage{}
+	}
+	sink.queue = sink.queue[n:]
+	return batch
+}
+
+func (sink *KafkaSink) isClosed() bool {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.closed
+}
+
+func (sink *KafkaSink) sendBackground() {
+	defer close(sink.done)
+	backoff := minSocketBackoff
+	for {
+		batch := sink.nextBatch()
+		if batch == nil {
+			return
+		}
+		for {
+			err := sink.producer.produce(sink.topic, batch)
+			if err == nil {
+				sink.lock.Lock()
+				sink.delivered += len(batch)
+				sink.lock.Unlock()
+				backoff = minSocketBackoff
+				break
+			}
+			logger.Debug("produce to kafka topic", sink.topic, "failed:", err)
+			if sink.isClosed() {
+				// broker unreachable when exit, give up remaining records
+				sink.lock.Lock()
+				sink.failed += len(batch) + len(sink.queue)
+				sink.queue = nil
+				sink.lock.Unlock()
+				return
+			}
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxSocketBackoff {
+				backoff = maxSocketBackoff
+			}
+		}
+		if len(batch) < maxKafkaBatch && !sink.isClosed() {
+			// wait more records to batch
+			time.Sleep(kafkaLinger)
+		}
+	}
+}
+
+// Close send queued records if broker is reachable, and report records not delivered
+func (sink *KafkaSink) Close() error {
+	sink.lock.Lock()
+	sink.closed = true
+	sink.cond.Signal()
+	sink.lock.Unlock()
+	<-sink.done
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	logger.Debug("kafka output delivered", sink.delivered, "records")
+	if sink.dropped > 0 || sink.failed > 0 {
+		logger.Warn("kafka output dropped", sink.dropped, "records, failed to deliver", sink.failed, "records")
+	}
+	return sink.producer.Close()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordProducer keep produced messages, and fail the first failures calls
+type recordProducer struct {
+	lock     sync.Mutex
+	messages []kafkaMessage
+	failures int
+	block    chan struct{} // if not nil, produce blocks until it is closed
+	closed   bool
+}
+
+func (producer *recordProducer) produce(topic string, messages []kafkaMessage) error {
+	if producer.block != nil {
+		<-producer.block
+	}
+	producer.lock.Lock()
+	defer producer.lock.Unlock()
+	if producer.failures > 0 {
+		producer.failures--
+		return errors.New("broker not available")
+	}
+	producer.messages = append(producer.messages, messages...)
+	return nil
+}
+
+func (producer *recordProducer) Close() error {
+	producer.closed = true
+	return nil
+}
+
+func (sink *KafkaSink) deliveredCount() int {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.delivered
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := &recordProducer{failures: 1}
+	handler, _ := newTestHTTPHandler(&Config{})
+	sink := newKafkaSink(producer, "exchanges", "json", 100)
+	handler.sinks = []ExchangeSink{sink}
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+		{up: true, payload: "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+	// delivered after the broker failure
+	for i := 0; i < 100 && sink.deliveredCount() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, sink.Close())
+	assert.True(t, producer.closed)
+	if assert.Equal(t, 2, len(producer.messages)) {
+		for i, url := range []string{"/a", "/b"} {
+			message := producer.messages[i]
+			assert.Equal(t, "10.0.0.1:50000-10.0.0.2:80", string(message.key))
+			var record map[string]interface{}
+			assert.Nil(t, json.Unmarshal(message.value, &record))
+			assert.Equal(t, url, record["url"])
+		}
+	}
+	assert.Equal(t, 2, sink.delivered)
+	assert.Equal(t, 0, sink.failed)
+}
+
+func TestKafkaSinkDrop(t *testing.T) {
+	producer := &recordProducer{block: make(chan struct{})}
+	sink := newKafkaSink(producer, "exchanges", "protobuf", 2)
+	for i := 0; i < 5; i++ {
+		// never blocks when broker is stalled
+		assert.Nil(t, sink.write(&Exchange{method: "GET", url: "/", index: i}))
+	}
+	close(producer.block)
+	assert.Nil(t, sink.Close())
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	// the first one may be taken by producer before the queue is full
+	assert.True(t, sink.dropped == 2 || sink.dropped == 3, sink.dropped)
+	assert.Equal(t, 5, sink.dropped+sink.delivered)
+}
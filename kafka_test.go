@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/stretchr/testify/assert"
+)
+
+// producedRecord is a record received by fakeKafkaTransport
+type producedRecord struct {
+	partition int32
+	key       string
+	value     string
+}
+
+// fakeKafkaTransport answer Metadata requests with partitions all led by one broker, and Produce requests with
+// success. Requests fail when unavailable
+type fakeKafkaTransport struct {
+	partitions  int32
+	lock        sync.Mutex
+	records     []producedRecord
+	unavailable bool
+}
+
+func (transport *fakeKafkaTransport) RoundTrip(ctx context.Context, addr net.Addr,
+	request kafka.Request) (kafka.Response, error) {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+	if transport.unavailable {
+		return nil, errors.New("broker not available")
+	}
+	switch request := request.(type) {
+	case *metadata.Request:
+		response := &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "127.0.0.1", Port: 9092}}}
+		for _, name := range request.TopicNames {
+			topic := metadata.ResponseTopic{Name: name}
+			for i := int32(0); i < transport.partitions; i++ {
+				topic.Partitions = append(topic.Partitions, metadata.ResponsePartition{PartitionIndex: i, LeaderID: 1})
+			}
+			response.Topics = append(response.Topics, topic)
+		}
+		return response, nil
+	case *produce.Request:
+		response := &produce.Response{}
+		for _, topic := range request.Topics {
+			responseTopic := produce.ResponseTopic{Topic: topic.Topic}
+			for _, partition := range topic.Partitions {
+				for {
+					record, err := partition.RecordSet.Records.ReadRecord()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						return nil, err
+					}
+					key, _ := protocol.ReadAll(record.Key)
+					value, _ := protocol.ReadAll(record.Value)
+					transport.records = append(transport.records, producedRecord{partition: partition.Partition,
+						key: string(key), value: string(value)})
+				}
+				responseTopic.Partitions = append(responseTopic.Partitions,
+					produce.ResponsePartition{Partition: partition.Partition})
+			}
+			response.Topics = append(response.Topics, responseTopic)
+		}
+		return response, nil
+	}
+	return nil, errors.New("unexpected request")
+}
+
+func TestKafkaWriter(t *testing.T) {
+	transport := &fakeKafkaTransport{partitions: 3}
+	producer := newKafkaWriter([]string{"127.0.0.1:9092"}, time.Second)
+	producer.writer.Transport = transport
+	defer producer.Close()
+
+	now := time.Now()
+	messages := []kafkaMessage{{key: []byte("a"), value: []byte("1"), timestamp: now},
+		{key: []byte("b"), value: []byte("2"), timestamp: now.Add(time.Millisecond)},
+		{key: []byte("a"), value: []byte("3"), timestamp: now.Add(time.Millisecond)}}
+	assert.Nil(t, producer.produce("exchanges", messages))
+	assert.Nil(t, producer.produce("exchanges", messages[:1]))
+
+	var byKey = map[string][]string{}
+	balancer := &kafka.Murmur2Balancer{}
+	for _, record := range transport.records {
+		// partitioned as java client does
+		partition := balancer.Balance(kafka.Message{Key: []byte(record.key)}, 0, 1, 2)
+		assert.Equal(t, int32(partition), record.partition)
+		byKey[record.key] = append(byKey[record.key], record.value)
+	}
+	assert.Equal(t, map[string][]string{"a": {"1", "3", "1"}, "b": {"2"}}, byKey)
+
+	// broker unavailable
+	transport.lock.Lock()
+	transport.unavailable = true
+	transport.lock.Unlock()
+	assert.NotNil(t, producer.produce("exchanges", messages))
+}
+
+func TestParseKafkaOutput(t *testing.T) {
+	brokers, topic, ok := parseKafkaOutput("kafka://k1:9092,k2:9092/http")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"k1:9092", "k2:9092"}, brokers)
+	assert.Equal(t, "http", topic)
+	_, _, ok = parseKafkaOutput("kafka://k1:9092")
+	assert.False(t, ok)
+	_, _, ok = parseKafkaOutput("tcp://k1:9092/http")
+	assert.False(t, ok)
+}
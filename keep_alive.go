@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/google/gopacket/layers"
+)
+
+// kinds of tcp segments, by what they carry
+const (
+	segmentControl      = iota // SYN, FIN, RST, or a pure ACK
+	segmentData                // carry new or retransmitted payload
+	segmentKeepAlive           // keep-alive probe, seq is one byte before next seq, with no or one garbage byte
+	segmentKeepAliveAck        // pure ACK answering a keep-alive probe
+)
+
+// keepAliveTracker tell keep-alive probes and their ACKs from data segments, and count them.
+// Sides are indexed by sender of the first tracked packet, as rttEstimator does
+type keepAliveTracker struct {
+	first   *Endpoint
+	nextSeq [2]uint32 // seq of the next byte to send, by side
+	seqSet  [2]bool
+	probed  [2]bool // side sent a keep-alive probe not answered yet
+	// counts of segments by kind, of both sides
+	data          int64
+	keepAlives    int64
+	keepAliveAcks int64
+}
+
+// classify and count a segment from src
+func (tracker *keepAliveTracker) track(src Endpoint, tcp *layers.TCP) int {
+	if tracker.first == nil {
+		tracker.first = &src
+	}
+	side, peer := 0, 1
+	if !tracker.first.equals(src) {
+		side, peer = 1, 0
+	}
+	size := uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN || tcp.RST {
+		end := tcp.Seq + size + 1
+		if tcp.RST {
+			end = tcp.Seq
+		}
+		tracker.advance(side, end)
+		return segmentControl
+	}
+	if tracker.seqSet[side] && size <= 1 && tcp.Seq == tracker.nextSeq[side]-1 {
+		tracker.probed[side] = true
+		tracker.keepAlives++
+		return segmentKeepAlive
+	}
+	if size > 0 {
+		tracker.advance(side, tcp.Seq+size)
+		tracker.data++
+		return segmentData
+	}
+	tracker.advance(side, tcp.Seq)
+	if tcp.ACK && tracker.probed[peer] && tcp.Ack == tracker.nextSeq[peer] {
+		tracker.probed[peer] = false
+		tracker.keepAliveAcks++
+		return segmentKeepAliveAck
+	}
+	return segmentControl
+}
+
+// move next seq of side forward to end, retransmissions do not move it back
+func (tracker *keepAliveTracker) advance(side int, end uint32) {
+	if !tracker.seqSet[side] || compareTCPSeq(end, tracker.nextSeq[side]) > 0 {
+		tracker.nextSeq[side] = end
+		tracker.seqSet[side] = true
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepAlive(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	requestEnd, responseEnd := 1000+uint32(len(request)), 5000+uint32(len(response))
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), start)
+	assembler.assemble(testServerFlow, serverPacket(5000, requestEnd, response), start)
+	assembler.assemble(testClientFlow, clientPacket(requestEnd, responseEnd, ""), start)
+
+	// probes from client with no payload and with a garbage byte, answered by server
+	assembler.assemble(testClientFlow, clientPacket(requestEnd-1, responseEnd, ""), start.Add(time.Minute))
+	assembler.assemble(testServerFlow, serverPacket(responseEnd, requestEnd, ""), start.Add(time.Minute))
+	assembler.assemble(testClientFlow, clientPacket(requestEnd-1, responseEnd, "x"), start.Add(2*time.Minute))
+	assembler.assemble(testServerFlow, serverPacket(responseEnd, requestEnd, ""), start.Add(2*time.Minute))
+	// a pure ACK not answering a probe
+	assembler.assemble(testServerFlow, serverPacket(responseEnd, requestEnd, ""), start.Add(3*time.Minute))
+
+	infos := assembler.Snapshot()
+	assert.Equal(t, 1, len(infos))
+	assert.Equal(t, int64(2), infos[0].DataSegments)
+	assert.Equal(t, int64(2), infos[0].KeepAlives)
+	assert.Equal(t, int64(2), infos[0].KeepAliveAcks)
+	assert.Equal(t, int64(len(request)+1), infos[0].UpBytes)
+
+	// garbage byte of probe is not delivered as data
+	connection := handler.connections[0]
+	assert.Equal(t, 0, connection.upStream.window.size)
+	assert.Equal(t, 1, len(connection.upStream.c))
+}
+
+func TestKeepAliveTracker(t *testing.T) {
+	client := Endpoint{ip: "10.0.0.1", port: 50000}
+	server := Endpoint{ip: "10.0.0.2", port: 80}
+	var tracker keepAliveTracker
+	assert.Equal(t, segmentControl, tracker.track(client, &layers.TCP{Seq: 99, SYN: true}))
+	assert.Equal(t, segmentControl, tracker.track(server, &layers.TCP{Seq: 4999, Ack: 100, SYN: true, ACK: true}))
+	assert.Equal(t, segmentControl, tracker.track(client, &layers.TCP{Seq: 100, Ack: 5000, ACK: true}))
+	// a one byte data segment right after handshake is not a probe
+	assert.Equal(t, segmentData, tracker.track(client, &layers.TCP{Seq: 100, Ack: 5000, ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: []byte{'G'}}}))
+	// retransmission of the one byte looks like a probe
+	assert.Equal(t, segmentKeepAlive, tracker.track(client, &layers.TCP{Seq: 100, Ack: 5000, ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: []byte{'G'}}}))
+	assert.Equal(t, segmentKeepAliveAck, tracker.track(server, &layers.TCP{Seq: 5000, Ack: 101, ACK: true}))
+	assert.Equal(t, segmentControl, tracker.track(server, &layers.TCP{Seq: 5000, Ack: 101, ACK: true}))
+	assert.Equal(t, segmentControl, tracker.track(client, &layers.TCP{Seq: 101, Ack: 5000, ACK: true, FIN: true}))
+	assert.Equal(t, int64(1), tracker.data)
+	assert.Equal(t, int64(1), tracker.keepAlives)
+	assert.Equal(t, int64(1), tracker.keepAliveAcks)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+)
+
+var errBareLF = errors.New("bare LF line ending in header block")
+
+// check the header block at head of reader uses CRLF line endings, as RFC 7230 requires.
+// The parser accepts bare LF, this is for strict mode. Only the header region is peeked, headers larger than
+// the reader buffer are not checked. On error, bytes until the bare LF are consumed, to locate it in error record
+func checkLineEndings(reader *bufio.Reader) error {
+	checked := 0
+	for {
+		n := reader.Buffered()
+		if n <= checked {
+			// blocks until more data arrives, as the parser does when header is not complete
+			n = checked + 1
+		}
+		if n > reader.Size() {
+			return nil
+		}
+		data, err := reader.Peek(n)
+		for i := checked; i < len(data); i++ {
+			if data[i] != '\n' {
+				continue
+			}
+			if i == 0 || data[i-1] != '\r' {
+				reader.Discard(i + 1)
+				return errBareLF
+			}
+			if i >= 3 && data[i-3] == '\r' && data[i-2] == '\n' {
+				// end of header block
+				return nil
+			}
+		}
+		checked = len(data)
+		if err != nil {
+			// let the parser handle it
+			return nil
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseErrorLines(printer *Printer) []string {
+	var lines []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[error]") {
+			lines = append(lines, msg)
+		}
+	}
+	return lines
+}
+
+func TestBareLFHeaders(t *testing.T) {
+	segments := []testSegment{
+		{up: true, payload: "GET /lf HTTP/1.1\nHost: example.com\nAccept: */*\n\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+	}
+	// lenient by default
+	sink, printer := runHTTPConversation(&Config{}, segments)
+	assert.Equal(t, 1, len(sink.exchanges))
+	assert.Equal(t, "/lf", sink.exchanges[0].url)
+	assert.Equal(t, "*/*", sink.exchanges[0].requestHeader.Get("Accept"))
+	assert.Equal(t, 200, sink.exchanges[0].status)
+	assert.Empty(t, parseErrorLines(printer))
+
+	sink, printer = runHTTPConversation(&Config{strictLineEndings: true}, segments)
+	assert.Empty(t, sink.exchanges)
+	assert.Equal(t, []string{"[error] 10.0.0.1:50000 -> 10.0.0.2:80 parse request error: " +
+		"bare LF line ending in header block, at offset 0: \"GET /lf HTTP/1.1\\n\"\n"}, parseErrorLines(printer))
+}
+
+func TestStrictLineEndings(t *testing.T) {
+	sink, printer := runHTTPConversation(&Config{strictLineEndings: true}, []testSegment{
+		// bare LF in body is not checked
+		{up: true, payload: "POST /a HTTP/1.1\r\nHost: exam"},
+		{up: true, payload: "ple.com\r\nContent-Length: 3\r\n"},
+		{up: true, payload: "\r\na\nb"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n\n\n"},
+		{up: true, payload: "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\n\n"},
+	})
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, 200, sink.exchanges[0].status)
+	assert.Equal(t, int64(3), sink.exchanges[0].requestBodySize)
+	assert.Equal(t, int64(2), sink.exchanges[0].responseBodySize)
+	assert.Equal(t, 0, sink.exchanges[1].status)
+	lines := parseErrorLines(printer)
+	assert.Equal(t, 1, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "[error] 10.0.0.2:80 -> 10.0.0.1:50000 parse response error: bare LF"), lines[0])
+}
+
+func TestCheckLineEndings(t *testing.T) {
+	data := "GET / HTTP/1.1\r\nHost: a\r\n\r\nbody\n"
+	reader := bufio.NewReader(strings.NewReader(data))
+	assert.Nil(t, checkLineEndings(reader))
+	// nothing consumed
+	assert.Equal(t, len(data), reader.Buffered())
+
+	// incomplete header is left to the parser
+	assert.Nil(t, checkLineEndings(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost"))))
+	assert.Nil(t, checkLineEndings(bufio.NewReader(strings.NewReader(""))))
+
+	reader = bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\nA: b\nC: d\r\n\r\n"))
+	assert.Equal(t, errBareLF, checkLineEndings(reader))
+	line, _ := reader.ReadString('\n')
+	assert.Equal(t, "C: d\r\n", line)
+}
@@ -4,15 +4,18 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"runtime"
 	"time"
 
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/hsiafan/vlog"
 )
@@ -28,25 +31,90 @@ var printerWaitGroup sync.WaitGroup
 
 // Config is user config for http traffics
 type Config struct {
-	level      string
-	filterIP   string
-	filterPort uint16
-	host       string
-	uri        string
-	force      bool
-	pretty     bool
-	output     string
-	timeout    uint16
+	level       string
+	filterIP    string
+	filterPort  uint16
+	cidrFilter  *CIDRFilter // nil for not filtering by ip ranges
+	host        string
+	uri         string
+	force       bool
+	pretty      bool
+	output      string
+	format      string
+	timeout     uint16
+	maxLifetime time.Duration
+	jsonRPC     bool
+	dumpNonHTTP int
+	maxWindow   int
+	spill       int
+	spillDir    string
+	protobuf    string
+	bpf         string
+	// header names(lower case) whose value is redacted in exchange records
+	redactHeaders  map[string]bool
+	statusFilter   *StatusFilter // nil for not filter by status
+	jsonFilter     *JSONFilter   // nil for not filter by json body
+	exchangeRange  *IndexRange   // nil for not filter by exchange index in connection
+	rawHeaders     bool          // keep header names casing as on wire in exchange records
+	serverPorts    map[uint16]bool
+	socks5         bool // parse http in socks5 tunnel
+	http09         bool // parse HTTP/0.9 simple requests and their bare body responses
+	unidirectional bool // deliver data without waiting ACKs, for captures with only one direction
+	dedupBody      bool // include request body hash in signature of duplicate suppression
+	overlap        OverlapPolicy
+	// capture file name, set for including file name and packet numbers in error and drop records
+	captureFile string
+	// how the assembler find request starts on client stream
+	requestBoundary RequestBoundary
+	verifyDigest    bool // verify body by Content-MD5 and Digest headers
+	firstLine       bool // only read request line and status line, without full header parsing
+	warnReset       bool // warn exchanges aborted by RST with request in flight
+	parseCookies    bool // parse Cookie and Set-Cookie headers to structured records
+	// warn requests took longer than this from first byte to complete, 0 for disabled
+	slowRequest time.Duration
+	// parse proxy hops in Forwarded and X-Forwarded-For headers
+	parseForwarded bool
+	// reject header blocks with bare LF line endings, instead of accepting them
+	strictLineEndings bool
+	maxHeaderBytes    int             // max bytes of a message header block, 0 for unlimited
+	maxConnExchanges  int             // exchanges in flight tracked per connection, 0 for unlimited
+	decodeLimit       decodeLimit     // bound of bodies decoded for inspection
+	bodyTypes         *BodyTypeFilter // nil for capture bodies of all content types
+	bodyStats         bool            // compute line, byte and json key counts of bodies
+	keepRequestBody   bool            // keep decoded request body in exchange records, for sinks need it
+	transcodeCharset  bool            // transcode kept bodies to utf-8 from the charset of Content-Type
+	messageBytes      bool            // count header and body bytes on wire of messages
+	cacheInfo         bool            // derive cacheability of responses from cache headers
+	// finalize connections on -port or server ports after this many payload bytes without http, 0 for disabled
+	rejectNonHTTP int
+	// emit a summary record for each connection, alongside or instead of exchange output
+	connectionSummary ConnectionSummaryMode
+	// report declared connection disposition of exchanges, and if connection is reused after them
+	connectionReuse bool
+	// how header fields are represented in exchange records
+	headerNormalization HeaderNormalization
 }
 
-func listenOneSource(handle *pcap.Handle) chan gopacket.Packet {
+func listenOneSource(handle *pcap.Handle, zeroCopy bool) chan *tcpSegment {
+	if zeroCopy {
+		return zeroCopySegments(handle, handle.LinkType())
+	}
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
 	packets := packetSource.Packets()
-	return packets
+	return packetSegments(packets)
+}
+
+// set packet capture filter, by bpf expression if set, or else by ip and port.
+// dns traffic is also captured if dns is true
+func setDeviceFilter(handle *pcap.Handle, bpf string, filterIP string, filterPort uint16, dns bool) error {
+	return handle.SetBPFFilter(captureFilter(bpf, filterIP, filterPort, dns))
 }
 
-// set packet capture filter, by ip and port
-func setDeviceFilter(handle *pcap.Handle, filterIP string, filterPort uint16) error {
+// bpf expression of capture, bpf if set, or else by ip and port
+func captureFilter(bpf string, filterIP string, filterPort uint16, dns bool) string {
+	if bpf != "" {
+		return bpf
+	}
 	var bpfFilter = "tcp"
 	if filterPort != 0 {
 		bpfFilter += " port " + strconv.Itoa(int(filterPort))
@@ -54,23 +122,59 @@ func setDeviceFilter(handle *pcap.Handle, filterIP string, filterPort uint16) er
 	if filterIP != "" {
 		bpfFilter += " ip host " + filterIP
 	}
-	return handle.SetBPFFilter(bpfFilter)
+	if dns {
+		bpfFilter = "(" + bpfFilter + ") or port " + strconv.Itoa(dnsPort)
+	}
+	return bpfFilter
 }
 
 // adapter multi channels to one channel. used to aggregate multi devices data
-func mergeChannel(channels []chan gopacket.Packet) chan gopacket.Packet {
-	var channel = make(chan gopacket.Packet)
+func mergeChannel(channels []chan *tcpSegment) chan *tcpSegment {
+	var channel = make(chan *tcpSegment)
 	for _, ch := range channels {
-		go func(c chan gopacket.Packet) {
-			for packet := range c {
-				channel <- packet
+		go func(c chan *tcpSegment) {
+			for segment := range c {
+				channel <- segment
 			}
 		}(ch)
 	}
 	return channel
 }
 
-func openSingleDevice(device string, filterIP string, filterPort uint16) (localPackets chan gopacket.Packet, err error) {
+// forward segments until duration elapsed from the first segment, then close the returned channel as the end of
+// capture. Elapsed time is by capture timestamps of segments, and for live capture also by wall-clock, so capture
+// stops in time even if no more packets come
+func limitDuration(packets chan *tcpSegment, duration time.Duration, live bool) chan *tcpSegment {
+	var channel = make(chan *tcpSegment)
+	go func() {
+		defer close(channel)
+		var first time.Time
+		var timer <-chan time.Time
+		for {
+			select {
+			case segment := <-packets:
+				if segment == nil {
+					return
+				}
+				if first.IsZero() {
+					first = segment.timestamp
+					if live {
+						timer = time.After(duration)
+					}
+				} else if segment.timestamp.Sub(first) >= duration {
+					return
+				}
+				channel <- segment
+			case <-timer:
+				return
+			}
+		}
+	}()
+	return channel
+}
+
+func openSingleDevice(device string, bpf string, filterIP string, filterPort uint16, dns bool,
+	zeroCopy bool) (localPackets chan *tcpSegment, err error) {
 	defer func() {
 		if msg := recover(); msg != nil {
 			switch x := msg.(type) {
@@ -89,56 +193,370 @@ func openSingleDevice(device string, filterIP string, filterPort uint16) (localP
 		return
 	}
 
-	if err := setDeviceFilter(handle, filterIP, filterPort); err != nil {
+	if err := setDeviceFilter(handle, bpf, filterIP, filterPort, dns); err != nil {
 		if err != nil {
 			logger.Warn("set capture filter failed, ", err)
 		}
 	}
-	localPackets = listenOneSource(handle)
+	localPackets = listenOneSource(handle, zeroCopy)
 	return
 }
 
 func main() {
 	var flagSet = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	var level = flagSet.String("level", "header", "Output level, options are: url(only url) | header(http headers) | all(headers, and textuary http body)")
-	var filePath = flagSet.String("file", "", "Read from pcap file. If not set, will capture data from network device by default")
+	var filePath = flagSet.String("file", "", "Read from pcap file. '-' or a fifo path for pcap stream, e.g. piped from tcpdump -w -. If not set, will capture data from network device by default")
 	var device = flagSet.String("device", "any", "Capture packet from network device. If is any, capture all interface traffics")
 	var filterIP = flagSet.String("ip", "", "Filter by ip, if either source or target ip is matched, the packet will be processed")
 	var filterPort = flagSet.Uint("port", 0, "Filter by port, if either source or target port is matched, the packet will be processed.")
+	var includeCIDR = flagSet.String("include-cidr", "", "Comma separated ip ranges, e.g. 10.0.0.0/8,fd00::/8. "+
+		"Only packets whose source or target ip is in one of them are processed")
+	var excludeCIDR = flagSet.String("exclude-cidr", "", "Comma separated ip ranges, e.g. 10.1.0.0/16. "+
+		"Packets whose source or target ip is in one of them are ignored, even if included")
 	var timeout = flagSet.Uint("timeout", 1, "Timeout to exit, as minute.")
+	var duration = flagSet.Duration("duration", 0, "Stop capture after this duration(e.g. 30s) from the first packet, "+
+		"by capture timestamps for pcap files. Connections are flushed and in-flight exchanges are printed. 0 for unlimited")
+	var maxLifetime = flagSet.Duration("max-lifetime", 0, "Finalize connections live longer than this(e.g. 10m), even if still active. 0 for unlimited")
+	var maxWindow = flagSet.Int("max-window", 0, "Max out-of-order segments hold per direction, exceeded segments are force delivered or dropped. 0 for unlimited")
+	var spill = flagSet.Int("spill-threshold", 0, "Buffer stream data in memory up to this many bytes per direction, exceeded data is spilled to a temp file. 0 for disabled")
+	var spillDir = flagSet.String("spill-dir", "", "Dir to create spill temp files, default is the os temp dir")
 	var host = flagSet.String("filter-host", "", "Filter by request host, using wildcard match(*, ?)")
 	var uri = flagSet.String("filter-uri", "", "Filter by request url path, using wildcard match(*, ?)")
 	var force = flagSet.Bool("force", false, "Force print unknown content-type http body even if it seems not to be text content")
 	var pretty = flagSet.Bool("pretty", false, "Try to format and prettify json content")
-	var output = flagSet.String("output", "", "Write result to file [output] instead of stdout")
+	var jsonRPC = flagSet.Bool("jsonrpc", false, "Parse json-rpc request/response body, and report calls paired by json-rpc id")
+	var dumpNonHTTP = flagSet.Int("dump-non-http", 0, "Hex dump first N client bytes of connections never detected as http, when closed")
+	var output = flagSet.String("output", "", "Write result to file [output] instead of stdout. "+
+		"Use tcp://host:port or udp://host:port to stream result to a remote collector")
+	var outputBuffer = flagSet.Int("output-buffer", maxOutputQueueLen, "Max output records queued when output is slower than capture, "+
+		"e.g. a slow terminal or pipe. Records are dropped and counted when queue is full, unless -output-block is set")
+	var outputBlock = flagSet.Bool("output-block", false, "Block capture when output queue is full, instead of dropping records")
+	var protobuf = flagSet.String("protobuf-output", "", "Write exchange records to file as length-delimited protobuf messages, see exchange.proto")
+	var kafkaOutput = flagSet.String("kafka-output", "", "Publish exchange records to kafka, as kafka://broker1:9092,broker2:9092/topic. "+
+		"Records are keyed by connection, and dropped when brokers are unreachable and queue is full")
+	var kafkaFormat = flagSet.String("kafka-format", "json", "Format of kafka records, options are: json | protobuf(ExchangeRecord of exchange.proto)")
+	var otlpEndpoint = flagSet.String("otlp-endpoint", "", "Export each exchange as an OpenTelemetry span to OTLP/HTTP endpoint, "+
+		"e.g. http://localhost:4318")
+	var parquetOutput = flagSet.String("parquet-output", "", "Write exchange records as parquet files for analytics, "+
+		"with columns as table exchanges of -sqlite-output. Files are named by the path with a sequence number, "+
+		"like records-000001.parquet for records.parquet")
+	var parquetRows = flagSet.Int("parquet-rows", defaultParquetRows, "Max rows of each parquet file, 0 for no limit")
+	var parquetSize = flagSet.Int("parquet-size", defaultParquetSize, "Max estimated bytes of each parquet file, "+
+		"0 for no limit")
+	var sqliteOutput = flagSet.String("sqlite-output", "", "Insert exchange records to table exchanges of sqlite database file, "+
+		"for querying with sql")
+	var waterfall = flagSet.String("waterfall-output", "", "Write send/wait/receive timing phases of exchanges to file at exit, "+
+		"as a json timeline grouped by connection for waterfall renderers")
+	var bodyTypes = flagSet.String("body-types", "", "Comma separated content types to capture bodies for, e.g. application/json,text/*. "+
+		"Bodies of other types are drained without buffering")
+	var skipBodyTypes = flagSet.String("skip-body-types", "", "Comma separated content types not to capture bodies for, e.g. image/*,video/*")
+	var bodyStats = flagSet.Bool("body-stats", false, "Compute byte, line and top level json key counts of decoded bodies, "+
+		"and report them per exchange")
+	var messageBytes = flagSet.Bool("message-bytes", false, "Count header block and body bytes on wire of each request "+
+		"and response, and report them per exchange")
+	var cacheInfo = flagSet.Bool("cache-info", false, "Derive cacheability and max-age of responses by a shared cache "+
+		"from Cache-Control, Expires, ETag, Last-Modified and status code, and report them per exchange")
+	var httpFiles = flagSet.String("http-files", "", "Write request of each exchange to a .http file(VS Code REST Client / "+
+		"JetBrains HTTP Client format) in dir, which can be executed by these tools")
+	var transcriptDir = flagSet.String("transcript-dir", "", "Write the conversation of each connection to <connkey>.txt in dir, "+
+		"as messages on wire with direction and timestamp. Non printable parts are hex dumped, bytes of a message beyond 1MB are omitted")
+	var format = flagSet.String("format", "text", "Output format, options are: text | json(one json record per line)")
+	var bpf = flagSet.String("bpf", "", "Capture filter as bpf expression, e.g. 'tcp port 80 or tcp port 8080'. If set, the -ip and -port capture filter is not used")
+	var redactHeaders = flagSet.String("redact-headers", "", "Comma separated header names, whose values are redacted in exchange records")
+	var filterStatus = flagSet.String("filter-status", "", "Filter by response status class, e.g. 4xx,5xx")
+	var filterJSON = flagSet.String("filter-json", "", "Filter by json request or response body, with a json path "+
+		"and an optional comparison, e.g. \"$.error.code == 'RATE_LIMIT'\" or $.items[*].id. Bodies not json never match")
+	var noResponse = flagSet.Bool("filter-status-no-response", false, "Include exchanges without captured response, when filter by status")
+	var countStatus = flagSet.Bool("count-status", false, "Print count of responses per status class at exit")
+	var top = flagSet.Int("top", 0, "Print the top N exchanges ranked by -top-by at exit, for quick triage of slow requests. 0 for disabled")
+	var topBy = flagSet.String("top-by", topByTTFB, "Metric of -top, options are: ttfb(request end to response start) | "+
+		"total(request start to response end) | size(response body size)")
+	var aggregate = flagSet.Bool("aggregate", false, "Print count and latency of exchanges grouped by method and url template at exit")
+	var urlTemplates URLTemplateRules
+	flagSet.Var(&urlTemplates, "url-template", "Rule as regex=replacement to template url path for -aggregate and -inventory, e.g. '/[0-9]+=/{id}'. "+
+		"Can be set multi times. Numeric and uuid path segments are collapsed to {id} if not set")
+	var inventory = flagSet.Bool("inventory", false, "Print the distinct set of method, host and url template of requests seen, "+
+		"with first seen time and hit count at exit, instead of each exchange")
+	var exchangeRange = flagSet.String("exchange-range", "", "Only output exchanges whose 1-based index in connection is in range, e.g. 50-60, 50-, -10")
+	var rawHeaders = flagSet.Bool("raw-headers", false, "Keep header names casing as on wire in exchange records, instead of canonicalize them. Headers are always in wire order")
+	var packetRefs = flagSet.Bool("packet-refs", false, "Include capture file name and packet number in error, dropped and lost records, when reading from a pcap file")
+	var zeroCopy = flagSet.Bool("zero-copy", false, "Read packets by zero copy read and decode them with reused layers, to reduce allocations at high packet rates")
+	var serverPorts = flagSet.String("server-ports", "", "Comma separated ports known as server ports. Endpoint on these ports is always treated as server, when detect connection direction")
+	var socks5 = flagSet.Bool("socks5", false, "Detect socks5 handshake, report the connect target, and parse http traffic in the tunnel")
+	var unidirectional = flagSet.Bool("unidirectional", false, "Deliver in-order data of each direction by its own sequence progression, "+
+		"without waiting ACKs of the peer. For captures taken with only one direction, e.g. only client to server")
+	var http09 = flagSet.Bool("http09", false, "Parse HTTP/0.9 simple requests without http version, e.g. GET /index.html. "+
+		"The response is the bare body until connection close, and reported with status 200 and no headers")
+	var dedupWindow = flagSet.Duration("dedup-window", 0, "Suppress exchanges with same method, host and path as one emitted within this window(e.g. 1m), and report suppressed count instead. 0 for disabled")
+	var diff = flagSet.Bool("diff", false, "Group exchanges by request signature(method, host and path), and for repeats output "+
+		"differences of status, headers and response body against the first occurrence. Json bodies are diffed by values, text bodies by lines")
+	var diffIgnoreHeaders = flagSet.String("diff-ignore-headers", defaultDiffIgnoreHeaders, "Comma separated headers not compared by -diff")
+	var afpacketCapture = flagSet.Bool("afpacket", false, "Capture from -device by AF_PACKET sockets with memory-mapped rings instead of pcap, linux only. "+
+		"-device must be an ethernet, loopback, ppp or tun device, any is not supported. Kernel packet and drop counts are reported at exit")
+	var afpacketFrameSize = flagSet.Int("afpacket-frame-size", defaultAFPacketFrameSize, "Max bytes of a packet captured by -afpacket")
+	var afpacketBlockSize = flagSet.Int("afpacket-block-size", defaultAFPacketBlockSize, "Bytes of a ring block of -afpacket, a multiple of frame size and page size")
+	var afpacketBlocks = flagSet.Int("afpacket-blocks", defaultAFPacketBlocks, "Blocks in the ring of each -afpacket socket")
+	var afpacketFanout = flagSet.Uint("afpacket-fanout", 0, "Fanout group id joined by -afpacket sockets, to share packets by flow hash "+
+		"with other sockets and processes in the group. 0 for disabled")
+	var afpacketSockets = flagSet.Int("afpacket-sockets", 1, "AF_PACKET sockets joined to the -afpacket-fanout group, each read by its own goroutine")
+	var connectionSummary = flagSet.String("connection-summary", "off", "Emit one record per connection when it ends, with exchange count, "+
+		"bytes each way, duration, close reason, peak concurrent exchanges, "+
+		"and min, max, mean and jitter of inter-arrival times of data packets. Options are: off | alongside(with exchange output) | only(instead of printed exchanges)")
+	var rejectNonHTTP = flagSet.Int("reject-non-http", 0, "Finalize connections on -port or -server-ports that carried this many payload bytes "+
+		"without http detected, and report them with a not-http record, instead of keeping them until closed or idle. 0 for disabled")
+	var emit = flagSet.String("emit", "", "Comma separated named outputs writing one line per exchange to -output, e.g. json,clf. "+
+		"Built-in ones are json(exchange record) | clf(common log format)")
+	var connectionReuse = flagSet.Bool("connection-reuse", false, "Report for each exchange the connection disposition declared by "+
+		"Connection header and http version, and if the connection is actually reused by a following exchange")
+	var normalizeHeaders = flagSet.String("normalize-headers", "raw", "How headers are represented in exchange records, options are: "+
+		"raw(one field per header line) | join(values of the same header comma joined) | list(one field per value of list headers). "+
+		"Runs of whitespace in values are collapsed if not raw, and header lines as on wire are kept in raw header fields")
+	var dedupBody = flagSet.Bool("dedup-body", false, "Also compare request body hash when suppress duplicated exchanges")
+	var requestBoundary = flagSet.String("request-boundary", "stream", "How request starts on client stream are found for timing info, "+
+		"options are: stream(parse sequentially, the next request starts after the previous body) | segment(a segment starting with a http method)")
+	var overlapPolicy = flagSet.String("overlap-policy", "first", "How to resolve overlapping tcp segments with conflicting content, options are: first(first received wins) | last(last received wins)")
+	var heartbeat = flagSet.Duration("heartbeat", 0, "Print a status line(packets seen, active connections, exchanges emitted, dropped segments) to stderr every interval(e.g. 1m). 0 for disabled")
+	var extractFiles = flagSet.String("extract-files", "", "Write file parts of multipart/form-data requests to this dir. Empty for disabled")
+	var extractMaxSize = flagSet.Int64("extract-max-size", 100<<20, "Max total bytes of extracted files, exceeded files are truncated or skipped. 0 for unlimited")
+	var transcodeCharset = flagSet.Bool("transcode-charset", false, "Transcode request bodies of -http-files and response bodies of -diff "+
+		"to utf-8 from the charset of Content-Type. Bodies of unknown charsets are kept as is")
+	var verifyDigest = flagSet.Bool("verify-digest", false, "Verify body by Content-MD5, Digest and Content-Digest headers(md5, sha-256, sha-512), and report mismatch")
+	var requireResponse = flagSet.Bool("require-response", false, "Only output exchanges with both request and response captured. Requests without response are discarded and counted")
+	var firstLine = flagSet.Bool("first-line", false, "Only output request line and status line of exchanges verbatim, without full header parsing. Cheaper on high volume")
+	var warnReset = flagSet.Bool("warn-reset", false, "Warn exchanges aborted by tcp RST while request is in flight")
+	var parseCookies = flagSet.Bool("parse-cookies", false, "Parse Cookie and Set-Cookie headers to name, value and attributes records. Redacted cookie values are kept redacted")
+	var parseForwarded = flagSet.Bool("parse-forwarded", false, "Parse Forwarded(RFC 7239) or X-Forwarded-For headers to the chain of proxy hops, "+
+		"from the originating client to the tcp source")
+	var maxHeaderBytes = flagSet.Int("max-header-bytes", defaultMaxHeaderBytes, "Max bytes of a request or response header block. "+
+		"A larger one is reported as header too large error, and the rest of its connection is not parsed. 0 for unlimited")
+	var maxDecodeRatio = flagSet.Int64("max-decode-ratio", defaultMaxDecodeRatio, "Max ratio of decoded size to encoded size of a gzip or deflate body "+
+		"decoded for inspection. Decoding stops at it, and the body is flagged as a potential compression bomb. 0 for unlimited")
+	var maxDecodeSize = flagSet.Int64("max-decode-size", defaultMaxDecodeSize, "Max decoded bytes of a body decoded for inspection. "+
+		"Decoding stops at it, and the body is flagged as a potential compression bomb. 0 for unlimited")
+	var maxConnExchanges = flagSet.Int("max-conn-exchanges", 0, "Track at most N exchanges in flight per connection, to bound memory on abusive pipelining connections. "+
+		"Requests started while N requests wait for response are parsed but not output, and counted in a capped record when connection ends. 0 for unlimited")
+	var strictLineEndings = flagSet.Bool("strict-line-endings", false, "Reject messages whose header block has bare LF line endings, and report parse error. "+
+		"By default bare LF is accepted as CRLF")
+	var slowRequest = flagSet.Duration("slow-request", 0, "Warn requests took longer than this(e.g. 10s) from first byte to complete, "+
+		"or still incomplete when connection ends, a slowloris indicator. 0 for disabled")
+	var count = flagSet.Int64("count", 0, "Exit after this number of exchanges are emitted. 0 for unlimited")
+	var ringSize = flagSet.Int("ring", 0, "Hold the last N exchanges in memory instead of output them, and output them when "+
+		"a trigger exchange is seen, with the following -ring-after exchanges. 0 for disabled")
+	var ringBytes = flagSet.Int("ring-bytes", 0, "Max bytes of printed exchanges held in ring, 0 for unlimited")
+	var ringStatus = flagSet.String("ring-trigger-status", "5xx", "Response status classes triggering ring output, e.g. 4xx,5xx")
+	var ringHeader = flagSet.String("ring-trigger-header", "", "Request or response header triggering ring output, "+
+		"as Name: pattern, using wildcard match(*, ?)")
+	var throughput = flagSet.Bool("throughput", false, "Report average throughput of each direction of connections when they end, "+
+		"by payload bytes over the duration from the first to the last packet")
+	var throughputSlow = flagSet.Int64("throughput-slow", 0, "Flag connection directions slower than this bytes per second in -throughput records, 0 for not flagged")
+	var throughputFast = flagSet.Int64("throughput-fast", 0, "Flag connection directions faster than this bytes per second in -throughput records, 0 for not flagged")
+	var connFilter = flagSet.String("conn-filter", "", "Only output exchanges of connections matching comma separated conditions "+
+		"when they end, by close reason: fin | rst | idle | max-lifetime | capture-end, any of them matches, "+
+		"and by tcp handshake: handshake | no-handshake. Exchanges are held until connection ends")
+	var connFilterMaxHeld = flagSet.Int("conn-filter-max-held", defaultMaxHeld, "Max exchanges held per connection by -conn-filter, "+
+		"the oldest are evicted and counted beyond it. 0 for unlimited")
+	var ringAfter = flagSet.Int("ring-after", 10, "Exchanges output directly after a ring trigger")
+	var geoipDB = flagSet.String("geoip-db", "", "Comma separated MaxMind DB(mmdb) files, e.g. GeoLite2-Country.mmdb,GeoLite2-ASN.mmdb. "+
+		"Records are enriched with country and ASN of public endpoint ips. Empty for disabled")
+	var captureDNS = flagSet.Bool("dns", false, "Also capture dns traffic on udp/tcp port 53, print resolved names, "+
+		"and correlate server ips of http connections with the host names resolved to them. "+
+		"If -bpf is set, it should also capture port 53")
+	var localProcess = flagSet.Bool("local-process", false, "Associate connections with a local endpoint to the process(pid and name) "+
+		"owning the socket, by /proc/net/tcp and /proc/<pid>/fd on Linux. For live captures of the host's own traffic")
+	var localProcessRefresh = flagSet.Duration("local-process-refresh", 5*time.Second, "Max age of the cached socket table of -local-process before it is rebuilt")
+	var geoipCache = flagSet.Int("geoip-cache", 10000, "Max number of ips whose geoip lookup results are cached")
+	var bench = flagSet.Bool("bench", false, "Read pcap file as fast as possible with output discarded, and report packets/s, MB/s "+
+		"reassembly throughput and peak heap memory at end. Requires -file")
+	var replay = flagSet.String("replay", "", "Replay requests of exchange records file written by -protobuf-output against -replay-target, "+
+		"at their original relative timing. Request bodies are not recorded, requests are replayed without body")
+	var replayTarget = flagSet.String("replay-target", "", "Target to replay requests, e.g. http://127.0.0.1:8080. Original Host headers are kept")
+	var speed = flagSet.String("speed", "1x", "Speed multiplier of replay, e.g. 2x for replaying at double rate")
+	var configPath = flagSet.String("config", "", "Config file(yaml) contains named capture profiles")
+	var profile = flagSet.String("profile", "", "Use settings of the profile in config file. Flags set in command line override profile settings")
 	flagSet.Parse(os.Args[1:])
 
+	if *profile != "" {
+		if *configPath == "" {
+			logger.Error("config file not specified for profile", *profile)
+			return
+		}
+		if err := applyProfile(flagSet, *configPath, *profile); err != nil {
+			logger.Error("load profile error:", err)
+			return
+		}
+	}
+
+	if *replay != "" {
+		runReplay(*replay, *replayTarget, *speed)
+		return
+	}
+
+	if *bench && *filePath == "" {
+		logger.Error("-bench requires -file")
+		return
+	}
+
 	if *filterPort < 0 || *filterPort >= 65536 {
 		fmt.Fprint(os.Stderr, "ignored invalid port ", *filterPort)
 		*filterPort = 0
 	}
 
 	var config = &Config{
-		level:      *level,
-		filterIP:   *filterIP,
-		filterPort: uint16(*filterPort),
-		host:       *host,
-		uri:        *uri,
-		force:      *force,
-		pretty:     *pretty,
-		output:     *output,
-		timeout:    uint16(*timeout),
-	}
-
-	var packets chan gopacket.Packet
-	if *filePath != "" {
+		level:       *level,
+		filterIP:    *filterIP,
+		filterPort:  uint16(*filterPort),
+		host:        *host,
+		uri:         *uri,
+		force:       *force,
+		pretty:      *pretty,
+		output:      *output,
+		format:      *format,
+		timeout:     uint16(*timeout),
+		maxLifetime: *maxLifetime,
+		jsonRPC:     *jsonRPC,
+		dumpNonHTTP: *dumpNonHTTP,
+		maxWindow:   *maxWindow,
+		spill:       *spill,
+		spillDir:    *spillDir,
+		protobuf:    *protobuf,
+		bpf:         *bpf,
+	}
+	config.redactHeaders = parseNameSet(*redactHeaders)
+	config.rawHeaders = *rawHeaders
+	config.socks5 = *socks5
+	config.http09 = *http09
+	config.unidirectional = *unidirectional
+	config.dedupBody = *dedupBody
+	config.bodyTypes = parseBodyTypeFilter(*bodyTypes, *skipBodyTypes)
+	config.bodyStats = *bodyStats
+	config.messageBytes = *messageBytes
+	config.cacheInfo = *cacheInfo
+	config.keepRequestBody = *httpFiles != ""
+	config.verifyDigest = *verifyDigest
+	config.transcodeCharset = *transcodeCharset
+	config.firstLine = *firstLine
+	config.warnReset = *warnReset
+	config.parseCookies = *parseCookies
+	config.slowRequest = *slowRequest
+	config.parseForwarded = *parseForwarded
+	config.strictLineEndings = *strictLineEndings
+	config.maxHeaderBytes = *maxHeaderBytes
+	config.maxConnExchanges = *maxConnExchanges
+	config.decodeLimit = decodeLimit{maxRatio: *maxDecodeRatio, maxSize: *maxDecodeSize}
+	overlap, err := parseOverlapPolicy(*overlapPolicy)
+	if err != nil {
+		logger.Error("invalid -overlap-policy:", err)
+		return
+	}
+	if *outputBuffer <= 0 {
+		logger.Error("invalid -output-buffer:", *outputBuffer)
+		return
+	}
+	config.overlap = overlap
+	if config.requestBoundary, err = parseRequestBoundary(*requestBoundary); err != nil {
+		logger.Error("invalid -request-boundary:", err)
+		return
+	}
+	config.rejectNonHTTP = *rejectNonHTTP
+	config.connectionReuse = *connectionReuse
+	if config.headerNormalization, err = parseHeaderNormalization(*normalizeHeaders); err != nil {
+		logger.Error("invalid -normalize-headers:", err)
+		return
+	}
+	if config.connectionSummary, err = parseConnectionSummaryMode(*connectionSummary); err != nil {
+		logger.Error("invalid -connection-summary:", err)
+		return
+	}
+	if *packetRefs && *filePath != "" && *filePath != "-" {
+		config.captureFile = *filePath
+	}
+	if *serverPorts != "" {
+		var err error
+		if config.serverPorts, err = parsePortSet(*serverPorts); err != nil {
+			logger.Error("invalid -server-ports:", err)
+			return
+		}
+	}
+	if *includeCIDR != "" || *excludeCIDR != "" {
+		var err error
+		if config.cidrFilter, err = parseCIDRFilter(*includeCIDR, *excludeCIDR); err != nil {
+			logger.Error("invalid -include-cidr or -exclude-cidr:", err)
+			return
+		}
+	}
+	if *filterStatus != "" {
+		var err error
+		if config.statusFilter, err = parseStatusFilter(*filterStatus, *noResponse); err != nil {
+			logger.Error("invalid -filter-status:", err)
+			return
+		}
+	}
+	if *filterJSON != "" {
+		var err error
+		if config.jsonFilter, err = parseJSONFilter(*filterJSON); err != nil {
+			logger.Error("invalid -filter-json:", err)
+			return
+		}
+	}
+	if *exchangeRange != "" {
+		var err error
+		if config.exchangeRange, err = parseIndexRange(*exchangeRange); err != nil {
+			logger.Error("invalid -exchange-range:", err)
+			return
+		}
+	}
+
+	var packets chan *tcpSegment
+	var live = true
+	var afpacketSource *AFPacketSource
+	if *afpacketCapture && *filePath == "" {
+		if *afpacketSockets > 1 && *afpacketFanout == 0 {
+			logger.Error("-afpacket-sockets larger than 1 requires -afpacket-fanout")
+			return
+		}
+		if *afpacketFanout > math.MaxUint16 {
+			logger.Error("invalid -afpacket-fanout:", *afpacketFanout)
+			return
+		}
+		var err error
+		afpacketSource, err = openAFPacket(afpacketConfig{device: *device, frameSize: *afpacketFrameSize,
+			blockSize: *afpacketBlockSize, blocks: *afpacketBlocks, fanout: uint16(*afpacketFanout),
+			sockets: *afpacketSockets,
+			filter:  captureFilter(config.bpf, config.filterIP, config.filterPort, *captureDNS)})
+		if err != nil {
+			logger.Error("open AF_PACKET on device", *device, "failed, error:", err)
+			return
+		}
+		defer afpacketSource.close()
+		packets = afpacketSource.segments(*zeroCopy)
+	} else if *filePath == "-" || isNamedPipe(*filePath) {
+		// read pcap stream from stdin or fifo
+		var stream io.Reader = os.Stdin
+		if *filePath != "-" {
+			fifo, err := os.Open(*filePath)
+			if err != nil {
+				logger.Error("Open fifo", *filePath, "error:", err)
+				return
+			}
+			defer fifo.Close()
+			stream = fifo
+		}
+		var err error
+		packets, err = pcapStreamSegments(stream, *zeroCopy)
+		if err != nil {
+			logger.Error("Read pcap stream error:", err)
+			return
+		}
+		live = false
+	} else if *filePath != "" {
 		// read from pcap file
 		var handle, err = pcap.OpenOffline(*filePath)
 		if err != nil {
 			logger.Error("Open file", *filePath, "error:", err)
 			return
 		}
-		packets = listenOneSource(handle)
+		packets = listenOneSource(handle, *zeroCopy)
+		live = false
 	} else if *device == "any" && runtime.GOOS != "linux" {
 		// capture all device
 		// Only linux 2.2+ support any interface. we have to list all network device and listened on them all
@@ -148,9 +566,9 @@ func main() {
 			return
 		}
 
-		var packetsSlice = make([]chan gopacket.Packet, len(interfaces))
+		var packetsSlice = make([]chan *tcpSegment, len(interfaces))
 		for _, itf := range interfaces {
-			localPackets, err := openSingleDevice(itf.Name, config.filterIP, config.filterPort)
+			localPackets, err := openSingleDevice(itf.Name, config.bpf, config.filterIP, config.filterPort, *captureDNS, *zeroCopy)
 			if err != nil {
 				logger.Warn("open device", device, "error:", err)
 				continue
@@ -161,7 +579,7 @@ func main() {
 	} else if *device != "" {
 		// capture one device
 		var err error
-		packets, err = openSingleDevice(*device, config.filterIP, config.filterPort)
+		packets, err = openSingleDevice(*device, config.bpf, config.filterIP, config.filterPort, *captureDNS, *zeroCopy)
 		if err != nil {
 			logger.Error("listen on device", *device, "failed, error:", err)
 			return
@@ -171,48 +589,305 @@ func main() {
 		flagSet.Usage()
 		return
 	}
+	if *duration > 0 {
+		packets = limitDuration(packets, *duration, live)
+	}
 
-	pPrinter := newPrinter(*output)
+	var pPrinter *Printer
+	if *bench {
+		pPrinter = newWriterPrinter(nopWriteCloser{ioutil.Discard}, *outputBuffer, *outputBlock)
+	} else {
+		pPrinter = newPrinter(*output, *outputBuffer, *outputBlock)
+	}
 	var handler = &HTTPConnectionHandler{
 		config:  config,
 		printer: pPrinter,
 	}
+	if config.protobuf != "" {
+		sink, err := newProtobufSink(config.protobuf)
+		if err != nil {
+			logger.Error("open protobuf output", config.protobuf, "error:", err)
+			return
+		}
+		handler.sinks = append(handler.sinks, sink)
+	}
+	if *kafkaOutput != "" {
+		brokers, topic, ok := parseKafkaOutput(*kafkaOutput)
+		if !ok {
+			logger.Error("invalid -kafka-output:", *kafkaOutput)
+			return
+		}
+		if *kafkaFormat != "json" && *kafkaFormat != "protobuf" {
+			logger.Error("unsupported kafka format:", *kafkaFormat)
+			return
+		}
+		handler.sinks = append(handler.sinks, newKafkaSink(newKafkaWriter(brokers, kafkaTimeout), topic, *kafkaFormat,
+			defaultKafkaQueue))
+	}
+	if *httpFiles != "" {
+		sink, err := newHTTPFileSink(*httpFiles)
+		if err != nil {
+			logger.Error("create dir", *httpFiles, "error:", err)
+			return
+		}
+		handler.sinks = append(handler.sinks, sink)
+	}
+	if *sqliteOutput != "" {
+		sink, err := newSQLiteSink(*sqliteOutput)
+		if err != nil {
+			logger.Error("open sqlite output", *sqliteOutput, "error:", err)
+			return
+		}
+		handler.sinks = append(handler.sinks, sink)
+	}
+	if *parquetOutput != "" {
+		sink, err := newParquetSink(*parquetOutput, *parquetRows, *parquetSize)
+		if err != nil {
+			logger.Error("open parquet output", *parquetOutput, "error:", err)
+			return
+		}
+		handler.sinks = append(handler.sinks, sink)
+	}
+	if *otlpEndpoint != "" {
+		exporter, err := newOTLPExporter(*otlpEndpoint, otlpTimeout)
+		if err != nil {
+			logger.Error("invalid -otlp-endpoint:", err)
+			return
+		}
+		handler.sinks = append(handler.sinks, newOTelSink(exporter, defaultOTelQueue))
+	}
+	if *waterfall != "" {
+		sink, err := newWaterfallSink(*waterfall)
+		if err != nil {
+			logger.Error("open waterfall output", *waterfall, "error:", err)
+			return
+		}
+		handler.sinks = append(handler.sinks, sink)
+	}
+	if *emit != "" {
+		sinks, err := newExchangeOutputs(*emit, pPrinter, config)
+		if err != nil {
+			logger.Error("invalid -emit:", err)
+			return
+		}
+		handler.sinks = append(handler.sinks, sinks...)
+	}
+	if *countStatus {
+		handler.statusCounter = &StatusCounter{}
+	}
+	if *top > 0 {
+		handler.top, err = newTopExchanges(*top, *topBy)
+		if err != nil {
+			logger.Error("invalid -top-by:", err)
+			return
+		}
+	}
+	if *aggregate {
+		handler.aggregator = newURLAggregator(urlTemplates)
+	}
+	if *inventory {
+		handler.inventory = newEndpointInventory(urlTemplates)
+	}
+	if *diff {
+		handler.differ = newExchangeDiffer(*diffIgnoreHeaders)
+	}
+	if *dedupWindow > 0 {
+		handler.suppressor = newExchangeSuppressor(*dedupWindow)
+	}
+	if *count > 0 {
+		handler.limit = newExchangeLimit(*count)
+	}
+	if *ringSize > 0 {
+		status, err := parseStatusFilter(*ringStatus, false)
+		if err != nil {
+			logger.Error("invalid -ring-trigger-status:", err)
+			return
+		}
+		handler.ring, err = newExchangeRing(*ringSize, *ringBytes, status, *ringHeader, *ringAfter)
+		if err != nil {
+			logger.Error("invalid -ring-trigger-header:", err)
+			return
+		}
+	}
+	if *connFilter != "" {
+		if handler.connectionFilter, err = parseConnectionFilter(*connFilter); err != nil {
+			logger.Error("invalid -conn-filter:", err)
+			return
+		}
+		handler.connectionFilter.maxHeld = *connFilterMaxHeld
+	}
+	if *requireResponse {
+		handler.unpaired = &UnpairedCounter{}
+	}
+	if *extractFiles != "" {
+		if err := os.MkdirAll(*extractFiles, 0755); err != nil {
+			logger.Error("create dir", *extractFiles, "error:", err)
+			return
+		}
+		handler.extractor = newFileExtractor(*extractFiles, *extractMaxSize)
+	}
+	if *transcriptDir != "" {
+		if handler.transcripts, err = newTranscriptWriter(*transcriptDir); err != nil {
+			logger.Error("create dir", *transcriptDir, "error:", err)
+			return
+		}
+	}
+	if *geoipDB != "" {
+		handler.geoip = newGeoIPEnricher(strings.Split(*geoipDB, ","), *geoipCache)
+		if handler.geoip == nil {
+			logger.Warn("no geoip db available, geoip enrichment disabled")
+		}
+	}
+	if *localProcess {
+		if handler.processes, err = newProcessResolver(osProcFS{}, *localProcessRefresh); err != nil {
+			logger.Warn("read socket table error:", err, ", local process association disabled")
+		}
+	}
+	if *captureDNS {
+		handler.dns = newDNSResolver(pPrinter, config.format)
+	}
 	var assembler = newTCPAssembler(handler, pPrinter)
-	assembler.filterIP = config.filterIP
-	assembler.filterPort = config.filterPort
+	configureAssembler(assembler, config)
+	assembler.dns = handler.dns
+	if *throughput {
+		assembler.throughput = &ThroughputReporter{slow: float64(*throughputSlow), fast: float64(*throughputFast)}
+	}
+	var stats *CaptureStats
+	if *heartbeat > 0 || *bench {
+		stats = &CaptureStats{}
+		handler.stats = stats
+		assembler.stats = stats
+	}
+	if *heartbeat > 0 {
+		stopHeartbeat := make(chan struct{})
+		defer close(stopHeartbeat)
+		go runHeartbeat(assembler, *heartbeat, os.Stderr, stopHeartbeat)
+	}
+	var stopSuppressReports, suppressReportsDone chan struct{}
+	if handler.suppressor != nil {
+		stopSuppressReports, suppressReportsDone = make(chan struct{}), make(chan struct{})
+		go runSuppressReports(handler.suppressor, pPrinter, config.format, stopSuppressReports, suppressReportsDone)
+	}
+	var stop <-chan struct{}
+	if handler.limit != nil {
+		stop = handler.limit.done
+	}
+	var benchmark *Benchmark
+	if *bench {
+		benchmark = startBenchmark(stats, 10*time.Millisecond)
+	}
+	capture(packets, assembler, time.Minute*time.Duration(config.timeout), stop)
+
+	assembler.finishAll()
+	waitGroup.Wait()
+	if stopSuppressReports != nil {
+		close(stopSuppressReports)
+		<-suppressReportsDone
+	}
+	if benchmark != nil {
+		fmt.Print(benchmark.finish())
+	}
+	if afpacketSource != nil {
+		if afpacketStats, err := afpacketSource.stats(); err != nil {
+			logger.Warn("read AF_PACKET stats error:", err)
+		} else {
+			pPrinter.send(afpacketStats.format(config.format))
+		}
+	}
+	handler.closeSinks()
+	handler.printer.finish()
+	printerWaitGroup.Wait()
+}
+
+// if path is a named pipe(fifo)
+func isNamedPipe(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// feed packets to assembler, until packets end, timeout, or stop is closed
+func capture(packets chan *tcpSegment, assembler *TCPAssembler, timeout time.Duration, stop <-chan struct{}) {
 	var ticker = time.Tick(time.Second * 30)
 
-	var endTimer = time.Tick(time.Minute * time.Duration(config.timeout))
+	var endTimer = time.Tick(timeout)
 
-outer:
 	for {
 		select {
-		case packet := <-packets:
-			// A nil packet indicates the end of a pcap file.
-			if packet == nil {
-				break outer
+		case segment := <-packets:
+			// A nil segment indicates the end of a pcap file.
+			if segment == nil {
+				return
 			}
-
-			// only assembly tcp/ip packets
-			if packet.NetworkLayer() == nil || packet.TransportLayer() == nil ||
-				packet.TransportLayer().LayerType() != layers.LayerTypeTCP {
+			if segment.dns != nil && assembler.dns != nil {
+				assembler.dns.handle(segment)
 				continue
 			}
-			var tcp = packet.TransportLayer().(*layers.TCP)
-
-			assembler.assemble(packet.NetworkLayer().NetworkFlow(), tcp, packet.Metadata().Timestamp)
+			if segment.tcp == nil {
+				// udp dns traffic, not resolved without -dns
+				continue
+			}
+			assembler.assembleIPPacket(segment.flow, segment.ip, segment.tcp, segment.timestamp, segment.number)
 
 		case <-ticker:
 			// flush connections that haven't seen activity in the past 2 minutes.
 			assembler.flushOlderThan(time.Now().Add(time.Minute * -2))
 		case <-endTimer:
 			fmt.Println("Auto exit.")
-			break outer
+			return
+		case <-stop:
+			return
 		}
 	}
+}
 
-	assembler.finishAll()
-	waitGroup.Wait()
-	handler.printer.finish()
-	printerWaitGroup.Wait()
+// copy assembler settings from config
+func configureAssembler(assembler *TCPAssembler, config *Config) {
+	assembler.filterIP = config.filterIP
+	assembler.filterPort = config.filterPort
+	assembler.cidrFilter = config.cidrFilter
+	assembler.format = config.format
+	assembler.maxLifetime = config.maxLifetime
+	assembler.dumpNonHTTP = config.dumpNonHTTP
+	assembler.rejectNonHTTP = config.rejectNonHTTP
+	assembler.maxWindow = config.maxWindow
+	assembler.spillThreshold = config.spill
+	assembler.spillDir = config.spillDir
+	assembler.serverPorts = config.serverPorts
+	assembler.socks5 = config.socks5
+	assembler.http09 = config.http09
+	assembler.unidirectional = config.unidirectional
+	assembler.summaryOnly = config.connectionSummary == SummaryOnly
+	assembler.overlapPolicy = config.overlap
+	assembler.requestBoundary = config.requestBoundary
+	assembler.captureFile = config.captureFile
+}
+
+// parse comma separated ports to a set
+func parsePortSet(value string) (map[uint16]bool, error) {
+	var ports = map[uint16]bool{}
+	for _, port := range strings.Split(value, ",") {
+		if port = strings.TrimSpace(port); port == "" {
+			continue
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return nil, fmt.Errorf("invalid port: %s", port)
+		}
+		ports[uint16(p)] = true
+	}
+	return ports, nil
+}
+
+// parse comma separated names to a set, names are lower cased
+func parseNameSet(value string) map[string]bool {
+	var names = map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[strings.ToLower(name)] = true
+		}
+	}
+	return names
 }
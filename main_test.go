@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump-duration")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	requestOf := func(port int) string {
+		return fmt.Sprintf("GET /%d HTTP/1.1\r\nHost: example.com\r\n\r\n", port-50000)
+	}
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	type timedPacket struct {
+		offset time.Duration
+		data   []byte
+	}
+	packets := []timedPacket{
+		// a whole exchange
+		{0, tcpPacketDataOf(t, 50001, true, 1000, 5000, requestOf(50001))},
+		{time.Second, tcpPacketDataOf(t, 50001, false, 5000, 1000+uint32(len(requestOf(50001))), response)},
+		{time.Second, tcpPacketDataOf(t, 50001, true, 1000+uint32(len(requestOf(50001))), 5000+uint32(len(response)), "")},
+		// request in flight when capture stops, its response is after the window
+		{2 * time.Second, tcpPacketDataOf(t, 50002, true, 1000, 5000, requestOf(50002))},
+		{5 * time.Second, tcpPacketDataOf(t, 50002, false, 5000, 1000+uint32(len(requestOf(50002))), response)},
+		// connection after the window
+		{6 * time.Second, tcpPacketDataOf(t, 50003, true, 1000, 5000, requestOf(50003))},
+	}
+	var data [][]byte
+	var timestamps []time.Time
+	for _, packet := range packets {
+		data = append(data, packet.data)
+		timestamps = append(timestamps, start.Add(packet.offset))
+	}
+	path := filepath.Join(dir, "capture.pcap")
+	f, err := os.Create(path)
+	assert.Nil(t, err)
+	writePcapStreamAt(t, f, data, timestamps)
+	assert.Nil(t, f.Close())
+
+	// offline capture file, stopped by capture timestamps
+	f, err = os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	segments, err := pcapStreamSegments(f, false)
+	assert.Nil(t, err)
+	handler, sink := newTestHTTPHandler(&Config{})
+	assembler := newTCPAssembler(handler, handler.printer)
+	capture(limitDuration(segments, 3*time.Second, false), assembler, time.Minute, nil)
+	assembler.finishAll()
+	waitGroup.Wait()
+
+	if assert.Equal(t, 2, len(sink.exchanges)) {
+		var byURL = map[string]int{}
+		for _, exchange := range sink.exchanges {
+			byURL[exchange.url] = exchange.status
+		}
+		assert.Equal(t, map[string]int{"/1": 204, "/2": 0}, byURL)
+	}
+}
+
+func TestCaptureDurationLive(t *testing.T) {
+	// no more packets after the first one, capture is stopped by wall-clock
+	packets := make(chan *tcpSegment, 1)
+	packets <- &tcpSegment{flow: testClientFlow, tcp: &layers.TCP{SrcPort: 50000, DstPort: 80, Seq: 1000, ACK: true},
+		timestamp: time.Now()}
+	assembler, _ := newTestAssembler()
+	stopped := make(chan struct{})
+	go func() {
+		capture(limitDuration(packets, 50*time.Millisecond, true), assembler, time.Minute, nil)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "capture not stopped after duration elapsed")
+	}
+}
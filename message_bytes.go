@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// messageBytes is the split of a http message on wire
+type messageBytes struct {
+	header int64 // start line, header lines and the blank line ending the header block
+	body   int64 // body as on wire, including chunk framing and trailers
+}
+
+// offset in stream of the position buffered reader consumed to
+func (r *recordReader) position(buffered *bufio.Reader) int64 {
+	return r.count - int64(buffered.Buffered())
+}
+
+// count header bytes of the message marked by recorder, when header is parsed. nil if not enabled
+func (h *HTTPTrafficHandler) readHeaderBytes(recorder *recordReader, buffered *bufio.Reader) *messageBytes {
+	if !h.config.messageBytes {
+		return nil
+	}
+	return &messageBytes{header: recorder.position(buffered) - recorder.start}
+}
+
+// count body bytes, when body of the message is read
+func (bytes *messageBytes) bodyDone(recorder *recordReader, buffered *bufio.Reader) {
+	if bytes == nil {
+		return
+	}
+	bytes.body = recorder.position(buffered) - recorder.start - bytes.header
+}
+
+func (bytes *messageBytes) String() string {
+	return fmt.Sprintf("header=%d body=%d", bytes.header, bytes.body)
+}
+
+// send a message bytes record of exchange to printer
+func (h *HTTPTrafficHandler) reportMessageBytes(exchange *Exchange) {
+	request, response := exchange.requestBytes, exchange.responseBytes
+	if request == nil {
+		return
+	}
+	if h.config.format == "json" {
+		record := map[string]interface{}{
+			"type":               "message-bytes",
+			"src":                exchange.key.srcString(),
+			"dst":                exchange.key.dstString(),
+			"requestHeaderBytes": request.header,
+			"requestBodyBytes":   request.body,
+		}
+		if response != nil {
+			record["responseHeaderBytes"] = response.header
+			record["responseBodyBytes"] = response.body
+		}
+		data, _ := json.Marshal(record)
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	var fields = []string{"[message-bytes]", exchange.key.srcString(), "->", exchange.key.dstString(),
+		exchange.method, exchange.host + exchange.url, "request", request.String()}
+	if response != nil {
+		fields = append(fields, "response", response.String())
+	}
+	h.printer.send(strings.Join(fields, " ") + "\n")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageBytes(t *testing.T) {
+	requestHeader := "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 11\r\n\r\n"
+	responseHeader := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"
+	responseBody := "5\r\nhello\r\n0\r\n\r\n"
+	sink, printer := runHTTPConversation(&Config{messageBytes: true}, []testSegment{
+		// header block end spans segments
+		{up: true, payload: requestHeader[:30]},
+		{up: true, payload: requestHeader[30 : len(requestHeader)-1]},
+		{up: true, payload: requestHeader[len(requestHeader)-1:] + "hello"},
+		{up: true, payload: " world"},
+		{up: false, payload: responseHeader[:len(responseHeader)-2]},
+		{up: false, payload: responseHeader[len(responseHeader)-2:] + responseBody[:4]},
+		{up: false, payload: responseBody[4:]},
+		{up: true, payload: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+
+	if assert.Equal(t, 2, len(sink.exchanges)) {
+		exchange := sink.exchanges[0]
+		assert.Equal(t, &messageBytes{header: int64(len(requestHeader)), body: 11}, exchange.requestBytes)
+		assert.Equal(t, &messageBytes{header: int64(len(responseHeader)), body: int64(len(responseBody))},
+			exchange.responseBytes)
+		assert.Equal(t, int64(5), exchange.responseBodySize)
+		record := exchange.toProto()
+		assert.Equal(t, int64(len(requestHeader)), record.RequestBytes.Header)
+		assert.Equal(t, int64(len(responseBody)), record.ResponseBytes.Body)
+
+		exchange = sink.exchanges[1]
+		assert.Equal(t, &messageBytes{header: 37}, exchange.requestBytes)
+		assert.Equal(t, &messageBytes{header: 27}, exchange.responseBytes)
+	}
+	var lines []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[message-bytes]") {
+			lines = append(lines, msg)
+		}
+	}
+	assert.Equal(t, []string{
+		"[message-bytes] 10.0.0.1:50000 -> 10.0.0.2:80 POST example.com/upload request header=64 body=11 response header=47 body=15\n",
+		"[message-bytes] 10.0.0.1:50000 -> 10.0.0.2:80 GET example.com/ request header=37 body=0 response header=27 body=0\n",
+	}, lines)
+
+	// not set if not enabled
+	sink, _ = runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n\r\n"},
+	})
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Nil(t, sink.exchanges[0].requestBytes)
+		assert.Nil(t, sink.exchanges[0].toProto().RequestBytes)
+	}
+}
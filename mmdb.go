@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MaxMindDB reads MaxMind DB(mmdb) files, e.g. GeoLite2-Country and GeoLite2-ASN.
+// The whole file is loaded into memory
+type MaxMindDB struct {
+	reader *maxminddb.Reader
+}
+
+// fields of country and asn databases used
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	ASN          uint32 `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// load MaxMind DB file
+func openMaxMindDB(path string) (*MaxMindDB, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseMaxMindDB(content)
+}
+
+func parseMaxMindDB(content []byte) (*MaxMindDB, error) {
+	reader, err := maxminddb.FromBytes(content)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindDB{reader: reader}, nil
+}
+
+func (db *MaxMindDB) lookup(ip net.IP) (geoInfo, bool) {
+	var record mmdbRecord
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		logger.Debug("lookup MaxMind DB error:", err)
+		return geoInfo{}, false
+	}
+	info := geoInfo{
+		country:      record.Country.ISOCode,
+		asn:          record.ASN,
+		organization: record.Organization,
+	}
+	if info.country == "" {
+		info.country = record.RegisteredCountry.ISOCode
+	}
+	return info, info != geoInfo{}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// data types, marker and separator of the MaxMind DB format, for building test databases
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbUint16  = 5
+	mmdbUint32  = 6
+	mmdbMap     = 7
+)
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+const mmdbDataSeparator = 16
+
+// control byte of type and size, size less than 285
+func mmdbControl(dataType byte, size int) []byte {
+	if size >= 29 {
+		return []byte{dataType<<5 | 29, byte(size - 29)}
+	}
+	return []byte{dataType<<5 | byte(size)}
+}
+
+func mmdbStringValue(s string) []byte {
+	return append(mmdbControl(mmdbString, len(s)), s...)
+}
+
+func mmdbUintValue(dataType byte, value uint32) []byte {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], value)
+	return append(mmdbControl(dataType, 4), data[:]...)
+}
+
+// build a ipv4 MaxMind DB with 24 bits records, which maps prefix/bits to one data record
+func buildTestMMDB(prefix net.IP, bits int) []byte {
+	prefix = prefix.To4()
+	nodeCount := uint32(bits)
+	// data section: the "US" string referenced by pointer, then the record map
+	data := mmdbStringValue("US")
+	recordOffset := uint32(len(data))
+	data = append(data, mmdbControl(mmdbMap, 3)...)
+	data = append(data, mmdbStringValue("country")...)
+	data = append(data, mmdbControl(mmdbMap, 1)...)
+	data = append(data, mmdbStringValue("iso_code")...)
+	data = append(data, mmdbPointer<<5, 0) // pointer to offset 0
+	data = append(data, mmdbStringValue("autonomous_system_number")...)
+	data = append(data, mmdbUintValue(mmdbUint32, 15169)...)
+	data = append(data, mmdbStringValue("autonomous_system_organization")...)
+	data = append(data, mmdbStringValue("GOOGLE")...)
+
+	var tree []byte
+	for node := uint32(0); node < nodeCount; node++ {
+		next := node + 1
+		if next == nodeCount {
+			next = nodeCount + mmdbDataSeparator + recordOffset
+		}
+		records := [2]uint32{nodeCount, nodeCount}
+		records[prefix[node/8]>>(7-node%8)&1] = next
+		for _, record := range records {
+			tree = append(tree, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+
+	content := append(tree, make([]byte, mmdbDataSeparator)...)
+	content = append(content, data...)
+	content = append(content, mmdbMetadataMarker...)
+	content = append(content, mmdbControl(mmdbMap, 3)...)
+	content = append(content, mmdbStringValue("node_count")...)
+	content = append(content, mmdbUintValue(mmdbUint32, nodeCount)...)
+	content = append(content, mmdbStringValue("record_size")...)
+	content = append(content, mmdbControl(mmdbUint16, 1)...)
+	content = append(content, 24)
+	content = append(content, mmdbStringValue("ip_version")...)
+	content = append(content, mmdbControl(mmdbUint16, 1)...)
+	content = append(content, 4)
+	return content
+}
+
+func TestMaxMindDBLookup(t *testing.T) {
+	db, err := parseMaxMindDB(buildTestMMDB(net.ParseIP("8.8.0.0"), 16))
+	assert.Nil(t, err)
+
+	info, ok := db.lookup(net.ParseIP("8.8.4.4"))
+	assert.True(t, ok)
+	assert.Equal(t, geoInfo{country: "US", asn: 15169, organization: "GOOGLE"}, info)
+
+	_, ok = db.lookup(net.ParseIP("8.9.4.4"))
+	assert.False(t, ok)
+	_, ok = db.lookup(net.ParseIP("2001:4860:4860::8888"))
+	assert.False(t, ok)
+
+	_, err = parseMaxMindDB([]byte("not a db"))
+	assert.NotNil(t, err)
+}
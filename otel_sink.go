@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultOTelQueue = 10000
+	maxOTelBatch     = 512
+	otelLinger       = 100 * time.Millisecond
+	otlpTimeout      = 10 * time.Second
+)
+
+// OTelSink export each exchange as an OpenTelemetry client span with http semantic convention attributes.
+// Spans are batched by the sdk in background. When its queue is full new spans are dropped, so an unreachable
+// collector never blocks the capture path
+type OTelSink struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// exporter of OTLP/HTTP endpoint url, like http://localhost:4318
+func newOTLPExporter(endpoint string, timeout time.Duration) (sdktrace.SpanExporter, error) {
+	return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint),
+		otlptracehttp.WithTimeout(timeout))
+}
+
+func newOTelSink(exporter sdktrace.SpanExporter, maxQueue int) *OTelSink {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithMaxQueueSize(maxQueue),
+			sdktrace.WithMaxExportBatchSize(maxOTelBatch), sdktrace.WithBatchTimeout(otelLinger)),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("httpdump"))),
+	)
+	return &OTelSink{provider: provider, tracer: provider.Tracer("httpdump")}
+}
+
+// span of exchange, from request start to response end. A span without response ends at request end,
+// and has error status
+func (sink *OTelSink) write(exchange *Exchange) error {
+	end := exchange.responseEnd
+	if end.IsZero() {
+		end = exchange.requestEnd
+	}
+	if end.Before(exchange.requestStart) {
+		end = exchange.requestStart
+	}
+	_, span := sink.tracer.Start(context.Background(), exchange.method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(exchange.requestStart), trace.WithAttributes(exchangeAttributes(exchange)...))
+	switch {
+	case exchange.status == 0:
+		message := "no response"
+		if exchange.closeReason != "" {
+			message += ", connection closed by " + exchange.closeReason
+		}
+		span.SetStatus(codes.Error, message)
+	case exchange.status >= 400:
+		// client span with 4xx or 5xx status is error by http semantic conventions
+		span.SetStatus(codes.Error, "")
+	}
+	span.End(trace.WithTimestamp(end))
+	return nil
+}
+
+func exchangeAttributes(exchange *Exchange) []attribute.KeyValue {
+	scheme := exchange.scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	host := exchange.host
+	if host == "" {
+		host = exchange.key.dstString()
+	}
+	path := exchange.url
+	if idx := strings.IndexByte(path, '?'); idx >= 0 {
+		path = path[:idx]
+	}
+	serverAddress := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		serverAddress = h
+	}
+	attributes := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(exchange.method),
+		semconv.URLFull(scheme + "://" + host + exchange.url),
+		semconv.URLPath(path),
+		semconv.URLScheme(scheme),
+		semconv.ServerAddress(serverAddress),
+		semconv.ServerPort(int(exchange.key.dst.port)),
+		semconv.NetworkPeerAddress(exchange.key.dst.ip),
+		semconv.ClientAddress(exchange.key.src.ip),
+		semconv.ClientPort(int(exchange.key.src.port)),
+		semconv.HTTPRequestBodySize(int(exchange.requestBodySize)),
+	}
+	if exchange.status > 0 {
+		attributes = append(attributes, semconv.HTTPResponseStatusCode(exchange.status),
+			semconv.HTTPResponseBodySize(int(exchange.responseBodySize)))
+	}
+	return attributes
+}
+
+// Close export queued spans if collector is reachable
+func (sink *OTelSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	return sink.provider.Shutdown(ctx)
+}
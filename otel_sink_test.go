@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttributes(span tracetest.SpanStub) map[string]interface{} {
+	var attributes = map[string]interface{}{}
+	for _, attribute := range span.Attributes {
+		attributes[string(attribute.Key)] = attribute.Value.AsInterface()
+	}
+	return attributes
+}
+
+func TestOTelSink(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	sink := newOTelSink(exporter, defaultOTelQueue)
+	handler, _ := newTestHTTPHandler(&Config{})
+	handler.sinks = append(handler.sinks, sink)
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /items?page=2 HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", delay: 200 * time.Millisecond},
+		{up: true, payload: "POST /items HTTP/1.1\r\nHost: example.com:8080\r\nContent-Length: 2\r\n\r\n{}",
+			delay: time.Second},
+		{up: false, payload: "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 0\r\n\r\n",
+			delay: 50 * time.Millisecond},
+		{up: true, payload: "GET /slow HTTP/1.1\r\nHost: example.com\r\n\r\n", delay: time.Second},
+	})
+	// the in memory exporter forgets spans when shut down, so spans are flushed before close
+	assert.Nil(t, sink.provider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	assert.Nil(t, sink.Close())
+	if !assert.Equal(t, 3, len(spans)) {
+		return
+	}
+
+	span := spans[0]
+	assert.Equal(t, "GET", span.Name)
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+	assert.Equal(t, 200*time.Millisecond, span.EndTime.Sub(span.StartTime))
+	assert.Equal(t, codes.Unset, span.Status.Code)
+	assert.Equal(t, map[string]interface{}{
+		"http.request.method":       "GET",
+		"url.full":                  "http://example.com/items?page=2",
+		"url.path":                  "/items",
+		"url.scheme":                "http",
+		"server.address":            "example.com",
+		"server.port":               int64(80),
+		"network.peer.address":      "10.0.0.2",
+		"client.address":            "10.0.0.1",
+		"client.port":               int64(50000),
+		"http.request.body.size":    int64(0),
+		"http.response.status_code": int64(200),
+		"http.response.body.size":   int64(5),
+	}, spanAttributes(span))
+	assert.Equal(t, "httpdump", span.InstrumentationScope.Name)
+
+	span = spans[1]
+	assert.Equal(t, "POST", span.Name)
+	assert.Equal(t, 50*time.Millisecond, span.EndTime.Sub(span.StartTime))
+	assert.Equal(t, codes.Error, span.Status.Code)
+	assert.Equal(t, "example.com", spanAttributes(span)["server.address"])
+	assert.Equal(t, int64(503), spanAttributes(span)["http.response.status_code"])
+
+	// request without response
+	span = spans[2]
+	assert.Equal(t, codes.Error, span.Status.Code)
+	assert.Equal(t, "no response, connection closed by fin", span.Status.Description)
+	assert.NotContains(t, spanAttributes(span), "http.response.status_code")
+
+	assert.NotEqual(t, spans[0].SpanContext.SpanID(), spans[1].SpanContext.SpanID())
+	assert.True(t, spans[0].SpanContext.IsValid())
+}
+
+func TestOTelSinkQueueFull(t *testing.T) {
+	// exports are blocked, spans beyond the queue are dropped without blocking write
+	exporter := &blockingSpanExporter{InMemoryExporter: tracetest.NewInMemoryExporter(), release: make(chan struct{})}
+	sink := newOTelSink(exporter, 1)
+	key := ConnectionKey{src: Endpoint{ip: "10.0.0.1", port: 50000}, dst: Endpoint{ip: "10.0.0.2", port: 80}}
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 2000; i++ {
+			sink.write(&Exchange{key: key, index: i + 1, method: "GET", url: "/", status: 200})
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write blocked by exporter")
+	}
+	close(exporter.release)
+	assert.Nil(t, sink.provider.ForceFlush(context.Background()))
+	assert.True(t, len(exporter.GetSpans()) < 2000)
+	assert.Nil(t, sink.Close())
+}
+
+type blockingSpanExporter struct {
+	*tracetest.InMemoryExporter
+	release chan struct{}
+}
+
+func (exporter *blockingSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	<-exporter.release
+	return exporter.InMemoryExporter.ExportSpans(ctx, spans)
+}
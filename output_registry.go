@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ExchangeOutputFactory create a named exchange output, which write records of exchanges to printer
+type ExchangeOutputFactory func(printer *Printer, config *Config) (ExchangeSink, error)
+
+var exchangeOutputs = struct {
+	lock      sync.Mutex
+	factories map[string]ExchangeOutputFactory
+}{factories: map[string]ExchangeOutputFactory{}}
+
+// register exchange output by name, for selecting it by -emit. It should be called at init, and panics if name
+// is already registered
+func registerExchangeOutput(name string, factory ExchangeOutputFactory) {
+	exchangeOutputs.lock.Lock()
+	defer exchangeOutputs.lock.Unlock()
+	if _, ok := exchangeOutputs.factories[name]; ok {
+		panic("exchange output already registered: " + name)
+	}
+	exchangeOutputs.factories[name] = factory
+}
+
+// names of registered exchange outputs, in order
+func exchangeOutputNames() []string {
+	exchangeOutputs.lock.Lock()
+	defer exchangeOutputs.lock.Unlock()
+	var names []string
+	for name := range exchangeOutputs.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// create exchange outputs of comma separated names
+func newExchangeOutputs(names string, printer *Printer, config *Config) ([]ExchangeSink, error) {
+	var sinks []ExchangeSink
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		exchangeOutputs.lock.Lock()
+		factory, ok := exchangeOutputs.factories[name]
+		exchangeOutputs.lock.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown output: %s, options are: %s", name,
+				strings.Join(exchangeOutputNames(), " | "))
+		}
+		sink, err := factory(printer, config)
+		if err != nil {
+			return nil, fmt.Errorf("create output %s: %v", name, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func init() {
+	registerExchangeOutput("json", func(printer *Printer, config *Config) (ExchangeSink, error) {
+		return &printerSink{printer: printer, format: func(exchange *Exchange) (string, error) {
+			data, err := protojson.Marshal(exchange.toProto())
+			return string(data), err
+		}}, nil
+	})
+	registerExchangeOutput("clf", func(printer *Printer, config *Config) (ExchangeSink, error) {
+		return &printerSink{printer: printer, format: func(exchange *Exchange) (string, error) {
+			return commonLogLine(exchange), nil
+		}}, nil
+	})
+}
+
+// printerSink send each exchange as one line formatted by format to printer
+type printerSink struct {
+	printer *Printer
+	format  func(exchange *Exchange) (string, error)
+}
+
+func (sink *printerSink) write(exchange *Exchange) error {
+	line, err := sink.format(exchange)
+	if err != nil {
+		return err
+	}
+	sink.printer.send(line + "\n")
+	return nil
+}
+
+func (sink *printerSink) Close() error {
+	return nil
+}
+
+// exchange in common log format as web servers log requests: client ip, time of request start, request line,
+// status and response body size. Missing status and zero size are -
+func commonLogLine(exchange *Exchange) string {
+	status, size := "-", "-"
+	if exchange.status != 0 {
+		status = strconv.Itoa(exchange.status)
+	}
+	if exchange.responseBodySize > 0 {
+		size = strconv.FormatInt(exchange.responseBodySize, 10)
+	}
+	proto := exchange.proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	return exchange.key.src.ip + " - - [" + exchange.requestStart.Format("02/Jan/2006:15:04:05 -0700") + "] " +
+		strconv.Quote(exchange.method+" "+exchange.url+" "+proto) + " " + status + " " + size
+}
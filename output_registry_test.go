@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordOutput is a custom exchange output remembering urls of written exchanges
+type recordOutput struct {
+	prefix string
+	urls   []string
+	closed bool
+}
+
+func (output *recordOutput) write(exchange *Exchange) error {
+	output.urls = append(output.urls, output.prefix+exchange.url)
+	return nil
+}
+
+func (output *recordOutput) Close() error {
+	output.closed = true
+	return nil
+}
+
+func TestExchangeOutputRegistry(t *testing.T) {
+	var created *recordOutput
+	registerExchangeOutput("test-record", func(printer *Printer, config *Config) (ExchangeSink, error) {
+		created = &recordOutput{prefix: config.host}
+		return created, nil
+	})
+	defer func() {
+		exchangeOutputs.lock.Lock()
+		delete(exchangeOutputs.factories, "test-record")
+		exchangeOutputs.lock.Unlock()
+	}()
+	assert.Panics(t, func() {
+		registerExchangeOutput("test-record", nil)
+	})
+	assert.Contains(t, exchangeOutputNames(), "json")
+	assert.Contains(t, exchangeOutputNames(), "clf")
+
+	config := &Config{}
+	handler, _ := newTestHTTPHandler(config)
+	sinks, err := newExchangeOutputs("test-record, clf", handler.printer, config)
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(sinks)) {
+		return
+	}
+	assert.Equal(t, created, sinks[0])
+	handler.sinks = sinks
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", delay: time.Millisecond},
+		{up: true, payload: "GET /missing HTTP/1.0\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n", delay: time.Millisecond},
+	})
+	assert.Equal(t, []string{"/index.html", "/missing"}, created.urls)
+	handler.closeSinks()
+	assert.True(t, created.closed)
+
+	var lines []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "10.0.0.1 ") {
+			lines = append(lines, msg)
+		}
+	}
+	assert.Equal(t, []string{
+		`10.0.0.1 - - [01/Jan/2018:00:00:00 +0000] "GET /index.html HTTP/1.1" 200 5` + "\n",
+		`10.0.0.1 - - [01/Jan/2018:00:00:00 +0000] "GET /missing HTTP/1.0" 404 -` + "\n",
+	}, lines)
+
+	_, err = newExchangeOutputs("json,unknown", handler.printer, config)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+)
+
+// IntervalStats is the distribution of inter-arrival times of data segments of a connection.
+// Jitter is the mean absolute difference of successive intervals
+type IntervalStats struct {
+	Count  int64 // intervals, 0 if less than two data segments are captured
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	Jitter time.Duration // 0 if less than two intervals
+}
+
+// intervalTracker collect inter-arrival times of data segments of both directions, in capture order.
+// Keep-alive probes and segments without payload are not tracked
+type intervalTracker struct {
+	last         time.Time
+	lastInterval time.Duration
+	count        int64
+	min          time.Duration
+	max          time.Duration
+	sum          time.Duration
+	variation    time.Duration // sum of absolute differences of successive intervals
+}
+
+func (tracker *intervalTracker) add(timestamp time.Time) {
+	if tracker.last.IsZero() {
+		tracker.last = timestamp
+		return
+	}
+	interval := timestamp.Sub(tracker.last)
+	if interval < 0 {
+		// timestamps of capture from multiple interfaces can be slightly out of order
+		interval = 0
+	}
+	tracker.last = timestamp
+	if tracker.count == 0 || interval < tracker.min {
+		tracker.min = interval
+	}
+	if interval > tracker.max {
+		tracker.max = interval
+	}
+	if tracker.count > 0 {
+		diff := interval - tracker.lastInterval
+		if diff < 0 {
+			diff = -diff
+		}
+		tracker.variation += diff
+	}
+	tracker.count++
+	tracker.sum += interval
+	tracker.lastInterval = interval
+}
+
+func (tracker *intervalTracker) stats() IntervalStats {
+	if tracker.count == 0 {
+		return IntervalStats{}
+	}
+	stats := IntervalStats{Count: tracker.count, Min: tracker.min, Max: tracker.max,
+		Mean: tracker.sum / time.Duration(tracker.count)}
+	if tracker.count > 1 {
+		stats.Jitter = tracker.variation / time.Duration(tracker.count-1)
+	}
+	return stats
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntervalTracker(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	var tracker intervalTracker
+	assert.Equal(t, IntervalStats{}, tracker.stats())
+	// single packet, no interval
+	tracker.add(start)
+	assert.Equal(t, IntervalStats{}, tracker.stats())
+	// single interval, no jitter
+	tracker.add(start.Add(10 * time.Millisecond))
+	assert.Equal(t, IntervalStats{Count: 1, Min: 10 * time.Millisecond, Max: 10 * time.Millisecond,
+		Mean: 10 * time.Millisecond}, tracker.stats())
+	// intervals 10, 20, 10, 20ms
+	for _, ms := range []int{30, 40, 60} {
+		tracker.add(start.Add(time.Duration(ms) * time.Millisecond))
+	}
+	assert.Equal(t, IntervalStats{Count: 4, Min: 10 * time.Millisecond, Max: 20 * time.Millisecond,
+		Mean: 15 * time.Millisecond, Jitter: 10 * time.Millisecond}, tracker.stats())
+}
+
+func TestConnectionSummaryIntervals(t *testing.T) {
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	segments := []testSegment{
+		{up: true, payload: "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: response, delay: 10 * time.Millisecond},
+		{up: true, payload: "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n", delay: 20 * time.Millisecond},
+		{up: false, payload: response, delay: 10 * time.Millisecond},
+		{up: true, payload: "GET /c HTTP/1.1\r\nHost: example.com\r\n\r\n", delay: 20 * time.Millisecond},
+	}
+	var summaries []string
+	_, printer := runHTTPConversation(&Config{connectionSummary: SummaryOnly, format: "json"}, segments)
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.Contains(msg, `"connection-summary"`) {
+			summaries = append(summaries, msg)
+		}
+	}
+	if assert.Equal(t, 1, len(summaries)) {
+		assert.Contains(t, summaries[0], `"packetIntervals":{"count":4,"jitter":0.01,"max":0.02,"mean":0.015,"min":0.01}`)
+	}
+
+	// single data packet
+	summaries = nil
+	_, printer = runHTTPConversation(&Config{connectionSummary: SummaryOnly}, segments[:1])
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[connection-summary]") {
+			summaries = append(summaries, msg)
+		}
+	}
+	if assert.Equal(t, 1, len(summaries)) {
+		assert.NotContains(t, summaries[0], "interval")
+		assert.NotContains(t, summaries[0], "jitter")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// recent packets kept by a stream to locate positions, which covers bytes kept by recordReader for common sizes
+const maxPacketMarks = 256
+
+// packetMark is the stream offset a packet starts at
+type packetMark struct {
+	offset int64
+	number int
+}
+
+// record offset of a packet read from stream
+func (stream *NetworkStream) markPacket(packet *TCPPacket) {
+	if packet.number > 0 {
+		if len(stream.marks) >= 2*maxPacketMarks {
+			stream.marks = append(stream.marks[:0], stream.marks[len(stream.marks)-maxPacketMarks:]...)
+		}
+		stream.marks = append(stream.marks, packetMark{offset: stream.readOffset, number: packet.number})
+	}
+	stream.readOffset += int64(len(packet.Payload))
+}
+
+// number of the packet which contains the byte at offset, 0 if unknown
+func (stream *NetworkStream) packetAt(offset int64) int {
+	if offset >= stream.readOffset {
+		return 0
+	}
+	for i := len(stream.marks) - 1; i >= 0; i-- {
+		if stream.marks[i].offset <= offset {
+			return stream.marks[i].number
+		}
+	}
+	return 0
+}
+
+// direction of stream in the connection
+func streamDirection(connection *TCPConnection, stream *NetworkStream) string {
+	if stream == connection.upStream {
+		return "from client"
+	}
+	return "from server"
+}
+
+// reference to a packet in capture file for text records, empty if not known
+func formatPacketRef(file string, number int) string {
+	if file == "" || number <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(", at %s packet %d", file, number)
+}
+
+func (assembler *TCPAssembler) packetRef(number int) string {
+	return formatPacketRef(assembler.captureFile, number)
+}
+
+// number of the packet in capture which contains the last byte consumed by the buffered reader, 0 if unknown
+func (h *HTTPTrafficHandler) packetNumber(recorder *recordReader, buffered *bufio.Reader) int {
+	stream, ok := recorder.reader.(*NetworkStream)
+	if !ok || h.config.captureFile == "" {
+		return 0
+	}
+	position := recorder.position(buffered) - 1
+	if position < recorder.start {
+		position = recorder.start
+	}
+	return stream.packetAt(position)
+}
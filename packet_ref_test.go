@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrorPacketNumber(t *testing.T) {
+	first := "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	line := "GET /b HTTP/1.1\r\n"
+	malformed := "this is not a header\r\n\r\n"
+	end := 1000 + uint32(len(first)+len(line)+len(malformed))
+	packets := [][]byte{
+		tcpPacketDataOf(t, 50000, true, 1000, 5000, first),
+		tcpPacketDataOf(t, 50000, false, 5000, 1000+uint32(len(first)), response),
+		tcpPacketDataOf(t, 50000, true, 1000+uint32(len(first)), 5000+uint32(len(response)), line),
+		// the 4th packet has the malformed header line
+		tcpPacketDataOf(t, 50000, true, 1000+uint32(len(first)+len(line)), 5000+uint32(len(response)), malformed),
+		tcpPacketDataOf(t, 50000, false, 5000+uint32(len(response)), end, ""),
+	}
+	for _, format := range []string{"text", "json"} {
+		for _, zeroCopy := range []bool{false, true} {
+			var buffer bytes.Buffer
+			writePcapStream(t, &buffer, packets)
+			segments, err := pcapStreamSegments(&buffer, zeroCopy)
+			assert.Nil(t, err)
+			handler, _ := newTestHTTPHandler(&Config{captureFile: "capture.pcap", format: format})
+			assembler := newTCPAssembler(handler, handler.printer)
+			capture(segments, assembler, time.Minute, nil)
+			assembler.finishAll()
+			waitGroup.Wait()
+
+			var records []string
+			for len(handler.printer.outputQueue) > 0 {
+				if msg := <-handler.printer.outputQueue; strings.Contains(msg, "error") {
+					records = append(records, msg)
+				}
+			}
+			if !assert.Equal(t, 1, len(records)) {
+				continue
+			}
+			if format == "json" {
+				var record map[string]interface{}
+				assert.Nil(t, json.Unmarshal([]byte(records[0]), &record))
+				assert.Equal(t, "capture.pcap", record["file"])
+				assert.Equal(t, float64(4), record["packet"])
+			} else {
+				assert.True(t, strings.HasPrefix(records[0], "[error] "), records[0])
+				assert.True(t, strings.HasSuffix(records[0], ", at capture.pcap packet 4\n"), records[0])
+			}
+		}
+	}
+}
+
+func TestLostPacketRef(t *testing.T) {
+	assembler, _ := newTestAssembler()
+	assembler.captureFile = "capture.pcap"
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	line := "GET /a HTTP/1.1\r\n"
+	header := "Host: example.com\r\n\r\n"
+	// 5 bytes not captured before the 2nd packet
+	headerSeq := 1000 + uint32(len(line)+5)
+	assembler.assemblePacket(testClientFlow, clientPacket(1000, 5000, line), timestamp, 1)
+	assembler.assemblePacket(testClientFlow, clientPacket(headerSeq, 5000, header), timestamp, 2)
+	end := headerSeq + uint32(len(header))
+	assembler.assemblePacket(testServerFlow, serverPacket(5000, end, ""), timestamp, 3)
+	fin := clientPacket(end, 5000, "")
+	fin.FIN = true
+	assembler.assemblePacket(testClientFlow, fin, timestamp, 4)
+	fin = serverPacket(5000, end+1, "")
+	fin.FIN = true
+	assembler.assemblePacket(testServerFlow, fin, timestamp, 5)
+
+	var lost []string
+	for len(assembler.printer.outputQueue) > 0 {
+		if msg := <-assembler.printer.outputQueue; strings.HasPrefix(msg, "[lost]") {
+			lost = append(lost, msg)
+		}
+	}
+	assert.Equal(t, []string{"[lost] 10.0.0.1:50000-10.0.0.2:80 5 bytes missing from client, at capture.pcap packet 2\n"}, lost)
+}
+
+// connection with a gap ended by capture end or idle timeout, rather than fin
+func TestLostWithoutFIN(t *testing.T) {
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, end := range []string{"finishAll", "idle"} {
+		assembler, _ := newTestAssembler()
+		line := "GET /a HTTP/1.1\r\n"
+		header := "Host: example.com\r\n\r\n"
+		headerSeq := 1000 + uint32(len(line)+5)
+		assembler.assemblePacket(testClientFlow, clientPacket(1000, 5000, line), timestamp, 1)
+		assembler.assemblePacket(testClientFlow, clientPacket(headerSeq, 5000, header), timestamp, 2)
+		assembler.assemblePacket(testServerFlow, serverPacket(5000, headerSeq+uint32(len(header)), ""), timestamp, 3)
+		if end == "finishAll" {
+			assembler.finishAll()
+		} else {
+			assembler.flushOlderThan(timestamp.Add(time.Minute))
+		}
+
+		var lost []string
+		for len(assembler.printer.outputQueue) > 0 {
+			if msg := <-assembler.printer.outputQueue; strings.HasPrefix(msg, "[lost]") {
+				lost = append(lost, msg)
+			}
+		}
+		assert.Equal(t, []string{"[lost] 10.0.0.1:50000-10.0.0.2:80 5 bytes missing from client\n"}, lost, end)
+	}
+
+	assembler, _ := newTestAssembler()
+	assembler.format = "json"
+	assembler.captureFile = "capture.pcap"
+	line := "GET /a HTTP/1.1\r\n"
+	headerSeq := 1000 + uint32(len(line)+7)
+	assembler.assemblePacket(testClientFlow, clientPacket(1000, 5000, line), timestamp, 1)
+	assembler.assemblePacket(testClientFlow, clientPacket(headerSeq, 5000, "Host"), timestamp, 2)
+	assembler.assemblePacket(testServerFlow, serverPacket(5000, headerSeq+4, ""), timestamp, 3)
+	assembler.finishAll()
+	var records []map[string]interface{}
+	for len(assembler.printer.outputQueue) > 0 {
+		var record map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(<-assembler.printer.outputQueue), &record))
+		records = append(records, record)
+	}
+	assert.Contains(t, records, map[string]interface{}{"type": "lost", "key": "10.0.0.1:50000-10.0.0.2:80",
+		"bytes": float64(7), "direction": "client", "file": "capture.pcap", "packet": float64(2)})
+}
+
+func TestPacketAt(t *testing.T) {
+	stream := newNetworkStream()
+	for i, payload := range []string{"abc", "", "de", "fgh"} {
+		packet := &TCPPacket{TCP: clientPacket(0, 0, payload), number: i + 1}
+		stream.markPacket(packet)
+	}
+	assert.Equal(t, 1, stream.packetAt(0))
+	assert.Equal(t, 1, stream.packetAt(2))
+	assert.Equal(t, 3, stream.packetAt(3))
+	assert.Equal(t, 4, stream.packetAt(7))
+	assert.Equal(t, 0, stream.packetAt(8))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	defaultParquetRows = 100000
+	defaultParquetSize = 64 << 20
+)
+
+// row of parquet files, with columns as table exchanges of sqlite output. Timestamps are microseconds since epoch
+// in utc, durations are in milliseconds. Missing values are null
+type parquetRecord struct {
+	Src              string   `parquet:"src"`
+	Dst              string   `parquet:"dst"`
+	ExchangeIndex    int32    `parquet:"exchange_index"`
+	Method           string   `parquet:"method"`
+	Host             string   `parquet:"host"`
+	URL              string   `parquet:"url"`
+	Status           *int32   `parquet:"status,optional"`
+	RequestStart     *int64   `parquet:"request_start,optional,timestamp(microsecond)"`
+	RequestEnd       *int64   `parquet:"request_end,optional,timestamp(microsecond)"`
+	ResponseStart    *int64   `parquet:"response_start,optional,timestamp(microsecond)"`
+	ResponseEnd      *int64   `parquet:"response_end,optional,timestamp(microsecond)"`
+	Send             *float64 `parquet:"send,optional"`
+	TTFB             *float64 `parquet:"ttfb,optional"`
+	Receive          *float64 `parquet:"receive,optional"`
+	Total            *float64 `parquet:"total,optional"`
+	RequestBodySize  int64    `parquet:"request_body_size"`
+	ResponseBodySize int64    `parquet:"response_body_size"`
+	CloseReason      *string  `parquet:"close_reason,optional"`
+}
+
+// ParquetSink buffer exchange records and write them as parquet files, for querying with analytics engines.
+// A file is written when buffered rows reach max rows or their estimated size reaches max size, and when the sink
+// is closed. Files are named by path with a sequence number before the extension, like records-000001.parquet,
+// and are renamed from a temporary name after written, so a file seen is always complete
+type ParquetSink struct {
+	path    string
+	maxRows int
+	maxSize int
+	lock    sync.Mutex
+	rows    []parquetRecord
+	size    int // estimated bytes of buffered rows
+	files   int
+	err     error
+}
+
+func newParquetSink(path string, maxRows int, maxSize int) (*ParquetSink, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	}
+	return &ParquetSink{path: path, maxRows: maxRows, maxSize: maxSize}, nil
+}
+
+func (sink *ParquetSink) write(exchange *Exchange) error {
+	row := parquetRow(exchange)
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.err != nil {
+		return sink.err
+	}
+	sink.rows = append(sink.rows, row)
+	sink.size += parquetRowSize(row)
+	if sink.maxRows > 0 && len(sink.rows) >= sink.maxRows || sink.maxSize > 0 && sink.size >= sink.maxSize {
+		sink.err = sink.flush()
+	}
+	return sink.err
+}
+
+// write buffered rows to the next file
+func (sink *ParquetSink) flush() error {
+	if len(sink.rows) == 0 {
+		return nil
+	}
+	sink.files++
+	path := parquetFilePath(sink.path, sink.files)
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	writer := parquet.NewGenericWriter[parquetRecord](file, parquet.CreatedBy("httpdump", "", ""))
+	if _, err = writer.Write(sink.rows); err == nil {
+		err = writer.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	sink.rows = nil
+	sink.size = 0
+	return os.Rename(temp, path)
+}
+
+// write remaining rows
+func (sink *ParquetSink) Close() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.err != nil {
+		return sink.err
+	}
+	return sink.flush()
+}
+
+// path of the n-th file, sequence number is inserted before the extension
+func parquetFilePath(path string, n int) string {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		ext = ".parquet"
+	}
+	return fmt.Sprintf("%s-%06d%s", strings.TrimSuffix(path, filepath.Ext(path)), n, ext)
+}
+
+func parquetRow(exchange *Exchange) parquetRecord {
+	record := parquetRecord{
+		Src:              exchange.key.srcString(),
+		Dst:              exchange.key.dstString(),
+		ExchangeIndex:    int32(exchange.index),
+		Method:           exchange.method,
+		Host:             exchange.host,
+		URL:              exchange.url,
+		RequestStart:     parquetTime(exchange.requestStart),
+		RequestEnd:       parquetTime(exchange.requestEnd),
+		ResponseStart:    parquetTime(exchange.responseStart),
+		ResponseEnd:      parquetTime(exchange.responseEnd),
+		Send:             parquetDuration(exchange.requestStart, exchange.requestEnd),
+		TTFB:             parquetDuration(exchange.requestEnd, exchange.responseStart),
+		Receive:          parquetDuration(exchange.responseStart, exchange.responseEnd),
+		Total:            parquetDuration(exchange.requestStart, exchange.responseEnd),
+		RequestBodySize:  exchange.requestBodySize,
+		ResponseBodySize: exchange.responseBodySize,
+	}
+	if exchange.status != 0 {
+		status := int32(exchange.status)
+		record.Status = &status
+	}
+	if exchange.closeReason != "" {
+		record.CloseReason = &exchange.closeReason
+	}
+	return record
+}
+
+// estimated bytes of row in file, strings with length prefix and 8 bytes for other values
+func parquetRowSize(row parquetRecord) int {
+	var size = 4*5 + len(row.Src) + len(row.Dst) + len(row.Method) + len(row.Host) + len(row.URL) + 8*11
+	if row.CloseReason != nil {
+		size += 4 + len(*row.CloseReason)
+	}
+	return size
+}
+
+// microseconds since epoch, nil if missing
+func parquetTime(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+	micros := t.UnixNano() / int64(time.Microsecond)
+	return &micros
+}
+
+// milliseconds from start to end, nil if either is missing
+func parquetDuration(start time.Time, end time.Time) *float64 {
+	if start.IsZero() || end.IsZero() {
+		return nil
+	}
+	millis := float64(end.Sub(start)) / float64(time.Millisecond)
+	return &millis
+}
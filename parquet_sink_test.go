@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParquetSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// rotated by rows
+	sink, err := newParquetSink(filepath.Join(dir, "records.parquet"), 2, 0)
+	assert.Nil(t, err)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"10.0.0.2", 80}}
+	for i, status := range []int{200, 503} {
+		requestStart := start.Add(time.Duration(i) * time.Second)
+		assert.Nil(t, sink.write(&Exchange{key: key, index: i + 1, method: "GET", host: "example.com",
+			url: "/items", status: status, requestStart: requestStart,
+			requestEnd:    requestStart.Add(time.Millisecond),
+			responseStart: requestStart.Add(101 * time.Millisecond),
+			responseEnd:   requestStart.Add(time.Second), responseBodySize: int64(100 * i)}))
+	}
+	// without response
+	assert.Nil(t, sink.write(&Exchange{key: key, index: 3, method: "POST", url: "/upload", requestStart: start,
+		requestBodySize: 10, closeReason: closeByRST}))
+	assert.Nil(t, sink.Close())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, []string{filepath.Join(dir, "records-000001.parquet"), filepath.Join(dir, "records-000002.parquet")},
+		files)
+
+	data, err := ioutil.ReadFile(files[0])
+	assert.Nil(t, err)
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	var names []string
+	for _, field := range file.Schema().Fields() {
+		names = append(names, field.Name())
+	}
+	assert.Equal(t, []string{"src", "dst", "exchange_index", "method", "host", "url", "status", "request_start",
+		"request_end", "response_start", "response_end", "send", "ttfb", "receive", "total", "request_body_size",
+		"response_body_size", "close_reason"}, names)
+	assert.Equal(t, int64(2), file.NumRows())
+	assert.Contains(t, file.Metadata().CreatedBy, "httpdump")
+	fields := file.Schema().Fields()
+	assert.True(t, fields[6].Optional())
+	assert.Equal(t, "STRING", fields[0].Type().LogicalType().String())
+	assert.Equal(t, "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)", fields[7].Type().LogicalType().String())
+
+	rows, err := parquet.ReadFile[parquetRecord](files[0])
+	assert.Nil(t, err)
+	if !assert.Equal(t, 2, len(rows)) {
+		return
+	}
+	assert.Equal(t, "10.0.0.1:50000", rows[0].Src)
+	assert.Equal(t, "10.0.0.2:80", rows[1].Dst)
+	assert.Equal(t, int32(200), *rows[0].Status)
+	assert.Equal(t, int32(503), *rows[1].Status)
+	assert.Equal(t, start.UnixNano()/1000, *rows[0].RequestStart)
+	assert.Equal(t, start.Add(time.Second).UnixNano()/1000, *rows[1].RequestStart)
+	assert.Equal(t, 100.0, *rows[0].TTFB)
+	assert.Equal(t, 1000.0, *rows[1].Total)
+	assert.Equal(t, int64(0), rows[0].ResponseBodySize)
+	assert.Equal(t, int64(100), rows[1].ResponseBodySize)
+	assert.Nil(t, rows[0].CloseReason)
+
+	rows, err = parquet.ReadFile[parquetRecord](files[1])
+	assert.Nil(t, err)
+	if !assert.Equal(t, 1, len(rows)) {
+		return
+	}
+	assert.Equal(t, "POST", rows[0].Method)
+	assert.Equal(t, "", rows[0].Host)
+	assert.Nil(t, rows[0].Status)
+	assert.Nil(t, rows[0].TTFB)
+	assert.Nil(t, rows[0].ResponseEnd)
+	assert.Equal(t, int64(10), rows[0].RequestBodySize)
+	assert.Equal(t, closeByRST, *rows[0].CloseReason)
+}
+
+func TestParquetSinkRotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sink, err := newParquetSink(filepath.Join(dir, "records"), 0, 1)
+	assert.Nil(t, err)
+	exchange := &Exchange{method: "GET", url: "/", status: 200}
+	assert.Nil(t, sink.write(exchange))
+	assert.Nil(t, sink.write(exchange))
+	assert.Nil(t, sink.Close())
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, []string{filepath.Join(dir, "records-000001.parquet"), filepath.Join(dir, "records-000002.parquet")},
+		files)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// bytes of excerpt in parse error record
+	parseErrorExcerptSize = 64
+	// must be larger than bufio reader buffer, so consumed bytes are still kept when the buffer is full
+	recordHistorySize = 4096 + parseErrorExcerptSize
+)
+
+// recordReader count and keep recent bytes read from underlying reader, to locate parse errors
+type recordReader struct {
+	reader  io.Reader
+	count   int64  // total bytes read
+	history []byte // recent bytes read, at most recordHistorySize kept
+	start   int64  // offset of the message being parsed
+	limit   int64  // offset reading stops at with errHeaderTooLarge, 0 for no limit
+	// bytes read are kept until taken for transcript, at most keepLimit bytes. 0 for not keeping
+	keepLimit  int
+	kept       []byte
+	keptOffset int64 // offset of kept bytes in stream
+}
+
+// mark current position of buffered reader as start of a message
+func (r *recordReader) mark(buffered *bufio.Reader) {
+	r.start = r.position(buffered)
+}
+
+func (r *recordReader) Read(p []byte) (int, error) {
+	if r.limit > 0 {
+		if r.count >= r.limit {
+			return 0, errHeaderTooLarge
+		}
+		if remain := r.limit - r.count; int64(len(p)) > remain {
+			p = p[:remain]
+		}
+	}
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	if r.keepLimit > 0 {
+		keep := p[:n]
+		if room := r.keepLimit - len(r.kept); len(keep) > room {
+			// bytes beyond the limit are not kept, the message is truncated in transcript
+			keep = keep[:max(room, 0)]
+		}
+		r.kept = append(r.kept, keep...)
+	}
+	r.history = append(r.history, p[:n]...)
+	if len(r.history) > 2*recordHistorySize {
+		r.history = append(r.history[:0], r.history[len(r.history)-recordHistorySize:]...)
+	}
+	return n, err
+}
+
+// return offset in stream and excerpt of bytes consumed by the buffered reader, from message start to
+// current position. the excerpt only contains the last parseErrorExcerptSize bytes
+func (r *recordReader) excerpt(buffered *bufio.Reader) (int64, []byte) {
+	historyOffset := r.count - int64(len(r.history))
+	end := len(r.history) - buffered.Buffered()
+	if end < 0 {
+		end = 0
+	}
+	start := end - parseErrorExcerptSize
+	if markStart := int(r.start - historyOffset); start < markStart {
+		start = markStart
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end {
+		start = end
+	}
+	return historyOffset + int64(start), r.history[start:end]
+}
+
+// header lines of the message being parsed, from the bytes consumed since message start. Lines before the kept
+// history are lost, continuation lines are dropped
+func (r *recordReader) headerLines(buffered *bufio.Reader) []string {
+	historyOffset := r.count - int64(len(r.history))
+	start := int(r.start - historyOffset)
+	end := len(r.history) - buffered.Buffered()
+	if start < 0 || end < start {
+		return nil
+	}
+	head := string(r.history[start:end])
+	if idx := strings.Index(head, "\n\r\n"); idx >= 0 {
+		head = head[:idx]
+	} else if idx := strings.Index(head, "\n\n"); idx >= 0 {
+		head = head[:idx]
+	}
+	var lines []string
+	for i, line := range strings.Split(head, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if i == 0 || line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// emit error record when request or response could not be parsed
+func (h *HTTPTrafficHandler) reportParseError(ck ConnectionKey, message string, err error, recorder *recordReader,
+	reader *bufio.Reader) {
+	offset, excerpt := recorder.excerpt(reader)
+	number := h.packetNumber(recorder, reader)
+	if h.config.format == "json" {
+		record := map[string]interface{}{
+			"type":    "error",
+			"src":     ck.srcString(),
+			"dst":     ck.dstString(),
+			"message": message,
+			"error":   err.Error(),
+			"offset":  offset,
+			"excerpt": string(excerpt),
+		}
+		if number > 0 {
+			record["file"] = h.config.captureFile
+			record["packet"] = number
+		}
+		data, _ := json.Marshal(record)
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	h.printer.send(fmt.Sprintf("[error] %s -> %s %s: %v, at offset %d: %q%s\n", ck.srcString(), ck.dstString(),
+		message, err, offset, excerpt, formatPacketRef(h.config.captureFile, number)))
+}
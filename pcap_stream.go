@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// pcapStreamReader read packets of pcap format from a stream, such as stdin or fifo.
+// gopacket pcapgo is not used, since the package depends on raw socket libs on linux
+type pcapStreamReader struct {
+	reader    *bufio.Reader
+	byteOrder binary.ByteOrder
+	nanoSecs  bool // timestamp fraction is nanosecond instead of microsecond
+	snapLen   uint32
+	linkType  layers.LinkType
+	header    [16]byte
+	buffer    []byte
+}
+
+const (
+	pcapMagicMicros = 0xa1b2c3d4
+	pcapMagicNanos  = 0xa1b23c4d
+)
+
+// read pcap file header from stream. this blocks until the header is received
+func newPcapStreamReader(stream io.Reader) (*pcapStreamReader, error) {
+	reader := &pcapStreamReader{reader: bufio.NewReaderSize(stream, 65536)}
+	var header [24]byte
+	if _, err := io.ReadFull(reader.reader, header[:]); err != nil {
+		return nil, fmt.Errorf("read pcap header error: %v", err)
+	}
+	switch magic := binary.LittleEndian.Uint32(header[:4]); magic {
+	case pcapMagicMicros, pcapMagicNanos:
+		reader.byteOrder = binary.LittleEndian
+		reader.nanoSecs = magic == pcapMagicNanos
+	default:
+		switch magic = binary.BigEndian.Uint32(header[:4]); magic {
+		case pcapMagicMicros, pcapMagicNanos:
+			reader.byteOrder = binary.BigEndian
+			reader.nanoSecs = magic == pcapMagicNanos
+		default:
+			return nil, errors.New("not a pcap stream, unknown magic number")
+		}
+	}
+	reader.snapLen = reader.byteOrder.Uint32(header[16:20])
+	reader.linkType = layers.LinkType(reader.byteOrder.Uint32(header[20:24]))
+	return reader, nil
+}
+
+// LinkType return link type of packets in the stream
+func (reader *pcapStreamReader) LinkType() layers.LinkType {
+	return reader.linkType
+}
+
+// ReadPacketData read next packet, the returned data is owned by caller
+func (reader *pcapStreamReader) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := reader.ZeroCopyReadPacketData()
+	if err != nil {
+		return nil, ci, err
+	}
+	return append([]byte(nil), data...), ci, nil
+}
+
+// ZeroCopyReadPacketData read next packet, the returned data is overwritten by next read
+func (reader *pcapStreamReader) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	var ci gopacket.CaptureInfo
+	if _, err := io.ReadFull(reader.reader, reader.header[:]); err != nil {
+		return nil, ci, err
+	}
+	seconds := int64(reader.byteOrder.Uint32(reader.header[0:4]))
+	fraction := int64(reader.byteOrder.Uint32(reader.header[4:8]))
+	if !reader.nanoSecs {
+		fraction *= 1000
+	}
+	ci.Timestamp = time.Unix(seconds, fraction)
+	ci.CaptureLength = int(reader.byteOrder.Uint32(reader.header[8:12]))
+	ci.Length = int(reader.byteOrder.Uint32(reader.header[12:16]))
+	if ci.CaptureLength > int(reader.snapLen) && ci.CaptureLength > 262144 {
+		// following data can not be located, stop reading the stream
+		logger.Warn("invalid packet capture length in pcap stream:", ci.CaptureLength)
+		return nil, ci, io.EOF
+	}
+	if cap(reader.buffer) < ci.CaptureLength {
+		reader.buffer = make([]byte, ci.CaptureLength)
+	}
+	data := reader.buffer[:ci.CaptureLength]
+	if _, err := io.ReadFull(reader.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, ci, err
+	}
+	return data, ci, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"httpdump/httpport"
+)
+
+// responses are paired with requests in order. A server answering pipelined requests out of order makes
+// responses paired with wrong requests, which is detected when a HEAD request is involved:
+// a response without body is taken as the response of a request expecting body, so the following response is
+// read as its body; or a response with body is taken as the response of a HEAD request, so its body is read
+// as the following response
+
+// if data starts with a status line like "HTTP/1.1 200"
+func isStatusLinePrefix(data []byte) bool {
+	if len(data) < 12 || !bytes.HasPrefix(data, []byte("HTTP/1.")) || data[7] != '0' && data[7] != '1' ||
+		data[8] != ' ' {
+		return false
+	}
+	for _, c := range data[9:12] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// check if body of response to a request expecting body starts with a status line, before the body is read
+func (h *HTTPTrafficHandler) checkResponseBody(reader *bufio.Reader, req *httpport.Request,
+	resp *httpport.Response, exchange *Exchange) {
+	if req.Method == "HEAD" || resp.ContentLength < 12 {
+		return
+	}
+	if data, _ := reader.Peek(12); isStatusLinePrefix(data) {
+		exchange.orderViolation = true
+		h.reportOrderViolation(exchange, "response body starts with a status line, the response may be for a HEAD request")
+	}
+}
+
+// check if data following response of a HEAD request is not a response. It waits the following data or end of
+// stream, so the exchange is checked before it is recorded
+func (h *HTTPTrafficHandler) checkAfterHEAD(reader *bufio.Reader, exchange *Exchange) {
+	if data, _ := reader.Peek(5); len(data) > 0 && !bytes.HasPrefix(data, []byte("HTTP/")) {
+		exchange.orderViolation = true
+		h.reportOrderViolation(exchange, "response is followed by data not a response, the response may be for a request expecting body")
+	}
+}
+
+func (h *HTTPTrafficHandler) reportOrderViolation(exchange *Exchange, message string) {
+	if h.config.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":    "order-violation",
+			"src":     h.key.srcString(),
+			"dst":     h.key.dstString(),
+			"method":  exchange.method,
+			"url":     exchange.host + exchange.url,
+			"message": message,
+		})
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	h.printer.send(strings.Join([]string{"[order-violation]", h.key.srcString(), "->", h.key.dstString(),
+		exchange.method, exchange.host + exchange.url, message}, " ") + "\n")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func orderViolations(printer *Printer) []string {
+	var reports []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[order-violation]") {
+			reports = append(reports, msg)
+		}
+	}
+	return reports
+}
+
+func TestOrderViolation(t *testing.T) {
+	headResponse := "HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\n"
+	getResponse := "HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\n" + strings.Repeat("a", 20)
+
+	// response of HEAD comes first, taken as response of GET
+	sink, printer := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\nHEAD /b HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: headResponse + getResponse},
+	})
+	assert.True(t, len(sink.exchanges) >= 1)
+	assert.True(t, sink.exchanges[0].orderViolation)
+	assert.True(t, sink.exchanges[0].toProto().OrderViolation)
+	assert.Equal(t, []string{"[order-violation] 10.0.0.1:50000 -> 10.0.0.2:80 GET example.com/a " +
+		"response body starts with a status line, the response may be for a HEAD request\n"}, orderViolations(printer))
+
+	// response of GET comes first, taken as response of HEAD
+	sink, printer = runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "HEAD /a HTTP/1.1\r\nHost: example.com\r\n\r\nGET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: getResponse + headResponse},
+	})
+	assert.True(t, len(sink.exchanges) >= 1)
+	assert.True(t, sink.exchanges[0].orderViolation)
+	assert.Equal(t, "HEAD", sink.exchanges[0].method)
+	assert.Equal(t, []string{"[order-violation] 10.0.0.1:50000 -> 10.0.0.2:80 HEAD example.com/a " +
+		"response is followed by data not a response, the response may be for a request expecting body\n"},
+		orderViolations(printer))
+
+	// in order
+	sink, printer = runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "HEAD /a HTTP/1.1\r\nHost: example.com\r\n\r\nGET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: headResponse + getResponse},
+	})
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.False(t, sink.exchanges[1].orderViolation)
+	assert.Equal(t, int64(20), sink.exchanges[1].responseBodySize)
+	assert.Empty(t, orderViolations(printer))
+}
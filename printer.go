@@ -3,20 +3,36 @@ package main
 import (
 	"io"
 	"os"
+	"sync/atomic"
 )
 
-// Printer output parsed http messages
+// Printer output parsed http messages. Messages are queued and written by a background goroutine, so a slow
+// terminal or pipe does not block capture. When queue is full, messages are dropped and counted, or
+// send blocks until there is room if block is set
 type Printer struct {
 	outputQueue chan string
 	outputFile  io.WriteCloser
+	block       bool
+	dropped     int64 // messages dropped because queue is full, accessed atomically
 }
 
 var maxOutputQueueLen = 4096
 
-func newPrinter(outputPath string) *Printer {
+// nopWriteCloser is a writer does nothing when closed
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func newPrinter(outputPath string, queueLen int, block bool) *Printer {
 	var outputFile io.WriteCloser
 	if outputPath == "" {
 		outputFile = os.Stdout
+	} else if network, address, ok := parseSocketOutput(outputPath); ok {
+		outputFile = newSocketSink(network, address, queueLen)
 	} else {
 		var err error
 		outputFile, err = os.OpenFile(outputPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
@@ -25,18 +41,34 @@ func newPrinter(outputPath string) *Printer {
 		}
 
 	}
-	printer := &Printer{outputQueue: make(chan string, maxOutputQueueLen), outputFile: outputFile}
+	return newWriterPrinter(outputFile, queueLen, block)
+}
+
+// printer write to outputFile, with at most queueLen messages waiting
+func newWriterPrinter(outputFile io.WriteCloser, queueLen int, block bool) *Printer {
+	printer := &Printer{outputQueue: make(chan string, queueLen), outputFile: outputFile, block: block}
 	printer.start()
 	return printer
 }
 
 func (printer *Printer) send(msg string) {
-	if len(printer.outputQueue) == maxOutputQueueLen {
-		// skip this msg
-		logger.Warn("too many messages to output, skipped!")
+	if printer.block {
+		printer.outputQueue <- msg
 		return
 	}
-	printer.outputQueue <- msg
+	select {
+	case printer.outputQueue <- msg:
+	default:
+		// skip this msg
+		if atomic.AddInt64(&printer.dropped, 1) == 1 {
+			logger.Warn("too many messages to output, skipped!")
+		}
+	}
+}
+
+// Dropped return the count of messages dropped because output queue is full
+func (printer *Printer) Dropped() int64 {
+	return atomic.LoadInt64(&printer.dropped)
 }
 
 func (printer *Printer) start() {
@@ -50,6 +82,9 @@ func (printer *Printer) printBackground() {
 	for msg := range printer.outputQueue {
 		printer.outputFile.Write([]byte(msg))
 	}
+	if dropped := printer.Dropped(); dropped > 0 {
+		logger.Warn("output dropped", dropped, "messages, output is slower than capture")
+	}
 }
 
 func (printer *Printer) finish() {
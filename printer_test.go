@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedWriter block writes until gate is closed, and records written messages
+type gatedWriter struct {
+	gate    chan struct{}
+	lock    sync.Mutex
+	written []string
+	closed  chan struct{}
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.written = append(w.written, string(p))
+	return len(p), nil
+}
+
+func (w *gatedWriter) Close() error {
+	close(w.closed)
+	return nil
+}
+
+func TestPrinterDrop(t *testing.T) {
+	writer := newGatedWriter()
+	printer := newWriterPrinter(writer, 4, false)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		printer.send(strconv.Itoa(i))
+	}
+	// writer is stuck, but send never blocks
+	assert.True(t, time.Since(start) < time.Second)
+	close(writer.gate)
+	printer.finish()
+	<-writer.closed
+	assert.True(t, printer.Dropped() >= 95)
+	assert.Equal(t, 100, int(printer.Dropped())+len(writer.written))
+	assert.Equal(t, "0", writer.written[0])
+}
+
+func TestPrinterBlock(t *testing.T) {
+	writer := newGatedWriter()
+	printer := newWriterPrinter(writer, 2, true)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			printer.send(strconv.Itoa(i))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("send not blocked when queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(writer.gate)
+	<-done
+	printer.finish()
+	<-writer.closed
+	assert.Equal(t, int64(0), printer.Dropped())
+	assert.Equal(t, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, writer.written)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a missed socket may be created after the last refresh, table is rebuilt on miss at most once this interval.
+// A pair still missed after that is not looked up again until the next scheduled refresh
+const processMissRefresh = time.Second
+
+// processInfo is the local process owning the socket of a connection endpoint
+type processInfo struct {
+	pid  int
+	name string // command name in /proc/<pid>/comm
+}
+
+func (info *processInfo) String() string {
+	return fmt.Sprintf("pid=%d %s", info.pid, info.name)
+}
+
+func (info *processInfo) toMap() map[string]interface{} {
+	return map[string]interface{}{"pid": info.pid, "name": info.name}
+}
+
+// procFS read the proc file system, names are relative to its root. stubbed in tests
+type procFS interface {
+	readFile(name string) ([]byte, error)
+	readDir(name string) ([]string, error)
+	readLink(name string) (string, error)
+}
+
+// osProcFS is the proc file system of linux mounted at /proc
+type osProcFS struct{}
+
+func (osProcFS) readFile(name string) ([]byte, error) {
+	return ioutil.ReadFile("/proc/" + name)
+}
+
+func (osProcFS) readDir(name string) ([]string, error) {
+	dir, err := os.Open("/proc/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	return dir.Readdirnames(-1)
+}
+
+func (osProcFS) readLink(name string) (string, error) {
+	return os.Readlink("/proc/" + name)
+}
+
+// socketPair is the local and remote endpoint of a tcp socket
+type socketPair struct {
+	local  Endpoint
+	remote Endpoint
+}
+
+// ProcessResolver map connections with a local endpoint to the process owning the socket, by socket inodes
+// in /proc/net/tcp(6) and socket links in /proc/<pid>/fd. The socket table is cached and rebuilt when older
+// than the refresh interval. It is shared by all connection goroutines, /proc is scanned without holding the
+// table, so lookups of cached sockets are not blocked by a scan
+type ProcessResolver struct {
+	proc      procFS
+	interval  time.Duration
+	now       func() time.Time
+	lock      sync.Mutex
+	sockets   map[socketPair]*processInfo // nil value if owner process is not found, e.g. no permission
+	refreshed time.Time
+	// only one scan runs at a time, lookups waiting for it use its table instead of scanning again
+	scanLock   sync.Mutex
+	generation int // count of scans
+	// pairs not found by a refresh on miss, cleared by scheduled refresh. Most captured connections have no
+	// local socket, so the table is not rebuilt for each of them
+	misses map[socketPair]bool
+}
+
+// resolver of linux proc file system. error if socket table is not readable, e.g. not on linux
+func newProcessResolver(proc procFS, interval time.Duration) (*ProcessResolver, error) {
+	if _, err := proc.readFile("net/tcp"); err != nil {
+		return nil, err
+	}
+	return &ProcessResolver{proc: proc, interval: interval, now: time.Now}, nil
+}
+
+// process owning the socket with local and remote endpoint. nil if it is not a local socket, or the socket
+// is gone by the time of lookup
+func (resolver *ProcessResolver) lookup(local Endpoint, remote Endpoint) *processInfo {
+	pair := socketPair{local: local, remote: remote}
+	resolver.lock.Lock()
+	now := resolver.now()
+	age := now.Sub(resolver.refreshed)
+	scheduled := resolver.sockets == nil || age >= resolver.interval
+	if !scheduled {
+		info, ok := resolver.sockets[pair]
+		if ok || resolver.misses[pair] || age < processMissRefresh {
+			resolver.lock.Unlock()
+			return info
+		}
+	}
+	generation := resolver.generation
+	resolver.lock.Unlock()
+
+	resolver.scanLock.Lock()
+	defer resolver.scanLock.Unlock()
+	// generation is only changed with scan lock held
+	if resolver.generation == generation {
+		// not refreshed by another lookup meanwhile
+		sockets := resolver.scan()
+		resolver.lock.Lock()
+		resolver.sockets = sockets
+		resolver.refreshed = now
+		resolver.generation++
+		if scheduled {
+			resolver.misses = map[socketPair]bool{}
+		}
+		resolver.lock.Unlock()
+	}
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+	info, ok := resolver.sockets[pair]
+	if !ok && !scheduled {
+		resolver.misses[pair] = true
+	}
+	return info
+}
+
+// build socket table. processes exited or not permitted while scanning are skipped
+func (resolver *ProcessResolver) scan() map[socketPair]*processInfo {
+	var inodes = map[string]socketPair{}
+	for _, name := range []string{"net/tcp", "net/tcp6"} {
+		if data, err := resolver.proc.readFile(name); err == nil {
+			parseProcNetTCP(data, inodes)
+		}
+	}
+	var sockets = make(map[socketPair]*processInfo, len(inodes))
+	for _, pair := range inodes {
+		sockets[pair] = nil
+	}
+	entries, _ := resolver.proc.readDir("")
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry)
+		if err != nil {
+			continue
+		}
+		fds, err := resolver.proc.readDir(entry + "/fd")
+		if err != nil {
+			continue
+		}
+		var info *processInfo
+		for _, fd := range fds {
+			link, err := resolver.proc.readLink(entry + "/fd/" + fd)
+			if err != nil || !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+				continue
+			}
+			pair, ok := inodes[link[len("socket:["):len(link)-1]]
+			if !ok {
+				continue
+			}
+			if info == nil {
+				comm, _ := resolver.proc.readFile(entry + "/comm")
+				info = &processInfo{pid: pid, name: strings.TrimSpace(string(comm))}
+			}
+			// socket inherited by forked processes is owned by the first one found
+			if sockets[pair] == nil {
+				sockets[pair] = info
+			}
+		}
+	}
+	return sockets
+}
+
+// parse lines of /proc/net/tcp or tcp6 to socket inodes. sockets without inode, e.g. in TIME_WAIT, are skipped
+func parseProcNetTCP(data []byte, inodes map[string]socketPair) {
+	lines := strings.Split(string(data), "\n")
+	// first line is the header
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[9] == "0" {
+			continue
+		}
+		local, ok := parseProcEndpoint(fields[1])
+		if !ok {
+			continue
+		}
+		remote, ok := parseProcEndpoint(fields[2])
+		if !ok {
+			continue
+		}
+		inodes[fields[9]] = socketPair{local: local, remote: remote}
+	}
+}
+
+// parse address as in /proc/net/tcp, hex ip in 32-bit words of host byte order, and hex port
+func parseProcEndpoint(address string) (Endpoint, bool) {
+	idx := strings.IndexByte(address, ':')
+	if idx < 0 {
+		return Endpoint{}, false
+	}
+	ip, err := hex.DecodeString(address[:idx])
+	if err != nil || len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return Endpoint{}, false
+	}
+	port, err := strconv.ParseUint(address[idx+1:], 16, 16)
+	if err != nil {
+		return Endpoint{}, false
+	}
+	for i := 0; i < len(ip); i += 4 {
+		// hex of a word is its value, bytes of ip are the word in memory
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(ip[i:]))
+	}
+	// ipv4-mapped ip of tcp6 is printed as ipv4, same as captured ipv4 endpoints
+	return Endpoint{ip: net.IP(ip).String(), port: uint16(port)}, true
+}
+
+// set local processes of exchange endpoints, and send a process record to printer once per connection if any
+// is found. processes found are kept for following exchanges, as the socket may be gone when the connection ends
+func (h *HTTPTrafficHandler) enrichProcess(exchange *Exchange) {
+	if h.srcProcess == nil {
+		h.srcProcess = h.processes.lookup(h.key.src, h.key.dst)
+	}
+	if h.dstProcess == nil {
+		h.dstProcess = h.processes.lookup(h.key.dst, h.key.src)
+	}
+	exchange.srcProcess, exchange.dstProcess = h.srcProcess, h.dstProcess
+	if exchange.srcProcess == nil && exchange.dstProcess == nil || h.processReported {
+		return
+	}
+	h.processReported = true
+	if h.config.format == "json" {
+		record := map[string]interface{}{
+			"type": "process",
+			"src":  exchange.key.srcString(),
+			"dst":  exchange.key.dstString(),
+		}
+		if exchange.srcProcess != nil {
+			record["srcProcess"] = exchange.srcProcess.toMap()
+		}
+		if exchange.dstProcess != nil {
+			record["dstProcess"] = exchange.dstProcess.toMap()
+		}
+		data, _ := json.Marshal(record)
+		h.printer.send(string(data) + "\n")
+		return
+	}
+	var fields = []string{"[process]", exchange.key.srcString()}
+	if exchange.srcProcess != nil {
+		fields = append(fields, "("+exchange.srcProcess.String()+")")
+	}
+	fields = append(fields, "->", exchange.key.dstString())
+	if exchange.dstProcess != nil {
+		fields = append(fields, "("+exchange.dstProcess.String()+")")
+	}
+	h.printer.send(strings.Join(fields, " ") + "\n")
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// proc file system in memory, dirs are listed from file and link names
+type stubProcFS struct {
+	files map[string]string
+	links map[string]string
+}
+
+func (proc *stubProcFS) readFile(name string) ([]byte, error) {
+	data, ok := proc.files[name]
+	if !ok {
+		return nil, errors.New("no such file: " + name)
+	}
+	return []byte(data), nil
+}
+
+func (proc *stubProcFS) readDir(name string) ([]string, error) {
+	var prefix = name + "/"
+	if name == "" {
+		prefix = ""
+	}
+	var names []string
+	var seen = map[string]bool{}
+	for _, entries := range []map[string]string{proc.files, proc.links} {
+		for path := range entries {
+			if !strings.HasPrefix(path, prefix) {
+				continue
+			}
+			child := strings.SplitN(path[len(prefix):], "/", 2)[0]
+			if !seen[child] {
+				seen[child] = true
+				names = append(names, child)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no such dir: " + name)
+	}
+	return names, nil
+}
+
+func (proc *stubProcFS) readLink(name string) (string, error) {
+	link, ok := proc.links[name]
+	if !ok {
+		return "", errors.New("no such link: " + name)
+	}
+	return link, nil
+}
+
+const procNetTCPHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func newStubProcFS() *stubProcFS {
+	return &stubProcFS{
+		files: map[string]string{
+			// 10.0.0.1:50000 -> 10.0.0.2:80 established, and a listening socket
+			"net/tcp": procNetTCPHeader +
+				"   0: 0100000A:C350 0200000A:0050 01 00000000:00000000 00:00000000 00000000  1000        0 4242 1 0\n" +
+				"   1: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 777 1 0\n",
+			"net/tcp6":    procNetTCPHeader,
+			"1234/comm":   "curl\n",
+			"1/comm":      "systemd\n",
+			"self/status": "",
+		},
+		links: map[string]string{
+			"1234/fd/0": "/dev/pts/0",
+			"1234/fd/3": "socket:[4242]",
+			"1/fd/5":    "socket:[777]",
+		},
+	}
+}
+
+func TestParseProcEndpoint(t *testing.T) {
+	endpoint, ok := parseProcEndpoint("0100007F:0050")
+	assert.True(t, ok)
+	assert.Equal(t, Endpoint{ip: "127.0.0.1", port: 80}, endpoint)
+	// ipv4-mapped ipv6 of tcp6
+	endpoint, ok = parseProcEndpoint("0000000000000000FFFF00000100007F:1F90")
+	assert.True(t, ok)
+	assert.Equal(t, Endpoint{ip: "127.0.0.1", port: 8080}, endpoint)
+	endpoint, ok = parseProcEndpoint("B80D0120000000000000000001000000:01BB")
+	assert.True(t, ok)
+	assert.Equal(t, Endpoint{ip: "2001:db8::1", port: 443}, endpoint)
+	_, ok = parseProcEndpoint("0100007F")
+	assert.False(t, ok)
+	_, ok = parseProcEndpoint("01007F:0050")
+	assert.False(t, ok)
+}
+
+func TestProcessResolver(t *testing.T) {
+	proc := newStubProcFS()
+	resolver, err := newProcessResolver(proc, time.Minute)
+	assert.Nil(t, err)
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	resolver.now = func() time.Time { return now }
+
+	client, server := Endpoint{ip: "10.0.0.1", port: 50000}, Endpoint{ip: "10.0.0.2", port: 80}
+	assert.Equal(t, &processInfo{pid: 1234, name: "curl"}, resolver.lookup(client, server))
+	// server is not local
+	assert.Nil(t, resolver.lookup(server, client))
+
+	// socket is gone by the time of lookup, cached result is used until refresh
+	delete(proc.links, "1234/fd/3")
+	proc.files["net/tcp"] = procNetTCPHeader
+	assert.Equal(t, &processInfo{pid: 1234, name: "curl"}, resolver.lookup(client, server))
+	now = now.Add(time.Minute)
+	assert.Nil(t, resolver.lookup(client, server))
+
+	// new socket is found by refresh on miss
+	proc.files["net/tcp"] = procNetTCPHeader +
+		"   0: 0200000A:0050 0100000A:C350 01 00000000:00000000 00:00000000 00000000  1000        0 5151 1 0\n"
+	proc.links["1/fd/6"] = "socket:[5151]"
+	assert.Nil(t, resolver.lookup(server, client))
+	now = now.Add(processMissRefresh)
+	assert.Equal(t, &processInfo{pid: 1, name: "systemd"}, resolver.lookup(server, client))
+
+	// pair still missed after refresh on miss is not refreshed again until the scheduled refresh
+	other := Endpoint{ip: "10.0.0.3", port: 443}
+	now = now.Add(processMissRefresh)
+	assert.Nil(t, resolver.lookup(client, other))
+	refreshed := resolver.refreshed
+	assert.Equal(t, now, refreshed)
+	now = now.Add(processMissRefresh)
+	assert.Nil(t, resolver.lookup(client, other))
+	assert.Equal(t, refreshed, resolver.refreshed)
+	now = now.Add(time.Minute)
+	assert.Nil(t, resolver.lookup(client, other))
+	assert.Equal(t, now, resolver.refreshed)
+
+	_, err = newProcessResolver(&stubProcFS{}, time.Minute)
+	assert.NotNil(t, err)
+}
+
+// proc file system whose process dirs are listed only after release is closed, once scanning is signaled
+type blockingProcFS struct {
+	*stubProcFS
+	scanning chan struct{}
+	release  chan struct{}
+}
+
+func (proc *blockingProcFS) readDir(name string) ([]string, error) {
+	if name == "" && proc.scanning != nil {
+		close(proc.scanning)
+		proc.scanning = nil
+		<-proc.release
+	}
+	return proc.stubProcFS.readDir(name)
+}
+
+// cached sockets are looked up while a scan is in progress
+func TestProcessResolverScanUnlocked(t *testing.T) {
+	proc := &blockingProcFS{stubProcFS: newStubProcFS()}
+	resolver, err := newProcessResolver(proc, time.Minute)
+	assert.Nil(t, err)
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	resolver.now = func() time.Time { return now }
+	client, server := Endpoint{ip: "10.0.0.1", port: 50000}, Endpoint{ip: "10.0.0.2", port: 80}
+	assert.NotNil(t, resolver.lookup(client, server))
+
+	now = now.Add(processMissRefresh)
+	scanning := make(chan struct{})
+	proc.scanning, proc.release = scanning, make(chan struct{})
+	done := make(chan *processInfo)
+	other := Endpoint{ip: "10.0.0.3", port: 443}
+	go func() {
+		done <- resolver.lookup(client, other)
+	}()
+	<-scanning
+	assert.Equal(t, &processInfo{pid: 1234, name: "curl"}, resolver.lookup(client, server))
+	close(proc.release)
+	assert.Nil(t, <-done)
+	assert.True(t, resolver.misses[socketPair{local: client, remote: other}])
+}
+
+func TestEnrichProcess(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.processes, _ = newProcessResolver(newStubProcFS(), time.Minute)
+	runConversation(handler, []testSegment{
+		{up: true, payload: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		{up: true, payload: "GET /next HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+	})
+
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, &processInfo{pid: 1234, name: "curl"}, sink.exchanges[1].srcProcess)
+	exchange := sink.exchanges[0]
+	assert.Equal(t, &processInfo{pid: 1234, name: "curl"}, exchange.srcProcess)
+	assert.Nil(t, exchange.dstProcess)
+	assert.Equal(t, int32(1234), exchange.toProto().SrcProcess.Pid)
+	assert.Nil(t, exchange.toProto().DstProcess)
+
+	var reports []string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[process]") {
+			reports = append(reports, msg)
+		}
+	}
+	assert.Equal(t, []string{"[process] 10.0.0.1:50000 (pid=1234 curl) -> 10.0.0.2:80\n"}, reports)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// profileConfig is the config file, contains named capture presets.
+// keys of a profile are the command line flag names, e.g.:
+//
+//	profiles:
+//	  web:
+//	    device: eth0
+//	    port: 80
+//	    bpf: tcp port 80 or tcp port 8080
+//	    format: json
+//	    redact-headers: [Cookie, Authorization]
+type profileConfig struct {
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// flags can not be set by profile
+var nonProfileFlags = map[string]bool{"config": true, "profile": true}
+
+// load profile from config file, and apply its settings to flags which are not set in command line
+func applyProfile(flagSet *flag.FlagSet, path string, name string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config profileConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return fmt.Errorf("parse config file %s error: %v", path, err)
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s not found in config file %s", name, path)
+	}
+
+	var setInCommandLine = map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		setInCommandLine[f.Name] = true
+	})
+
+	var keys []string
+	for key := range profile {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var unknownKeys []string
+	for _, key := range keys {
+		if flagSet.Lookup(key) == nil || nonProfileFlags[key] {
+			unknownKeys = append(unknownKeys, key)
+			continue
+		}
+		if setInCommandLine[key] {
+			continue
+		}
+		if err := flagSet.Set(key, profileValue(profile[key])); err != nil {
+			return fmt.Errorf("invalid value for %s in profile %s: %v", key, name, err)
+		}
+	}
+	if len(unknownKeys) > 0 {
+		return fmt.Errorf("unknown keys in profile %s: %s", name, strings.Join(unknownKeys, ", "))
+	}
+	return nil
+}
+
+// convert yaml value to flag value string. list is joined by comma
+func profileValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		var values []string
+		for _, v := range list {
+			values = append(values, fmt.Sprint(v))
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testProfileConfig = `
+profiles:
+  web:
+    device: eth0
+    port: 80
+    bpf: tcp port 80 or tcp port 8080
+    format: json
+    redact-headers: [Cookie, Authorization]
+  bad:
+    device: eth1
+    colour: red
+`
+
+func newTestProfileFlagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet("httpdump", flag.ContinueOnError)
+	flagSet.String("device", "any", "")
+	flagSet.Uint("port", 0, "")
+	flagSet.String("bpf", "", "")
+	flagSet.String("format", "text", "")
+	flagSet.String("redact-headers", "", "")
+	flagSet.String("config", "", "")
+	flagSet.String("profile", "", "")
+	return flagSet
+}
+
+func TestApplyProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "httpdump.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(testProfileConfig), 0644))
+
+	flagSet := newTestProfileFlagSet()
+	assert.Nil(t, flagSet.Parse([]string{"-format", "text", "-profile", "web"}))
+	assert.Nil(t, applyProfile(flagSet, path, "web"))
+	assert.Equal(t, "eth0", flagSet.Lookup("device").Value.String())
+	assert.Equal(t, "80", flagSet.Lookup("port").Value.String())
+	assert.Equal(t, "tcp port 80 or tcp port 8080", flagSet.Lookup("bpf").Value.String())
+	assert.Equal(t, "Cookie,Authorization", flagSet.Lookup("redact-headers").Value.String())
+	// command line flag wins
+	assert.Equal(t, "text", flagSet.Lookup("format").Value.String())
+
+	err = applyProfile(newTestProfileFlagSet(), path, "bad")
+	assert.EqualError(t, err, "unknown keys in profile bad: colour")
+	err = applyProfile(newTestProfileFlagSet(), path, "missing")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("profile:\n  web:\n    port: 80\n"), 0644))
+	assert.NotNil(t, applyProfile(newTestProfileFlagSet(), path, "web"))
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := redactHeaders([]string{"Host: example.com", "cookie: sid=1"}, parseNameSet("Cookie, Authorization"))
+	assert.Equal(t, []string{"Host: example.com", "cookie: ***"}, headers)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufSink write exchange records as length-delimited protobuf messages.
+// Each message is prefixed by its size as varint, same as java writeDelimitedTo
+type ProtobufSink struct {
+	writer io.WriteCloser
+	lock   sync.Mutex
+}
+
+func newProtobufSink(path string) (*ProtobufSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &ProtobufSink{writer: file}, nil
+}
+
+func (sink *ProtobufSink) write(exchange *Exchange) error {
+	data, err := proto.Marshal(exchange.toProto())
+	if err != nil {
+		return err
+	}
+	var sizeBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(sizeBuf[:], uint64(len(data)))
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if _, err := sink.writer.Write(sizeBuf[:n]); err != nil {
+		return err
+	}
+	_, err = sink.writer.Write(data)
+	return err
+}
+
+// Close the output file
+func (sink *ProtobufSink) Close() error {
+	return sink.writer.Close()
+}
+
+// read one length-delimited exchange record
+func readDelimitedExchange(reader io.ByteReader) (*ExchangeRecord, error) {
+	size, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	for i := range data {
+		if data[i], err = reader.ReadByte(); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+	var record ExchangeRecord
+	if err := proto.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (exchange *Exchange) toProto() *ExchangeRecord {
+	rawRequestHeaders, rawResponseHeaders := exchange.rawHeaderFields()
+	return &ExchangeRecord{
+		Src:                     exchange.key.srcString(),
+		Dst:                     exchange.key.dstString(),
+		Method:                  exchange.method,
+		Url:                     exchange.url,
+		Host:                    exchange.host,
+		Status:                  int32(exchange.status),
+		RequestHeaders:          toHeaderFields(exchange.requestHeaderFields()),
+		ResponseHeaders:         toHeaderFields(exchange.responseHeaderFields()),
+		RequestStart:            unixNano(exchange.requestStart),
+		RequestEnd:              unixNano(exchange.requestEnd),
+		ResponseStart:           unixNano(exchange.responseStart),
+		ResponseEnd:             unixNano(exchange.responseEnd),
+		RequestBodySize:         exchange.requestBodySize,
+		ResponseBodySize:        exchange.responseBodySize,
+		RequestBodyShort:        exchange.requestBodyShort,
+		ResponseBodyShort:       exchange.responseBodyShort,
+		EarlyHints:              exchange.earlyHints,
+		FormFields:              toFormFields(exchange.formFields),
+		Uploads:                 toUploadedFiles(exchange.uploads),
+		RequestDigestMismatch:   exchange.requestDigestMismatch,
+		ResponseDigestMismatch:  exchange.responseDigestMismatch,
+		ResponseRangeMismatch:   exchange.responseRangeMismatch,
+		CloseReason:             exchange.closeReason,
+		RequestCookies:          toCookies(exchange.requestCookies),
+		ResponseCookies:         toCookies(exchange.responseCookies),
+		SrcGeo:                  toGeoInfo(exchange.srcGeo),
+		DstGeo:                  toGeoInfo(exchange.dstGeo),
+		ForwardedHops:           toForwardedHops(exchange.forwardedHops),
+		ResolvedName:            exchange.resolvedName,
+		RequestBodyStats:        toBodyStats(exchange.requestBodyStats),
+		ResponseBodyStats:       toBodyStats(exchange.responseBodyStats),
+		OrderViolation:          exchange.orderViolation,
+		Scheme:                  exchange.scheme,
+		RequestBytes:            toMessageBytes(exchange.requestBytes),
+		ResponseBytes:           toMessageBytes(exchange.responseBytes),
+		Cache:                   toCacheInfo(exchange.cache),
+		RequestCompressionBomb:  exchange.requestCompressionBomb,
+		ResponseCompressionBomb: exchange.responseCompressionBomb,
+		SrcProcess:              toProcessInfo(exchange.srcProcess),
+		DstProcess:              toProcessInfo(exchange.dstProcess),
+		RawRequestHeaders:       toHeaderFields(rawRequestHeaders),
+		RawResponseHeaders:      toHeaderFields(rawResponseHeaders),
+	}
+}
+
+func toProcessInfo(info *processInfo) *ProcessInfo {
+	if info == nil {
+		return nil
+	}
+	return &ProcessInfo{Pid: int32(info.pid), Name: info.name}
+}
+
+func toBodyStats(stats *bodyStats) *BodyStats {
+	if stats == nil {
+		return nil
+	}
+	return &BodyStats{Bytes: stats.bytes, Lines: stats.lines, JsonKeys: int32(stats.jsonKeys)}
+}
+
+func toMessageBytes(bytes *messageBytes) *MessageBytes {
+	if bytes == nil {
+		return nil
+	}
+	return &MessageBytes{Header: bytes.header, Body: bytes.body}
+}
+
+func toCacheInfo(info *cacheInfo) *CacheInfo {
+	if info == nil {
+		return nil
+	}
+	return &CacheInfo{Cacheable: info.cacheable, MaxAge: info.maxAge, Heuristic: info.heuristic,
+		Validator: info.validator, Reason: info.reason}
+}
+
+func toForwardedHops(hops []forwardedHop) []*ForwardedHop {
+	var result []*ForwardedHop
+	for _, hop := range hops {
+		result = append(result, &ForwardedHop{For: hop.forNode, By: hop.by, Proto: hop.proto, Host: hop.host})
+	}
+	return result
+}
+
+func toGeoInfo(info *geoInfo) *GeoInfo {
+	if info == nil {
+		return nil
+	}
+	return &GeoInfo{Country: info.country, Asn: info.asn, Organization: info.organization}
+}
+
+func toCookies(cookies []cookieRecord) []*Cookie {
+	var result []*Cookie
+	for _, cookie := range cookies {
+		result = append(result, &Cookie{Name: cookie.name, Value: cookie.value, Path: cookie.path,
+			Domain: cookie.domain, Expires: cookie.expires, MaxAge: int32(cookie.maxAge), Secure: cookie.secure,
+			HttpOnly: cookie.httpOnly, SameSite: cookie.sameSite})
+	}
+	return result
+}
+
+func toFormFields(fields []formField) []*HeaderField {
+	var result []*HeaderField
+	for _, field := range fields {
+		result = append(result, &HeaderField{Name: field.name, Value: field.value})
+	}
+	return result
+}
+
+func toUploadedFiles(files []uploadedFile) []*UploadedFile {
+	var result []*UploadedFile
+	for _, file := range files {
+		result = append(result, &UploadedFile{Field: file.field, Filename: file.filename,
+			ContentType: file.contentType, Path: file.path, Size: file.size, Truncated: file.truncated})
+	}
+	return result
+}
+
+// convert raw header lines to header fields
+func toHeaderFields(headers []headerField) []*HeaderField {
+	var fields []*HeaderField
+	for _, header := range headers {
+		fields = append(fields, &HeaderField{Name: header.name, Value: header.value})
+	}
+	return fields
+}
+
+// unix nano of time, 0 for zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
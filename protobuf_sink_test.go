@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtobufSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "exchanges.pb")
+
+	sink, err := newProtobufSink(path)
+	assert.Nil(t, err)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	exchange := &Exchange{
+		key:              ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"10.0.0.2", 80}},
+		method:           "POST",
+		url:              "/api/users?id=1",
+		host:             "example.com",
+		status:           201,
+		requestHeaders:   []string{"Host: example.com", "Content-Length: 12"},
+		responseHeaders:  []string{"Content-Type: application/json"},
+		requestStart:     start,
+		requestEnd:       start.Add(time.Millisecond),
+		responseStart:    start.Add(5 * time.Millisecond),
+		responseEnd:      start.Add(7 * time.Millisecond),
+		requestBodySize:  12,
+		responseBodySize: 1024,
+	}
+	assert.Nil(t, sink.write(exchange))
+	assert.Nil(t, sink.write(&Exchange{key: exchange.key, method: "GET", url: "/"}))
+	assert.Nil(t, sink.Close())
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	record, err := readDelimitedExchange(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:50000", record.Src)
+	assert.Equal(t, "10.0.0.2:80", record.Dst)
+	assert.Equal(t, "POST", record.Method)
+	assert.Equal(t, "/api/users?id=1", record.Url)
+	assert.Equal(t, "example.com", record.Host)
+	assert.Equal(t, int32(201), record.Status)
+	assert.Equal(t, 2, len(record.RequestHeaders))
+	assert.Equal(t, "Content-Length", record.RequestHeaders[1].Name)
+	assert.Equal(t, "12", record.RequestHeaders[1].Value)
+	assert.Equal(t, "application/json", record.ResponseHeaders[0].Value)
+	assert.Equal(t, start.UnixNano(), record.RequestStart)
+	assert.Equal(t, start.Add(7*time.Millisecond).UnixNano(), record.ResponseEnd)
+	assert.Equal(t, int64(12), record.RequestBodySize)
+	assert.Equal(t, int64(1024), record.ResponseBodySize)
+
+	record, err = readDelimitedExchange(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "GET", record.Method)
+	assert.Equal(t, int64(0), record.ResponseEnd)
+	_, err = readDelimitedExchange(reader)
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headers not replayed as recorded. Bodies are not in records, and connection is managed by the client
+var skipReplayHeaders = map[string]bool{
+	"content-length":    true,
+	"transfer-encoding": true,
+	"connection":        true,
+	"keep-alive":        true,
+	"host":              true,
+	"expect":            true,
+	"upgrade":           true,
+}
+
+// replay requests in records file against target, result lines are written to stdout
+func runReplay(path string, target string, speedValue string) {
+	speed, err := parseSpeed(speedValue)
+	if err != nil {
+		logger.Error("invalid -speed:", err)
+		return
+	}
+	replayer, err := newReplayer(target, speed, os.Stdout)
+	if err != nil {
+		logger.Error("invalid -replay-target:", err)
+		return
+	}
+	records, err := readExchangeRecords(path)
+	if err != nil {
+		logger.Warn("read records", path, "error:", err)
+	}
+	replayer.replay(records)
+}
+
+// Replayer issue recorded requests against a target, keeping their original relative timing
+type Replayer struct {
+	target *url.URL
+	speed  float64 // time offsets of requests are divided by speed
+	client *http.Client
+	output io.Writer // result line of each request is written here
+	lock   sync.Mutex
+}
+
+// parse replay speed multiplier like 2x, 0.5x, or 2
+func parseSpeed(value string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if speed <= 0 {
+		return 0, errors.New("speed should be positive")
+	}
+	return speed, nil
+}
+
+func newReplayer(target string, speed float64, output io.Writer) (*Replayer, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if targetURL.Scheme != "http" && targetURL.Scheme != "https" || targetURL.Host == "" {
+		return nil, errors.New("target should be http://host:port or https://host:port")
+	}
+	return &Replayer{
+		target: targetURL,
+		speed:  speed,
+		client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		output: output,
+	}, nil
+}
+
+// read all length-delimited exchange records from file
+func readExchangeRecords(path string) ([]*ExchangeRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var records []*ExchangeRecord
+	for {
+		record, err := readDelimitedExchange(reader)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+// issue requests of records, each at its offset from the first request start, scaled by speed.
+// Requests are sent concurrently, so a slow response does not delay the requests after it
+func (replayer *Replayer) replay(records []*ExchangeRecord) {
+	records = append([]*ExchangeRecord(nil), records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].RequestStart < records[j].RequestStart
+	})
+	if len(records) == 0 {
+		return
+	}
+	var wg sync.WaitGroup
+	first := records[0].RequestStart
+	start := time.Now()
+	for _, record := range records {
+		offset := time.Duration(float64(record.RequestStart-first) / replayer.speed)
+		if wait := time.Until(start.Add(offset)); wait > 0 {
+			time.Sleep(wait)
+		}
+		wg.Add(1)
+		go func(record *ExchangeRecord, offset time.Duration) {
+			defer wg.Done()
+			replayer.send(record, offset)
+		}(record, offset)
+	}
+	wg.Wait()
+}
+
+// send request of record, and write the result line
+func (replayer *Replayer) send(record *ExchangeRecord, offset time.Duration) {
+	req, err := replayer.newRequest(record)
+	var result string
+	if err == nil {
+		begin := time.Now()
+		var resp *http.Response
+		if resp, err = replayer.client.Do(req); err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			result = fmt.Sprintf("%d %v", resp.StatusCode, time.Since(begin).Round(time.Millisecond))
+		}
+	}
+	if err != nil {
+		result = "error: " + err.Error()
+	}
+	target := record.Host + record.Url
+	if strings.Contains(record.Url, "://") {
+		target = record.Url
+	}
+	replayer.lock.Lock()
+	defer replayer.lock.Unlock()
+	fmt.Fprintln(replayer.output, "[replay]", "+"+offset.Round(time.Millisecond).String(), record.Method,
+		target, "->", result)
+}
+
+// build request of record against the target. Original Host header is kept
+func (replayer *Replayer) newRequest(record *ExchangeRecord) (*http.Request, error) {
+	uri := record.Url
+	if parsed, err := url.Parse(uri); err == nil && parsed.IsAbs() {
+		// absolute form of proxy requests
+		uri = parsed.RequestURI()
+	}
+	req, err := http.NewRequest(record.Method, replayer.target.Scheme+"://"+replayer.target.Host+uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range record.RequestHeaders {
+		if !skipReplayHeaders[strings.ToLower(header.Name)] {
+			req.Header.Add(header.Name, header.Value)
+		}
+	}
+	if record.Host != "" {
+		req.Host = record.Host
+	}
+	return req, nil
+}
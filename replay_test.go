@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSpeed(t *testing.T) {
+	for value, expected := range map[string]float64{"2x": 2, "0.5x": 0.5, "3": 3, " 1x ": 1} {
+		speed, err := parseSpeed(value)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, speed)
+	}
+	for _, value := range []string{"", "x", "0x", "-1x", "fast"} {
+		_, err := parseSpeed(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	var lock sync.Mutex
+	var arrivals []time.Time
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		arrivals = append(arrivals, time.Now())
+		requests = append(requests, r)
+		lock.Unlock()
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	// write records by protobuf sink, the second request is 200ms after the first
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "records.pb")
+	sink, err := newProtobufSink(path)
+	assert.Nil(t, err)
+	base := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := &Exchange{method: "POST", url: "http://example.com/b?x=1", host: "example.com",
+		requestStart:   base.Add(200 * time.Millisecond),
+		requestHeaders: []string{"Content-Length: 3", "X-Trace: 2", "Connection: keep-alive"}}
+	first := &Exchange{method: "GET", url: "/a", host: "example.com", requestStart: base,
+		requestHeaders: []string{"Host: example.com", "X-Trace: 1"}}
+	// written out of order, as exchanges are emitted by completion
+	assert.Nil(t, sink.write(second))
+	assert.Nil(t, sink.write(first))
+	assert.Nil(t, sink.Close())
+
+	records, err := readExchangeRecords(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+
+	var output bytes.Buffer
+	replayer, err := newReplayer(server.URL, 2, &output)
+	assert.Nil(t, err)
+	replayer.replay(records)
+
+	assert.Equal(t, 2, len(arrivals))
+	gap := arrivals[1].Sub(arrivals[0])
+	assert.True(t, gap >= 90*time.Millisecond && gap < 150*time.Millisecond, gap.String())
+
+	assert.Equal(t, "GET", requests[0].Method)
+	assert.Equal(t, "/a", requests[0].URL.RequestURI())
+	assert.Equal(t, "example.com", requests[0].Host)
+	assert.Equal(t, "1", requests[0].Header.Get("X-Trace"))
+	assert.Equal(t, "POST", requests[1].Method)
+	assert.Equal(t, "/b?x=1", requests[1].URL.RequestURI())
+	assert.Equal(t, "2", requests[1].Header.Get("X-Trace"))
+	assert.Equal(t, int64(0), requests[1].ContentLength)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "[replay] +0s GET example.com/a -> 204"), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "[replay] +100ms POST http://example.com/b?x=1 -> 204"), lines[1])
+}
+
+func TestReplayInvalidTarget(t *testing.T) {
+	for _, target := range []string{"", "example.com:80", "ftp://example.com"} {
+		_, err := newReplayer(target, 1, os.Stdout)
+		assert.NotNil(t, err, target)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RequestBoundary decide how the assembler find request starts on client stream, for timing info and
+// telling response starts from response bodies
+type RequestBoundary int
+
+const (
+	// BoundaryStream parse client stream sequentially, the next request starts right after the previous
+	// request body, at a segment start or in the middle of a segment
+	BoundaryStream RequestBoundary = iota
+	// BoundarySegment take every segment starting with a http method as a request start
+	BoundarySegment
+)
+
+func parseRequestBoundary(value string) (RequestBoundary, error) {
+	switch value {
+	case "stream":
+		return BoundaryStream, nil
+	case "segment":
+		return BoundarySegment, nil
+	}
+	return BoundaryStream, fmt.Errorf("invalid request boundary: %s", value)
+}
+
+// max header block held to find the header end, longer header loses track of the stream
+const maxScanHeader = 64 * 1024
+
+// states of requestScanner
+const (
+	scanLost   = iota // out of sync, wait a segment starting with a request line
+	scanStart         // at start of the next request
+	scanHeader        // in header block of a request
+	scanBody          // in body of a request
+)
+
+// requestScanner follow request boundaries of client stream. Segments are expected in seq order,
+// retransmitted bytes are skipped, and a gap or a chunked body loses track until a segment starts with a request line
+type requestScanner struct {
+	boundary  RequestBoundary
+	nextSeq   uint32 // seq of the next byte expected
+	seqSet    bool
+	state     int
+	header    []byte // header block of current request received so far
+	remaining int64  // body bytes of current request not received
+}
+
+// scan a client segment, return methods of the requests starting in it
+func (scanner *requestScanner) scan(seq uint32, payload []byte) []string {
+	if scanner.boundary == BoundarySegment {
+		if isHTTPRequestData(payload) {
+			return []string{requestMethod(payload, requestMethodWindow)}
+		}
+		return nil
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	if scanner.seqSet {
+		if diff := compareTCPSeq(seq, scanner.nextSeq); diff < 0 {
+			if -diff >= len(payload) {
+				// retransmission
+				return nil
+			}
+			payload = payload[-diff:]
+			seq = scanner.nextSeq
+		} else if diff > 0 {
+			// bytes missing
+			scanner.lose()
+		}
+	}
+	scanner.nextSeq = seq + uint32(len(payload))
+	scanner.seqSet = true
+
+	if scanner.state == scanLost {
+		if !isHTTPRequestData(payload) {
+			return nil
+		}
+		scanner.state = scanStart
+	}
+	var methods []string
+	for len(payload) > 0 {
+		switch scanner.state {
+		case scanStart:
+			// tolerate empty lines between requests
+			if payload = bytes.TrimLeft(payload, "\r\n"); len(payload) > 0 {
+				scanner.state = scanHeader
+			}
+		case scanHeader:
+			before := len(scanner.header)
+			scanner.header = append(scanner.header, payload...)
+			if before < 8 && len(scanner.header) >= 8 {
+				if !isHTTPRequestData(scanner.header) {
+					scanner.lose()
+					return methods
+				}
+				methods = append(methods, requestMethod(scanner.header, requestMethodWindow))
+			}
+			from := before - 3
+			if from < 0 {
+				from = 0
+			}
+			idx := bytes.Index(scanner.header[from:], []byte("\r\n\r\n"))
+			if idx < 0 {
+				if len(scanner.header) > maxScanHeader {
+					scanner.lose()
+				}
+				return methods
+			}
+			idx += from
+			if idx+4 < 8 {
+				// too short to be a request
+				scanner.lose()
+				return methods
+			}
+			payload = payload[idx+4-before:]
+			length, chunked := contentLength(scanner.header[:idx])
+			scanner.header = nil
+			if chunked {
+				scanner.lose()
+				return methods
+			}
+			if length > 0 {
+				scanner.remaining = length
+				scanner.state = scanBody
+			} else {
+				// request without Content-Length has no body
+				scanner.state = scanStart
+			}
+		case scanBody:
+			n := int64(len(payload))
+			if n > scanner.remaining {
+				n = scanner.remaining
+			}
+			scanner.remaining -= n
+			payload = payload[n:]
+			if scanner.remaining == 0 {
+				scanner.state = scanStart
+			}
+		}
+	}
+	return methods
+}
+
+func (scanner *requestScanner) lose() {
+	scanner.state = scanLost
+	scanner.header = nil
+	scanner.remaining = 0
+}
+
+// method of the request line starting data, the part before the first space in the first window bytes.
+// empty if no space there. window is cut to data length, so never reads past data
+func requestMethod(data []byte, window int) string {
+	if window > len(data) {
+		window = len(data)
+	}
+	if window <= 0 {
+		return ""
+	}
+	idx := bytes.IndexByte(data[:window], ' ')
+	if idx <= 0 {
+		return ""
+	}
+	return string(data[:idx])
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestScanner(t *testing.T) {
+	var scanner requestScanner
+	seq := uint32(1000)
+	scan := func(payload string) []string {
+		methods := scanner.scan(seq, []byte(payload))
+		seq += uint32(len(payload))
+		return methods
+	}
+	assert.Equal(t, []string{"POST"}, scan("POST /a HTTP/1.1\r\nContent-Length: 9\r\n\r\nhel"))
+	// body looks like a request
+	assert.Nil(t, scan("GET lo"))
+	// next request in the middle of a segment, after an empty line
+	assert.Equal(t, []string{"GET"}, scan("\r\nGET /b HTTP/1.1\r\nHost: example.com\r\n\r\nPU"))
+	// request line split between segments
+	assert.Equal(t, []string{"PUT"}, scan("T /c HTTP/1.1\r\nContent-Length: 0\r\n\r\n"))
+	// retransmission is skipped
+	assert.Nil(t, scanner.scan(seq-4, []byte("\r\n\r\n")))
+	assert.Equal(t, scanStart, scanner.state)
+
+	// chunked body loses track, until a segment starts with a request line
+	assert.Equal(t, []string{"POST"}, scan("POST /d HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"))
+	assert.Nil(t, scan("3\r\nGET\r\n0\r\n\r\n"))
+	assert.Equal(t, []string{"GET", "HEAD"}, scan("GET /e HTTP/1.1\r\n\r\nHEAD /f HTTP/1.1\r\n\r\n"))
+	// gap loses track
+	seq += 100
+	assert.Nil(t, scan("xxGET /g HTTP/1.1\r\n\r\n"))
+	assert.Equal(t, scanLost, scanner.state)
+	// not a request
+	assert.Equal(t, []string{"GET"}, scan("GET /h HTTP/1.1\r\n\r\n"))
+	assert.Nil(t, scan("hello world"))
+	assert.Equal(t, scanLost, scanner.state)
+
+	segment := requestScanner{boundary: BoundarySegment}
+	assert.Equal(t, []string{"GET"}, segment.scan(0, []byte("GET lo world")))
+	assert.Nil(t, segment.scan(0, []byte("loGET /b HTTP/1.1\r\n\r\n")))
+}
+
+func TestParseRequestBoundary(t *testing.T) {
+	boundary, err := parseRequestBoundary("segment")
+	assert.Nil(t, err)
+	assert.Equal(t, BoundarySegment, boundary)
+	_, err = parseRequestBoundary("line")
+	assert.NotNil(t, err)
+}
+
+func TestKeepAliveRequestBoundary(t *testing.T) {
+	first := "POST /a HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhel"
+	// the second request starts in the middle of the segment
+	second := "loGET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	reply := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"
+	for _, boundary := range []RequestBoundary{BoundaryStream, BoundarySegment} {
+		assembler, handler := newTestAssembler()
+		assembler.requestBoundary = boundary
+		timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		clientSeq, serverSeq := uint32(1000), uint32(5000)
+		assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, first), timestamp)
+		clientSeq += uint32(len(first))
+		assembler.assemble(testClientFlow, clientPacket(clientSeq, serverSeq, second), timestamp)
+		clientSeq += uint32(len(second))
+		for i := 1; i <= 2; i++ {
+			assembler.assemble(testServerFlow, serverPacket(serverSeq, clientSeq, reply),
+				timestamp.Add(time.Duration(i)*time.Millisecond))
+			serverSeq += uint32(len(reply))
+		}
+
+		assert.Equal(t, 1, len(handler.connections))
+		info := gTsInfo[handler.connections[0].key]
+		if boundary == BoundaryStream {
+			// the second response starts after the first one of unknown length, as a request is waiting
+			assert.Equal(t, timestamp.Add(2*time.Millisecond), info.rep1)
+		} else {
+			assert.Equal(t, timestamp.Add(time.Millisecond), info.rep1)
+		}
+	}
+
+	// exchanges are parsed sequentially
+	sink, _ := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: first},
+		{up: true, payload: second},
+		{up: false, payload: reply + reply},
+	})
+	if assert.Equal(t, 2, len(sink.exchanges)) {
+		assert.Equal(t, "/a", sink.exchanges[0].url)
+		assert.Equal(t, "/b", sink.exchanges[1].url)
+		assert.Equal(t, 200, sink.exchanges[1].status)
+	}
+}
+
+func TestRequestMethod(t *testing.T) {
+	assert.Equal(t, "GET", requestMethod([]byte("GET / HTTP/1.1"), 100))
+	assert.Equal(t, "", requestMethod([]byte("GET / HTTP/1.1"), 3))
+	assert.Equal(t, "GET", requestMethod([]byte("GET / HTTP/1.1"), 4))
+	assert.Equal(t, "", requestMethod([]byte("GET"), 8))
+	assert.Equal(t, "", requestMethod(nil, 8))
+	assert.Equal(t, "", requestMethod([]byte("GET /"), -1))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"httpdump/httpport"
+)
+
+// ExchangeRing hold recent exchanges in memory instead of output them. When a trigger exchange is seen,
+// the held exchanges and the trigger one are output, as context of the event, then the following exchanges
+// up to after are output directly
+type ExchangeRing struct {
+	lock      sync.Mutex
+	maxCount  int
+	maxBytes  int // 0 for unlimited
+	status    *StatusFilter
+	header    string // canonical header name to trigger, empty for not trigger by header
+	pattern   string // wildcard pattern of the header value
+	after     int
+	remaining int // exchanges to output directly after the last trigger
+	entries   []ringEntry
+	bytes     int
+	triggers  int
+	dropped   int // exchanges evicted without output
+}
+
+// ringEntry is an exchange with its printed text
+type ringEntry struct {
+	exchange *Exchange
+	text     string
+}
+
+func newExchangeRing(maxCount int, maxBytes int, status *StatusFilter, header string, after int) (*ExchangeRing, error) {
+	ring := &ExchangeRing{maxCount: maxCount, maxBytes: maxBytes, status: status, after: after}
+	if header != "" {
+		idx := strings.IndexByte(header, ':')
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid header trigger, should be Name: pattern: %s", header)
+		}
+		ring.header = httpport.CanonicalHeaderKey(strings.TrimSpace(header[:idx]))
+		ring.pattern = strings.TrimSpace(header[idx+1:])
+	}
+	return ring, nil
+}
+
+// if exchange fires the trigger, by response status or by a request or response header
+func (ring *ExchangeRing) triggered(exchange *Exchange) bool {
+	if ring.status != nil && exchange.status != 0 && ring.status.match(exchange.status) {
+		return true
+	}
+	if ring.header == "" {
+		return false
+	}
+	for _, header := range []httpport.Header{exchange.requestHeader, exchange.responseHeader} {
+		for _, value := range header[ring.header] {
+			if wildcardMatch(value, ring.pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// add an exchange, emit is called in order for exchanges should be output now
+func (ring *ExchangeRing) add(exchange *Exchange, text string, emit func(exchange *Exchange, text string)) {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	if ring.triggered(exchange) {
+		ring.triggers++
+		for _, entry := range ring.entries {
+			emit(entry.exchange, entry.text)
+		}
+		ring.entries = nil
+		ring.bytes = 0
+		ring.remaining = ring.after
+		emit(exchange, text)
+		return
+	}
+	if ring.remaining > 0 {
+		ring.remaining--
+		emit(exchange, text)
+		return
+	}
+	ring.entries = append(ring.entries, ringEntry{exchange: exchange, text: text})
+	ring.bytes += len(text)
+	for len(ring.entries) > ring.maxCount || ring.maxBytes > 0 && ring.bytes > ring.maxBytes && len(ring.entries) > 0 {
+		ring.bytes -= len(ring.entries[0].text)
+		ring.entries[0] = ringEntry{}
+		ring.entries = ring.entries[1:]
+		ring.dropped++
+	}
+}
+
+// report trigger count, and exchanges not output
+func (ring *ExchangeRing) format(format string) string {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{"type": "ring", "triggers": ring.triggers,
+			"dropped": ring.dropped + len(ring.entries)})
+		return string(data) + "\n"
+	}
+	return "[ring] triggers=" + strconv.Itoa(ring.triggers) + " dropped=" +
+		strconv.Itoa(ring.dropped+len(ring.entries)) + "\n"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"httpdump/httpport"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeRing(t *testing.T) {
+	var segments []testSegment
+	for i := 1; i <= 7; i++ {
+		status := "200 OK"
+		if i == 5 {
+			status = "500 Internal Server Error"
+		}
+		segments = append(segments,
+			testSegment{up: true, payload: fmt.Sprintf("GET /%d HTTP/1.1\r\nHost: example.com\r\n\r\n", i)},
+			testSegment{payload: "HTTP/1.1 " + status + "\r\nContent-Length: 0\r\n\r\n"})
+	}
+	status, _ := parseStatusFilter("5xx", false)
+	ring, err := newExchangeRing(3, 0, status, "", 1)
+	assert.Nil(t, err)
+	handler, sink := newTestHTTPHandler(&Config{level: "header"})
+	handler.ring = ring
+	runConversation(handler, segments)
+
+	// the 3 preceding exchanges, the trigger one, and 1 following exchange
+	var urls []string
+	for _, exchange := range sink.exchanges {
+		urls = append(urls, exchange.url)
+	}
+	assert.Equal(t, []string{"/2", "/3", "/4", "/5", "/6"}, urls)
+	assert.Equal(t, "[ring] triggers=1 dropped=2\n", ring.format("text"))
+}
+
+func TestExchangeRingTrigger(t *testing.T) {
+	ring, err := newExchangeRing(10, 10, nil, "x-debug: on*", 0)
+	assert.Nil(t, err)
+	var emitted []string
+	emit := func(exchange *Exchange, text string) {
+		emitted = append(emitted, text)
+	}
+	ring.add(&Exchange{status: 500}, "aaaaa", emit)
+	ring.add(&Exchange{status: 200}, "bbbbb", emit)
+	// exceed max bytes, the oldest is evicted
+	ring.add(&Exchange{status: 200}, "cc", emit)
+	assert.Nil(t, emitted)
+	ring.add(&Exchange{status: 200, responseHeader: httpport.Header{"X-Debug": {"online"}}}, "d", emit)
+	assert.Equal(t, []string{"bbbbb", "cc", "d"}, emitted)
+
+	_, err = newExchangeRing(10, 0, nil, "X-Debug", 0)
+	assert.NotNil(t, err)
+}
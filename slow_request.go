@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// capture timestamp of the first byte of next request, blocks until it arrives.
+// If the bytes are already buffered, timestamp of the last packet read is used, which may be later than actual
+func firstByteTimestamp(reader interface{ Peek(int) ([]byte, error) }, stream *NetworkStream) time.Time {
+	reader.Peek(1)
+	return stream.lastTimestamp
+}
+
+// warn if request took longer than threshold from its first byte to complete, which is a slowloris indicator.
+// exchange is nil if connection ended before request headers completed, then the last packet time is used as end
+func (h *HTTPTrafficHandler) checkSlowRequest(exchange *Exchange, firstByte time.Time, stream *NetworkStream) {
+	threshold := h.config.slowRequest
+	var record = map[string]interface{}{
+		"type":      "slow-request",
+		"src":       h.key.srcString(),
+		"dst":       h.key.dstString(),
+		"threshold": threshold.String(),
+	}
+	var text string
+	if exchange == nil {
+		duration := stream.lastTimestamp.Sub(firstByte)
+		if duration <= threshold {
+			return
+		}
+		record["duration"] = duration.String()
+		record["complete"] = false
+		text = fmt.Sprintf("request headers incomplete after %v, threshold %v", duration, threshold)
+	} else {
+		duration := exchange.requestEnd.Sub(firstByte)
+		if duration <= threshold {
+			return
+		}
+		headers := exchange.requestStart.Sub(firstByte)
+		body := exchange.requestEnd.Sub(exchange.requestStart)
+		record["method"] = exchange.method
+		record["url"] = exchange.host + exchange.url
+		record["duration"] = duration.String()
+		record["headers"] = headers.String()
+		record["body"] = body.String()
+		record["complete"] = !exchange.requestBodyShort
+		verb := "took"
+		if exchange.requestBodyShort {
+			verb = "incomplete after"
+		}
+		text = fmt.Sprintf("%s %s %s %v(headers %v, body %v), threshold %v", exchange.method,
+			exchange.host+exchange.url, verb, duration, headers, body, threshold)
+	}
+	if h.config.format == "json" {
+		data, _ := json.Marshal(record)
+		h.printer.send(string(data) + "\n")
+	} else {
+		h.printer.send(fmt.Sprintln("[slow-request]", h.key.srcString(), "->", h.key.dstString(), text))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func slowRequestLines(printer *Printer) []string {
+	var lines []string
+	for len(printer.outputQueue) > 0 {
+		if msg := <-printer.outputQueue; strings.HasPrefix(msg, "[slow-request]") {
+			lines = append(lines, msg)
+		}
+	}
+	return lines
+}
+
+func TestSlowRequest(t *testing.T) {
+	sink, printer := runHTTPConversation(&Config{slowRequest: 10 * time.Second}, []testSegment{
+		// headers trickle over 24s, body over 6s
+		{up: true, payload: "POST /upload HTTP/1.1\r\n"},
+		{up: true, payload: "Host: example.com\r\n", delay: 8 * time.Second},
+		{up: true, payload: "Content-Length: 4\r\n", delay: 8 * time.Second},
+		{up: true, payload: "\r\nab", delay: 8 * time.Second},
+		{up: true, payload: "cd", delay: 6 * time.Second},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		// fast request after keep-alive idle, the idle time is not counted
+		{up: true, payload: "GET /fast HTTP/1.1\r\nHost: example.com\r\n\r\n", delay: time.Minute},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		// headers never complete
+		{up: true, payload: "GET /loris HTTP/1.1\r\n", delay: time.Second},
+		{up: true, payload: "X-a: b\r\n", delay: 9 * time.Second},
+		{up: true, payload: "X-c: d\r\n", delay: 9 * time.Second},
+	})
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, []string{
+		"[slow-request] 10.0.0.1:50000 -> 10.0.0.2:80 POST example.com/upload took 30s(headers 24s, body 6s), threshold 10s\n",
+		"[slow-request] 10.0.0.1:50000 -> 10.0.0.2:80 request headers incomplete after 18s, threshold 10s\n",
+	}, slowRequestLines(printer))
+}
+
+func TestSlowRequestDisabled(t *testing.T) {
+	_, printer := runHTTPConversation(&Config{}, []testSegment{
+		{up: true, payload: "GET /slow HTTP/1.1\r\n"},
+		{up: true, payload: "Host: example.com\r\n\r\n", delay: time.Minute},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+	})
+	assert.Empty(t, slowRequestLines(printer))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minSocketBackoff = 100 * time.Millisecond
+	maxSocketBackoff = 10 * time.Second
+)
+
+// SocketSink stream output records to a remote collector over tcp or udp.
+// Records are buffered in a bounded queue, when queue is full the oldest record is dropped,
+// so a slow or unreachable collector never blocks the capture path.
+type SocketSink struct {
+	network  string
+	address  string
+	queue    [][]byte
+	maxQueue int
+	dropped  int
+	closed   bool
+	lock     sync.Mutex
+	cond     *sync.Cond
+	done     chan struct{}
+	// cancelled when closed, to stop waiting reconnect backoff or connecting
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// parse output setting like tcp://host:port or udp://host:port. return ok=false if is not a socket address
+func parseSocketOutput(output string) (network string, address string, ok bool) {
+	for _, n := range []string{"tcp", "udp"} {
+		if strings.HasPrefix(output, n+"://") {
+			return n, output[len(n)+3:], true
+		}
+	}
+	return "", "", false
+}
+
+func newSocketSink(network, address string, maxQueue int) *SocketSink {
+	sink := &SocketSink{network: network, address: address, maxQueue: maxQueue, done: make(chan struct{})}
+	sink.ctx, sink.cancel = context.WithCancel(context.Background())
+	sink.cond = sync.NewCond(&sink.lock)
+	go sink.sendBackground()
+	return sink
+}
+
+// Write queue one record, never blocks
+func (sink *SocketSink) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(sink.queue) >= sink.maxQueue {
+		// drop oldest
+		sink.queue[0] = nil
+		sink.queue = sink.queue[1:]
+		sink.dropped++
+	}
+	sink.queue = append(sink.queue, data)
+	sink.cond.Signal()
+	return len(p), nil
+}
+
+// Dropped return the count of records dropped because queue is full
+func (sink *SocketSink) Dropped() int {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.dropped
+}
+
+// Close flush queued records if collector is connected, and stop the sink. Reconnecting is given up
+func (sink *SocketSink) Close() error {
+	sink.lock.Lock()
+	sink.closed = true
+	sink.cond.Signal()
+	sink.lock.Unlock()
+	sink.cancel()
+	<-sink.done
+	if dropped := sink.Dropped(); dropped > 0 {
+		logger.Warn("socket output dropped", dropped, "records")
+	}
+	return nil
+}
+
+// take next record, wait if queue is empty. return nil if sink is closed and all records are sent
+func (sink *SocketSink) next() []byte {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	for len(sink.queue) == 0 && !sink.closed {
+		sink.cond.Wait()
+	}
+	if len(sink.queue) == 0 {
+		return nil
+	}
+	data := sink.queue[0]
+	sink.queue[0] = nil
+	sink.queue = sink.queue[1:]
+	return data
+}
+
+func (sink *SocketSink) isClosed() bool {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.closed
+}
+
+func (sink *SocketSink) sendBackground() {
+	defer close(sink.done)
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	backoff := minSocketBackoff
+	for {
+		data := sink.next()
+		if data == nil {
+			return
+		}
+		for {
+			if conn == nil {
+				var err error
+				dialer := net.Dialer{Timeout: maxSocketBackoff}
+				conn, err = dialer.DialContext(sink.ctx, sink.network, sink.address)
+				if err != nil {
+					conn = nil
+					if sink.isClosed() {
+						// collector unreachable when exit, give up remaining records
+						return
+					}
+					logger.Debug("connect to collector", sink.address, "failed:", err)
+					select {
+					case <-time.After(backoff):
+					case <-sink.ctx.Done():
+					}
+					if backoff *= 2; backoff > maxSocketBackoff {
+						backoff = maxSocketBackoff
+					}
+					continue
+				}
+				backoff = minSocketBackoff
+			}
+			if _, err := conn.Write(data); err != nil {
+				logger.Debug("write to collector", sink.address, "failed:", err)
+				conn.Close()
+				conn = nil
+				continue
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// accept one connection and send received lines to channel
+func acceptLines(listener net.Listener, conns chan net.Conn, lines chan string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conns <- conn
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		lines <- line
+	}
+}
+
+func TestSocketSinkReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	conns := make(chan net.Conn, 2)
+	lines := make(chan string, 100)
+	go acceptLines(listener, conns, lines)
+
+	sink := newSocketSink("tcp", address, 16)
+	sink.Write([]byte(`{"id":1}` + "\n"))
+	select {
+	case line := <-lines:
+		assert.Equal(t, `{"id":1}`+"\n", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("record not received")
+	}
+
+	// restart collector
+	listener.Close()
+	(<-conns).Close()
+	time.Sleep(50 * time.Millisecond)
+	listener, err = net.Listen("tcp", address)
+	assert.Nil(t, err)
+	defer listener.Close()
+	lines2 := make(chan string, 100)
+	go acceptLines(listener, conns, lines2)
+
+	// records written to the broken connection may be lost, keep writing until collector receive one
+	deadline := time.After(10 * time.Second)
+	for received := false; !received; {
+		sink.Write([]byte(`{"id":2}` + "\n"))
+		select {
+		case line := <-lines2:
+			assert.Equal(t, `{"id":2}`+"\n", line)
+			received = true
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("record not received after collector restart")
+		}
+	}
+	sink.Close()
+}
+
+func TestSocketSinkDropOldest(t *testing.T) {
+	// no collector listen on this address
+	sink := newSocketSink("tcp", "127.0.0.1:1", 2)
+	for i := 0; i < 5; i++ {
+		sink.Write([]byte("record\n"))
+	}
+	assert.True(t, sink.Dropped() >= 2)
+	sink.lock.Lock()
+	assert.True(t, len(sink.queue) <= 2)
+	sink.lock.Unlock()
+	sink.Close()
+
+	network, address, ok := parseSocketOutput("udp://10.0.0.1:9000")
+	assert.True(t, ok)
+	assert.Equal(t, "udp", network)
+	assert.Equal(t, "10.0.0.1:9000", address)
+	_, _, ok = parseSocketOutput("out.txt")
+	assert.False(t, ok)
+}
+
+func TestSocketSinkCloseDuringBackoff(t *testing.T) {
+	sink := newSocketSink("tcp", "127.0.0.1:1", 2)
+	sink.Write([]byte("record\n"))
+	// reconnect backoff has grown to 800ms after failed attempts
+	time.Sleep(800 * time.Millisecond)
+	start := time.Now()
+	sink.Close()
+	assert.True(t, time.Since(start) < 300*time.Millisecond, time.Since(start))
+}
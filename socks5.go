@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	socks5Version    = 5
+	socks5AuthVer    = 1 // version of username/password auth sub-negotiation
+	socks5CmdConnect = 1
+	socks5AuthPass   = 2 // username/password auth method
+	socks5AddrIPv4   = 1
+	socks5AddrDomain = 3
+	socks5AddrIPv6   = 4
+)
+
+var errNotSOCKS5 = errors.New("not socks5 connect handshake")
+
+// socks5Handshake parse bytes of socks5 handshake, to get the connect target and skip the handshake
+type socks5Handshake struct {
+	buffer  []byte
+	greeted bool
+	target  string // host:port, set when connect request is parsed
+
+	serverBuffer  []byte
+	serverStage   int  // server messages parsed: method selection, auth status if needed, connect reply
+	authSelected  bool // username/password auth selected by server
+	serverReplied bool // connect reply parsed
+
+	// seq after the handshake bytes fed of client and server, to skip retransmitted handshake bytes
+	seq, serverSeq       uint32
+	seqSet, serverSeqSet bool
+}
+
+// if data looks like a socks5 client greeting
+func isSOCKS5Greeting(data []byte) bool {
+	return len(data) >= 3 && data[0] == socks5Version && data[1] > 0 && len(data) >= 2+int(data[1])
+}
+
+// the part of payload after next seq, so bytes of retransmitted segments already fed are skipped
+func socks5Unfed(next uint32, nextSet bool, seq uint32, payload []byte) []byte {
+	if !nextSet {
+		return payload
+	}
+	diff := compareTCPSeq(next, seq)
+	if diff <= 0 {
+		return payload
+	}
+	if diff >= len(payload) {
+		return nil
+	}
+	return payload[diff:]
+}
+
+// feed client data. return bytes after the connect request if it is parsed, or nil if more data is needed
+func (handshake *socks5Handshake) feed(data []byte) ([]byte, error) {
+	handshake.buffer = append(handshake.buffer, data...)
+	for handshake.target == "" {
+		n, err := handshake.parse(handshake.buffer)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		handshake.buffer = handshake.buffer[n:]
+	}
+	return handshake.buffer, nil
+}
+
+// feed server data. return bytes after the connect reply if it is parsed, or nil if more data is needed
+func (handshake *socks5Handshake) feedServer(data []byte) ([]byte, error) {
+	handshake.serverBuffer = append(handshake.serverBuffer, data...)
+	for !handshake.serverReplied {
+		n, err := handshake.parseServer(handshake.serverBuffer)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		handshake.serverBuffer = handshake.serverBuffer[n:]
+	}
+	return handshake.serverBuffer, nil
+}
+
+// parse one server message, return bytes consumed, 0 if data is not enough
+func (handshake *socks5Handshake) parseServer(data []byte) (int, error) {
+	if len(data) < 2 {
+		return 0, nil
+	}
+	if handshake.serverStage == 0 {
+		// VER METHOD
+		if data[0] != socks5Version {
+			return 0, errNotSOCKS5
+		}
+		handshake.serverStage++
+		handshake.authSelected = data[1] == socks5AuthPass
+		return 2, nil
+	}
+	if handshake.serverStage == 1 && handshake.authSelected {
+		// VER STATUS
+		if data[0] != socks5AuthVer {
+			return 0, errNotSOCKS5
+		}
+		handshake.serverStage++
+		return 2, nil
+	}
+	// VER REP RSV ATYP BND.ADDR BND.PORT
+	if data[0] != socks5Version {
+		return 0, errNotSOCKS5
+	}
+	if len(data) < 5 {
+		return 0, nil
+	}
+	var end int
+	switch data[3] {
+	case socks5AddrIPv4:
+		end = 4 + net.IPv4len
+	case socks5AddrIPv6:
+		end = 4 + net.IPv6len
+	case socks5AddrDomain:
+		end = 5 + int(data[4])
+	default:
+		return 0, errNotSOCKS5
+	}
+	if len(data) < end+2 {
+		return 0, nil
+	}
+	handshake.serverReplied = true
+	return end + 2, nil
+}
+
+// parse one message, return bytes consumed, 0 if data is not enough
+func (handshake *socks5Handshake) parse(data []byte) (int, error) {
+	if len(data) < 2 {
+		return 0, nil
+	}
+	if !handshake.greeted {
+		// VER NMETHODS METHODS
+		if data[0] != socks5Version || data[1] == 0 {
+			return 0, errNotSOCKS5
+		}
+		if len(data) < 2+int(data[1]) {
+			return 0, nil
+		}
+		handshake.greeted = true
+		return 2 + int(data[1]), nil
+	}
+
+	switch data[0] {
+	case socks5AuthVer:
+		// VER ULEN UNAME PLEN PASSWD
+		userEnd := 2 + int(data[1])
+		if len(data) < userEnd+1 || len(data) < userEnd+1+int(data[userEnd]) {
+			return 0, nil
+		}
+		return userEnd + 1 + int(data[userEnd]), nil
+	case socks5Version:
+		// VER CMD RSV ATYP DST.ADDR DST.PORT
+		if data[1] != socks5CmdConnect {
+			return 0, errNotSOCKS5
+		}
+		if len(data) < 5 {
+			return 0, nil
+		}
+		var host string
+		var end int
+		switch data[3] {
+		case socks5AddrIPv4:
+			end = 4 + net.IPv4len
+			if len(data) >= end {
+				host = net.IP(data[4:end]).String()
+			}
+		case socks5AddrIPv6:
+			end = 4 + net.IPv6len
+			if len(data) >= end {
+				host = net.IP(data[4:end]).String()
+			}
+		case socks5AddrDomain:
+			end = 5 + int(data[4])
+			if len(data) >= end {
+				host = string(data[5:end])
+			}
+		default:
+			return 0, errNotSOCKS5
+		}
+		if len(data) < end+2 {
+			return 0, nil
+		}
+		port := binary.BigEndian.Uint16(data[end:])
+		handshake.target = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		return end + 2, nil
+	}
+	return 0, errNotSOCKS5
+}
+
+// consume socks5 handshake bytes from packet. return packet with the data after handshake
+func (connection *TCPConnection) consumeSOCKS5(src Endpoint, tcp *layers.TCP) *layers.TCP {
+	handshake := connection.socks
+	up := connection.clientID.equals(src)
+	next, nextSet, done := &handshake.seq, &handshake.seqSet, handshake.target != ""
+	if !up {
+		next, nextSet, done = &handshake.serverSeq, &handshake.serverSeqSet, handshake.serverReplied
+	}
+	rest := socks5Unfed(*next, *nextSet, tcp.Seq, tcp.Payload)
+	if !done {
+		var err error
+		if up {
+			rest, err = handshake.feed(rest)
+		} else {
+			rest, err = handshake.feedServer(rest)
+		}
+		if err != nil {
+			// not socks5, or not a connect tunnel
+			connection.socks = nil
+			return tcp
+		}
+		// seq after the handshake bytes fed
+		*next = tcp.Seq + uint32(len(tcp.Payload)-len(rest))
+		*nextSet = true
+	}
+	var trimmed = *tcp
+	trimmed.Payload = rest
+	trimmed.Seq += uint32(len(tcp.Payload) - len(rest))
+	connection.socksTarget = handshake.target
+	if handshake.target != "" && handshake.serverReplied {
+		connection.socks = nil
+	}
+	return &trimmed
+}
+
+// report socks5 connect target of connection
+func (assembler *TCPAssembler) printSOCKS5(connection *TCPConnection, server Endpoint) {
+	client := connection.clientID.String()
+	if assembler.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":   "socks5",
+			"src":    client,
+			"dst":    server.String(),
+			"target": connection.socksTarget,
+		})
+		assembler.printer.send(string(data) + "\n")
+		return
+	}
+	assembler.printer.send(fmt.Sprintf("[socks5] %s -> %s target=%s\n", client, server.String(), connection.socksTarget))
+}
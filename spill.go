@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// spillBuffer queue stream packets between assembler and reader. when bytes hold in memory exceed threshold,
+// following packets payload are written to a temp file, and read back from the file by reader.
+type spillBuffer struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	threshold int    // max payload bytes hold in memory
+	dir       string // dir to create temp file, empty for the os default
+	memory    []*TCPPacket
+	memSize   int
+
+	file        *os.File
+	spilled     []spillSegment // segments in the file, not read yet
+	writeOffset int64
+	readOffset  int64
+
+	closed    bool // no more packets will be pushed
+	destroyed bool // reader closed, all packets discarded
+}
+
+// spillSegment is payload of one packet, saved in temp file, with the tcp header kept in memory
+type spillSegment struct {
+	length    int
+	header    layers.TCP
+	timestamp time.Time
+	number    int
+}
+
+func newSpillBuffer(threshold int, dir string) *spillBuffer {
+	buffer := &spillBuffer{threshold: threshold, dir: dir}
+	buffer.cond = sync.NewCond(&buffer.lock)
+	return buffer
+}
+
+// move all packets from channel to buffer, until the channel is closed
+func (buffer *spillBuffer) pump(c chan *TCPPacket) {
+	for packet := range c {
+		buffer.push(packet)
+	}
+	buffer.lock.Lock()
+	buffer.closed = true
+	buffer.cond.Broadcast()
+	buffer.lock.Unlock()
+}
+
+func (buffer *spillBuffer) push(packet *TCPPacket) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	if buffer.destroyed {
+		return
+	}
+	defer buffer.cond.Broadcast()
+	// once spilled, all packets go to file until it is drained, to keep the order
+	if len(buffer.spilled) == 0 && buffer.memSize+len(packet.Payload) <= buffer.threshold {
+		buffer.memory = append(buffer.memory, packet)
+		buffer.memSize += len(packet.Payload)
+		return
+	}
+	if err := buffer.spill(packet); err != nil {
+		logger.Warn("spill stream data to file error:", err)
+		if len(buffer.spilled) == 0 {
+			// keep in memory
+			buffer.memory = append(buffer.memory, packet)
+			buffer.memSize += len(packet.Payload)
+		}
+	}
+}
+
+func (buffer *spillBuffer) spill(packet *TCPPacket) error {
+	if buffer.file == nil {
+		file, err := ioutil.TempFile(buffer.dir, "httpdump-stream-")
+		if err != nil {
+			return err
+		}
+		buffer.file = file
+	}
+	if _, err := buffer.file.WriteAt(packet.Payload, buffer.writeOffset); err != nil {
+		return err
+	}
+	buffer.writeOffset += int64(len(packet.Payload))
+	buffer.spilled = append(buffer.spilled, spillSegment{len(packet.Payload), spillHeader(packet.TCP), packet.timestamp,
+		packet.number})
+	return nil
+}
+
+// copy of header fields of tcp, without references to the packet data, so the payload is not hold in memory
+func spillHeader(tcp *layers.TCP) layers.TCP {
+	header := *tcp
+	header.Contents, header.Payload = nil, nil
+	header.Options, header.Padding = nil, nil
+	for _, option := range tcp.Options {
+		option.OptionData = append([]byte(nil), option.OptionData...)
+		header.Options = append(header.Options, option)
+	}
+	return header
+}
+
+// pop next packet, block until there is one. return false if the buffer is closed and all packets are read
+func (buffer *spillBuffer) pop() (*TCPPacket, bool) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	for len(buffer.memory) == 0 && len(buffer.spilled) == 0 && !buffer.closed && !buffer.destroyed {
+		buffer.cond.Wait()
+	}
+	if len(buffer.memory) > 0 {
+		packet := buffer.memory[0]
+		buffer.memory[0] = nil
+		buffer.memory = buffer.memory[1:]
+		buffer.memSize -= len(packet.Payload)
+		return packet, true
+	}
+	if len(buffer.spilled) > 0 {
+		segment := buffer.spilled[0]
+		buffer.spilled = buffer.spilled[1:]
+		payload := make([]byte, segment.length)
+		if _, err := buffer.file.ReadAt(payload, buffer.readOffset); err != nil {
+			logger.Warn("read spilled stream data error:", err)
+			buffer.removeFile()
+			return nil, false
+		}
+		buffer.readOffset += int64(segment.length)
+		if len(buffer.spilled) == 0 {
+			// drained, reuse the file from start
+			buffer.readOffset, buffer.writeOffset = 0, 0
+			if err := buffer.file.Truncate(0); err != nil {
+				logger.Warn("truncate spill file error:", err)
+			}
+		}
+		header := segment.header
+		packet := &TCPPacket{TCP: &header, timestamp: segment.timestamp, number: segment.number}
+		packet.Payload = payload
+		return packet, true
+	}
+	buffer.removeFile()
+	return nil, false
+}
+
+// discard all packets, and remove the temp file
+func (buffer *spillBuffer) destroy() {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	buffer.destroyed = true
+	buffer.memory = nil
+	buffer.memSize = 0
+	buffer.spilled = nil
+	buffer.removeFile()
+	buffer.cond.Broadcast()
+}
+
+func (buffer *spillBuffer) removeFile() {
+	if buffer.file == nil {
+		return
+	}
+	buffer.file.Close()
+	if err := os.Remove(buffer.file.Name()); err != nil {
+		logger.Warn("remove spill file error:", err)
+	}
+	buffer.file = nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpillStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	stream := newNetworkStream()
+	stream.enableSpill(100, dir)
+	var expected string
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 50; i++ {
+		payload := strings.Repeat(string(rune('a'+i%26)), 30)
+		expected += payload
+		stream.c <- &TCPPacket{TCP: &layers.TCP{BaseLayer: layers.BaseLayer{Payload: []byte(payload)}},
+			timestamp: timestamp.Add(time.Duration(i) * time.Second)}
+	}
+	// wait pump move all packets to spill buffer
+	for len(stream.c) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files))
+	stream.finish()
+
+	data, err := ioutil.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(data))
+	assert.Equal(t, timestamp.Add(49*time.Second), stream.lastTimestamp)
+	files, _ = ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestSpillStreamClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	stream := newNetworkStream()
+	stream.enableSpill(10, dir)
+	stream.c <- &TCPPacket{TCP: &layers.TCP{BaseLayer: layers.BaseLayer{Payload: []byte("0123456789")}}}
+	stream.c <- &TCPPacket{TCP: &layers.TCP{BaseLayer: layers.BaseLayer{Payload: []byte("abcdefghij")}}}
+	for len(stream.c) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var p = make([]byte, 4)
+	n, err := stream.Read(p)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123", string(p[:n]))
+
+	stream.Close()
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+	stream.finish()
+}
+
+func TestSpillKeepHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	buffer := newSpillBuffer(0, dir)
+	data := []byte("0123456789")
+	buffer.push(&TCPPacket{TCP: &layers.TCP{BaseLayer: layers.BaseLayer{Contents: data[:4], Payload: data[4:]},
+		Seq: 1000, Ack: 2000, ACK: true, PSH: true, Window: 512,
+		Options: []layers.TCPOption{{OptionType: layers.TCPOptionKindTimestamps, OptionData: data[:2]}}}, number: 7})
+	copy(data, "abcdefghij")
+
+	packet, ok := buffer.pop()
+	assert.True(t, ok)
+	assert.Equal(t, "456789", string(packet.Payload))
+	assert.Equal(t, uint32(1000), packet.Seq)
+	assert.Equal(t, uint32(2000), packet.Ack)
+	assert.True(t, packet.ACK)
+	assert.True(t, packet.PSH)
+	assert.False(t, packet.FIN)
+	assert.Equal(t, uint16(512), packet.Window)
+	assert.Equal(t, "01", string(packet.Options[0].OptionData))
+	assert.Nil(t, packet.Contents)
+	assert.Equal(t, 7, packet.number)
+	buffer.destroy()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// rows inserted in one transaction
+const sqliteBatchSize = 500
+
+// time layout of timestamp columns, which sqlite date and time functions accept
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000"
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS exchanges (
+  id INTEGER PRIMARY KEY,
+  src TEXT NOT NULL,
+  dst TEXT NOT NULL,
+  exchange_index INTEGER NOT NULL,
+  method TEXT NOT NULL,
+  host TEXT NOT NULL,
+  url TEXT NOT NULL,
+  status INTEGER,
+  request_start TEXT,
+  request_end TEXT,
+  response_start TEXT,
+  response_end TEXT,
+  send REAL,
+  ttfb REAL,
+  receive REAL,
+  total REAL,
+  request_body_size INTEGER NOT NULL,
+  response_body_size INTEGER NOT NULL,
+  close_reason TEXT
+);
+CREATE INDEX IF NOT EXISTS exchanges_status ON exchanges (status);
+CREATE INDEX IF NOT EXISTS exchanges_host ON exchanges (host);
+CREATE INDEX IF NOT EXISTS exchanges_request_start ON exchanges (request_start);
+CREATE INDEX IF NOT EXISTS exchanges_ttfb ON exchanges (ttfb);
+`
+
+const sqliteInsert = "INSERT INTO exchanges (src, dst, exchange_index, method, host, url, status, request_start, " +
+	"request_end, response_start, response_end, send, ttfb, receive, total, request_body_size, " +
+	"response_body_size, close_reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// SQLiteSink insert exchange records to table exchanges of a sqlite database, for querying with sql.
+// Rows are inserted by a prepared statement in batched transactions.
+// Durations are in milliseconds: send for request sending, ttfb from request sent to the first response byte,
+// receive for response receiving, and total from request start to response end. Missing ones are null
+type SQLiteSink struct {
+	db       *sql.DB
+	insert   *sql.Stmt
+	tx       *sql.Tx
+	txInsert *sql.Stmt // insert of current transaction
+	lock     sync.Mutex
+	pending  int // rows inserted in current transaction
+	err      error
+}
+
+// open database file, which is created if not exists. Rows are appended if table exists
+func newSQLiteSink(path string) (*SQLiteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// one writer, statements of a transaction must be on the same connection anyway
+	db.SetMaxOpenConns(1)
+	sink := &SQLiteSink{db: db}
+	if _, err = db.Exec(sqliteSchema); err == nil {
+		if sink.insert, err = db.Prepare(sqliteInsert); err == nil {
+			err = sink.begin()
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *SQLiteSink) begin() error {
+	tx, err := sink.db.Begin()
+	if err != nil {
+		return err
+	}
+	sink.tx = tx
+	sink.txInsert = tx.Stmt(sink.insert)
+	return nil
+}
+
+// commit current transaction
+func (sink *SQLiteSink) commit() error {
+	sink.txInsert.Close()
+	sink.pending = 0
+	return sink.tx.Commit()
+}
+
+func (sink *SQLiteSink) write(exchange *Exchange) error {
+	values := insertValues(exchange)
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.err != nil {
+		return sink.err
+	}
+	if _, sink.err = sink.txInsert.Exec(values...); sink.err != nil {
+		return sink.err
+	}
+	sink.pending++
+	if sink.pending >= sqliteBatchSize {
+		if sink.err = sink.commit(); sink.err == nil {
+			sink.err = sink.begin()
+		}
+	}
+	return sink.err
+}
+
+// commit the last transaction, and close database
+func (sink *SQLiteSink) Close() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	err := sink.err
+	if err == nil {
+		err = sink.commit()
+	} else {
+		sink.tx.Rollback()
+	}
+	sink.insert.Close()
+	if closeErr := sink.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func insertValues(exchange *Exchange) []interface{} {
+	var status interface{}
+	if exchange.status != 0 {
+		// null if response is not captured
+		status = exchange.status
+	}
+	var closeReason interface{}
+	if exchange.closeReason != "" {
+		closeReason = exchange.closeReason
+	}
+	return []interface{}{
+		exchange.key.srcString(),
+		exchange.key.dstString(),
+		exchange.index,
+		exchange.method,
+		exchange.host,
+		exchange.url,
+		status,
+		sqliteTime(exchange.requestStart),
+		sqliteTime(exchange.requestEnd),
+		sqliteTime(exchange.responseStart),
+		sqliteTime(exchange.responseEnd),
+		sqliteDuration(exchange.requestStart, exchange.requestEnd),
+		sqliteDuration(exchange.requestEnd, exchange.responseStart),
+		sqliteDuration(exchange.responseStart, exchange.responseEnd),
+		sqliteDuration(exchange.requestStart, exchange.responseEnd),
+		exchange.requestBodySize,
+		exchange.responseBodySize,
+		closeReason,
+	}
+}
+
+// time as text, or null if missing
+func sqliteTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// milliseconds from start to end, null if either is missing
+func sqliteDuration(start time.Time, end time.Time) interface{} {
+	if start.IsZero() || end.IsZero() {
+		return nil
+	}
+	return float64(end.Sub(start)) / float64(time.Millisecond)
+}
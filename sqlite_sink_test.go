@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// run a query, return rows of | separated columns. Nulls are empty
+func sqliteQuery(t *testing.T, path string, query string) []string {
+	db, err := sql.Open("sqlite", path)
+	assert.Nil(t, err)
+	defer db.Close()
+	rows, err := db.Query(query)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	var result []string
+	for rows.Next() {
+		var values = make([]interface{}, len(columns))
+		var pointers = make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		assert.Nil(t, rows.Scan(pointers...))
+		var fields []string
+		for _, value := range values {
+			if value == nil {
+				fields = append(fields, "")
+			} else {
+				fields = append(fields, fmt.Sprint(value))
+			}
+		}
+		result = append(result, strings.Join(fields, "|"))
+	}
+	assert.Nil(t, rows.Err())
+	return result
+}
+
+func TestSQLiteSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "records.db")
+
+	sink, err := newSQLiteSink(path)
+	assert.Nil(t, err)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"10.0.0.2", 80}}
+	for i, status := range []int{200, 503, 500} {
+		requestStart := start.Add(time.Duration(i) * time.Second)
+		assert.Nil(t, sink.write(&Exchange{key: key, index: i + 1, method: "GET", host: "example.com",
+			url: "/items?name='a'", status: status, requestStart: requestStart,
+			requestEnd:    requestStart.Add(time.Millisecond),
+			responseStart: requestStart.Add(time.Duration(i+1) * 100 * time.Millisecond),
+			responseEnd:   requestStart.Add(time.Second), responseBodySize: int64(100 * i)}))
+	}
+	// without response
+	assert.Nil(t, sink.write(&Exchange{key: key, index: 4, method: "POST", url: "/upload", requestStart: start,
+		requestBodySize: 10, closeReason: closeByRST}))
+	assert.Nil(t, sink.Close())
+
+	indexes := sqliteQuery(t, path, "SELECT name FROM sqlite_master WHERE type = 'index' ORDER BY name")
+	assert.Equal(t, []string{"exchanges_host", "exchanges_request_start", "exchanges_status", "exchanges_ttfb"},
+		indexes)
+	assert.Equal(t, []string{
+		"3|500|/items?name='a'|299|200",
+		"2|503|/items?name='a'|199|100",
+	}, sqliteQuery(t, path, "SELECT exchange_index, status, url, ttfb, response_body_size FROM exchanges "+
+		"WHERE status >= 500 ORDER BY ttfb DESC"))
+	assert.Equal(t, []string{"2018-01-01 00:00:01.000000|2018-01-01 00:00:01.001000|1|1000"},
+		sqliteQuery(t, path, "SELECT request_start, request_end, send, total FROM exchanges WHERE exchange_index = 2"))
+	assert.Equal(t, []string{"POST||1|10|rst"}, sqliteQuery(t, path, "SELECT method, host, status IS NULL, "+
+		"request_body_size, close_reason FROM exchanges WHERE ttfb IS NULL"))
+
+	// rows are appended to existing table
+	sink, err = newSQLiteSink(path)
+	assert.Nil(t, err)
+	assert.Nil(t, sink.write(&Exchange{key: key, index: 1, method: "GET", url: "/", requestStart: start}))
+	assert.Nil(t, sink.Close())
+	assert.Equal(t, []string{"5"}, sqliteQuery(t, path, "SELECT count(*) FROM exchanges"))
+}
+
+func TestSQLiteSinkBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "records.db")
+
+	sink, err := newSQLiteSink(path)
+	assert.Nil(t, err)
+	for i := 0; i < sqliteBatchSize+10; i++ {
+		assert.Nil(t, sink.write(&Exchange{index: i + 1, method: "GET", url: "/", status: 200}))
+	}
+	assert.Equal(t, 10, sink.pending)
+	assert.Nil(t, sink.Close())
+	assert.Equal(t, []string{"510"}, sqliteQuery(t, path, "SELECT count(*) FROM exchanges"))
+}
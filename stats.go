@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// CaptureStats count packets, bytes, connections, exchanges and drops of capture.
+// Counters are updated with atomic operations, so reading them does not block the packet path
+type CaptureStats struct {
+	packets   int64
+	exchanges int64
+	dropped   int64
+	// tcp payload bytes, and connections created
+	bytes       int64
+	connections int64
+}
+
+func (stats *CaptureStats) addPackets(n int64) {
+	atomic.AddInt64(&stats.packets, n)
+}
+
+func (stats *CaptureStats) addExchanges(n int64) {
+	atomic.AddInt64(&stats.exchanges, n)
+}
+
+func (stats *CaptureStats) addDropped(n int64) {
+	atomic.AddInt64(&stats.dropped, n)
+}
+
+func (stats *CaptureStats) addBytes(n int64) {
+	atomic.AddInt64(&stats.bytes, n)
+}
+
+func (stats *CaptureStats) addConnections(n int64) {
+	atomic.AddInt64(&stats.connections, n)
+}
+
+// ExchangeLimit stop capture after a number of exchanges are emitted. It is shared by all connection goroutines
+type ExchangeLimit struct {
+	limit   int64
+	emitted int64
+	done    chan struct{} // closed when limit is reached
+}
+
+func newExchangeLimit(limit int64) *ExchangeLimit {
+	return &ExchangeLimit{limit: limit, done: make(chan struct{})}
+}
+
+// take one exchange from the limit, return false if limit already reached and exchange should not be emitted
+func (limit *ExchangeLimit) take() bool {
+	emitted := atomic.AddInt64(&limit.emitted, 1)
+	if emitted == limit.limit {
+		close(limit.done)
+	}
+	return emitted <= limit.limit
+}
+
+// status line of current stats
+func (stats *CaptureStats) line(connections int) string {
+	return fmt.Sprintf("[heartbeat] %s packets=%d connections=%d exchanges=%d dropped=%d\n",
+		time.Now().Format("2006-01-02 15:04:05"), atomic.LoadInt64(&stats.packets), connections,
+		atomic.LoadInt64(&stats.exchanges), atomic.LoadInt64(&stats.dropped))
+}
+
+// write a status line of assembler stats to w every interval, independent of traffic, until stop is closed
+func runHeartbeat(assembler *TCPAssembler, interval time.Duration, w io.Writer, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			io.WriteString(w, assembler.stats.line(assembler.activeConnections()))
+		case <-stop:
+			return
+		}
+	}
+}
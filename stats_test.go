@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// send each write as a line to channel
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestHeartbeat(t *testing.T) {
+	assembler, _ := newTestAssembler()
+	assembler.stats = &CaptureStats{}
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, "GET / HTTP/1.1\r\n\r\n"), time.Now())
+	assembler.stats.addExchanges(1)
+
+	lines := make(lineWriter, 100)
+	stop := make(chan struct{})
+	go runHeartbeat(assembler, 10*time.Millisecond, lines, stop)
+	defer close(stop)
+
+	select {
+	case line := <-lines:
+		assert.True(t, strings.HasPrefix(line, "[heartbeat] "))
+		assert.True(t, strings.HasSuffix(line, "packets=1 connections=1 exchanges=1 dropped=0\n"), line)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no heartbeat line")
+	}
+}
+
+func TestExchangeLimit(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.limit = newExchangeLimit(5)
+	assembler := newTCPAssembler(handler, handler.printer)
+
+	// exchanges on concurrent connections, the packet channel is kept open as live capture
+	packets := make(chan *tcpSegment, 100)
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+	for i := 0; i < 8; i++ {
+		port := layers.TCPPort(50000 + i)
+		packets <- &tcpSegment{flow: testClientFlow, tcp: &layers.TCP{SrcPort: port, DstPort: 80, Seq: 1000, Ack: 5000,
+			ACK: true, BaseLayer: layers.BaseLayer{Payload: []byte(request)}}, timestamp: time.Now()}
+		packets <- &tcpSegment{flow: testServerFlow, tcp: &layers.TCP{SrcPort: 80, DstPort: port, Seq: 5000,
+			Ack: 1000 + uint32(len(request)), ACK: true, BaseLayer: layers.BaseLayer{Payload: []byte(response)}},
+			timestamp: time.Now()}
+		packets <- &tcpSegment{flow: testClientFlow, tcp: &layers.TCP{SrcPort: port, DstPort: 80,
+			Seq: 1000 + uint32(len(request)), Ack: 5000 + uint32(len(response)), ACK: true}, timestamp: time.Now()}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		capture(packets, assembler, time.Minute, handler.limit.done)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "capture not stopped after exchange limit reached")
+		return
+	}
+	assembler.finishAll()
+	waitGroup.Wait()
+	assert.Equal(t, 5, len(sink.exchanges))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StatusFilter match exchanges by response status class(1xx - 5xx)
+type StatusFilter struct {
+	classes    [6]bool // index 1 - 5 for status classes
+	noResponse bool    // if match exchanges whose response is not captured
+}
+
+// parse status classes like "4xx,5xx"
+func parseStatusFilter(value string, noResponse bool) (*StatusFilter, error) {
+	filter := &StatusFilter{noResponse: noResponse}
+	for _, class := range strings.Split(value, ",") {
+		class = strings.ToLower(strings.TrimSpace(class))
+		if class == "" {
+			continue
+		}
+		if len(class) != 3 || class[1:] != "xx" || class[0] < '1' || class[0] > '5' {
+			return nil, fmt.Errorf("invalid status class: %s", class)
+		}
+		filter.classes[class[0]-'0'] = true
+	}
+	return filter, nil
+}
+
+// if exchange with the response status should be output. status 0 for response not captured
+func (filter *StatusFilter) match(status int) bool {
+	if filter == nil {
+		return true
+	}
+	class := statusClass(status)
+	if class == 0 {
+		return filter.noResponse
+	}
+	return filter.classes[class]
+}
+
+// return 1 - 5 for status class, 0 for no response or invalid status
+func statusClass(status int) int {
+	class := status / 100
+	if class < 1 || class > 5 {
+		return 0
+	}
+	return class
+}
+
+// StatusCounter count exchanges by response status class
+type StatusCounter struct {
+	lock   sync.Mutex
+	counts [6]int // index 0 for no response
+}
+
+func (counter *StatusCounter) count(status int) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	counter.counts[statusClass(status)]++
+}
+
+// UnpairedCounter count requests discarded because no response is captured
+type UnpairedCounter struct {
+	lock  sync.Mutex
+	count int
+}
+
+func (counter *UnpairedCounter) add() {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	counter.count++
+}
+
+func (counter *UnpairedCounter) format(format string) string {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{"type": "unpaired", "discarded": counter.count})
+		return string(data) + "\n"
+	}
+	return "[unpaired] " + strconv.Itoa(counter.count) + " requests discarded without response\n"
+}
+
+func (counter *StatusCounter) format(format string) string {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	if format == "json" {
+		var record = map[string]interface{}{"type": "status", "noResponse": counter.counts[0]}
+		for class := 1; class <= 5; class++ {
+			record[strconv.Itoa(class)+"xx"] = counter.counts[class]
+		}
+		data, _ := json.Marshal(record)
+		return string(data) + "\n"
+	}
+	var fields = []string{"[status]"}
+	for class := 1; class <= 5; class++ {
+		fields = append(fields, strconv.Itoa(class)+"xx="+strconv.Itoa(counter.counts[class]))
+	}
+	fields = append(fields, "no-response="+strconv.Itoa(counter.counts[0]))
+	return strings.Join(fields, " ") + "\n"
+}
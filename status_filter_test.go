@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func statusExchange(path string, status string) []testSegment {
+	return []testSegment{
+		{up: true, payload: "GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{up: false, payload: "HTTP/1.1 " + status + "\r\nContent-Length: 0\r\n\r\n"},
+	}
+}
+
+func TestStatusFilter(t *testing.T) {
+	var segments []testSegment
+	segments = append(segments, statusExchange("/ok", "200 OK")...)
+	segments = append(segments, statusExchange("/missing", "404 Not Found")...)
+	segments = append(segments, statusExchange("/moved", "302 Found")...)
+	segments = append(segments, statusExchange("/error", "500 Internal Server Error")...)
+	segments = append(segments, statusExchange("/ok2", "200 OK")...)
+	segments = append(segments, testSegment{up: true, payload: "GET /pending HTTP/1.1\r\nHost: example.com\r\n\r\n"})
+
+	filter, err := parseStatusFilter("4xx, 5xx", false)
+	assert.Nil(t, err)
+	handler, sink := newTestHTTPHandler(&Config{statusFilter: filter})
+	handler.statusCounter = &StatusCounter{}
+	runConversation(handler, segments)
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, "/missing", sink.exchanges[0].url)
+	assert.Equal(t, "/error", sink.exchanges[1].url)
+	assert.Equal(t, "[status] 1xx=0 2xx=2 3xx=1 4xx=1 5xx=1 no-response=1\n", handler.statusCounter.format("text"))
+
+	// include exchange without response
+	filter, _ = parseStatusFilter("5xx", true)
+	handler, sink = newTestHTTPHandler(&Config{statusFilter: filter})
+	runConversation(handler, segments)
+	assert.Equal(t, 2, len(sink.exchanges))
+	assert.Equal(t, "/error", sink.exchanges[0].url)
+	assert.Equal(t, "/pending", sink.exchanges[1].url)
+	assert.Equal(t, 0, sink.exchanges[1].status)
+
+	// exchange without response discarded as unpaired is not counted by status
+	handler, _ = newTestHTTPHandler(&Config{})
+	handler.statusCounter = &StatusCounter{}
+	handler.unpaired = &UnpairedCounter{}
+	runConversation(handler, segments)
+	assert.Equal(t, "[status] 1xx=0 2xx=2 3xx=1 4xx=1 5xx=1 no-response=0\n", handler.statusCounter.format("text"))
+	assert.Equal(t, 1, handler.unpaired.count)
+
+	_, err = parseStatusFilter("6xx", false)
+	assert.NotNil(t, err)
+}
@@ -2,8 +2,13 @@ package main
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,9 +21,6 @@ import (
 // gopacket provide a tcp connection, however it split one tcp connection into two stream.
 // So it is hard to match http request and response. we make our own connection here
 
-const maxTCPSeq uint32 = 0xFFFFFFFF
-const tcpSeqWindow = 0x0000FFFF
-
 // TCPAssembler do tcp package assemble
 type TCPAssembler struct {
 	connectionDict    map[string]*TCPConnection
@@ -26,7 +28,40 @@ type TCPAssembler struct {
 	connectionHandler ConnectionHandler
 	filterIP          string
 	filterPort        uint16
+	cidrFilter        *CIDRFilter // nil for not filtering by ip ranges
+	format            string
+	maxLifetime       time.Duration // max lifetime since connection created, 0 for unlimited
+	dumpNonHTTP       int           // dump leading bytes of non-http connections when closed, 0 for disabled
+	maxWindow         int           // max segments held in receive window, 0 for unlimited
+	spillThreshold    int           // spill stream data to disk when buffered bytes exceed this, 0 for disabled
+	spillDir          string        // dir for spill files, empty for os default temp dir
 	printer           *Printer
+
+	// endpoint on these ports is always treated as server
+	serverPorts map[uint16]bool
+	// finalize connections on filter port or server ports carried this many payload bytes without http detected,
+	// 0 for disabled
+	rejectNonHTTP int
+	// detect and skip socks5 handshake, then parse the tunneled traffic
+	socks5 bool
+	// HTTP/0.9 simple requests also start http connections
+	http09 bool
+	// capture has only one direction of connections, data is delivered without ACKs
+	unidirectional bool
+	// connection summaries are output instead of exchanges, timing lines of exchanges are not printed
+	summaryOnly bool
+	// resolve overlapping segments with conflicting content
+	overlapPolicy OverlapPolicy
+	// how request starts on client stream are found
+	requestBoundary RequestBoundary
+	// capture file name, packet references are added to error and drop records if set
+	captureFile string
+	// nil for not collecting stats
+	stats *CaptureStats
+	// nil for not reporting connection throughput
+	throughput *ThroughputReporter
+	// record names resolved by captured dns messages, nil for ignoring dns messages
+	dns *DNSResolver
 }
 
 type TsInfo struct {
@@ -40,6 +75,10 @@ type TsInfo struct {
 	rep2        time.Time
 	repLen      int
 	id          string
+	// syn options of the connection
+	clientOptions *TCPOptions
+	serverOptions *TCPOptions
+	rtt           time.Duration // by tcp timestamps echoes, 0 if not available
 }
 
 var gTsInfo map[string]TsInfo = map[string]TsInfo{}
@@ -49,8 +88,23 @@ func newTCPAssembler(connectionHandler ConnectionHandler, p *Printer) *TCPAssemb
 }
 
 func (assembler *TCPAssembler) assemble(flow gopacket.Flow, tcp *layers.TCP, timestamp time.Time) {
+	assembler.assemblePacket(flow, tcp, timestamp, 0)
+}
+
+// assemble a packet with its 1-based number in capture, 0 if unknown
+func (assembler *TCPAssembler) assemblePacket(flow gopacket.Flow, tcp *layers.TCP, timestamp time.Time, number int) {
+	assembler.assembleIPPacket(flow, nil, tcp, timestamp, number)
+}
+
+// assemble a packet with its ip header fields, nil if unknown
+func (assembler *TCPAssembler) assembleIPPacket(flow gopacket.Flow, ip *ipFields, tcp *layers.TCP, timestamp time.Time,
+	number int) {
 	src := Endpoint{ip: flow.Src().String(), port: uint16(tcp.SrcPort)}
 	dst := Endpoint{ip: flow.Dst().String(), port: uint16(tcp.DstPort)}
+	if assembler.stats != nil {
+		assembler.stats.addPackets(1)
+		assembler.stats.addBytes(int64(len(tcp.Payload)))
+	}
 	dropped := false
 	if assembler.filterIP != "" {
 		if src.ip != assembler.filterIP && dst.ip != assembler.filterIP {
@@ -62,6 +116,9 @@ func (assembler *TCPAssembler) assemble(flow gopacket.Flow, tcp *layers.TCP, tim
 			dropped = true
 		}
 	}
+	if !assembler.cidrFilter.match(flow.Src().Raw(), flow.Dst().Raw()) {
+		dropped = true
+	}
 	if dropped {
 		return
 	}
@@ -75,18 +132,62 @@ func (assembler *TCPAssembler) assemble(flow gopacket.Flow, tcp *layers.TCP, tim
 		key = dstString + "-" + srcString
 	}
 
-	var createNewConn = tcp.SYN && !tcp.ACK || isHTTPRequestData(tcp.Payload)
+	// packets from known server ports never create connection, so the creator is the client
+	var createNewConn = (tcp.SYN && !tcp.ACK || isHTTPRequestData(tcp.Payload) ||
+		assembler.socks5 && isSOCKS5Greeting(tcp.Payload) || assembler.http09 && isHTTP09Request(tcp.Payload)) &&
+		!assembler.isServer(src, dst)
 	connection := assembler.retrieveConnection(src, dst, key, createNewConn)
 	if connection == nil {
 		return
 	}
 
+	droppedSegments := connection.droppedSegments()
+	connection.packetNumber = number
 	connection.onReceive(src, dst, tcp, timestamp, assembler.PrintTsInfo)
+	if assembler.stats != nil {
+		assembler.stats.addDropped(int64(connection.droppedSegments() - droppedSegments))
+	}
+	connection.updateInfo(src, ip, tcp, timestamp)
+	assembler.notifyLifecycle(connection)
+	if connection.socksTarget != "" && !connection.socksReported {
+		connection.socksReported = true
+		assembler.printSOCKS5(connection, dst)
+	}
+
+	if assembler.rejectNonHTTP > 0 && !connection.isHTTP && connection.nonHTTPBytes >= assembler.rejectNonHTTP &&
+		assembler.expectsHTTP(src, dst) {
+		assembler.rejectConnection(connection, src, dst)
+		return
+	}
 
 	if connection.closed() {
-		assembler.PrintTsInfo(connection.key)
+		if tcp.RST {
+			assembler.endConnection(connection, closeByRST)
+		} else {
+			assembler.endConnection(connection, closeByFIN)
+		}
+		if connection.isHTTP {
+			assembler.PrintTsInfo(connection.key)
+		}
 		assembler.deleteConnection(key)
 		connection.finish()
+	} else if assembler.maxLifetime > 0 && timestamp.Sub(connection.createTimestamp) >= assembler.maxLifetime {
+		// long lived connection, finalize it even if it is still active
+		assembler.endConnection(connection, closeByLifetime)
+		assembler.PrintTsInfo(connection.key)
+		assembler.deleteConnection(key)
+		delete(gTsInfo, connection.key)
+		connection.flushOlderThan()
+	}
+}
+
+// set close reason, and report drops, losses and throughput of connection, whichever way it ends
+func (assembler *TCPAssembler) endConnection(connection *TCPConnection, reason string) {
+	connection.setCloseReason(reason)
+	assembler.printDropped(connection)
+	assembler.reportThroughput(connection)
+	if !connection.isHTTP {
+		assembler.printNonHTTP(connection)
 	}
 }
 
@@ -98,7 +199,33 @@ func (assembler *TCPAssembler) retrieveConnection(src, dst Endpoint, key string,
 	if connection == nil {
 		if init {
 			connection = newTCPConnection(key)
+			connection.info = ConnectionInfo{Key: key, Client: src.String(), Server: dst.String(), State: "open"}
+			connection.leadingLimit = assembler.dumpNonHTTP
+			if assembler.isServer(dst, src) {
+				// direction is known by server port, not by the first packet
+				connection.clientID = src
+				connection.clientFixed = true
+			}
+			if assembler.socks5 {
+				connection.socks = &socks5Handshake{}
+				connection.clientID = src
+			}
+			connection.upStream.window.maxSize = assembler.maxWindow
+			connection.downStream.window.maxSize = assembler.maxWindow
+			connection.upStream.window.overlapPolicy = assembler.overlapPolicy
+			connection.downStream.window.overlapPolicy = assembler.overlapPolicy
+			connection.requests.boundary = assembler.requestBoundary
+			connection.http09 = assembler.http09
+			connection.upStream.unidirectional = assembler.unidirectional
+			connection.downStream.unidirectional = assembler.unidirectional
+			if assembler.spillThreshold > 0 {
+				connection.upStream.enableSpill(assembler.spillThreshold, assembler.spillDir)
+				connection.downStream.enableSpill(assembler.spillThreshold, assembler.spillDir)
+			}
 			assembler.connectionDict[key] = connection
+			if assembler.stats != nil {
+				assembler.stats.addConnections(1)
+			}
 			assembler.connectionHandler.handle(src, dst, connection)
 		}
 	}
@@ -106,6 +233,98 @@ func (assembler *TCPAssembler) retrieveConnection(src, dst Endpoint, key string,
 	return connection
 }
 
+// call lifecycle callbacks for events not notified yet
+func (assembler *TCPAssembler) notifyLifecycle(connection *TCPConnection) {
+	handler, ok := assembler.connectionHandler.(ConnectionLifecycleHandler)
+	if !ok {
+		return
+	}
+	if !connection.establishNotified && (connection.established || connection.isHTTP) {
+		connection.establishNotified = true
+		handler.OnEstablished(connection)
+	}
+	if !connection.httpNotified && connection.isHTTP {
+		connection.httpNotified = true
+		handler.OnHTTPDetected(connection)
+	}
+	if !connection.halfCloseNotified && !connection.closed() &&
+		(connection.upStream.closed || connection.downStream.closed) {
+		connection.halfCloseNotified = true
+		handler.OnHalfClosed(connection, connection.upStream.closed)
+	}
+}
+
+// if connection between endpoints is expected to be http, since it is on the port filtered to or a server port
+func (assembler *TCPAssembler) expectsHTTP(src Endpoint, dst Endpoint) bool {
+	return assembler.expectedPort(src.port) || assembler.expectedPort(dst.port)
+}
+
+// finalize connection expected to be http but never detected as http, without waiting it to close or idle.
+// Following packets of it are dropped, as they do not create connection
+func (assembler *TCPAssembler) rejectConnection(connection *TCPConnection, src Endpoint, dst Endpoint) {
+	port := dst.port
+	if assembler.expectedPort(src.port) && !assembler.expectedPort(dst.port) {
+		port = src.port
+	}
+	info := connection.snapshot()
+	if assembler.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":   "not-http",
+			"key":    connection.key,
+			"port":   port,
+			"bytes":  connection.nonHTTPBytes,
+			"scheme": info.Scheme,
+		})
+		assembler.printer.send(string(data) + "\n")
+	} else {
+		var fields = []string{"[not-http]", connection.key, "port=" + strconv.Itoa(int(port)),
+			"bytes=" + strconv.Itoa(connection.nonHTTPBytes)}
+		if info.Scheme == "https" {
+			fields = append(fields, "tls")
+		}
+		assembler.printer.send(strings.Join(fields, " ") + "\n")
+	}
+	assembler.endConnection(connection, closeByNotHTTP)
+	assembler.deleteConnection(connection.key)
+	connection.finish()
+}
+
+// if port is the filter port or a server port
+func (assembler *TCPAssembler) expectedPort(port uint16) bool {
+	return assembler.filterPort != 0 && port == assembler.filterPort || assembler.serverPorts[port]
+}
+
+// if endpoint is the server of connection, known by server ports
+func (assembler *TCPAssembler) isServer(endpoint Endpoint, peer Endpoint) bool {
+	return assembler.serverPorts[endpoint.port] && !assembler.serverPorts[peer.port]
+}
+
+// Snapshot return info of all active connections, ordered by key. It is safe to call while capturing
+func (assembler *TCPAssembler) Snapshot() []ConnectionInfo {
+	assembler.lock.Lock()
+	var connections = make([]*TCPConnection, 0, len(assembler.connectionDict))
+	for _, connection := range assembler.connectionDict {
+		connections = append(connections, connection)
+	}
+	assembler.lock.Unlock()
+
+	var infos = make([]ConnectionInfo, 0, len(connections))
+	for _, connection := range connections {
+		infos = append(infos, connection.snapshot())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+	return infos
+}
+
+// count of connections tracked now
+func (assembler *TCPAssembler) activeConnections() int {
+	assembler.lock.Lock()
+	defer assembler.lock.Unlock()
+	return len(assembler.connectionDict)
+}
+
 // remove connection (when is closed or timeout)
 func (assembler *TCPAssembler) deleteConnection(key string) {
 	assembler.lock.Lock()
@@ -128,6 +347,7 @@ func (assembler *TCPAssembler) flushOlderThan(time time.Time) {
 	assembler.lock.Unlock()
 
 	for _, connection := range connections {
+		assembler.endConnection(connection, closeByIdle)
 		connection.flushOlderThan()
 	}
 }
@@ -136,6 +356,10 @@ func (assembler *TCPAssembler) finishAll() {
 	assembler.lock.Lock()
 	defer assembler.lock.Unlock()
 	for _, connection := range assembler.connectionDict {
+		// in-flight data not acked yet
+		connection.upStream.flushWindow()
+		connection.downStream.flushWindow()
+		assembler.endConnection(connection, closeByCaptureEnd)
 		connection.finish()
 	}
 	assembler.connectionDict = nil
@@ -148,14 +372,148 @@ type ConnectionHandler interface {
 	finish()
 }
 
+// ConnectionLifecycleHandler can be optionally implemented by ConnectionHandler, to be notified of connection events.
+// Callbacks are called in the assembler goroutine, should not block
+type ConnectionLifecycleHandler interface {
+	// tcp handshake completed. If handshake is not captured, called right before OnHTTPDetected
+	OnEstablished(connection *TCPConnection)
+	// first http request data seen
+	OnHTTPDetected(connection *TCPConnection)
+	// one side sent FIN while the other side is still open. client is true if client closed its direction
+	OnHalfClosed(connection *TCPConnection, client bool)
+}
+
 // TCPConnection hold info for one tcp connection
 type TCPConnection struct {
-	upStream      *NetworkStream // stream from client to server
-	downStream    *NetworkStream // stream from server to client
-	clientID      Endpoint       // the client key(by ip and port)
-	lastTimestamp time.Time      // timestamp receive last packet
-	isHTTP        bool
-	key           string
+	upStream        *NetworkStream // stream from client to server
+	downStream      *NetworkStream // stream from server to client
+	clientID        Endpoint       // the client key(by ip and port)
+	clientFixed     bool           // client is known by server ports, should not be changed
+	synAcked        bool           // SYN-ACK received
+	established     bool           // tcp handshake completed
+	createTimestamp time.Time      // timestamp receive first packet
+	lastTimestamp   time.Time      // timestamp receive last packet
+	isHTTP          bool
+	key             string
+	leadingBytes    []byte // leading client data of connection not detected as http yet
+	leadingLimit    int
+	nonHTTPBytes    int         // payload bytes of both directions received before detected as http
+	clientOptions   *TCPOptions // options of client SYN, nil if SYN not captured
+	serverOptions   *TCPOptions // options of server SYN-ACK, nil if SYN-ACK not captured
+	info            ConnectionInfo
+	infoLock        sync.Mutex // guard info, which is read by other goroutines
+	// lifecycle events already notified
+	establishNotified bool
+	httpNotified      bool
+	halfCloseNotified bool
+	// socks5 handshake in progress, nil if not socks5 or handshake completed
+	socks         *socks5Handshake
+	socksTarget   string // target of socks5 connect request
+	socksReported bool
+	// response boundary of downStream for timing info, so a body which contains "HTTP/1.1 200" at
+	// a segment start is not taken as a new response
+	pendingMethods []string       // methods of requests whose response not started yet
+	replyRemaining int64          // body bytes of current response not received, -1 if length unknown
+	requests       requestScanner // request starts of upStream
+	rtt            rttEstimator
+	keepAlive      keepAliveTracker
+	intervals      intervalTracker
+	progress       dataProgress
+	schemeChecked  bool // scheme is inferred from the first payload
+	alpnChecked    bool // alpn, tls version and cipher are parsed from the first payload of server
+	http09         bool // HTTP/0.9 simple request also starts http data
+	packetNumber   int  // number in capture of the packet being received, 0 if unknown
+}
+
+// ConnectionInfo is a point-in-time state of a connection
+type ConnectionInfo struct {
+	Key         string
+	Client      string // ip:port of the endpoint sent the first captured packet
+	Server      string
+	HTTP        bool
+	UpBytes     int64         // payload bytes from client to server
+	DownBytes   int64         // payload bytes from server to client
+	State       string        // open | client-closed | server-closed | closed
+	CloseReason string        // fin | rst | idle | max-lifetime | capture-end | not-http, empty if not closed
+	RTT         time.Duration // estimated by tcp timestamps option echoes, 0 if not available
+	// segments of both directions, keep-alive probes and their ACKs are not counted as data
+	DataSegments  int64
+	KeepAlives    int64
+	KeepAliveAcks int64
+	Scheme        string // http or https by the first payload, regardless of port. empty if unknown
+	ALPN          string // protocol selected by server in tls ServerHello, e.g. h2. empty if not negotiated
+	// negotiated tls version and cipher suite in ServerHello, e.g. TLS 1.3 and TLS_AES_128_GCM_SHA256.
+	// empty if ServerHello is not captured
+	TLSVersion  string
+	CipherSuite string
+	Handshake   bool // SYN, SYN-ACK and the last ACK of tcp handshake are captured
+	// inter-arrival times of data segments of both directions
+	Intervals IntervalStats
+	// ip layer metadata of packets sent by client and by server
+	ClientIP     IPMetadata
+	ServerIP     IPMetadata
+	Created      time.Time
+	LastActivity time.Time
+}
+
+// reasons of connection close
+const (
+	closeByFIN        = "fin"          // both sides sent FIN
+	closeByRST        = "rst"          // aborted by RST
+	closeByIdle       = "idle"         // flushed for no activity
+	closeByLifetime   = "max-lifetime" // exceeded max lifetime
+	closeByCaptureEnd = "capture-end"  // still open when capture ends
+	closeByNotHTTP    = "not-http"     // finalized since http is expected but not detected
+)
+
+// scheme inferred from the first payload of connection
+func (connection *TCPConnection) scheme() string {
+	connection.infoLock.Lock()
+	defer connection.infoLock.Unlock()
+	return connection.info.Scheme
+}
+
+// set the reason connection closed, if not set yet
+func (connection *TCPConnection) setCloseReason(reason string) {
+	connection.infoLock.Lock()
+	defer connection.infoLock.Unlock()
+	if connection.info.CloseReason == "" {
+		connection.info.CloseReason = reason
+	}
+}
+
+// the reason connection closed, empty if not closed
+func (connection *TCPConnection) closeReason() string {
+	connection.infoLock.Lock()
+	defer connection.infoLock.Unlock()
+	return connection.info.CloseReason
+}
+
+// TCPOptions is the options negotiated by SYN packet
+type TCPOptions struct {
+	MSS           uint16 `json:"mss"`         // 0 if absent
+	WindowScale   int    `json:"windowScale"` // shift count, -1 if absent(window scaling not enabled)
+	SACKPermitted bool   `json:"sackPermitted"`
+}
+
+// parse options from SYN/SYN-ACK packet
+func parseTCPOptions(tcp *layers.TCP) *TCPOptions {
+	options := &TCPOptions{WindowScale: -1}
+	for _, option := range tcp.Options {
+		switch option.OptionType {
+		case layers.TCPOptionKindMSS:
+			if len(option.OptionData) >= 2 {
+				options.MSS = binary.BigEndian.Uint16(option.OptionData)
+			}
+		case layers.TCPOptionKindWindowScale:
+			if len(option.OptionData) >= 1 {
+				options.WindowScale = int(option.OptionData[0])
+			}
+		case layers.TCPOptionKindSACKPermitted:
+			options.SACKPermitted = true
+		}
+	}
+	return options
 }
 
 // Endpoint is one endpoint of a tcp connection
@@ -168,8 +526,9 @@ func (p Endpoint) equals(p2 Endpoint) bool {
 	return p.ip == p2.ip && p.port == p2.port
 }
 
+// ip:port, ipv6 ip is bracketed as [ip]:port
 func (p Endpoint) String() string {
-	return p.ip + ":" + strconv.Itoa(int(p.port))
+	return net.JoinHostPort(p.ip, strconv.Itoa(int(p.port)))
 }
 
 // ConnectionID identify a tcp connection
@@ -190,12 +549,57 @@ func newTCPConnection(key string) *TCPConnection {
 
 // when receive tcp packet
 func (connection *TCPConnection) onReceive(src, dst Endpoint, tcp *layers.TCP, timestamp time.Time, pFunc func(string)) {
+	if connection.createTimestamp.IsZero() {
+		connection.createTimestamp = timestamp
+	}
 	connection.lastTimestamp = timestamp
 	payload := tcp.Payload
+	if tcp.SYN {
+		if tcp.ACK {
+			connection.serverOptions = parseTCPOptions(tcp)
+			connection.synAcked = true
+		} else {
+			connection.clientOptions = parseTCPOptions(tcp)
+		}
+	} else if tcp.ACK && connection.synAcked && connection.clientID.equals(src) {
+		// the last ACK of handshake
+		connection.established = true
+	}
+	if connection.rtt.track(src, tcp, timestamp) {
+		if info, ok := gTsInfo[connection.key]; ok {
+			info.rtt = connection.rtt.rtt()
+			gTsInfo[connection.key] = info
+		}
+	}
+	kind := connection.keepAlive.track(src, tcp)
+	if kind == segmentData {
+		connection.intervals.add(timestamp)
+	}
+	if kind == segmentKeepAlive && len(payload) > 0 {
+		// the garbage byte of probe is already sent, it should not overwrite the data
+		probe := *tcp
+		probe.Payload = nil
+		tcp = &probe
+		payload = nil
+	}
+	if tcp.SYN && len(payload) > 0 {
+		// data in SYN, as TCP Fast Open, starts after the sequence number taken by SYN itself
+		data := *tcp
+		data.Seq++
+		tcp = &data
+	}
+
+	if connection.socks != nil && len(payload) > 0 {
+		// http data follows socks5 handshake
+		tcp = connection.consumeSOCKS5(src, tcp)
+		payload = tcp.Payload
+	}
 
 	if !connection.isHTTP {
-		// skip no-http data
-		if !isHTTPRequestData(payload) {
+		// skip no-http data, and data from server which looks like a request
+		isRequest := isHTTPRequestData(payload) || connection.http09 && isHTTP09Request(payload)
+		if !isRequest || connection.clientFixed && !connection.clientID.equals(src) {
+			connection.onNonHTTPReceive(src, tcp)
 			return
 		}
 		// receive first valid http data packet
@@ -215,27 +619,27 @@ func (connection *TCPConnection) onReceive(src, dst Endpoint, tcp *layers.TCP, t
 		up = false
 	}
 
-	if isHTTPRequestData(payload) {
-		info := TsInfo{req1: timestamp, req2: timestamp, up: up, reqFragment: false, repFragment: false, reqLen: len(payload)}
+	// retransmitted and duplicated payload does not advance timing info
+	newBytes := connection.progress.advance(up, tcp.Seq, len(payload))
+	var requestStarts []string
+	if up && newBytes > 0 {
+		requestStarts = connection.requests.scan(tcp.Seq, payload)
+	}
+	if up && len(requestStarts) > 0 || !up && newBytes == len(payload) && isHTTPRequestData(payload) {
+		for _, method := range requestStarts {
+			connection.onRequestStart(method)
+		}
+		info := TsInfo{req1: timestamp, req2: timestamp, up: up, reqFragment: false, repFragment: false, reqLen: newBytes}
 		info.id = src.String() + "-" + dst.String()
+		info.clientOptions = connection.clientOptions
+		info.serverOptions = connection.serverOptions
+		info.rtt = connection.rtt.rtt()
 		if info.reqLen > 1400 {
 			info.reqFragment = true
 		}
 		gTsInfo[connection.key] = info
-	}
-	if len(payload) > 100 { /* not only ack */
-		if info, ok := gTsInfo[connection.key]; ok {
-			if info.up == up {
-				info.req2 = timestamp
-				info.reqLen += len(payload)
-			} else {
-				info.rep2 = timestamp
-				info.repLen += len(payload)
-			}
-			gTsInfo[connection.key] = info
-		}
-	}
-	if isHTTPReplyData(payload) {
+	} else if !up && newBytes == len(payload) && isHTTPReplyData(payload) && connection.atReplyBoundary() {
+		connection.onReplyStart(payload)
 		pFunc(connection.key)
 		if info, ok := gTsInfo[connection.key]; ok {
 			if len(payload) > 1400 {
@@ -246,22 +650,125 @@ func (connection *TCPConnection) onReceive(src, dst Endpoint, tcp *layers.TCP, t
 			info.repLen = len(payload)
 			gTsInfo[connection.key] = info
 		}
+	} else if newBytes > 0 { /* not only ack, nor retransmission */
+		if !up && connection.replyRemaining > 0 {
+			connection.replyRemaining -= int64(newBytes)
+			if connection.replyRemaining < 0 {
+				connection.replyRemaining = 0
+			}
+		}
+		if info, ok := gTsInfo[connection.key]; ok {
+			if info.up == up {
+				info.req2 = timestamp
+				info.reqLen += newBytes
+			} else {
+				info.rep2 = timestamp
+				info.repLen += newBytes
+			}
+			gTsInfo[connection.key] = info
+		}
 	}
 
-	sendStream.appendPacket(tcp)
-
-	if tcp.SYN {
-		// do nothing
-	}
+	sendStream.insertPacket(&TCPPacket{TCP: tcp, timestamp: timestamp, number: connection.packetNumber})
 
 	if tcp.ACK {
 		// confirm
 		confirmStream.confirmPacket(tcp.Ack)
 	}
 
-	// terminate connection
-	if tcp.FIN || tcp.RST {
+	// terminate connection. RST aborts both directions
+	if tcp.RST {
+		connection.upStream.closed = true
+		connection.downStream.closed = true
+	} else if tcp.FIN {
 		sendStream.closed = true
+		sendStream.fin = true
+		sendStream.finSeq = tcp.Seq + uint32(len(tcp.Payload))
+	}
+	if !connection.closed() {
+		// data before FIN may be delivered by this packet, or by the ACK of peer
+		sendStream.finishDelivered()
+		confirmStream.finishDelivered()
+	}
+}
+
+// update info after packet received
+func (connection *TCPConnection) updateInfo(src Endpoint, ip *ipFields, tcp *layers.TCP, timestamp time.Time) {
+	var state = "open"
+	if connection.closed() {
+		state = "closed"
+	} else if connection.upStream.closed {
+		state = "client-closed"
+	} else if connection.downStream.closed {
+		state = "server-closed"
+	}
+
+	connection.infoLock.Lock()
+	defer connection.infoLock.Unlock()
+	info := &connection.info
+	if src.String() == info.Client {
+		info.UpBytes += int64(len(tcp.Payload))
+		info.ClientIP.add(ip)
+	} else {
+		info.DownBytes += int64(len(tcp.Payload))
+		info.ServerIP.add(ip)
+	}
+	info.HTTP = connection.isHTTP
+	info.State = state
+	info.RTT = connection.rtt.rtt()
+	if !connection.schemeChecked && len(tcp.Payload) > 0 && connection.socks == nil {
+		connection.schemeChecked = true
+		info.Scheme = inferScheme(tcp.Payload)
+	}
+	if !connection.alpnChecked && len(tcp.Payload) > 0 && src.String() == info.Server && info.Scheme == "https" {
+		connection.alpnChecked = true
+		if hello := parseServerHello(tcp.Payload); hello != nil {
+			if len(hello.alpn) == 1 {
+				info.ALPN = hello.alpn[0]
+			}
+			info.TLSVersion = hello.negotiatedVersion()
+			info.CipherSuite = hello.selectedCipherSuite()
+		}
+	}
+	info.DataSegments = connection.keepAlive.data
+	info.KeepAlives = connection.keepAlive.keepAlives
+	info.KeepAliveAcks = connection.keepAlive.keepAliveAcks
+	info.Intervals = connection.intervals.stats()
+	info.Handshake = connection.established
+	info.Created = connection.createTimestamp
+	info.LastActivity = timestamp
+}
+
+// info of the connection. It is safe to call from other goroutines
+func (connection *TCPConnection) snapshot() ConnectionInfo {
+	connection.infoLock.Lock()
+	defer connection.infoLock.Unlock()
+	return connection.info
+}
+
+// track close state and leading client bytes, for connection not detected as http
+func (connection *TCPConnection) onNonHTTPReceive(src Endpoint, tcp *layers.TCP) {
+	if tcp.SYN && !tcp.ACK && !connection.clientFixed {
+		connection.clientID = src
+	}
+	fromClient := connection.clientID.equals(src)
+	connection.nonHTTPBytes += len(tcp.Payload)
+	if fromClient && len(connection.leadingBytes) < connection.leadingLimit {
+		payload := tcp.Payload
+		if remain := connection.leadingLimit - len(connection.leadingBytes); len(payload) > remain {
+			payload = payload[:remain]
+		}
+		connection.leadingBytes = append(connection.leadingBytes, payload...)
+	}
+	if tcp.RST {
+		connection.upStream.closed = true
+		connection.downStream.closed = true
+	} else if tcp.FIN {
+		if fromClient {
+			connection.upStream.closed = true
+		} else {
+			connection.downStream.closed = true
+		}
 	}
 }
 
@@ -277,6 +784,11 @@ func (connection *TCPConnection) flushOlderThan() {
 
 }
 
+// count of segments force dropped because receive window exceeds max size
+func (connection *TCPConnection) droppedSegments() int {
+	return connection.upStream.window.dropped + connection.downStream.window.dropped
+}
+
 func (connection *TCPConnection) closed() bool {
 	return connection.upStream.closed && connection.downStream.closed
 }
@@ -289,42 +801,108 @@ func (connection *TCPConnection) finish() {
 // NetworkStream tread one-direction tcp data as stream. impl reader closer
 type NetworkStream struct {
 	window *ReceiveWindow
-	c      chan *layers.TCP
+	c      chan *TCPPacket
 	remain []byte
 	ignore bool
 	closed bool
+	// FIN received, and seq after the last data byte before it
+	fin    bool
+	finSeq uint32
+	// channel is closed, reader gets EOF after packets delivered
+	finished bool
+	// deliver data by its own seq progression, without waiting ACK of peer
+	unidirectional bool
+	// capture timestamp of the last packet read from this stream
+	lastTimestamp time.Time
+	// if not nil, delivered packets are buffered here, and spilled to disk when exceed threshold
+	spill *spillBuffer
+	// stream offsets of recent packets read, to locate a stream position in capture
+	readOffset int64
+	marks      []packetMark
+}
+
+// TCPPacket is a tcp packet with its capture timestamp
+type TCPPacket struct {
+	*layers.TCP
+	timestamp time.Time
+	number    int // number in capture, 0 if unknown
 }
 
 func newNetworkStream() *NetworkStream {
-	return &NetworkStream{window: newReceiveWindow(64), c: make(chan *layers.TCP, 1024)}
+	return &NetworkStream{window: newReceiveWindow(64), c: make(chan *TCPPacket, 1024)}
 }
 
-func (stream *NetworkStream) appendPacket(tcp *layers.TCP) {
-	if stream.ignore {
+// buffer delivered packets, spill to temp file in dir when buffered bytes exceed threshold
+func (stream *NetworkStream) enableSpill(threshold int, dir string) {
+	stream.spill = newSpillBuffer(threshold, dir)
+	go stream.spill.pump(stream.c)
+}
+
+func (stream *NetworkStream) appendPacket(tcp *layers.TCP, timestamp time.Time) {
+	stream.insertPacket(&TCPPacket{TCP: tcp, timestamp: timestamp})
+}
+
+func (stream *NetworkStream) insertPacket(packet *TCPPacket) {
+	if stream.ignore || stream.finished {
 		return
 	}
-	stream.window.insert(tcp)
+	if stream.window.full() {
+		stream.window.forceDeliver(stream.c)
+	}
+	stream.window.insert(packet)
+	if stream.unidirectional {
+		// no ACK from peer in capture
+		stream.window.deliverContiguous(stream.c)
+	}
 }
 
 func (stream *NetworkStream) confirmPacket(ack uint32) {
-	if stream.ignore {
+	if stream.ignore || stream.finished {
 		return
 	}
 	stream.window.confirm(ack, stream.c)
 }
 
+// deliver the contiguous prefix of hold packets without ack, when capture ends and the ack will never be seen.
+// packets after a gap are not delivered
+func (stream *NetworkStream) flushWindow() {
+	window := stream.window
+	if stream.ignore || stream.finished || window.size == 0 ||
+		window.expectSet && compareTCPSeq(window.buffer[window.start].Seq, window.expectBegin) > 0 {
+		return
+	}
+	window.forceDeliver(stream.c)
+}
+
 func (stream *NetworkStream) finish() {
+	if stream.finished {
+		return
+	}
+	stream.finished = true
 	close(stream.c)
 }
 
+// finish the half-closed stream once all data before FIN is delivered, so reader gets EOF while the other
+// direction keeps open. Data missing before FIN keeps the stream open until connection ends
+func (stream *NetworkStream) finishDelivered() {
+	window := stream.window
+	if !stream.fin || stream.finished || window.size > 0 ||
+		window.expectSet && compareTCPSeq(window.expectBegin, stream.finSeq) < 0 {
+		return
+	}
+	stream.finish()
+}
+
 func (stream *NetworkStream) Read(p []byte) (n int, err error) {
 	for len(stream.remain) == 0 {
-		packet, ok := <-stream.c
+		packet, ok := stream.nextPacket()
 		if !ok {
 			err = io.EOF
 			return
 		}
 		stream.remain = packet.Payload
+		stream.lastTimestamp = packet.timestamp
+		stream.markPacket(packet)
 	}
 
 	if len(stream.remain) > len(p) {
@@ -337,9 +915,20 @@ func (stream *NetworkStream) Read(p []byte) (n int, err error) {
 	return
 }
 
+func (stream *NetworkStream) nextPacket() (*TCPPacket, bool) {
+	if stream.spill != nil {
+		return stream.spill.pop()
+	}
+	packet, ok := <-stream.c
+	return packet, ok
+}
+
 // Close the stream
 func (stream *NetworkStream) Close() error {
 	stream.ignore = true
+	if stream.spill != nil {
+		stream.spill.destroy()
+	}
 	return nil
 }
 
@@ -347,13 +936,42 @@ func (stream *NetworkStream) Close() error {
 type ReceiveWindow struct {
 	size        int
 	start       int
-	buffer      []*layers.TCP
+	buffer      []*TCPPacket
 	lastAck     uint32
-	expectBegin uint32
+	expectBegin uint32 // seq of next byte expected to deliver, valid only if expectSet is true
+	expectSet   bool
+	maxSize     int   // max packets hold, 0 for unlimited
+	dropped     int   // packets dropped because window exceeds max size
+	firstDrop   int   // number of the first dropped packet, 0 if unknown
+	lostBytes   int64 // bytes missing in delivered data, by seq gaps
+	firstLost   int   // number of the packet after the first gap, 0 if unknown
+	// how to resolve overlapping segments with conflicting content, not applied to data already delivered
+	overlapPolicy OverlapPolicy
+	maxPayload    int // longest payload inserted, bounds how far back a hold packet can overlap a new one
+}
+
+// OverlapPolicy decide which content is kept for overlapping segments
+type OverlapPolicy int
+
+const (
+	// OverlapFirstWins keep content of the segment received first
+	OverlapFirstWins OverlapPolicy = iota
+	// OverlapLastWins keep content of the segment received last
+	OverlapLastWins
+)
+
+func parseOverlapPolicy(value string) (OverlapPolicy, error) {
+	switch value {
+	case "first":
+		return OverlapFirstWins, nil
+	case "last":
+		return OverlapLastWins, nil
+	}
+	return OverlapFirstWins, fmt.Errorf("invalid overlap policy: %s", value)
 }
 
 func newReceiveWindow(initialSize int) *ReceiveWindow {
-	buffer := make([]*layers.TCP, initialSize)
+	buffer := make([]*TCPPacket, initialSize)
 	return &ReceiveWindow{buffer: buffer}
 }
 
@@ -363,9 +981,9 @@ func (window *ReceiveWindow) destroy() {
 	window.buffer = nil
 }
 
-func (window *ReceiveWindow) insert(packet *layers.TCP) {
+func (window *ReceiveWindow) insert(packet *TCPPacket) {
 
-	if window.expectBegin != 0 && compareTCPSeq(window.expectBegin, packet.Seq+uint32(len(packet.Payload))) >= 0 {
+	if window.expectSet && compareTCPSeq(window.expectBegin, packet.Seq+uint32(len(packet.Payload))) >= 0 {
 		// dropped
 		return
 	}
@@ -375,20 +993,26 @@ func (window *ReceiveWindow) insert(packet *layers.TCP) {
 		return
 	}
 
+	if len(packet.Payload) > window.maxPayload {
+		window.maxPayload = len(packet.Payload)
+	}
 	idx := window.size
+	duplicated := false
 	for ; idx > 0; idx-- {
 		index := (idx - 1 + window.start) % len(window.buffer)
 		prev := window.buffer[index]
 		result := compareTCPSeq(prev.Seq, packet.Seq)
-		if result == 0 {
-			// duplicated
-			return
-		}
-		if result < 0 {
+		if result <= 0 {
 			// insert at index
+			duplicated = result == 0 && len(packet.Payload) <= len(prev.Payload)
 			break
 		}
 	}
+	window.resolveOverlap(packet, idx)
+	if duplicated {
+		// overlapped content is already resolved
+		return
+	}
 
 	if window.size == len(window.buffer) {
 		window.expand()
@@ -412,8 +1036,61 @@ func (window *ReceiveWindow) insert(packet *layers.TCP) {
 	window.size++
 }
 
+// make overlapping content of packet and hold packets the same, by overlap policy.
+// so whichever packet the overlapped bytes are delivered from, the content is same.
+// hold packets are sorted by seq, only the neighbours of insert position idx within reach are checked
+func (window *ReceiveWindow) resolveOverlap(packet *TCPPacket, idx int) {
+	end := packet.Seq + uint32(len(packet.Payload))
+	for i := idx; i < window.size; i++ {
+		hold := window.buffer[(i+window.start)%len(window.buffer)]
+		if compareTCPSeq(hold.Seq, end) >= 0 {
+			break
+		}
+		window.copyOverlap(hold, packet)
+	}
+	reach := uint32(window.maxPayload)
+	for i := idx - 1; i >= 0; i-- {
+		hold := window.buffer[(i+window.start)%len(window.buffer)]
+		if compareTCPSeq(hold.Seq+reach, packet.Seq) <= 0 {
+			break
+		}
+		window.copyOverlap(hold, packet)
+	}
+}
+
+// copy overlapping content between hold and new packet by overlap policy
+func (window *ReceiveWindow) copyOverlap(hold, packet *TCPPacket) {
+	if window.overlapPolicy == OverlapLastWins {
+		copyOverlap(hold, packet)
+	} else {
+		copyOverlap(packet, hold)
+	}
+}
+
+// copy payload bytes of src to dst where their seq ranges overlap. dst payload is copied before modified
+func copyOverlap(dst, src *TCPPacket) {
+	start, end := dst.Seq, dst.Seq+uint32(len(dst.Payload))
+	if compareTCPSeq(src.Seq, start) > 0 {
+		start = src.Seq
+	}
+	if srcEnd := src.Seq + uint32(len(src.Payload)); compareTCPSeq(srcEnd, end) < 0 {
+		end = srcEnd
+	}
+	if compareTCPSeq(start, end) >= 0 {
+		return
+	}
+	dstData := dst.Payload[start-dst.Seq : end-dst.Seq]
+	srcData := src.Payload[start-src.Seq : end-src.Seq]
+	if bytes.Equal(dstData, srcData) {
+		return
+	}
+	payload := append([]byte(nil), dst.Payload...)
+	copy(payload[start-dst.Seq:], srcData)
+	dst.Payload = payload
+}
+
 // send confirmed packets to reader, when receive ack
-func (window *ReceiveWindow) confirm(ack uint32, c chan *layers.TCP) {
+func (window *ReceiveWindow) confirm(ack uint32, c chan *TCPPacket) {
 	idx := 0
 	for ; idx < window.size; idx++ {
 		index := (idx + window.start) % len(window.buffer)
@@ -422,25 +1099,29 @@ func (window *ReceiveWindow) confirm(ack uint32, c chan *layers.TCP) {
 		if result >= 0 {
 			break
 		}
+		// every packet before ack is consumed from window, whether delivered or dropped as duplicated;
+		// start and size are moved by idx after the loop
 		window.buffer[index] = nil
 		newExpect := packet.Seq + uint32(len(packet.Payload))
-		if window.expectBegin != 0 {
+		if window.expectSet {
 			diff := compareTCPSeq(window.expectBegin, packet.Seq)
 			if diff > 0 {
+				// wraparound safe, as the uint32 difference
 				duplicatedSize := window.expectBegin - packet.Seq
-				if duplicatedSize < 0 {
-					duplicatedSize += maxTCPSeq
-				}
 				if duplicatedSize >= uint32(len(packet.Payload)) {
+					// all delivered by previous packets, expectBegin is already after it
 					continue
 				}
+				// seq of delivered packet is its first new byte
 				packet.Payload = packet.Payload[duplicatedSize:]
+				packet.Seq += duplicatedSize
 			} else if diff < 0 {
-				//TODO: we lose packet here
+				window.lose(packet)
 			}
 		}
 		c <- packet
 		window.expectBegin = newExpect
+		window.expectSet = true
 	}
 	window.start = (window.start + idx) % len(window.buffer)
 	window.size = window.size - idx
@@ -449,8 +1130,68 @@ func (window *ReceiveWindow) confirm(ack uint32, c chan *layers.TCP) {
 	}
 }
 
+// record bytes missing before packet, which is delivered after a gap
+func (window *ReceiveWindow) lose(packet *TCPPacket) {
+	if window.lostBytes == 0 {
+		window.firstLost = packet.number
+	}
+	window.lostBytes += int64(packet.Seq - window.expectBegin)
+}
+
+// if window reach max size
+func (window *ReceiveWindow) full() bool {
+	return window.maxSize > 0 && window.size >= window.maxSize
+}
+
+// make room when window is full, before ack received.
+// deliver the contiguous prefix of hold packets; if there is a gap at head, drop the oldest packet
+func (window *ReceiveWindow) forceDeliver(c chan *TCPPacket) {
+	if window.size == 0 {
+		return
+	}
+	first := window.buffer[window.start]
+	if window.expectSet && compareTCPSeq(first.Seq, window.expectBegin) > 0 {
+		// packets lost before the first hold one
+		window.buffer[window.start] = nil
+		window.start = (window.start + 1) % len(window.buffer)
+		window.size--
+		if window.dropped == 0 {
+			window.firstDrop = first.number
+		}
+		window.dropped++
+		return
+	}
+	window.deliverContiguous(c)
+}
+
+// deliver hold packets contiguous from the next expected seq, as if they are acked.
+// nothing is delivered if there is a gap before the first hold packet
+func (window *ReceiveWindow) deliverContiguous(c chan *TCPPacket) {
+	if window.size == 0 {
+		return
+	}
+	first := window.buffer[window.start]
+	if window.expectSet && compareTCPSeq(first.Seq, window.expectBegin) > 0 {
+		return
+	}
+	end := first.Seq + uint32(len(first.Payload))
+	for idx := 1; idx < window.size; idx++ {
+		packet := window.buffer[(idx+window.start)%len(window.buffer)]
+		if compareTCPSeq(packet.Seq, end) > 0 {
+			break
+		}
+		if packetEnd := packet.Seq + uint32(len(packet.Payload)); compareTCPSeq(packetEnd, end) > 0 {
+			end = packetEnd
+		}
+	}
+	lastAck := window.lastAck
+	window.confirm(end, c)
+	// not real ack from peer
+	window.lastAck = lastAck
+}
+
 func (window *ReceiveWindow) expand() {
-	buffer := make([]*layers.TCP, len(window.buffer)*2)
+	buffer := make([]*TCPPacket, len(window.buffer)*2)
 	end := window.start + window.size
 	if end < len(window.buffer) {
 		copy(buffer, window.buffer[window.start:window.start+window.size])
@@ -463,31 +1204,25 @@ func (window *ReceiveWindow) expand() {
 }
 
 // compare two tcp sequences, if seq1 is earlier, return num < 0, if seq1 == seq2, return 0, else return num > 0
+// the uint32 difference interpreted as signed handles wraparound, as long as two seqs are less than 2^31 apart
 func compareTCPSeq(seq1, seq2 uint32) int {
-	if seq1 < tcpSeqWindow && seq2 > maxTCPSeq-tcpSeqWindow {
-		return int(seq1 + maxTCPSeq - seq2)
-	} else if seq2 < tcpSeqWindow && seq1 > maxTCPSeq-tcpSeqWindow {
-		return int(seq1 - (maxTCPSeq + seq2))
-	}
 	return int(int32(seq1 - seq2))
 }
 
 var httpMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "DELETE": true, "HEAD": true,
-	"TRACE": true, "OPTIONS": true, "PATCH": true}
+	"TRACE": true, "OPTIONS": true, "PATCH": true, "CONNECT": true,
+	"PRI": true} // PRI for http2 connection preface
+
+// bytes looked at for request method and the following space, longer than the longest method
+const requestMethodWindow = 8
 
 // if is first http request packet
 func isHTTPRequestData(body []byte) bool {
-	if len(body) < 8 {
-		return false
-	}
-	data := body[0:8]
-	idx := bytes.IndexByte(data, byte(' '))
-	if idx < 0 {
+	// too short to tell from other protocols
+	if len(body) < requestMethodWindow {
 		return false
 	}
-
-	method := string(data[:idx])
-	return httpMethods[method]
+	return httpMethods[requestMethod(body, requestMethodWindow)]
 }
 
 func isHTTPReplyData(body []byte) bool {
@@ -500,16 +1235,240 @@ func isHTTPReplyData(body []byte) bool {
 	return false
 }
 
+// max pending request methods kept for response boundary
+const maxPendingMethods = 64
+
+func (connection *TCPConnection) onRequestStart(method string) {
+	if len(connection.pendingMethods) >= maxPendingMethods {
+		return
+	}
+	connection.pendingMethods = append(connection.pendingMethods, method)
+}
+
+// if downStream is at the start of a response, not in the middle of a body
+func (connection *TCPConnection) atReplyBoundary() bool {
+	if connection.replyRemaining > 0 {
+		return false
+	}
+	// body length unknown(chunked or close-delimited), next response must follow a request
+	if connection.replyRemaining < 0 {
+		return len(connection.pendingMethods) > 0
+	}
+	return true
+}
+
+// track body length of the response starting with payload
+func (connection *TCPConnection) onReplyStart(payload []byte) {
+	method := ""
+	if len(connection.pendingMethods) > 0 {
+		method = connection.pendingMethods[0]
+		connection.pendingMethods = connection.pendingMethods[1:]
+	}
+	if method == "HEAD" {
+		connection.replyRemaining = 0
+		return
+	}
+	connection.replyRemaining = -1
+	idx := bytes.Index(payload, []byte("\r\n\r\n"))
+	if idx < 0 {
+		// header not complete in one segment
+		return
+	}
+	length := replyContentLength(payload[:idx])
+	if length < 0 {
+		return
+	}
+	remaining := length - int64(len(payload)-idx-4)
+	if remaining < 0 {
+		remaining = 0
+	}
+	connection.replyRemaining = remaining
+}
+
+// content length of response head, -1 if chunked or not present
+func replyContentLength(head []byte) int64 {
+	length, chunked := contentLength(head)
+	if chunked {
+		return -1
+	}
+	return length
+}
+
+// Content-Length of a message head(without the ending blank line), -1 if not set. chunked is true if
+// Transfer-Encoding is chunked, which overrides Content-Length
+func contentLength(head []byte) (length int64, chunked bool) {
+	length = -1
+	for _, line := range bytes.Split(head, []byte("\r\n"))[1:] {
+		idx := bytes.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+		name := string(bytes.TrimSpace(line[:idx]))
+		value := string(bytes.TrimSpace(line[idx+1:]))
+		if strings.EqualFold(name, "Transfer-Encoding") && strings.Contains(strings.ToLower(value), "chunked") {
+			return -1, true
+		}
+		if strings.EqualFold(name, "Content-Length") {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+				length = n
+			}
+		}
+	}
+	return length, false
+}
+
+// swap the two endpoints of a connection key, key is returned as is if it is malformed
 func getInverseKey(key string) string {
-	s := strings.Split(key, "-")
-	return s[1] + "-" + s[0]
+	first, second, ok := splitConnectionKey(key)
+	if !ok {
+		return key
+	}
+	return second + "-" + first
+}
+
+// split connection key "ip:port-ip:port" to the two endpoints. ipv6 zone may contain "-",
+// so the separator is the one both sides of which are valid endpoints
+func splitConnectionKey(key string) (string, string, bool) {
+	for i := 0; i < len(key); i++ {
+		if key[i] != '-' {
+			continue
+		}
+		if isEndpointString(key[:i]) && isEndpointString(key[i+1:]) {
+			return key[:i], key[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func isEndpointString(value string) bool {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil || host == "" {
+		return false
+	}
+	_, err = strconv.ParseUint(port, 10, 16)
+	return err == nil
 }
 
 const gTimeFmt = "05.000000"
 
+// tsRecord is the json form of TsInfo, one record per line
+type tsRecord struct {
+	ID          string    `json:"id"`
+	Up          bool      `json:"up"`
+	Req1        time.Time `json:"req1"`
+	Req2        time.Time `json:"req2"`
+	Rep1        time.Time `json:"rep1"`
+	Rep2        time.Time `json:"rep2"`
+	ReqDuration int64     `json:"reqDuration"`
+	Wait        int64     `json:"wait"`
+	RepDuration int64     `json:"repDuration"`
+	ReqLen      int       `json:"reqLen"`
+	RepLen      int       `json:"repLen"`
+	ReqFragment bool      `json:"reqFragment"`
+	RepFragment bool      `json:"repFragment"`
+	// omitted if handshake not captured
+	ClientOptions *TCPOptions `json:"clientOptions,omitempty"`
+	ServerOptions *TCPOptions `json:"serverOptions,omitempty"`
+	// nanoseconds by tcp timestamps echoes, omitted if timestamps option not used
+	RTT int64 `json:"rtt,omitempty"`
+}
+
+func (tsInfo TsInfo) jsonLine() string {
+	record := tsRecord{
+		ID:          tsInfo.id,
+		Up:          tsInfo.up,
+		Req1:        tsInfo.req1,
+		Req2:        tsInfo.req2,
+		Rep1:        tsInfo.rep1,
+		Rep2:        tsInfo.rep2,
+		ReqDuration: tsInfo.req2.Sub(tsInfo.req1).Nanoseconds(),
+		Wait:        tsInfo.rep1.Sub(tsInfo.req2).Nanoseconds(),
+		RepDuration: tsInfo.rep2.Sub(tsInfo.rep1).Nanoseconds(),
+		ReqLen:      tsInfo.reqLen,
+		RepLen:      tsInfo.repLen,
+		ReqFragment: tsInfo.reqFragment,
+		RepFragment: tsInfo.repFragment,
+
+		ClientOptions: tsInfo.clientOptions,
+		ServerOptions: tsInfo.serverOptions,
+		RTT:           tsInfo.rtt.Nanoseconds(),
+	}
+	data, _ := json.Marshal(record)
+	return string(data) + "\n"
+}
+
+// report connection which has data dropped because of receive window overflow, or lost by seq gaps
+func (assembler *TCPAssembler) printDropped(connection *TCPConnection) {
+	if dropped := connection.droppedSegments(); dropped > 0 {
+		first := connection.upStream.window.firstDrop
+		if connection.upStream.window.dropped == 0 {
+			first = connection.downStream.window.firstDrop
+		}
+		if assembler.format == "json" {
+			assembler.printer.send(assembler.packetRecord(map[string]interface{}{
+				"type":     "dropped",
+				"key":      connection.key,
+				"segments": dropped,
+			}, first))
+		} else {
+			assembler.printer.send(fmt.Sprintf("[dropped] %s %d segments dropped, receive window full%s\n",
+				connection.key, dropped, assembler.packetRef(first)))
+		}
+	}
+	for _, stream := range []*NetworkStream{connection.upStream, connection.downStream} {
+		window := stream.window
+		if window.lostBytes == 0 {
+			continue
+		}
+		if assembler.format == "json" {
+			assembler.printer.send(assembler.packetRecord(map[string]interface{}{
+				"type":      "lost",
+				"key":       connection.key,
+				"bytes":     window.lostBytes,
+				"direction": strings.TrimPrefix(streamDirection(connection, stream), "from "),
+			}, window.firstLost))
+		} else {
+			assembler.printer.send(fmt.Sprintf("[lost] %s %d bytes missing %s%s\n", connection.key, window.lostBytes,
+				streamDirection(connection, stream), assembler.packetRef(window.firstLost)))
+		}
+	}
+}
+
+// json line of record, with file and number of packet if known
+func (assembler *TCPAssembler) packetRecord(record map[string]interface{}, number int) string {
+	if assembler.captureFile != "" && number > 0 {
+		record["file"] = assembler.captureFile
+		record["packet"] = number
+	}
+	data, _ := json.Marshal(record)
+	return string(data) + "\n"
+}
+
+// print hex dump of leading client bytes for connection never detected as http
+func (assembler *TCPAssembler) printNonHTTP(connection *TCPConnection) {
+	if assembler.dumpNonHTTP <= 0 || len(connection.leadingBytes) == 0 {
+		return
+	}
+	if assembler.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type": "non-http",
+			"key":  connection.key,
+			"data": hex.EncodeToString(connection.leadingBytes),
+		})
+		assembler.printer.send(string(data) + "\n")
+		return
+	}
+	assembler.printer.send(fmt.Sprintf("[non-http] %s\n%s", connection.key, hex.Dump(connection.leadingBytes)))
+}
+
 func (assembler *TCPAssembler) PrintTsInfo(key string) {
 	tsInfo := gTsInfo[key]
-	if tsInfo.rep1.Before(tsInfo.req2) {
+	if tsInfo.rep1.Before(tsInfo.req2) || assembler.summaryOnly {
+		return
+	}
+
+	if assembler.format == "json" {
+		assembler.printer.send(tsInfo.jsonLine())
 		return
 	}
 
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestReceiveWindow(t *testing.T) {
@@ -11,28 +19,875 @@ func TestReceiveWindow(t *testing.T) {
 	window := newReceiveWindow(4)
 
 	// init insert
-	window.insert(&layers.TCP{Seq: 10005, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2}}})
-	window.insert(&layers.TCP{Seq: 10000, BaseLayer: layers.BaseLayer{Payload: []byte{7, 8, 9, 0}}})
-	window.insert(&layers.TCP{Seq: 10010, BaseLayer: layers.BaseLayer{Payload: []byte{2, 3, 4, 5}}})
-	window.insert(&layers.TCP{Seq: 10005, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2}}})
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 10005, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2}}}})
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 10000, BaseLayer: layers.BaseLayer{Payload: []byte{7, 8, 9, 0}}}})
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 10010, BaseLayer: layers.BaseLayer{Payload: []byte{2, 3, 4, 5}}}})
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 10005, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2}}}})
 	assert.Equal(t, 3, window.size)
 	assert.Equal(t, 0, window.start)
 	assert.Equal(t, uint32(10000), window.buffer[0].Seq)
 	assert.Equal(t, uint32(10005), window.buffer[1].Seq)
 	assert.Equal(t, uint32(10010), window.buffer[2].Seq)
 
-	window.insert(&layers.TCP{Seq: 10009, BaseLayer: layers.BaseLayer{Payload: []byte{7, 8, 9, 0}}})
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 10009, BaseLayer: layers.BaseLayer{Payload: []byte{7, 8, 9, 0}}}})
 	assert.Equal(t, uint32(10000), window.buffer[0].Seq)
 	assert.Equal(t, uint32(10005), window.buffer[1].Seq)
 
 	// expand
-	window.insert(&layers.TCP{Seq: 10030, BaseLayer: layers.BaseLayer{Payload: []byte{7, 8, 9, 0}}})
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 10030, BaseLayer: layers.BaseLayer{Payload: []byte{7, 8, 9, 0}}}})
 	assert.Equal(t, 5, window.size)
 	assert.Equal(t, 0, window.start)
 
-	c := make(chan *layers.TCP, 1000)
+	c := make(chan *TCPPacket, 1000)
 	// confirm
 	window.confirm(10020, c)
 	assert.Equal(t, 1, window.size)
 	assert.Equal(t, 4, window.start)
 }
+
+// records connections passed to handler, without reading them
+type recordConnectionHandler struct {
+	connections []*TCPConnection
+}
+
+func (handler *recordConnectionHandler) handle(src Endpoint, dst Endpoint, connection *TCPConnection) {
+	handler.connections = append(handler.connections, connection)
+}
+
+func (handler *recordConnectionHandler) finish() {
+}
+
+func newTestAssembler() (*TCPAssembler, *recordConnectionHandler) {
+	handler := &recordConnectionHandler{}
+	printer := &Printer{outputQueue: make(chan string, 1024)}
+	return newTCPAssembler(handler, printer), handler
+}
+
+func ipv4Flow(src, dst string) gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointIPv4, net.ParseIP(src).To4(), net.ParseIP(dst).To4())
+}
+
+var testClientFlow = ipv4Flow("10.0.0.1", "10.0.0.2")
+var testServerFlow = ipv4Flow("10.0.0.2", "10.0.0.1")
+
+func clientPacket(seq, ack uint32, payload string) *layers.TCP {
+	return &layers.TCP{SrcPort: 50000, DstPort: 80, Seq: seq, Ack: ack, ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: []byte(payload)}}
+}
+
+func serverPacket(seq, ack uint32, payload string) *layers.TCP {
+	return &layers.TCP{SrcPort: 80, DstPort: 50000, Seq: seq, Ack: ack, ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: []byte(payload)}}
+}
+
+func TestMaxLifetime(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	assembler.maxLifetime = time.Minute
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	request := "GET /stream HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), start)
+	assert.Equal(t, 1, len(handler.connections))
+	connection := handler.connections[0]
+
+	// keep active, but not exceed max lifetime
+	seq := uint32(5000)
+	for i := 1; i <= 5; i++ {
+		data := "HTTP/1.1 200 OK\r\n"
+		assembler.assemble(testServerFlow, serverPacket(seq, 1000+uint32(len(request)), data),
+			start.Add(time.Duration(i)*10*time.Second))
+		seq += uint32(len(data))
+	}
+	assert.Equal(t, 1, len(assembler.connectionDict))
+	assert.False(t, connection.closed())
+
+	assembler.assemble(testServerFlow, serverPacket(seq, 1000+uint32(len(request)), "chunk"),
+		start.Add(time.Minute))
+	assert.Equal(t, 0, len(assembler.connectionDict))
+	assert.True(t, connection.closed())
+	_, ok := gTsInfo[connection.key]
+	assert.False(t, ok)
+}
+
+func TestReceiveWindowExpectZero(t *testing.T) {
+	assert.True(t, compareTCPSeq(0xFFFFFFFC, 0) < 0)
+	assert.True(t, compareTCPSeq(2, 0xFFFFFFFE) > 0)
+
+	window := newReceiveWindow(4)
+	c := make(chan *TCPPacket, 10)
+
+	// next expected seq wraps to 0 after this packet
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 0xFFFFFFFC, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2, 3, 4}}}})
+	window.confirm(0, c)
+	assert.Equal(t, 1, len(c))
+	<-c
+	assert.True(t, window.expectSet)
+	assert.Equal(t, uint32(0), window.expectBegin)
+
+	// retransmission of delivered data is dropped
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 0xFFFFFFFC, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2, 3, 4}}}})
+	assert.Equal(t, 0, window.size)
+
+	// overlapped data is trimmed
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 0xFFFFFFFE, BaseLayer: layers.BaseLayer{Payload: []byte{3, 4, 5, 6}}}})
+	window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 2, BaseLayer: layers.BaseLayer{Payload: []byte{7, 8}}}})
+	window.confirm(4, c)
+	assert.Equal(t, 2, len(c))
+	assert.Equal(t, []byte{5, 6}, (<-c).Payload)
+	assert.Equal(t, []byte{7, 8}, (<-c).Payload)
+	assert.Equal(t, uint32(4), window.expectBegin)
+	assert.Equal(t, 0, window.size)
+}
+
+func TestReceiveWindowDuplicateAfterDelivery(t *testing.T) {
+	window := newReceiveWindow(4)
+	c := make(chan *TCPPacket, 10)
+	packet := func(seq uint32, payload ...byte) *TCPPacket {
+		return &TCPPacket{TCP: &layers.TCP{Seq: seq, BaseLayer: layers.BaseLayer{Payload: payload}}}
+	}
+
+	// a segment inside the one before it is held, and consumed without delivery
+	window.insert(packet(100, 1, 2, 3, 4, 5, 6, 7, 8))
+	window.insert(packet(102, 3, 4, 5))
+	window.insert(packet(108, 9, 10))
+	assert.Equal(t, 3, window.size)
+	window.confirm(110, c)
+	assert.Equal(t, 0, window.size)
+	assert.Equal(t, 3, window.start)
+	assert.Equal(t, uint32(110), window.expectBegin)
+	assert.Equal(t, 2, len(c))
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, (<-c).Payload)
+	assert.Equal(t, []byte{9, 10}, (<-c).Payload)
+	for _, p := range window.buffer {
+		assert.Nil(t, p)
+	}
+
+	// after partial delivery, the rest of a segment is delivered once, and a duplicate of delivered data is dropped
+	window.insert(packet(105, 6, 7, 8, 9, 10, 11, 12))
+	window.insert(packet(110, 11, 12))
+	window.insert(packet(112, 13))
+	assert.Equal(t, 3, window.size)
+	window.confirm(111, c)
+	assert.Equal(t, 1, window.size)
+	assert.Equal(t, 1, window.start)
+	assert.Equal(t, uint32(112), window.expectBegin)
+	delivered := <-c
+	assert.Equal(t, uint32(110), delivered.Seq)
+	assert.Equal(t, []byte{11, 12}, delivered.Payload)
+	assert.Equal(t, 0, len(c))
+	window.confirm(113, c)
+	assert.Equal(t, 0, window.size)
+	assert.Equal(t, 2, window.start)
+	assert.Equal(t, []byte{13}, (<-c).Payload)
+	assert.Equal(t, int64(0), window.lostBytes)
+}
+
+func TestReceiveWindowOverlapPolicy(t *testing.T) {
+	deliver := func(policy OverlapPolicy) []byte {
+		window := newReceiveWindow(4)
+		window.overlapPolicy = policy
+		c := make(chan *TCPPacket, 10)
+		window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 100, BaseLayer: layers.BaseLayer{Payload: []byte("abcdef")}}})
+		// rewritten segments conflict with the first one, partially and fully
+		window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 103, BaseLayer: layers.BaseLayer{Payload: []byte("XYZgh")}}})
+		window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 100, BaseLayer: layers.BaseLayer{Payload: []byte("QR")}}})
+		window.confirm(108, c)
+		close(c)
+		var data []byte
+		for packet := range c {
+			data = append(data, packet.Payload...)
+		}
+		assert.Equal(t, 0, window.size)
+		return data
+	}
+	assert.Equal(t, "abcdefgh", string(deliver(OverlapFirstWins)))
+	assert.Equal(t, "QRcXYZgh", string(deliver(OverlapLastWins)))
+
+	// a long hold segment overlaps past a contained neighbour, segments after the new one are not reached
+	deliverSpanned := func(policy OverlapPolicy) string {
+		window := newReceiveWindow(4)
+		window.overlapPolicy = policy
+		c := make(chan *TCPPacket, 10)
+		window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 100, BaseLayer: layers.BaseLayer{Payload: []byte("abcdefghij")}}})
+		window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 102, BaseLayer: layers.BaseLayer{Payload: []byte("cd")}}})
+		window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 110, BaseLayer: layers.BaseLayer{Payload: []byte("kl")}}})
+		window.insert(&TCPPacket{TCP: &layers.TCP{Seq: 106, BaseLayer: layers.BaseLayer{Payload: []byte("XYZ")}}})
+		assert.Equal(t, "kl", string(window.buffer[3].Payload))
+		window.confirm(112, c)
+		close(c)
+		var data []byte
+		for packet := range c {
+			data = append(data, packet.Payload...)
+		}
+		return string(data)
+	}
+	assert.Equal(t, "abcdefghijkl", deliverSpanned(OverlapFirstWins))
+	assert.Equal(t, "abcdefXYZjkl", deliverSpanned(OverlapLastWins))
+
+	policy, err := parseOverlapPolicy("last")
+	assert.Nil(t, err)
+	assert.Equal(t, OverlapLastWins, policy)
+	_, err = parseOverlapPolicy("middle")
+	assert.NotNil(t, err)
+}
+
+func TestDumpNonHTTP(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	assembler.dumpNonHTTP = 8
+	now := time.Now()
+
+	syn := clientPacket(999, 0, "")
+	syn.SYN, syn.ACK = true, false
+	assembler.assemble(testClientFlow, syn, now)
+	synAck := serverPacket(4999, 1000, "")
+	synAck.SYN = true
+	assembler.assemble(testServerFlow, synAck, now)
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, "\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03"), now)
+	assembler.assemble(testServerFlow, serverPacket(5000, 1010, "\x16\x03\x03\x00\x7a"), now)
+	assert.Equal(t, 1, len(handler.connections))
+	assert.False(t, handler.connections[0].isHTTP)
+	assert.Equal(t, 0, len(assembler.printer.outputQueue))
+
+	fin := clientPacket(1010, 5005, "")
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, now)
+	fin = serverPacket(5005, 1011, "")
+	fin.FIN = true
+	assembler.assemble(testServerFlow, fin, now)
+	assert.Equal(t, 0, len(assembler.connectionDict))
+	assert.Equal(t, 1, len(assembler.printer.outputQueue))
+	msg := <-assembler.printer.outputQueue
+	assert.Equal(t, "[non-http] 10.0.0.1:50000-10.0.0.2:80\n"+
+		"00000000  16 03 01 02 00 01 00 01                           |........|\n", msg)
+}
+
+func TestReceiveWindowMaxSize(t *testing.T) {
+	stream := newNetworkStream()
+	stream.window.maxSize = 4
+	stream.appendPacket(&layers.TCP{Seq: 0, BaseLayer: layers.BaseLayer{Payload: []byte{0, 1, 2, 3, 4}}}, time.Time{})
+	stream.confirmPacket(5)
+	assert.Equal(t, 1, len(stream.c))
+
+	// ack stalled, and segment at seq 5 is lost
+	for seq := uint32(10); seq < 210; seq += 10 {
+		stream.appendPacket(&layers.TCP{Seq: seq, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2, 3, 4, 5}}}, time.Time{})
+	}
+	assert.Equal(t, 4, stream.window.size)
+	assert.True(t, len(stream.window.buffer) <= 64)
+	assert.Equal(t, 16, stream.window.dropped)
+	assert.Equal(t, 1, len(stream.c))
+
+	// contiguous prefix is delivered instead of dropped
+	stream = newNetworkStream()
+	stream.window.maxSize = 2
+	stream.appendPacket(&layers.TCP{Seq: 100, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2}}}, time.Time{})
+	stream.appendPacket(&layers.TCP{Seq: 102, BaseLayer: layers.BaseLayer{Payload: []byte{3, 4}}}, time.Time{})
+	stream.appendPacket(&layers.TCP{Seq: 110, BaseLayer: layers.BaseLayer{Payload: []byte{5, 6}}}, time.Time{})
+	assert.Equal(t, 0, stream.window.dropped)
+	assert.Equal(t, 2, len(stream.c))
+	assert.Equal(t, 1, stream.window.size)
+	assert.Equal(t, uint32(104), stream.window.expectBegin)
+
+	// not acked data is flushed when capture ends, except data after a gap
+	stream = newNetworkStream()
+	stream.appendPacket(&layers.TCP{Seq: 100, BaseLayer: layers.BaseLayer{Payload: []byte{1, 2}}}, time.Time{})
+	stream.appendPacket(&layers.TCP{Seq: 102, BaseLayer: layers.BaseLayer{Payload: []byte{3, 4}}}, time.Time{})
+	stream.appendPacket(&layers.TCP{Seq: 110, BaseLayer: layers.BaseLayer{Payload: []byte{5, 6}}}, time.Time{})
+	stream.flushWindow()
+	assert.Equal(t, 2, len(stream.c))
+	stream.flushWindow()
+	assert.Equal(t, 2, len(stream.c))
+	assert.Equal(t, 1, stream.window.size)
+	assert.Equal(t, 0, stream.window.dropped)
+}
+
+// content of stream byte at offset from initial seq, so overlapping segments always agree
+func fuzzStreamByte(offset uint32) byte {
+	return byte(offset ^ offset>>8)
+}
+
+// ops are 4 bytes each: kind(even insert, odd confirm), offset from base seq in 2 bytes, payload size.
+// Delivered data must be in seq order without any byte delivered twice, gaps must be counted as lost,
+// and the window must be kept within max size
+func FuzzReceiveWindow(f *testing.F) {
+	// in order, overlapping, out of order and retransmitted segments, around seq wraparound
+	f.Add(uint32(1000), []byte{0, 0, 0, 10, 0, 0, 10, 10, 1, 0, 20, 0})
+	f.Add(uint32(0xfffffff8), []byte{0, 0, 0, 10, 0, 0, 5, 10, 0, 0, 20, 5, 1, 0, 25, 0, 0, 0, 10, 10, 1, 0, 25, 0})
+	f.Add(uint32(0xfffffffc), []byte{0, 0, 8, 8, 0, 0, 0, 8, 0, 0, 2, 3, 1, 0, 16, 0, 0, 0, 0, 16, 1, 0, 16, 0})
+	f.Add(uint32(0), []byte{0, 0, 0, 4, 0, 0, 1, 2, 0, 0, 0, 6, 0, 0, 12, 4, 1, 0, 4, 0, 1, 0, 16, 0})
+	f.Add(uint32(0x7ffffff0), []byte{0, 0, 32, 8, 0, 0, 16, 8, 0, 0, 0, 8, 1, 0, 40, 0, 1, 0, 8, 0})
+
+	f.Fuzz(func(t *testing.T, base uint32, ops []byte) {
+		window := newReceiveWindow(4)
+		window.maxSize = 16
+		c := make(chan *TCPPacket, 64)
+		var end uint32
+		var endSet bool
+		var lost int64
+		check := func() {
+			for len(c) > 0 {
+				packet := <-c
+				if len(packet.Payload) == 0 {
+					t.Fatalf("empty packet delivered at %d", packet.Seq-base)
+				}
+				if endSet {
+					diff := compareTCPSeq(packet.Seq, end)
+					if diff < 0 {
+						t.Fatalf("bytes from %d delivered again, delivered to %d", packet.Seq-base, end-base)
+					}
+					lost += int64(diff)
+				}
+				for i, b := range packet.Payload {
+					if offset := packet.Seq + uint32(i) - base; b != fuzzStreamByte(offset) {
+						t.Fatalf("wrong content at %d", offset)
+					}
+				}
+				end, endSet = packet.Seq+uint32(len(packet.Payload)), true
+			}
+			if lost != window.lostBytes {
+				t.Fatalf("lost %d bytes, window counted %d", lost, window.lostBytes)
+			}
+			if endSet && (!window.expectSet || window.expectBegin != end) {
+				t.Fatalf("delivered to %d, window expects %d", end-base, window.expectBegin-base)
+			}
+			if window.size > window.maxSize || len(window.buffer) > window.maxSize {
+				t.Fatalf("window grows to %d packets, buffer %d", window.size, len(window.buffer))
+			}
+		}
+		for ; len(ops) >= 4; ops = ops[4:] {
+			offset := uint32(ops[1])<<8 | uint32(ops[2])
+			if ops[0]%2 == 1 {
+				window.confirm(base+offset, c)
+				check()
+				continue
+			}
+			payload := make([]byte, ops[3]%64)
+			for i := range payload {
+				payload[i] = fuzzStreamByte(offset + uint32(i))
+			}
+			if window.full() {
+				window.forceDeliver(c)
+				check()
+			}
+			window.insert(&TCPPacket{TCP: &layers.TCP{Seq: base + offset, BaseLayer: layers.BaseLayer{Payload: payload}}})
+			check()
+		}
+		// everything hold is delivered by ack after all segments
+		window.confirm(base+1<<16+64, c)
+		check()
+		if window.size != 0 {
+			t.Fatalf("%d packets hold after all acked", window.size)
+		}
+	})
+}
+
+func TestSYNOptions(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	syn := clientPacket(999, 0, "")
+	syn.SYN, syn.ACK = true, false
+	syn.Options = []layers.TCPOption{
+		{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}},
+		{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2},
+		{OptionType: layers.TCPOptionKindNop, OptionLength: 1},
+		{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}},
+	}
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	assembler.assemble(testClientFlow, syn, timestamp)
+	synAck := serverPacket(4999, 1000, "")
+	synAck.SYN = true
+	assembler.assemble(testServerFlow, synAck, timestamp)
+
+	assert.Equal(t, 1, len(handler.connections))
+	connection := handler.connections[0]
+	assert.Equal(t, &TCPOptions{MSS: 1460, WindowScale: 7, SACKPermitted: true}, connection.clientOptions)
+	// no options in SYN-ACK
+	assert.Equal(t, &TCPOptions{WindowScale: -1}, connection.serverOptions)
+
+	info := TsInfo{clientOptions: connection.clientOptions}
+	assert.Contains(t, info.jsonLine(), `"clientOptions":{"mss":1460,"windowScale":7,"sackPermitted":true}`)
+	assert.NotContains(t, info.jsonLine(), "serverOptions")
+}
+
+func TestTsInfoSmallBody(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "POST /small HTTP/1.1\r\nHost: example.com\r\nContent-Length: 20\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 50\r\n\r\n"
+	body := strings.Repeat("a", 50)
+
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	assembler.assemble(testClientFlow, clientPacket(1000+uint32(len(request)), 5000, strings.Repeat("b", 20)), timestamp)
+	assembler.assemble(testServerFlow, serverPacket(5000, 1020+uint32(len(request)), response), timestamp)
+	assembler.assemble(testServerFlow, serverPacket(5000+uint32(len(response)), 1020+uint32(len(request)), body),
+		timestamp.Add(time.Millisecond))
+
+	assert.Equal(t, 1, len(handler.connections))
+	info := gTsInfo[handler.connections[0].key]
+	assert.Equal(t, len(request)+20, info.reqLen)
+	assert.Equal(t, len(response)+50, info.repLen)
+	assert.Equal(t, timestamp.Add(time.Millisecond), info.rep2)
+}
+
+func TestTsInfoEmbeddedReply(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET /dump HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	embedded := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: " + strconv.Itoa(len(embedded)) + "\r\n\r\n"
+
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	assembler.assemble(testServerFlow, serverPacket(5000, 1000+uint32(len(request)), response),
+		timestamp.Add(time.Millisecond))
+	// body segment looks like a response start
+	assembler.assemble(testServerFlow, serverPacket(5000+uint32(len(response)), 1000+uint32(len(request)), embedded),
+		timestamp.Add(2*time.Millisecond))
+
+	assert.Equal(t, 1, len(handler.connections))
+	connection := handler.connections[0]
+	info := gTsInfo[connection.key]
+	assert.Equal(t, timestamp.Add(time.Millisecond), info.rep1)
+	assert.Equal(t, timestamp.Add(2*time.Millisecond), info.rep2)
+	assert.Equal(t, len(response)+len(embedded), info.repLen)
+	assert.True(t, connection.atReplyBoundary())
+
+	// the next response after a request
+	second := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"
+	seq := 5000 + uint32(len(response)+len(embedded))
+	assembler.assemble(testClientFlow, clientPacket(1000+uint32(len(request)), seq, request), timestamp.Add(time.Second))
+	assembler.assemble(testServerFlow, serverPacket(seq, 1000+2*uint32(len(request)), second),
+		timestamp.Add(time.Second+time.Millisecond))
+	info = gTsInfo[connection.key]
+	assert.Equal(t, timestamp.Add(time.Second+time.Millisecond), info.rep1)
+	assert.Equal(t, len(second), info.repLen)
+	// unknown body length, no request waiting
+	assert.False(t, connection.atReplyBoundary())
+}
+
+func TestTsInfoDuplicateSegments(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET /dup HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 200\r\n\r\n"
+	body := strings.Repeat("a", 200)
+	upEnd := 1000 + uint32(len(request))
+	at := func(ms int) time.Time { return timestamp.Add(time.Duration(ms) * time.Millisecond) }
+
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), at(0))
+	assembler.assemble(testServerFlow, serverPacket(5000, upEnd, response), at(1))
+	// duplicate acks between data segments
+	assembler.assemble(testClientFlow, clientPacket(upEnd, 5000, ""), at(2))
+	assembler.assemble(testClientFlow, clientPacket(upEnd, 5000, ""), at(3))
+	// retransmitted response header, and request
+	assembler.assemble(testServerFlow, serverPacket(5000, upEnd, response), at(4))
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), at(5))
+	seq := 5000 + uint32(len(response))
+	assembler.assemble(testServerFlow, serverPacket(seq, upEnd, body[:100]), at(6))
+	// partly retransmitted
+	assembler.assemble(testServerFlow, serverPacket(seq+50, upEnd, body[50:]), at(7))
+	// duplicated on capture
+	assembler.assemble(testServerFlow, serverPacket(seq+50, upEnd, body[50:]), at(8))
+	assembler.assemble(testClientFlow, clientPacket(upEnd, seq+200, ""), at(9))
+
+	assert.Equal(t, 1, len(handler.connections))
+	connection := handler.connections[0]
+	info := gTsInfo[connection.key]
+	assert.Equal(t, at(0), info.req1)
+	assert.Equal(t, at(0), info.req2)
+	assert.Equal(t, at(1), info.rep1)
+	assert.Equal(t, at(7), info.rep2)
+	assert.Equal(t, len(request), info.reqLen)
+	assert.Equal(t, len(response)+len(body), info.repLen)
+	assert.True(t, connection.atReplyBoundary())
+}
+
+func TestDataProgress(t *testing.T) {
+	var progress dataProgress
+	assert.Equal(t, 10, progress.advance(true, 100, 10))
+	assert.Equal(t, 0, progress.advance(true, 100, 10))
+	assert.Equal(t, 5, progress.advance(true, 105, 10))
+	assert.Equal(t, 0, progress.advance(true, 115, 0))
+	// directions are tracked separately
+	assert.Equal(t, 10, progress.advance(false, 100, 10))
+	// after a gap
+	assert.Equal(t, 10, progress.advance(true, 200, 10))
+	// seq wraps around
+	progress = dataProgress{}
+	assert.Equal(t, 10, progress.advance(false, 0xfffffffa, 10))
+	assert.Equal(t, 4, progress.advance(false, 0xfffffffe, 10))
+}
+
+func TestReplyContentLength(t *testing.T) {
+	assert.Equal(t, int64(12), replyContentLength([]byte("HTTP/1.1 200 OK\r\ncontent-length: 12")))
+	assert.Equal(t, int64(-1), replyContentLength([]byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip, chunked")))
+	assert.Equal(t, int64(-1), replyContentLength([]byte("HTTP/1.1 200 OK\r\nConnection: close")))
+}
+
+func TestInverseKey(t *testing.T) {
+	var cases = []struct {
+		first  Endpoint
+		second Endpoint
+		key    string
+	}{
+		{Endpoint{"10.0.0.1", 50000}, Endpoint{"10.0.0.2", 80}, "10.0.0.1:50000-10.0.0.2:80"},
+		{Endpoint{"2001:db8::1", 443}, Endpoint{"::1", 8080}, "[2001:db8::1]:443-[::1]:8080"},
+		{Endpoint{"fe80::1%br-lan", 80}, Endpoint{"fe80::2%br-lan", 50000}, "[fe80::1%br-lan]:80-[fe80::2%br-lan]:50000"},
+		{Endpoint{"::ffff:10.0.0.1", 80}, Endpoint{"10.0.0.1", 80}, "[::ffff:10.0.0.1]:80-10.0.0.1:80"},
+		// loopback to the same endpoint
+		{Endpoint{"127.0.0.1", 8080}, Endpoint{"127.0.0.1", 8080}, "127.0.0.1:8080-127.0.0.1:8080"},
+		{Endpoint{"::1", 8080}, Endpoint{"::1", 8080}, "[::1]:8080-[::1]:8080"},
+	}
+	for _, c := range cases {
+		key := c.first.String() + "-" + c.second.String()
+		assert.Equal(t, c.key, key)
+		inverse := getInverseKey(key)
+		assert.Equal(t, c.second.String()+"-"+c.first.String(), inverse, key)
+		assert.Equal(t, key, getInverseKey(inverse), key)
+	}
+	assert.Equal(t, "malformed", getInverseKey("malformed"))
+	assert.Equal(t, "10.0.0.1:80", getInverseKey("10.0.0.1:80"))
+}
+
+func TestSnapshot(t *testing.T) {
+	assembler, _ := newTestAssembler()
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Empty(t, assembler.Snapshot())
+
+	// snapshot while capturing
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			assembler.Snapshot()
+		}
+		done <- true
+	}()
+
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	assembler.assemble(testServerFlow, serverPacket(5000, 1000+uint32(len(request)), "HTTP/1.1 200 OK\r\n"),
+		timestamp.Add(time.Second))
+
+	syn := &layers.TCP{SrcPort: 50001, DstPort: 22, Seq: 100, SYN: true}
+	assembler.assemble(testClientFlow, syn, timestamp.Add(2*time.Second))
+	fin := &layers.TCP{SrcPort: 50001, DstPort: 22, Seq: 101, Ack: 1, ACK: true, FIN: true}
+	assembler.assemble(testClientFlow, fin, timestamp.Add(3*time.Second))
+	<-done
+
+	infos := assembler.Snapshot()
+	assert.Equal(t, 2, len(infos))
+	assert.Equal(t, ConnectionInfo{Key: "10.0.0.1:50000-10.0.0.2:80", Client: "10.0.0.1:50000", Server: "10.0.0.2:80",
+		HTTP: true, UpBytes: int64(len(request)), DownBytes: 17, DataSegments: 2, Scheme: "http", State: "open",
+		Intervals: IntervalStats{Count: 1, Min: time.Second, Max: time.Second, Mean: time.Second}, Created: timestamp,
+		LastActivity: timestamp.Add(time.Second)}, infos[0])
+	assert.Equal(t, ConnectionInfo{Key: "10.0.0.1:50001-10.0.0.2:22", Client: "10.0.0.1:50001", Server: "10.0.0.2:22",
+		State: "client-closed", Created: timestamp.Add(2 * time.Second), LastActivity: timestamp.Add(3 * time.Second)},
+		infos[1])
+}
+
+func TestServerPorts(t *testing.T) {
+	clientFlow, serverFlow := ipv4Flow("10.0.0.1", "10.0.0.2"), ipv4Flow("10.0.0.2", "10.0.0.1")
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	// server response body segment looks like a request, and arrives before client data
+	serverData := &layers.TCP{SrcPort: 9000, DstPort: 40000, Seq: 5000, Ack: 1000, ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: []byte("POST /jobs HTTP/1.1\r\n")}}
+	clientData := &layers.TCP{SrcPort: 40000, DstPort: 9000, Seq: 1000, Ack: 5021, ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: []byte("GET /status HTTP/1.1\r\nHost: example.com\r\n\r\n")}}
+
+	// without hint, the server is taken as client
+	assembler, handler := newTestAssembler()
+	assembler.assemble(serverFlow, serverData, timestamp)
+	assert.Equal(t, 1, len(handler.connections))
+	assert.Equal(t, Endpoint{"10.0.0.2", 9000}, handler.connections[0].clientID)
+
+	ports, err := parsePortSet("8080, 9000")
+	assert.Nil(t, err)
+	assembler, handler = newTestAssembler()
+	assembler.serverPorts = ports
+	assembler.assemble(serverFlow, serverData, timestamp)
+	assert.Empty(t, handler.connections)
+	assembler.assemble(clientFlow, clientData, timestamp)
+	assembler.assemble(serverFlow, serverData, timestamp)
+	assert.Equal(t, 1, len(handler.connections))
+	connection := handler.connections[0]
+	assert.Equal(t, Endpoint{"10.0.0.1", 40000}, connection.clientID)
+	assert.True(t, connection.isHTTP)
+	assert.Equal(t, "10.0.0.1:40000", assembler.Snapshot()[0].Client)
+
+	_, err = parsePortSet("80,http")
+	assert.NotNil(t, err)
+}
+
+// records lifecycle events of connections
+type lifecycleConnectionHandler struct {
+	recordConnectionHandler
+	events []string
+}
+
+func (handler *lifecycleConnectionHandler) OnEstablished(connection *TCPConnection) {
+	handler.events = append(handler.events, "established")
+}
+
+func (handler *lifecycleConnectionHandler) OnHTTPDetected(connection *TCPConnection) {
+	handler.events = append(handler.events, "http")
+}
+
+func (handler *lifecycleConnectionHandler) OnHalfClosed(connection *TCPConnection, client bool) {
+	if client {
+		handler.events = append(handler.events, "client-closed")
+	} else {
+		handler.events = append(handler.events, "server-closed")
+	}
+}
+
+func TestConnectionLifecycle(t *testing.T) {
+	handler := &lifecycleConnectionHandler{}
+	assembler := newTCPAssembler(handler, &Printer{outputQueue: make(chan string, 1024)})
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	syn := clientPacket(999, 0, "")
+	syn.SYN, syn.ACK = true, false
+	assembler.assemble(testClientFlow, syn, timestamp)
+	synAck := serverPacket(4999, 1000, "")
+	synAck.SYN = true
+	assembler.assemble(testServerFlow, synAck, timestamp)
+	assert.Empty(t, handler.events)
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, ""), timestamp)
+	assert.Equal(t, []string{"established"}, handler.events)
+
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), timestamp)
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, "GET /2 HTTP/1.1\r\nHost: example.com\r\n\r\n"), timestamp)
+	assert.Equal(t, []string{"established", "http"}, handler.events)
+
+	// handshake not captured
+	handler = &lifecycleConnectionHandler{}
+	assembler = newTCPAssembler(handler, &Printer{outputQueue: make(chan string, 1024)})
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), timestamp)
+	assert.Equal(t, []string{"established", "http"}, handler.events)
+}
+
+func TestHalfClose(t *testing.T) {
+	handler := &lifecycleConnectionHandler{}
+	assembler := newTCPAssembler(handler, &Printer{outputQueue: make(chan string, 1024)})
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+	// client sends request and FIN, data is not delivered until acked
+	fin := clientPacket(1000, 5000, request)
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, timestamp)
+	connection := handler.connections[0]
+	assert.False(t, connection.upStream.finished)
+	assembler.assemble(testServerFlow, serverPacket(5000, 1000+uint32(len(request))+1, ""), timestamp)
+	assert.True(t, connection.upStream.finished)
+	assert.False(t, connection.downStream.finished)
+	assert.Equal(t, []string{"established", "http", "client-closed"}, handler.events)
+	data, err := ioutil.ReadAll(connection.upStream)
+	assert.Nil(t, err)
+	assert.Equal(t, request, string(data))
+
+	// server still sends response in the open direction
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+	assembler.assemble(testServerFlow, serverPacket(5000, 1000+uint32(len(request))+1, response), timestamp)
+	assembler.assemble(testClientFlow, clientPacket(1000+uint32(len(request))+1, 5000+uint32(len(response)), ""),
+		timestamp)
+	buffer := make([]byte, len(response))
+	_, err = io.ReadFull(connection.downStream, buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, response, string(buffer))
+	assert.False(t, connection.downStream.finished)
+
+	// server closes, connection ends without closing the finished stream again
+	fin = serverPacket(5000+uint32(len(response)), 1000+uint32(len(request))+1, "")
+	fin.FIN = true
+	assembler.assemble(testServerFlow, fin, timestamp)
+	assert.True(t, connection.downStream.finished)
+	assert.Equal(t, []string{"established", "http", "client-closed"}, handler.events)
+}
+
+func TestCloseReason(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	newConnection := func() (*TCPAssembler, *TCPConnection) {
+		assembler, handler := newTestAssembler()
+		assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), start)
+		assert.Equal(t, 1, len(handler.connections))
+		assert.Equal(t, "", handler.connections[0].closeReason())
+		return assembler, handler.connections[0]
+	}
+
+	assembler, connection := newConnection()
+	fin := clientPacket(1000+uint32(len(request)), 5000, "")
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, start)
+	assert.Equal(t, "", connection.closeReason())
+	fin = serverPacket(5000, 1001+uint32(len(request)), "")
+	fin.FIN = true
+	assembler.assemble(testServerFlow, fin, start)
+	assert.Equal(t, closeByFIN, connection.closeReason())
+
+	assembler, connection = newConnection()
+	rst := serverPacket(5000, 1000+uint32(len(request)), "")
+	rst.RST = true
+	assembler.assemble(testServerFlow, rst, start)
+	assert.True(t, connection.closed())
+	assert.Equal(t, 0, len(assembler.connectionDict))
+	assert.Equal(t, closeByRST, connection.closeReason())
+
+	assembler, connection = newConnection()
+	assembler.flushOlderThan(start.Add(time.Minute))
+	assert.Equal(t, closeByIdle, connection.closeReason())
+
+	assembler, connection = newConnection()
+	assembler.maxLifetime = time.Minute
+	assembler.assemble(testServerFlow, serverPacket(5000, 1000+uint32(len(request)), "HTTP/1.1 200 OK\r\n"),
+		start.Add(time.Minute))
+	assert.Equal(t, closeByLifetime, connection.closeReason())
+
+	assembler, connection = newConnection()
+	assembler.finishAll()
+	assert.Equal(t, closeByCaptureEnd, connection.closeReason())
+	assert.Equal(t, closeByCaptureEnd, connection.info.CloseReason)
+}
+
+func TestIsHTTPRequestData(t *testing.T) {
+	assert.True(t, isHTTPRequestData([]byte("GET / HTTP/1.1\r\n")))
+	assert.True(t, isHTTPRequestData([]byte("OPTIONS * HTTP/1.1\r\n")))
+	assert.True(t, isHTTPRequestData([]byte("CONNECT example.com:443 HTTP/1.1\r\n")))
+	assert.False(t, isHTTPRequestData([]byte("GET /")))
+	assert.False(t, isHTTPRequestData([]byte("GETTING / HTTP/1.1\r\n")))
+	assert.False(t, isHTTPRequestData([]byte(" GET / HTTP/1.1\r\n")))
+	assert.False(t, isHTTPRequestData([]byte("get / HTTP/1.1\r\n")))
+}
+
+func FuzzIsHTTPRequestData(f *testing.F) {
+	for _, seed := range []string{"GET / HTTP/1.1\r\n", "OPTIONS * HTTP/1.1\r\n", "PRI * HTTP/2.0\r\n", "GET ",
+		"", " ", "        ", "\x16\x03\x01\x02\x00\x01\x00\x01"} {
+		f.Add([]byte(seed), requestMethodWindow)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, window int) {
+		if isHTTPRequestData(data) {
+			method := requestMethod(data, requestMethodWindow)
+			if !httpMethods[method] || !strings.HasPrefix(string(data), method+" ") {
+				t.Fatalf("%q detected as request with method %q", data, method)
+			}
+		}
+		method := requestMethod(data, window)
+		if method != "" && (len(method) >= window || !strings.HasPrefix(string(data), method+" ")) {
+			t.Fatalf("method %q of %q in window %d", method, data, window)
+		}
+	})
+}
+
+func TestUnidirectional(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// only client to server is captured, data waits ACKs which never come
+	assembler, handler := newTestAssembler()
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	assert.Equal(t, 0, len(handler.connections[0].upStream.c))
+
+	assembler, handler = newTestAssembler()
+	assembler.unidirectional = true
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	connection := handler.connections[0]
+	assert.Equal(t, 1, len(connection.upStream.c))
+	// out of order packet is hold until the gap is filled
+	next := 1000 + uint32(len(request))
+	assembler.assemble(testClientFlow, clientPacket(next+5, 5000, request), timestamp)
+	assert.Equal(t, 1, len(connection.upStream.c))
+	assembler.assemble(testClientFlow, clientPacket(next, 5000, "GET /"), timestamp)
+	assert.Equal(t, 3, len(connection.upStream.c))
+}
+
+func TestRejectNonHTTP(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	hello := append([]byte{tlsRecordHandshake, 3, 1, 0, 40}, make([]byte, 40)...)
+	feed := func(assembler *TCPAssembler, port layers.TCPPort) {
+		assembler.assemble(testClientFlow, &layers.TCP{SrcPort: 50000, DstPort: port, Seq: 999, SYN: true}, start)
+		assembler.assemble(testClientFlow, &layers.TCP{SrcPort: 50000, DstPort: port, Seq: 1000, Ack: 5000,
+			ACK: true, BaseLayer: layers.BaseLayer{Payload: hello[:20]}}, start)
+		assembler.assemble(testClientFlow, &layers.TCP{SrcPort: 50000, DstPort: port, Seq: 1020, Ack: 5000,
+			ACK: true, BaseLayer: layers.BaseLayer{Payload: hello[20:]}}, start)
+	}
+
+	assembler, _ := newTestAssembler()
+	assembler.filterPort = 80
+	assembler.rejectNonHTTP = 32
+	feed(assembler, 80)
+	// finalized after threshold, without waiting close
+	assert.Equal(t, 0, len(assembler.Snapshot()))
+	var records []string
+	for len(assembler.printer.outputQueue) > 0 {
+		records = append(records, <-assembler.printer.outputQueue)
+	}
+	assert.Equal(t, []string{"[not-http] 10.0.0.1:50000-10.0.0.2:80 port=80 bytes=45 tls\n"}, records)
+	// following packets do not create connection again
+	assembler.assemble(testClientFlow, clientPacket(1045, 5000, "more"), start)
+	assert.Equal(t, 0, len(assembler.Snapshot()))
+
+	// rejected connection ends like the others, with throughput reported
+	assembler, _ = newTestAssembler()
+	assembler.filterPort = 80
+	assembler.rejectNonHTTP = 32
+	assembler.throughput = &ThroughputReporter{}
+	feed(assembler, 80)
+	records = nil
+	for len(assembler.printer.outputQueue) > 0 {
+		records = append(records, <-assembler.printer.outputQueue)
+	}
+	if assert.Equal(t, 2, len(records)) {
+		assert.True(t, strings.HasPrefix(records[0], "[not-http]"))
+		assert.True(t, strings.HasPrefix(records[1], "[throughput]"), records[1])
+	}
+
+	// connections not on server ports keep open
+	assembler, _ = newTestAssembler()
+	assembler.serverPorts = map[uint16]bool{80: true}
+	assembler.rejectNonHTTP = 32
+	feed(assembler, 9000)
+	if infos := assembler.Snapshot(); assert.Equal(t, 1, len(infos)) {
+		assert.Equal(t, "", infos[0].CloseReason)
+	}
+	assert.Equal(t, 0, len(assembler.printer.outputQueue))
+	feed(assembler, 80)
+	assert.Equal(t, 1, len(assembler.Snapshot()))
+	assert.Equal(t, 1, len(assembler.printer.outputQueue))
+}
+
+func TestFinishIdempotent(t *testing.T) {
+	timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+	// finished twice, and again by idle flush and capture end
+	assembler, handler := newTestAssembler()
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	connection := handler.connections[0]
+	assert.NotPanics(t, func() {
+		connection.finish()
+		connection.finish()
+		connection.flushOlderThan()
+		assembler.flushOlderThan(timestamp.Add(time.Second))
+		assembler.finishAll()
+	})
+	assert.True(t, connection.upStream.finished)
+	assert.True(t, connection.downStream.finished)
+	_, err := ioutil.ReadAll(connection.upStream)
+	assert.Nil(t, err)
+
+	// closed by FIN, then finished by idle flush and capture end
+	assembler, handler = newTestAssembler()
+	assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+	connection = handler.connections[0]
+	fin := serverPacket(5000, 1000+uint32(len(request)), "")
+	fin.FIN = true
+	assembler.assemble(testServerFlow, fin, timestamp)
+	fin = clientPacket(1000+uint32(len(request)), 5001, "")
+	fin.FIN = true
+	assembler.assemble(testClientFlow, fin, timestamp)
+	assert.True(t, connection.closed())
+	assert.NotPanics(t, func() {
+		connection.flushOlderThan()
+		connection.finish()
+		assembler.finishAll()
+	})
+}
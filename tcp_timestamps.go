@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// parse TSval and TSecr of tcp Timestamps option(rfc 7323)
+func parseTCPTimestamps(tcp *layers.TCP) (tsval uint32, tsecr uint32, ok bool) {
+	for _, option := range tcp.Options {
+		if option.OptionType == layers.TCPOptionKindTimestamps && len(option.OptionData) >= 8 {
+			return binary.BigEndian.Uint32(option.OptionData), binary.BigEndian.Uint32(option.OptionData[4:]), true
+		}
+	}
+	return 0, 0, false
+}
+
+// pendingTimestamp is a TSval sent by one side, waiting to be echoed by the other side
+type pendingTimestamp struct {
+	value     uint32
+	timestamp time.Time // capture time of the first packet carrying the value
+	echoed    bool
+}
+
+// rttEstimator estimate rtt by tcp Timestamps echoes. A TSval sent by client and echoed by server gives the
+// rtt from capture point to server, and the reverse gives the rtt from capture point to client, the rtt
+// is the sum of them. Each half is smoothed as rfc 6298 srtt.
+// Sides are indexed by sender of the first tracked packet, as client may be not known yet
+type rttEstimator struct {
+	first    *Endpoint           // side 0
+	pending  [2]pendingTimestamp // by the side sent TSval
+	smoothed [2]time.Duration    // by the side echoed
+	samples  [2]int
+}
+
+// track tcp Timestamps option of a packet from src, return true if a new rtt sample is taken
+func (estimator *rttEstimator) track(src Endpoint, tcp *layers.TCP, timestamp time.Time) bool {
+	tsval, tsecr, ok := parseTCPTimestamps(tcp)
+	if !ok {
+		return false
+	}
+	if estimator.first == nil {
+		estimator.first = &src
+	}
+	sent, peer := 0, 1
+	if !estimator.first.equals(src) {
+		sent, peer = 1, 0
+	}
+	sampled := false
+	if pending := &estimator.pending[peer]; tsecr != 0 && !pending.echoed && !pending.timestamp.IsZero() &&
+		tsecr == pending.value {
+		pending.echoed = true
+		estimator.addSample(sent, timestamp.Sub(pending.timestamp))
+		sampled = true
+	}
+	// retransmissions and following segments may carry the same value, keep the first seen one
+	if pending := &estimator.pending[sent]; pending.timestamp.IsZero() || tsval != pending.value {
+		*pending = pendingTimestamp{value: tsval, timestamp: timestamp}
+	}
+	return sampled
+}
+
+func (estimator *rttEstimator) addSample(half int, sample time.Duration) {
+	if sample < 0 {
+		return
+	}
+	if estimator.samples[half] == 0 {
+		estimator.smoothed[half] = sample
+	} else {
+		estimator.smoothed[half] = estimator.smoothed[half] - estimator.smoothed[half]/8 + sample/8
+	}
+	estimator.samples[half]++
+}
+
+// estimated rtt, 0 if no sample taken. if only one half has samples, it is the rtt
+func (estimator *rttEstimator) rtt() time.Duration {
+	return estimator.smoothed[0] + estimator.smoothed[1]
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// add tcp Timestamps option to packet
+func withTimestamps(tcp *layers.TCP, tsval uint32, tsecr uint32) *layers.TCP {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, tsval)
+	binary.BigEndian.PutUint32(data[4:], tsecr)
+	tcp.Options = append(tcp.Options, layers.TCPOption{OptionType: layers.TCPOptionKindTimestamps,
+		OptionLength: 10, OptionData: data})
+	return tcp
+}
+
+func TestTimestampsRTT(t *testing.T) {
+	assembler, handler := newTestAssembler()
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+	requestEnd := 1001 + uint32(len(request))
+
+	// capture point is 20ms to server, 1ms to client
+	syn := withTimestamps(&layers.TCP{SrcPort: 50000, DstPort: 80, Seq: 1000, SYN: true}, 100, 0)
+	assembler.assemble(testClientFlow, syn, at(0))
+	synAck := withTimestamps(&layers.TCP{SrcPort: 80, DstPort: 50000, Seq: 5000, Ack: 1001, SYN: true, ACK: true},
+		7000, 100)
+	assembler.assemble(testServerFlow, synAck, at(20))
+	assembler.assemble(testClientFlow, withTimestamps(clientPacket(1001, 5001, ""), 101, 7000), at(21))
+	assembler.assemble(testClientFlow, withTimestamps(clientPacket(1001, 5001, request), 102, 7000), at(22))
+	// server side sample of 30ms
+	assembler.assemble(testServerFlow, withTimestamps(serverPacket(5001, requestEnd, response), 7001, 102), at(52))
+	// client side sample of 3ms
+	assembler.assemble(testClientFlow, withTimestamps(clientPacket(requestEnd, 5001+uint32(len(response)), ""),
+		103, 7001), at(55))
+	// echo again, or echo of old value is not sampled
+	assembler.assemble(testServerFlow, withTimestamps(serverPacket(5001, requestEnd, ""), 7001, 102), at(200))
+	assembler.assemble(testClientFlow, withTimestamps(clientPacket(requestEnd, 5001+uint32(len(response)), ""),
+		104, 7000), at(300))
+
+	assert.Equal(t, 1, len(handler.connections))
+	connection := handler.connections[0]
+	// server side: 20ms, then 30ms smoothed by 1/8; client side: 1ms, then 3ms smoothed by 1/8
+	serverRTT := 20*time.Millisecond - 20*time.Millisecond/8 + 30*time.Millisecond/8
+	clientRTT := time.Millisecond - time.Millisecond/8 + 3*time.Millisecond/8
+	assert.Equal(t, [2]int{2, 2}, connection.rtt.samples)
+	assert.Equal(t, serverRTT+clientRTT, connection.rtt.rtt())
+	assert.Equal(t, serverRTT+clientRTT, assembler.Snapshot()[0].RTT)
+	info := gTsInfo[connection.key]
+	assert.Equal(t, serverRTT+clientRTT, info.rtt)
+	assert.Contains(t, info.jsonLine(), `"rtt":22500000`)
+}
+
+func TestTimestampsAbsent(t *testing.T) {
+	var estimator rttEstimator
+	assert.False(t, estimator.track(Endpoint{"10.0.0.1", 50000}, clientPacket(1000, 5000, "data"), time.Now()))
+	assert.Equal(t, time.Duration(0), estimator.rtt())
+	assert.NotContains(t, TsInfo{}.jsonLine(), "rtt")
+}
@@ -167,24 +167,43 @@ func byteToStringWithCharset(data []byte, charset string) (string, error) {
 	return readToStringWithCharset(reader, charset)
 }
 
-// parse content type to mimeType and charset
+// decode data in charset to utf-8 string. data is kept as is if charset is empty, utf-8 or unknown,
+// return true if data is transcoded
+func decodeCharset(data []byte, charset string) (string, bool) {
+	if charset == "" || strings.EqualFold(charset, "UTF-8") || strings.EqualFold(charset, "UTF8") {
+		return string(data), false
+	}
+	str, err := byteToStringWithCharset(data, charset)
+	if err != nil {
+		logger.Debug("decode body with charset", charset, "error:", err)
+		return string(data), false
+	}
+	return str, true
+}
+
+// replace charset parameter of content type with utf-8
+func utf8ContentType(contentType string) string {
+	params := splitQuoted(contentType, ';')
+	for i, param := range params[1:] {
+		if idx := strings.IndexByte(param, '='); idx >= 0 && strings.EqualFold(strings.TrimSpace(param[:idx]), "charset") {
+			params[i+1] = " charset=utf-8"
+		}
+	}
+	return strings.Join(params, ";")
+}
+
+// parse content type to mimeType and charset parameter, e.g. text/html; charset="ISO-8859-1".
+// charset is empty if not set
 func parseContentType(contentType string) (string, string) {
-	var mimeTypeStr, charset string
-	idx := strings.Index(contentType, ";")
-	if idx < 0 {
-		mimeTypeStr = strings.TrimSpace(contentType)
-		charset = ""
-	} else {
-		mimeTypeStr = strings.TrimSpace(contentType[:idx])
-		charsetSeg := strings.TrimSpace(contentType[idx+1:])
-		eidx := strings.Index(charsetSeg, "=")
-		if eidx < 0 {
-			charset = ""
-		} else {
-			charset = strings.TrimSpace(charsetSeg[eidx+1:])
+	params := splitQuoted(contentType, ';')
+	mimeTypeStr := strings.TrimSpace(params[0])
+	for _, param := range params[1:] {
+		idx := strings.IndexByte(param, '=')
+		if idx >= 0 && strings.EqualFold(strings.TrimSpace(param[:idx]), "charset") {
+			return mimeTypeStr, unquote(strings.TrimSpace(param[idx+1:]))
 		}
 	}
-	return mimeTypeStr, charset
+	return mimeTypeStr, ""
 }
 
 // if sting 'looks like' a json string
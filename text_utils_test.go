@@ -41,3 +41,33 @@ func TestWildcardMatch(t *testing.T) {
 	assert.False(t, wildcardMatch("test", "tt*"))
 	assert.False(t, wildcardMatch("test", "es"))
 }
+
+func TestParseContentType(t *testing.T) {
+	mimeType, charset := parseContentType("text/html; charset=UTF-8")
+	assert.Equal(t, "text/html", mimeType)
+	assert.Equal(t, "UTF-8", charset)
+	// not the first parameter, quoted
+	mimeType, charset = parseContentType(`multipart/mixed; boundary="a;b"; Charset="iso-8859-1"`)
+	assert.Equal(t, "multipart/mixed", mimeType)
+	assert.Equal(t, "iso-8859-1", charset)
+	mimeType, charset = parseContentType("application/json")
+	assert.Equal(t, "application/json", mimeType)
+	assert.Equal(t, "", charset)
+}
+
+func TestDecodeCharset(t *testing.T) {
+	str, transcoded := decodeCharset([]byte("caf\xe9"), "ISO-8859-1")
+	assert.Equal(t, "café", str)
+	assert.True(t, transcoded)
+	str, _ = decodeCharset([]byte("\x93\xfa\x96\x7b"), "Shift_JIS")
+	assert.Equal(t, "日本", str)
+	// raw bytes for unknown charset
+	str, transcoded = decodeCharset([]byte("caf\xe9"), "x-unknown")
+	assert.Equal(t, "caf\xe9", str)
+	assert.False(t, transcoded)
+	str, transcoded = decodeCharset([]byte("café"), "utf-8")
+	assert.Equal(t, "café", str)
+	assert.False(t, transcoded)
+
+	assert.Equal(t, "text/plain; charset=utf-8; format=flowed", utf8ContentType(`text/plain; Charset="latin1"; format=flowed`))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ThroughputReporter report average throughput of each direction of connections when they end, by payload bytes
+// over the active duration from the first to the last packet. Directions out of thresholds are flagged
+type ThroughputReporter struct {
+	slow float64 // bytes per second, directions lower than it are flagged slow. 0 for not flagged
+	fast float64 // bytes per second, directions higher than it are flagged fast. 0 for not flagged
+}
+
+// throughput of one direction
+type directionThroughput struct {
+	bytes int64
+	rate  float64 // bytes per second, 0 if duration is 0
+	flag  string  // slow | fast, empty if within thresholds
+}
+
+func (reporter *ThroughputReporter) measure(bytes int64, duration time.Duration) directionThroughput {
+	throughput := directionThroughput{bytes: bytes}
+	if duration <= 0 || bytes == 0 {
+		// rate is meaningless for a direction without data, or a connection seen at one instant
+		return throughput
+	}
+	throughput.rate = float64(bytes) / duration.Seconds()
+	if reporter.slow > 0 && throughput.rate < reporter.slow {
+		throughput.flag = "slow"
+	} else if reporter.fast > 0 && throughput.rate > reporter.fast {
+		throughput.flag = "fast"
+	}
+	return throughput
+}
+
+// report throughput of the ended connection
+func (assembler *TCPAssembler) reportThroughput(connection *TCPConnection) {
+	reporter := assembler.throughput
+	if reporter == nil {
+		return
+	}
+	info := connection.snapshot()
+	duration := info.LastActivity.Sub(info.Created)
+	up := reporter.measure(info.UpBytes, duration)
+	down := reporter.measure(info.DownBytes, duration)
+	if assembler.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":      "throughput",
+			"src":       info.Client,
+			"dst":       info.Server,
+			"duration":  duration.Nanoseconds(),
+			"upBytes":   up.bytes,
+			"upRate":    up.rate,
+			"upFlag":    up.flag,
+			"downBytes": down.bytes,
+			"downRate":  down.rate,
+			"downFlag":  down.flag,
+		})
+		assembler.printer.send(string(data) + "\n")
+		return
+	}
+	var fields = []string{"[throughput]", info.Client, "->", info.Server, "duration=" + duration.String(),
+		fmt.Sprintf("up=%dB %.0fB/s", up.bytes, up.rate), fmt.Sprintf("down=%dB %.0fB/s", down.bytes, down.rate)}
+	for _, direction := range []struct {
+		name string
+		flag string
+	}{{"up", up.flag}, {"down", down.flag}} {
+		if direction.flag != "" {
+			fields = append(fields, direction.flag+"="+direction.name)
+		}
+	}
+	assembler.printer.send(strings.Join(fields, " ") + "\n")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughput(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n" + strings.Repeat("a", 63)
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 1000\r\n\r\n"
+	response += strings.Repeat("b", 2000-len(response))
+	for _, format := range []string{"text", "json"} {
+		assembler, _ := newTestAssembler()
+		assembler.format = format
+		assembler.throughput = &ThroughputReporter{slow: 500, fast: 800}
+		timestamp := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		upEnd, downEnd := 1000+uint32(len(request)), 5000+uint32(len(response))
+		assembler.assemble(testClientFlow, clientPacket(1000, 5000, request), timestamp)
+		assembler.assemble(testServerFlow, serverPacket(5000, upEnd, response[:1000]), timestamp.Add(time.Second))
+		assembler.assemble(testServerFlow, serverPacket(5000+1000, upEnd, response[1000:]),
+			timestamp.Add(1500*time.Millisecond))
+		fin := clientPacket(upEnd, downEnd, "")
+		fin.FIN = true
+		assembler.assemble(testClientFlow, fin, timestamp.Add(1900*time.Millisecond))
+		fin = serverPacket(downEnd, upEnd+1, "")
+		fin.FIN = true
+		assembler.assemble(testServerFlow, fin, timestamp.Add(2*time.Second))
+
+		var records []string
+		for len(assembler.printer.outputQueue) > 0 {
+			if msg := <-assembler.printer.outputQueue; strings.Contains(msg, "throughput") {
+				records = append(records, msg)
+			}
+		}
+		if !assert.Equal(t, 1, len(records)) {
+			continue
+		}
+		if format == "text" {
+			// 100 bytes up, 2000 bytes down in 2 seconds
+			assert.Equal(t, "[throughput] 10.0.0.1:50000 -> 10.0.0.2:80 duration=2s up=100B 50B/s down=2000B 1000B/s "+
+				"slow=up fast=down\n", records[0])
+			continue
+		}
+		var record map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(records[0]), &record))
+		assert.Equal(t, float64(2*time.Second), record["duration"])
+		assert.Equal(t, float64(50), record["upRate"])
+		assert.Equal(t, float64(1000), record["downRate"])
+		assert.Equal(t, "slow", record["upFlag"])
+		assert.Equal(t, "fast", record["downFlag"])
+	}
+}
+
+func TestThroughputMeasure(t *testing.T) {
+	reporter := &ThroughputReporter{}
+	assert.Equal(t, directionThroughput{bytes: 10}, reporter.measure(10, 0))
+	assert.Equal(t, directionThroughput{bytes: 10, rate: 20}, reporter.measure(10, 500*time.Millisecond))
+}
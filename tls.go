@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	tlsRecordHandshake  = 0x16
+	tlsClientHello      = 1
+	tlsServerHello      = 2
+	tlsExtServerName    = 0
+	tlsExtALPN          = 16
+	tlsExtSupportedVers = 43
+	tlsMaxRecordPayload = 1<<14 + 2048
+)
+
+var errNotTLSHandshake = errors.New("not tls handshake")
+
+// tlsHello is info parsed from tls ClientHello or ServerHello, without decryption
+type tlsHello struct {
+	handshakeType byte
+	version       uint16 // legacy version field in hello message
+	// version selected by server in supported_versions extension, set by TLS 1.3 ServerHello only
+	supportedVersion uint16
+	serverName       string   // sni, ClientHello only
+	alpn             []string // protocols offered by client, or the one selected by server
+	cipherSuites     []uint16 // offered by client, or the one selected by server
+}
+
+// if data looks like start of a tls handshake record
+func isTLSHandshake(data []byte) bool {
+	return len(data) >= 3 && data[0] == tlsRecordHandshake && data[1] == 3 && data[2] <= 4
+}
+
+// infer scheme of connection by its first payload, https if it is a tls handshake, http if it is a http request.
+// empty if unknown
+func inferScheme(payload []byte) string {
+	if isTLSHandshake(payload) {
+		return "https"
+	}
+	if isHTTPRequestData(payload) {
+		return "http"
+	}
+	return ""
+}
+
+// protocol selected by server in the ServerHello record starting payload, the first segment from server.
+// The record may continue in later segments, ALPN extension is found if it is in this one.
+// empty if payload is not a ServerHello, or server selected no protocol. TLS 1.3 servers send ALPN in
+// encrypted extensions, so it is not known for them
+func serverHelloALPN(payload []byte) string {
+	hello := parseServerHello(payload)
+	if hello == nil || len(hello.alpn) != 1 {
+		return ""
+	}
+	return hello.alpn[0]
+}
+
+// the ServerHello record starting payload, nil if payload is not one
+func parseServerHello(payload []byte) *tlsHello {
+	if !isTLSHandshake(payload) || len(payload) < 5 {
+		return nil
+	}
+	hello, err := parseTLSHello(payload[5:])
+	if err != nil || hello.handshakeType != tlsServerHello {
+		return nil
+	}
+	return hello
+}
+
+// negotiated version of ServerHello, like TLS 1.2. TLS 1.3 sets legacy version to 1.2, and the real one in
+// supported_versions extension
+func (hello *tlsHello) negotiatedVersion() string {
+	if hello.supportedVersion != 0 {
+		return tls.VersionName(hello.supportedVersion)
+	}
+	return tls.VersionName(hello.version)
+}
+
+// cipher suite selected by server, like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Unknown ones are in hex
+func (hello *tlsHello) selectedCipherSuite() string {
+	if hello.handshakeType != tlsServerHello || len(hello.cipherSuites) != 1 {
+		return ""
+	}
+	return tls.CipherSuiteName(hello.cipherSuites[0])
+}
+
+// read one tls handshake record from reader, and parse the hello message in it
+func readTLSHello(reader io.Reader) (*tlsHello, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, err
+	}
+	if !isTLSHandshake(header[:]) {
+		return nil, errNotTLSHandshake
+	}
+	length := int(binary.BigEndian.Uint16(header[3:]))
+	if length > tlsMaxRecordPayload {
+		return nil, errNotTLSHandshake
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	return parseTLSHello(payload)
+}
+
+// parse ClientHello or ServerHello handshake message
+func parseTLSHello(data []byte) (*tlsHello, error) {
+	r := tlsReader(data)
+	msgType, ok := r.uint8()
+	if !ok || (msgType != tlsClientHello && msgType != tlsServerHello) {
+		return nil, errNotTLSHandshake
+	}
+	if len(r) < 3 {
+		return nil, errNotTLSHandshake
+	}
+	body, ok := r.bytes24()
+	if !ok {
+		// hello message span multi records, parse what we have
+		body = r[3:]
+	}
+	hello := &tlsHello{handshakeType: msgType}
+	r = body
+	if hello.version, ok = r.uint16(); !ok {
+		return nil, errNotTLSHandshake
+	}
+	if !r.skip(32) { // random
+		return nil, errNotTLSHandshake
+	}
+	if _, ok = r.bytes8(); !ok { // session id
+		return nil, errNotTLSHandshake
+	}
+	if msgType == tlsClientHello {
+		suites, ok := r.bytes16()
+		if !ok {
+			return nil, errNotTLSHandshake
+		}
+		for len(suites) >= 2 {
+			hello.cipherSuites = append(hello.cipherSuites, binary.BigEndian.Uint16(suites))
+			suites = suites[2:]
+		}
+		if _, ok = r.bytes8(); !ok { // compression methods
+			return nil, errNotTLSHandshake
+		}
+	} else {
+		suite, ok := r.uint16()
+		if !ok || !r.skip(1) { // compression method
+			return nil, errNotTLSHandshake
+		}
+		hello.cipherSuites = []uint16{suite}
+	}
+
+	extensions, ok := r.bytes16()
+	if !ok {
+		// no extensions
+		return hello, nil
+	}
+	for len(extensions) > 0 {
+		extType, ok1 := extensions.uint16()
+		extData, ok2 := extensions.bytes16()
+		if !ok1 || !ok2 {
+			break
+		}
+		switch extType {
+		case tlsExtServerName:
+			hello.serverName = parseTLSServerName(extData)
+		case tlsExtALPN:
+			hello.alpn = parseTLSALPN(extData)
+		case tlsExtSupportedVers:
+			// client lists versions it supports, server sends the selected one
+			if msgType == tlsServerHello {
+				hello.supportedVersion, _ = extData.uint16()
+			}
+		}
+	}
+	return hello, nil
+}
+
+func parseTLSServerName(data tlsReader) string {
+	list, ok := data.bytes16()
+	if !ok {
+		return ""
+	}
+	for len(list) > 0 {
+		nameType, ok1 := list.uint8()
+		name, ok2 := list.bytes16()
+		if !ok1 || !ok2 {
+			return ""
+		}
+		if nameType == 0 {
+			return string(name)
+		}
+	}
+	return ""
+}
+
+func parseTLSALPN(data tlsReader) []string {
+	list, ok := data.bytes16()
+	if !ok {
+		return nil
+	}
+	var protocols []string
+	for len(list) > 0 {
+		protocol, ok := list.bytes8()
+		if !ok {
+			break
+		}
+		protocols = append(protocols, string(protocol))
+	}
+	return protocols
+}
+
+// tlsReader read big-endian values from tls message
+type tlsReader []byte
+
+func (r *tlsReader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *tlsReader) uint8() (byte, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *tlsReader) uint16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+// read a length-prefixed vector, n is the size of length
+func (r *tlsReader) vector(n int) (tlsReader, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	var length int
+	for i := 0; i < n; i++ {
+		length = length<<8 | int((*r)[i])
+	}
+	if len(*r) < n+length {
+		return nil, false
+	}
+	v := (*r)[n : n+length]
+	*r = (*r)[n+length:]
+	return v, true
+}
+
+func (r *tlsReader) bytes8() (tlsReader, bool) {
+	return r.vector(1)
+}
+
+func (r *tlsReader) bytes16() (tlsReader, bool) {
+	return r.vector(2)
+}
+
+func (r *tlsReader) bytes24() (tlsReader, bool) {
+	return r.vector(3)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// generate a tls ClientHello record by crypto/tls
+func clientHelloRecord(t *testing.T, serverName string, alpn []string) []byte {
+	client, server := net.Pipe()
+	go func() {
+		conn := tls.Client(client, &tls.Config{ServerName: serverName, NextProtos: alpn})
+		conn.Handshake()
+	}()
+	var header [5]byte
+	_, err := server.Read(header[:])
+	assert.Nil(t, err)
+	payload := make([]byte, int(header[3])<<8|int(header[4]))
+	for n := 0; n < len(payload); {
+		read, err := server.Read(payload[n:])
+		assert.Nil(t, err)
+		n += read
+	}
+	server.Close()
+	client.Close()
+	return append(header[:], payload...)
+}
+
+func TestReadTLSClientHello(t *testing.T) {
+	data := clientHelloRecord(t, "example.com", []string{"h2", "http/1.1"})
+	assert.True(t, isTLSHandshake(data))
+	hello, err := readTLSHello(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, byte(tlsClientHello), hello.handshakeType)
+	assert.Equal(t, "example.com", hello.serverName)
+	assert.Equal(t, []string{"h2", "http/1.1"}, hello.alpn)
+	assert.NotEmpty(t, hello.cipherSuites)
+
+	_, err = readTLSHello(bytes.NewReader([]byte("GET / HTTP/1.1\r\n")))
+	assert.Equal(t, errNotTLSHandshake, err)
+	_, err = parseTLSHello([]byte{tlsClientHello, 0, 0, 10, 3, 3})
+	assert.Equal(t, errNotTLSHandshake, err)
+}
+
+// build a tls 1.2 ServerHello record, with the ALPN extension selecting protocol if not empty
+func serverHelloRecord(protocol string) []byte {
+	var extensions []byte
+	if protocol != "" {
+		list := append([]byte{byte(len(protocol))}, protocol...)
+		data := append([]byte{0, byte(len(list))}, list...)
+		extensions = append([]byte{0, tlsExtALPN, 0, byte(len(data))}, data...)
+	}
+	body := []byte{3, 3}
+	body = append(body, make([]byte, 32)...)      // random
+	body = append(body, 0)                        // empty session id
+	body = append(body, 0xc0, 0x2f, 0)            // cipher suite, compression method
+	body = append(body, 0, byte(len(extensions))) // extensions length
+	body = append(body, extensions...)
+	message := append([]byte{tlsServerHello, 0, 0, byte(len(body))}, body...)
+	return append([]byte{tlsRecordHandshake, 3, 3, 0, byte(len(message))}, message...)
+}
+
+// build a tls 1.3 ServerHello record selecting cipher suite, with the supported_versions extension
+func tls13ServerHelloRecord(suite uint16) []byte {
+	extensions := []byte{0, tlsExtSupportedVers, 0, 2, 3, 4}
+	body := []byte{3, 3}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0)
+	body = append(body, byte(suite>>8), byte(suite), 0)
+	body = append(body, 0, byte(len(extensions)))
+	body = append(body, extensions...)
+	message := append([]byte{tlsServerHello, 0, 0, byte(len(body))}, body...)
+	return append([]byte{tlsRecordHandshake, 3, 3, 0, byte(len(message))}, message...)
+}
+
+func TestServerHelloVersionCipher(t *testing.T) {
+	hello := parseServerHello(serverHelloRecord("h2"))
+	if assert.NotNil(t, hello) {
+		assert.Equal(t, "TLS 1.2", hello.negotiatedVersion())
+		assert.Equal(t, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", hello.selectedCipherSuite())
+	}
+	hello = parseServerHello(tls13ServerHelloRecord(0x1302))
+	if assert.NotNil(t, hello) {
+		assert.Equal(t, "TLS 1.3", hello.negotiatedVersion())
+		assert.Equal(t, "TLS_AES_256_GCM_SHA384", hello.selectedCipherSuite())
+	}
+	assert.Nil(t, parseServerHello(clientHelloRecord(t, "example.com", nil)))
+
+	assembler, _ := newTestAssembler()
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	clientHello := clientHelloRecord(t, "example.com", []string{"h2"})
+	assembler.assemble(testClientFlow, &layers.TCP{SrcPort: 50000, DstPort: 443, Seq: 999, SYN: true}, start)
+	assembler.assemble(testClientFlow, &layers.TCP{SrcPort: 50000, DstPort: 443, Seq: 1000, Ack: 5000, ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: clientHello}}, start)
+	assembler.assemble(testServerFlow, &layers.TCP{SrcPort: 443, DstPort: 50000, Seq: 5000,
+		Ack: 1000 + uint32(len(clientHello)), ACK: true,
+		BaseLayer: layers.BaseLayer{Payload: tls13ServerHelloRecord(0x1301)}}, start)
+	infos := assembler.Snapshot()
+	if assert.Equal(t, 1, len(infos)) {
+		assert.Equal(t, "TLS 1.3", infos[0].TLSVersion)
+		assert.Equal(t, "TLS_AES_128_GCM_SHA256", infos[0].CipherSuite)
+		assert.Equal(t, "", infos[0].ALPN)
+	}
+}
+
+func TestServerHelloALPN(t *testing.T) {
+	assert.Equal(t, "h2", serverHelloALPN(serverHelloRecord("h2")))
+	assert.Equal(t, "http/1.1", serverHelloALPN(serverHelloRecord("http/1.1")))
+	assert.Equal(t, "", serverHelloALPN(serverHelloRecord("")))
+	// record continues in the next segments, with certificate following
+	record := serverHelloRecord("h2")
+	record[4] += 100
+	assert.Equal(t, "h2", serverHelloALPN(record))
+	assert.Equal(t, "", serverHelloALPN(clientHelloRecord(t, "example.com", []string{"h2"})))
+	assert.Equal(t, "", serverHelloALPN([]byte("HTTP/1.1 200 OK\r\n")))
+
+	assembler, _ := newTestAssembler()
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	packet := func(srcPort, dstPort layers.TCPPort, seq, ack uint32, payload []byte) *layers.TCP {
+		return &layers.TCP{SrcPort: srcPort, DstPort: dstPort, Seq: seq, Ack: ack, ACK: true,
+			BaseLayer: layers.BaseLayer{Payload: payload}}
+	}
+	clientHello := clientHelloRecord(t, "example.com", []string{"h2", "http/1.1"})
+	for port, protocol := range map[layers.TCPPort]string{50000: "h2", 50001: ""} {
+		assembler.assemble(testClientFlow, &layers.TCP{SrcPort: port, DstPort: 443, Seq: 999, SYN: true}, start)
+		assembler.assemble(testClientFlow, packet(port, 443, 1000, 5000, clientHello), start)
+		assembler.assemble(testServerFlow, packet(443, port, 5000, 1000+uint32(len(clientHello)),
+			serverHelloRecord(protocol)), start)
+		// later server segments are not hellos
+		assembler.assemble(testServerFlow, packet(443, port, 6000, 1000+uint32(len(clientHello)),
+			serverHelloRecord("http/1.1")), start)
+	}
+	infos := assembler.Snapshot()
+	if assert.Equal(t, 2, len(infos)) {
+		assert.Equal(t, "https", infos[0].Scheme)
+		assert.Equal(t, "h2", infos[0].ALPN)
+		assert.Equal(t, "https", infos[1].Scheme)
+		assert.Equal(t, "", infos[1].ALPN)
+	}
+}
+
+func TestInferScheme(t *testing.T) {
+	handler, sink := newTestHTTPHandler(&Config{})
+	assembler := newTCPAssembler(handler, handler.printer)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	packet := func(srcPort, dstPort layers.TCPPort, seq, ack uint32, payload []byte) *layers.TCP {
+		return &layers.TCP{SrcPort: srcPort, DstPort: dstPort, Seq: seq, Ack: ack, ACK: true,
+			BaseLayer: layers.BaseLayer{Payload: payload}}
+	}
+	// plaintext http on the usual https port
+	request := []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	response := []byte("HTTP/1.1 204 No Content\r\n\r\n")
+	assembler.assemble(testClientFlow, packet(50000, 8443, 1000, 5000, request), start)
+	assembler.assemble(testServerFlow, packet(8443, 50000, 5000, 1000+uint32(len(request)), response), start)
+	assembler.assemble(testClientFlow, packet(50000, 8443, 1000+uint32(len(request)), 5000+uint32(len(response)), nil), start)
+	// tls on the usual http port
+	assembler.assemble(testClientFlow, &layers.TCP{SrcPort: 50001, DstPort: 8080, Seq: 99, SYN: true}, start)
+	assembler.assemble(testClientFlow, packet(50001, 8080, 100, 1, clientHelloRecord(t, "example.com", nil)), start)
+
+	infos := assembler.Snapshot()
+	assert.Equal(t, 2, len(infos))
+	for _, info := range infos {
+		if info.Server == "10.0.0.2:8443" {
+			assert.Equal(t, "http", info.Scheme)
+		} else {
+			assert.Equal(t, "10.0.0.2:8080", info.Server)
+			assert.Equal(t, "https", info.Scheme)
+		}
+	}
+	assembler.finishAll()
+	waitGroup.Wait()
+	if assert.Equal(t, 1, len(sink.exchanges)) {
+		assert.Equal(t, "http", sink.exchanges[0].scheme)
+		assert.Equal(t, "http", sink.exchanges[0].toProto().Scheme)
+	}
+
+	assert.Equal(t, "", inferScheme([]byte("SSH-2.0-OpenSSH_8.9\r\n")))
+}
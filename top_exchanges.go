@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics exchanges are ranked by
+const (
+	topByTTFB  = "ttfb"  // request end to response start
+	topByTotal = "total" // request start to response end
+	topBySize  = "size"  // response body size
+)
+
+// TopExchanges keep the top N exchanges by a metric in a bounded min-heap, so memory is bounded however many
+// exchanges are captured. Exchanges without the metric, e.g. without response, are not ranked
+type TopExchanges struct {
+	lock    sync.Mutex
+	n       int
+	metric  string
+	entries topHeap
+	added   int // exchanges ranked, gives order of exchanges with same value
+}
+
+type topEntry struct {
+	src    string
+	dst    string
+	method string
+	url    string
+	status int
+	value  int64 // nanoseconds for durations, bytes for size
+	order  int
+}
+
+// topHeap is a min-heap of entries, the root is the first to evict. Of same value the later one is evicted
+type topHeap []topEntry
+
+func (h topHeap) Len() int { return len(h) }
+func (h topHeap) Less(i, j int) bool {
+	return h[i].value < h[j].value || h[i].value == h[j].value && h[i].order > h[j].order
+}
+func (h topHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x interface{}) { *h = append(*h, x.(topEntry)) }
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func newTopExchanges(n int, metric string) (*TopExchanges, error) {
+	if metric != topByTTFB && metric != topByTotal && metric != topBySize {
+		return nil, fmt.Errorf("invalid top metric: %s", metric)
+	}
+	return &TopExchanges{n: n, metric: metric}, nil
+}
+
+// value of the metric for exchange, false if exchange has not the timestamps of it
+func (top *TopExchanges) value(exchange *Exchange) (int64, bool) {
+	if exchange.status == 0 {
+		return 0, false
+	}
+	switch top.metric {
+	case topByTTFB:
+		if exchange.requestEnd.IsZero() || exchange.responseStart.IsZero() {
+			return 0, false
+		}
+		return int64(exchange.responseStart.Sub(exchange.requestEnd)), true
+	case topByTotal:
+		if exchange.requestStart.IsZero() || exchange.responseEnd.IsZero() {
+			return 0, false
+		}
+		return int64(exchange.responseEnd.Sub(exchange.requestStart)), true
+	}
+	return exchange.responseBodySize, true
+}
+
+func (top *TopExchanges) add(exchange *Exchange) {
+	value, ok := top.value(exchange)
+	if !ok {
+		return
+	}
+	top.lock.Lock()
+	defer top.lock.Unlock()
+	entry := topEntry{src: exchange.key.srcString(), dst: exchange.key.dstString(), method: exchange.method,
+		url: exchange.host + exchange.url, status: exchange.status, value: value, order: top.added}
+	top.added++
+	if len(top.entries) < top.n {
+		heap.Push(&top.entries, entry)
+		return
+	}
+	if root := top.entries[0]; value > root.value {
+		top.entries[0] = entry
+		heap.Fix(&top.entries, 0)
+	}
+}
+
+// the top exchanges in descending order of metric, one line for each
+func (top *TopExchanges) format(format string) string {
+	top.lock.Lock()
+	entries := append([]topEntry(nil), top.entries...)
+	top.lock.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].value > entries[j].value || entries[i].value == entries[j].value &&
+			entries[i].order < entries[j].order
+	})
+	var buffer strings.Builder
+	for i, entry := range entries {
+		if format == "json" {
+			var record = map[string]interface{}{
+				"type":   "top",
+				"rank":   i + 1,
+				"metric": top.metric,
+				"method": entry.method,
+				"url":    entry.url,
+				"status": entry.status,
+				"src":    entry.src,
+				"dst":    entry.dst,
+			}
+			if top.metric == topBySize {
+				record["value"] = entry.value
+			} else {
+				record["value"] = time.Duration(entry.value).Seconds()
+			}
+			data, _ := json.Marshal(record)
+			buffer.Write(data)
+			buffer.WriteString("\n")
+			continue
+		}
+		value := time.Duration(entry.value).String()
+		if top.metric == topBySize {
+			value = strconv.FormatInt(entry.value, 10)
+		}
+		fmt.Fprintf(&buffer, "[top] %d %s=%s %s %s %d %s -> %s\n", i+1, top.metric, value, entry.method, entry.url,
+			entry.status, entry.src, entry.dst)
+	}
+	return buffer.String()
+}
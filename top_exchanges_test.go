@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopExchanges(t *testing.T) {
+	key := ConnectionKey{src: Endpoint{ip: "10.0.0.1", port: 50000}, dst: Endpoint{ip: "10.0.0.2", port: 80}}
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	exchange := func(path string, ttfb time.Duration, size int64) *Exchange {
+		return &Exchange{key: key, method: "GET", host: "example.com", url: path, status: 200,
+			requestStart: start, requestEnd: start.Add(time.Millisecond), responseStart: start.Add(time.Millisecond + ttfb),
+			responseEnd: start.Add(time.Second), responseBodySize: size}
+	}
+	var exchanges = []*Exchange{
+		exchange("/a", 30*time.Millisecond, 500),
+		exchange("/b", 200*time.Millisecond, 100),
+		exchange("/c", 10*time.Millisecond, 900),
+		exchange("/d", 500*time.Millisecond, 300),
+		exchange("/e", 200*time.Millisecond, 700),
+		exchange("/f", 50*time.Millisecond, 200),
+		{key: key, method: "GET", host: "example.com", url: "/no-response", requestStart: start, requestEnd: start},
+	}
+
+	top, err := newTopExchanges(3, topByTTFB)
+	assert.Nil(t, err)
+	for _, e := range exchanges {
+		top.add(e)
+	}
+	assert.Equal(t, 3, len(top.entries))
+	assert.Equal(t, "[top] 1 ttfb=500ms GET example.com/d 200 10.0.0.1:50000 -> 10.0.0.2:80\n"+
+		"[top] 2 ttfb=200ms GET example.com/b 200 10.0.0.1:50000 -> 10.0.0.2:80\n"+
+		"[top] 3 ttfb=200ms GET example.com/e 200 10.0.0.1:50000 -> 10.0.0.2:80\n", top.format("text"))
+
+	top, _ = newTopExchanges(2, topBySize)
+	for _, e := range exchanges {
+		top.add(e)
+	}
+	assert.Equal(t, "[top] 1 size=900 GET example.com/c 200 10.0.0.1:50000 -> 10.0.0.2:80\n"+
+		"[top] 2 size=700 GET example.com/e 200 10.0.0.1:50000 -> 10.0.0.2:80\n", top.format("text"))
+
+	top, _ = newTopExchanges(10, topByTotal)
+	for _, e := range exchanges {
+		top.add(e)
+	}
+	assert.Equal(t, 6, strings.Count(top.format("text"), "total=1s"))
+
+	_, err = newTopExchanges(3, "latency")
+	assert.NotNil(t, err)
+}
+
+func TestTopExchangesCapture(t *testing.T) {
+	handler, _ := newTestHTTPHandler(&Config{})
+	handler.top, _ = newTopExchanges(2, topByTTFB)
+	var segments []testSegment
+	for i, delay := range []time.Duration{100, 300, 200} {
+		segments = append(segments, testSegment{up: true, payload: "GET /" + string(rune('a'+i)) +
+			" HTTP/1.1\r\nHost: example.com\r\n\r\n"})
+		segments = append(segments, testSegment{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+			delay: delay * time.Millisecond})
+	}
+	runConversation(handler, segments)
+	assert.Equal(t, "[top] 1 ttfb=300ms GET example.com/b 200 10.0.0.1:50000 -> 10.0.0.2:80\n"+
+		"[top] 2 ttfb=200ms GET example.com/c 200 10.0.0.1:50000 -> 10.0.0.2:80\n", handler.top.format("text"))
+}
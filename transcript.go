@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// bytes of a message kept for transcript by default, so large bodies are not held in memory until written
+const defaultTranscriptMaxMessage = 1 << 20
+
+// TranscriptWriter write the conversation of each connection to <connkey>.txt in dir. Messages are written as
+// on wire in exchange order, each after a line with direction and timestamp. Non printable parts are hex dumped.
+// Traffic after switching to a tunnel, websocket or http2 is not transcribed
+type TranscriptWriter struct {
+	dir        string
+	maxMessage int // bytes of a message kept for transcript, the rest is left out
+}
+
+func newTranscriptWriter(dir string) (*TranscriptWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &TranscriptWriter{dir: dir, maxMessage: defaultTranscriptMaxMessage}, nil
+}
+
+// connectionTranscript is the transcript of one connection. bytes read by the recorders are kept until
+// written to transcript, the file is created when the first message is written
+type connectionTranscript struct {
+	writer     *TranscriptWriter
+	key        ConnectionKey
+	connection *TCPConnection
+	request    *recordReader
+	response   *recordReader
+	file       *os.File
+	closed     bool
+}
+
+// start transcript of connection, with bytes read by the recorders. nil if transcript is not enabled
+func (h *HTTPTrafficHandler) startTranscript(connection *TCPConnection, request *recordReader,
+	response *recordReader) *connectionTranscript {
+	if h.transcripts == nil {
+		return nil
+	}
+	request.keepLimit = h.transcripts.maxMessage
+	response.keepLimit = h.transcripts.maxMessage
+	return &connectionTranscript{writer: h.transcripts, key: h.key, connection: connection, request: request,
+		response: response}
+}
+
+// file name of connection key, with chars unsafe for file system replaced
+func transcriptFileName(key ConnectionKey) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, key.srcString()+"-"+key.dstString()) + ".txt"
+}
+
+// write the message ending at current position of buffered reader, with bytes not written before it
+func (t *connectionTranscript) writeMessage(up bool, index int, timestamp time.Time, buffered *bufio.Reader) {
+	if t == nil || t.closed {
+		return
+	}
+	kind, recorder := "response", t.response
+	if up {
+		kind, recorder = "request", t.request
+	}
+	data, omitted := recorder.take(recorder.position(buffered))
+	t.writeBlock(up, fmt.Sprintf("%s %d", kind, index), timestamp, data, omitted)
+}
+
+// write bytes read but not part of a written message, by a note why transcript ends if not empty,
+// and close the transcript. Recorders stop keeping bytes
+func (t *connectionTranscript) close(note string) {
+	if t == nil || t.closed {
+		return
+	}
+	data, omitted := t.request.take(t.request.count)
+	t.writeBlock(true, "unparsed", t.connection.upStream.lastTimestamp, data, omitted)
+	data, omitted = t.response.take(t.response.count)
+	t.writeBlock(false, "unparsed", t.connection.downStream.lastTimestamp, data, omitted)
+	if note != "" && t.file != nil {
+		t.writeString("--- " + note + ", following traffic is not transcribed\n")
+	}
+	t.closed = true
+	t.request.keepLimit = 0
+	t.response.keepLimit = 0
+	if t.file != nil {
+		t.file.Close()
+	}
+}
+
+// write block of message data, with a marker of omitted bytes after data if message is truncated
+func (t *connectionTranscript) writeBlock(up bool, label string, timestamp time.Time, data []byte, omitted int64) {
+	if len(data) == 0 {
+		return
+	}
+	src, dst, marker := t.key.srcString(), t.key.dstString(), ">>>"
+	if !up {
+		src, dst, marker = dst, src, "<<<"
+	}
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s %s %s -> %s %s %d bytes\n", marker, label, src, dst,
+		timestamp.Format(time.RFC3339Nano), int64(len(data))+omitted)
+	// header block is mostly text even if body is binary
+	header, body := data, []byte(nil)
+	if idx := bytes.Index(data, []byte("\r\n\r\n")); idx >= 0 {
+		header, body = data[:idx+4], data[idx+4:]
+	}
+	writeTranscriptData(&builder, header)
+	writeTranscriptData(&builder, body)
+	if omitted > 0 {
+		fmt.Fprintf(&builder, "--- %d bytes omitted, beyond max message size\n", omitted)
+	}
+	builder.WriteString("\n")
+	t.writeString(builder.String())
+}
+
+func (t *connectionTranscript) writeString(s string) {
+	if t.file == nil {
+		f, err := createUnique(t.writer.dir, transcriptFileName(t.key))
+		if err != nil {
+			logger.Warn("create transcript error:", err)
+			t.closed = true
+			return
+		}
+		t.file = f
+	}
+	if _, err := t.file.WriteString(s); err != nil {
+		logger.Warn("write transcript error:", err)
+	}
+}
+
+// write data as is if printable, or else as hex dump
+func writeTranscriptData(builder *strings.Builder, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if !isPrintable(data) {
+		builder.WriteString(hex.Dump(data))
+		return
+	}
+	builder.Write(data)
+	if data[len(data)-1] != '\n' {
+		builder.WriteString("\n")
+	}
+}
+
+// if data is valid utf-8 without control chars other than tab and line endings
+func isPrintable(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, c := range data {
+		if c < 0x20 && c != '\t' && c != '\r' && c != '\n' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// bytes kept from the last taken to offset end in stream, which are dropped, and count of bytes not kept as the
+// keep limit is reached
+func (r *recordReader) take(end int64) ([]byte, int64) {
+	n := end - r.keptOffset
+	if n <= 0 {
+		return nil, 0
+	}
+	if n <= int64(len(r.kept)) {
+		data := r.kept[:n:n]
+		r.kept = r.kept[n:]
+		r.keptOffset += n
+		return data, 0
+	}
+	data := r.kept[:len(r.kept):len(r.kept)]
+	omitted := n - int64(len(r.kept))
+	// bytes read after end are still in history, as they are at most the buffered bytes of reader
+	after := r.count - end
+	if after > int64(len(r.history)) {
+		after = int64(len(r.history))
+	}
+	r.kept = append([]byte(nil), r.history[int64(len(r.history))-after:]...)
+	r.keptOffset = r.count - after
+	return data, omitted
+}
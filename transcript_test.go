@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscriptFileName(t *testing.T) {
+	key := ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"10.0.0.2", 80}}
+	assert.Equal(t, "10.0.0.1_50000-10.0.0.2_80.txt", transcriptFileName(key))
+}
+
+func TestTranscript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	handler, _ := newTestHTTPHandler(&Config{})
+	handler.transcripts, err = newTranscriptWriter(filepath.Join(dir, "transcripts"))
+	assert.Nil(t, err)
+	request := "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello"
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\n"
+	binary := "\x00\x01\x02\xff"
+	second := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	runConversation(handler, []testSegment{
+		{up: true, payload: request[:20]},
+		{up: true, payload: request[20:]},
+		{up: false, payload: response + binary[:2], delay: time.Millisecond},
+		{up: false, payload: binary[2:]},
+		{up: true, payload: second, delay: time.Second},
+		// cut by connection end
+		{up: false, payload: "HTTP/1.1 204 No Content\r\n", delay: time.Millisecond},
+	})
+
+	files, err := filepath.Glob(filepath.Join(dir, "transcripts", "*"))
+	assert.Nil(t, err)
+	if !assert.Equal(t, []string{filepath.Join(dir, "transcripts", "10.0.0.1_50000-10.0.0.2_80.txt")}, files) {
+		return
+	}
+	data, err := ioutil.ReadFile(files[0])
+	assert.Nil(t, err)
+	assert.Equal(t, ">>> request 1 10.0.0.1:50000 -> 10.0.0.2:80 2018-01-01T00:00:00Z 68 bytes\n"+
+		request+"\n\n"+
+		"<<< response 1 10.0.0.2:80 -> 10.0.0.1:50000 2018-01-01T00:00:00.001Z 42 bytes\n"+
+		response+hex.Dump([]byte(binary))+"\n"+
+		">>> request 2 10.0.0.1:50000 -> 10.0.0.2:80 2018-01-01T00:00:01.001Z 37 bytes\n"+
+		second+"\n"+
+		"<<< unparsed 10.0.0.2:80 -> 10.0.0.1:50000 2018-01-01T00:00:01.002Z 25 bytes\n"+
+		"HTTP/1.1 204 No Content\r\n\n", string(data))
+}
+
+// bytes of a message beyond max message size are not kept, following messages are still transcribed
+func TestTranscriptMaxMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	handler, _ := newTestHTTPHandler(&Config{})
+	handler.transcripts, err = newTranscriptWriter(dir)
+	assert.Nil(t, err)
+	handler.transcripts.maxMessage = 64
+	request := "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("a", 100)
+	response := "HTTP/1.1 204 No Content\r\n\r\n"
+	second := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	runConversation(handler, []testSegment{
+		{up: true, payload: request + second},
+		{up: false, payload: response + response},
+	})
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 1, len(files)) {
+		return
+	}
+	data, err := ioutil.ReadFile(files[0])
+	assert.Nil(t, err)
+	assert.Equal(t, ">>> request 1 10.0.0.1:50000 -> 10.0.0.2:80 2018-01-01T00:00:00Z 165 bytes\n"+
+		request[:64]+"\n--- 101 bytes omitted, beyond max message size\n\n"+
+		"<<< response 1 10.0.0.2:80 -> 10.0.0.1:50000 2018-01-01T00:00:00Z 27 bytes\n"+
+		response+"\n"+
+		">>> request 2 10.0.0.1:50000 -> 10.0.0.2:80 2018-01-01T00:00:00Z 37 bytes\n"+
+		second+"\n"+
+		"<<< response 2 10.0.0.2:80 -> 10.0.0.1:50000 2018-01-01T00:00:00Z 27 bytes\n"+
+		response+"\n", string(data))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+
+	"httpdump/httpport"
+)
+
+// tunnelRecord is metadata of a tunnel established by CONNECT request
+type tunnelRecord struct {
+	key    ConnectionKey
+	target string // CONNECT request target, host:port
+	tls    bool   // if tunneled traffic is tls
+	sni    string
+	alpn   []string
+}
+
+// if response establish a tunnel for the CONNECT request
+func isTunnelEstablished(req *httpport.Request, resp *httpport.Response) bool {
+	return req.Method == "CONNECT" && resp.StatusCode/100 == 2
+}
+
+// after the tunnel is established, following traffic is not http, parse tls hellos if it is tls, and report tunnel.
+// the remaining traffic is discarded
+func (h *HTTPTrafficHandler) handleTunnel(req *httpport.Request, requestReader *bufio.Reader,
+	responseReader *bufio.Reader) {
+	record := &tunnelRecord{key: h.key, target: req.RequestURI}
+	if data, err := requestReader.Peek(3); err == nil && isTLSHandshake(data) {
+		record.tls = true
+		if hello, err := readTLSHello(requestReader); err == nil && hello.handshakeType == tlsClientHello {
+			record.sni = hello.serverName
+			record.alpn = hello.alpn
+		} else if err != nil {
+			logger.Debug("parse tls client hello error:", err)
+		}
+		if data, err := responseReader.Peek(3); err == nil && isTLSHandshake(data) {
+			if hello, err := readTLSHello(responseReader); err == nil && hello.handshakeType == tlsServerHello &&
+				len(hello.alpn) > 0 {
+				// the protocol selected by server
+				record.alpn = hello.alpn
+			}
+		}
+	}
+	h.printer.send(record.format(h.config.format))
+}
+
+func (record *tunnelRecord) format(format string) string {
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":   "tunnel",
+			"src":    record.key.srcString(),
+			"dst":    record.key.dstString(),
+			"target": record.target,
+			"tls":    record.tls,
+			"sni":    record.sni,
+			"alpn":   record.alpn,
+		})
+		return string(data) + "\n"
+	}
+	var fields = []string{"[tunnel]", record.key.srcString(), "->", record.key.dstString(), "target=" + record.target}
+	if record.tls {
+		fields = append(fields, "sni="+record.sni)
+		if len(record.alpn) > 0 {
+			fields = append(fields, "alpn="+strings.Join(record.alpn, ","))
+		}
+	} else {
+		fields = append(fields, "tls=false")
+	}
+	return strings.Join(fields, " ") + "\n"
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"httpdump/httpport"
+)
+
+// FileExtractor write file parts of multipart/form-data requests to a directory.
+// It is shared by all connection goroutines
+type FileExtractor struct {
+	dir      string
+	maxTotal int64 // max bytes of all extracted files, 0 for unlimited
+	lock     sync.Mutex
+	total    int64 // bytes extracted
+}
+
+// formField is a non-file field of multipart form
+type formField struct {
+	name  string
+	value string
+}
+
+// uploadedFile is a file part of multipart form, written to disk
+type uploadedFile struct {
+	field       string
+	filename    string // filename declared in request
+	contentType string
+	path        string // path of extracted file, empty if not written because size cap is reached
+	size        int64  // size of file part in request
+	truncated   bool   // only part of the file is written, because size cap is reached
+}
+
+func newFileExtractor(dir string, maxTotal int64) *FileExtractor {
+	return &FileExtractor{dir: dir, maxTotal: maxTotal}
+}
+
+// if content type is multipart/form-data, return the boundary
+func multipartBoundary(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return "", false
+	}
+	return params["boundary"], true
+}
+
+// parse multipart body, write file parts to dir, and return text fields and extracted files
+func (extractor *FileExtractor) extract(data []byte, boundary string) ([]formField, []uploadedFile, error) {
+	var fields []formField
+	var files []uploadedFile
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return fields, files, nil
+		}
+		if err != nil {
+			return fields, files, err
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return fields, files, err
+		}
+		if part.FileName() == "" {
+			fields = append(fields, formField{name: part.FormName(), value: string(content)})
+			continue
+		}
+		file := uploadedFile{
+			field:       part.FormName(),
+			filename:    part.FileName(),
+			contentType: part.Header.Get("Content-Type"),
+			size:        int64(len(content)),
+		}
+		if err := extractor.write(&file, content); err != nil {
+			logger.Warn("extract upload file", file.filename, "error:", err)
+		}
+		files = append(files, file)
+	}
+}
+
+// write file content, at most remaining bytes of size cap
+func (extractor *FileExtractor) write(file *uploadedFile, content []byte) error {
+	content = extractor.reserve(content)
+	if len(content) < int(file.size) {
+		file.truncated = true
+	}
+	if len(content) == 0 && file.size > 0 {
+		return nil
+	}
+	f, err := createUnique(extractor.dir, sanitizeFilename(file.filename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	file.path = f.Name()
+	_, err = f.Write(content)
+	return err
+}
+
+// take bytes of content allowed by size cap
+func (extractor *FileExtractor) reserve(content []byte) []byte {
+	if extractor.maxTotal <= 0 {
+		return content
+	}
+	extractor.lock.Lock()
+	defer extractor.lock.Unlock()
+	remain := extractor.maxTotal - extractor.total
+	if remain < int64(len(content)) {
+		content = content[:remain]
+	}
+	extractor.total += int64(len(content))
+	return content
+}
+
+// create file with name in dir. if the name is already used, add a number suffix
+func createUnique(dir string, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, ext))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			return f, err
+		}
+	}
+}
+
+// keep only base name of the declared filename, and replace chars unsafe for file system
+func sanitizeFilename(filename string) string {
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, filename)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "upload"
+	}
+	return name
+}
+
+// format records of the form in request
+func formatUploads(key ConnectionKey, fields []formField, files []uploadedFile, format string) string {
+	var builder strings.Builder
+	for _, file := range files {
+		if format == "json" {
+			data, _ := json.Marshal(map[string]interface{}{
+				"type":         "upload",
+				"src":          key.srcString(),
+				"dst":          key.dstString(),
+				"field":        file.field,
+				"filename":     file.filename,
+				"content_type": file.contentType,
+				"size":         file.size,
+				"path":         file.path,
+				"truncated":    file.truncated,
+			})
+			builder.Write(data)
+			builder.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(&builder, "[upload] %s -> %s field=%s filename=%q content-type=%s size=%d path=%s",
+			key.srcString(), key.dstString(), file.field, file.filename, file.contentType, file.size, file.path)
+		if file.truncated {
+			builder.WriteString(" truncated")
+		}
+		builder.WriteString("\n")
+	}
+	for _, field := range fields {
+		if format == "json" {
+			data, _ := json.Marshal(map[string]interface{}{
+				"type":  "form",
+				"src":   key.srcString(),
+				"dst":   key.dstString(),
+				"field": field.name,
+				"value": field.value,
+			})
+			builder.Write(data)
+			builder.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(&builder, "[form] %s -> %s %s=%q\n", key.srcString(), key.dstString(), field.name, field.value)
+	}
+	return builder.String()
+}
+
+// extract file parts if request body is multipart/form-data. the body is kept for later printing
+func (h *HTTPTrafficHandler) extractUploads(req *httpport.Request, exchange *Exchange) {
+	boundary, ok := multipartBoundary(req.Header.Get("Content-Type"))
+	if !ok {
+		return
+	}
+	data, err := h.bufferBody(&req.Body, req.Header)
+	if err != nil {
+		logger.Warn("read multipart body error:", err)
+		return
+	}
+	fields, files, err := h.extractor.extract(data, boundary)
+	if err != nil {
+		logger.Warn("parse multipart body error:", err)
+	}
+	exchange.formFields = fields
+	exchange.uploads = files
+	if len(fields) > 0 || len(files) > 0 {
+		h.printer.send(formatUploads(h.key, fields, files, h.config.format))
+	}
+}
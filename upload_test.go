@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func multipartRequest(body string) string {
+	return "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Type: multipart/form-data; boundary=XyZ\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
+
+func TestExtractUploads(t *testing.T) {
+	dir := t.TempDir()
+	body := "--XyZ\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nmy report\r\n" +
+		"--XyZ\r\nContent-Disposition: form-data; name=\"file\"; filename=\"../../etc/report 1.txt\"\r\n" +
+		"Content-Type: text/plain\r\n\r\nline1\nline2\r\n--XyZ--\r\n"
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.extractor = newFileExtractor(dir, 0)
+	runConversation(handler, []testSegment{
+		{up: true, payload: multipartRequest(body)},
+		{up: false, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+	})
+
+	assert.Equal(t, 1, len(sink.exchanges))
+	exchange := sink.exchanges[0]
+	assert.Equal(t, int64(len(body)), exchange.requestBodySize)
+	assert.Equal(t, []formField{{name: "title", value: "my report"}}, exchange.formFields)
+	assert.Equal(t, 1, len(exchange.uploads))
+	file := exchange.uploads[0]
+	assert.Equal(t, "file", file.field)
+	assert.Equal(t, "report 1.txt", file.filename)
+	assert.Equal(t, "text/plain", file.contentType)
+	assert.Equal(t, int64(11), file.size)
+	assert.Equal(t, filepath.Join(dir, "report_1.txt"), file.path)
+	data, err := ioutil.ReadFile(file.path)
+	assert.Nil(t, err)
+	assert.Equal(t, "line1\nline2", string(data))
+
+	record := exchange.toProto()
+	assert.Equal(t, "my report", record.FormFields[0].Value)
+	assert.Equal(t, file.path, record.Uploads[0].Path)
+
+	var output string
+	for len(handler.printer.outputQueue) > 0 {
+		if msg := <-handler.printer.outputQueue; strings.HasPrefix(msg, "[upload]") {
+			output = msg
+		}
+	}
+	assert.True(t, strings.HasPrefix(output, "[upload] 10.0.0.1:50000 -> 10.0.0.2:80 field=file"), output)
+	assert.Contains(t, output, "[form] 10.0.0.1:50000 -> 10.0.0.2:80 title=\"my report\"")
+}
+
+func TestExtractUploadsMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	extractor := newFileExtractor(dir, 6)
+	body := "--XyZ\r\nContent-Disposition: form-data; name=\"a\"; filename=\"a.bin\"\r\n\r\n1234\r\n" +
+		"--XyZ\r\nContent-Disposition: form-data; name=\"b\"; filename=\"a.bin\"\r\n\r\n5678\r\n" +
+		"--XyZ\r\nContent-Disposition: form-data; name=\"c\"; filename=\"a.bin\"\r\n\r\n90\r\n--XyZ--\r\n"
+	_, files, err := extractor.extract([]byte(body), "XyZ")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+	assert.False(t, files[0].truncated)
+	assert.True(t, files[1].truncated)
+	data, _ := ioutil.ReadFile(files[1].path)
+	assert.Equal(t, "56", string(data))
+	assert.Equal(t, filepath.Join(dir, "a-1.bin"), files[1].path)
+	assert.True(t, files[2].truncated)
+	assert.Equal(t, "", files[2].path)
+
+	assert.Equal(t, "upload", sanitizeFilename(".."))
+	assert.Equal(t, "x.exe", sanitizeFilename(`C:\Users\x.exe`))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URLTemplateRule replace url path parts matched by pattern
+type URLTemplateRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+const maxURLTemplatePasses = 8
+
+// default rules collapse uuid, numeric and long hex path segments to {id}
+var defaultURLTemplateRules = []URLTemplateRule{
+	{regexp.MustCompile(`/[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}(/|$)`), "/{id}$1"},
+	{regexp.MustCompile(`/[0-9]+(/|$)`), "/{id}$1"},
+	{regexp.MustCompile(`/[0-9a-fA-F]{16,}(/|$)`), "/{id}$1"},
+}
+
+// parse template rule in form of regex=replacement
+func parseURLTemplateRule(value string) (URLTemplateRule, error) {
+	idx := strings.LastIndexByte(value, '=')
+	if idx <= 0 {
+		return URLTemplateRule{}, fmt.Errorf("invalid url template rule, should be regex=replacement: %s", value)
+	}
+	pattern, err := regexp.Compile(value[:idx])
+	if err != nil {
+		return URLTemplateRule{}, err
+	}
+	return URLTemplateRule{pattern, value[idx+1:]}, nil
+}
+
+// URLTemplateRules is flag value of url template rules, can be set multi times
+type URLTemplateRules []URLTemplateRule
+
+func (rules *URLTemplateRules) String() string {
+	var values []string
+	for _, rule := range *rules {
+		values = append(values, rule.pattern.String()+"="+rule.replacement)
+	}
+	return strings.Join(values, " ")
+}
+
+// Set add one rule
+func (rules *URLTemplateRules) Set(value string) error {
+	rule, err := parseURLTemplateRule(value)
+	if err != nil {
+		return err
+	}
+	*rules = append(*rules, rule)
+	return nil
+}
+
+// apply rules to url path, query string is removed
+func applyURLTemplate(rules []URLTemplateRule, url string) string {
+	if idx := strings.IndexByte(url, '?'); idx >= 0 {
+		url = url[:idx]
+	}
+	for _, rule := range rules {
+		// adjacent matches may share the slash, replace until nothing changed
+		for i := 0; i < maxURLTemplatePasses; i++ {
+			replaced := rule.pattern.ReplaceAllString(url, rule.replacement)
+			if replaced == url {
+				break
+			}
+			url = replaced
+		}
+	}
+	return url
+}
+
+// URLAggregator count exchanges and latencies, grouped by method and url template
+type URLAggregator struct {
+	lock    sync.Mutex
+	rules   []URLTemplateRule
+	buckets map[string]*urlBucket
+}
+
+type urlBucket struct {
+	count     int
+	responses int // exchanges with response, which has latency
+	total     time.Duration
+	max       time.Duration
+}
+
+func newURLAggregator(rules []URLTemplateRule) *URLAggregator {
+	if len(rules) == 0 {
+		rules = defaultURLTemplateRules
+	}
+	return &URLAggregator{rules: rules, buckets: map[string]*urlBucket{}}
+}
+
+func (aggregator *URLAggregator) add(exchange *Exchange) {
+	key := exchange.method + " " + applyURLTemplate(aggregator.rules, exchange.url)
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	bucket := aggregator.buckets[key]
+	if bucket == nil {
+		bucket = &urlBucket{}
+		aggregator.buckets[key] = bucket
+	}
+	bucket.count++
+	if exchange.status != 0 {
+		// latency from request start to response end
+		latency := exchange.responseEnd.Sub(exchange.requestStart)
+		bucket.responses++
+		bucket.total += latency
+		if latency > bucket.max {
+			bucket.max = latency
+		}
+	}
+}
+
+// one line for each group, ordered by method and url template
+func (aggregator *URLAggregator) format(format string) string {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	var keys []string
+	for key := range aggregator.buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buffer strings.Builder
+	for _, key := range keys {
+		bucket := aggregator.buckets[key]
+		var avg time.Duration
+		if bucket.responses > 0 {
+			avg = bucket.total / time.Duration(bucket.responses)
+		}
+		if format == "json" {
+			data, _ := json.Marshal(map[string]interface{}{
+				"type":  "aggregate",
+				"group": key,
+				"count": bucket.count,
+				"avg":   avg.Seconds(),
+				"max":   bucket.max.Seconds(),
+			})
+			buffer.Write(data)
+			buffer.WriteString("\n")
+			continue
+		}
+		buffer.WriteString("[aggregate] " + key + " count=" + strconv.Itoa(bucket.count) +
+			" avg=" + avg.String() + " max=" + bucket.max.String() + "\n")
+	}
+	return buffer.String()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyURLTemplate(t *testing.T) {
+	rules := defaultURLTemplateRules
+	assert.Equal(t, "/users/{id}", applyURLTemplate(rules, "/users/123"))
+	assert.Equal(t, "/users/{id}/orders/{id}", applyURLTemplate(rules, "/users/123/orders/456?page=2"))
+	assert.Equal(t, "/v1/{id}/{id}/{id}", applyURLTemplate(rules, "/v1/1/2/3"))
+	assert.Equal(t, "/items/{id}", applyURLTemplate(rules, "/items/0b5a3c1e-7d4f-4c2a-9e8b-1a2b3c4d5e6f"))
+	assert.Equal(t, "/v2/users", applyURLTemplate(rules, "/v2/users"))
+
+	var custom URLTemplateRules
+	assert.Nil(t, custom.Set(`/[a-z]+@[a-z.]+=/{email}`))
+	assert.Equal(t, "/mail/{email}", applyURLTemplate(custom, "/mail/bob@example.com"))
+	assert.NotNil(t, custom.Set("no-replacement"))
+	assert.NotNil(t, custom.Set("(=x"))
+}
+
+func TestURLAggregator(t *testing.T) {
+	var segments []testSegment
+	segments = append(segments, statusExchange("/users/123", "200 OK")...)
+	segments[len(segments)-1].delay = 10 * time.Millisecond
+	segments = append(segments, statusExchange("/users/456", "404 Not Found")...)
+	segments[len(segments)-1].delay = 20 * time.Millisecond
+	segments = append(segments, statusExchange("/health", "200 OK")...)
+
+	handler, sink := newTestHTTPHandler(&Config{})
+	handler.aggregator = newURLAggregator(nil)
+	runConversation(handler, segments)
+	// exchange records keep the original url
+	assert.Equal(t, 3, len(sink.exchanges))
+	assert.Equal(t, "/users/123", sink.exchanges[0].url)
+	assert.Equal(t, "[aggregate] GET /health count=1 avg=0s max=0s\n"+
+		"[aggregate] GET /users/{id} count=2 avg=15ms max=20ms\n", handler.aggregator.format("text"))
+}
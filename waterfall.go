@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WaterfallSink collect timing phases of exchanges, and write them as a json timeline grouped by connection
+// when closed, for waterfall renderers. dns and connect phases are not available from captured http data
+type WaterfallSink struct {
+	file        *os.File
+	lock        sync.Mutex
+	connections map[ConnectionKey]*waterfallConnection
+}
+
+type waterfallConnection struct {
+	Src       string           `json:"src"`
+	Dst       string           `json:"dst"`
+	Exchanges []waterfallEntry `json:"exchanges"`
+}
+
+// waterfallEntry is timing of one exchange. phases are in milliseconds and sum to total
+type waterfallEntry struct {
+	Index  int             `json:"index"`
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Status int             `json:"status"`
+	Start  time.Time       `json:"start"`
+	Total  float64         `json:"total"`
+	Phases waterfallPhases `json:"phases"`
+	end    time.Time
+}
+
+// queueing: waiting after previous exchange on the connection completed; send: request sending;
+// wait: waiting for response after request sent; receive: response receiving
+type waterfallPhases struct {
+	Queueing float64 `json:"queueing"`
+	Send     float64 `json:"send"`
+	Wait     float64 `json:"wait"`
+	Receive  float64 `json:"receive"`
+}
+
+func newWaterfallSink(path string) (*WaterfallSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &WaterfallSink{file: file, connections: make(map[ConnectionKey]*waterfallConnection)}, nil
+}
+
+func (sink *WaterfallSink) write(exchange *Exchange) error {
+	entry := waterfallEntry{
+		Index:  exchange.index,
+		Method: exchange.method,
+		URL:    exchange.host + exchange.url,
+		Status: exchange.status,
+	}
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	connection, ok := sink.connections[exchange.key]
+	if !ok {
+		connection = &waterfallConnection{Src: exchange.key.srcString(), Dst: exchange.key.dstString()}
+		sink.connections[exchange.key] = connection
+	}
+	var previousEnd time.Time
+	if n := len(connection.Exchanges); n > 0 {
+		previousEnd = connection.Exchanges[n-1].end
+	}
+	entry.setPhases(exchange, previousEnd)
+	connection.Exchanges = append(connection.Exchanges, entry)
+	return nil
+}
+
+// phases between timestamps of exchange, queueing starts at end of previous exchange on the connection.
+// a missing timestamp and one earlier than the previous, as with pipelined requests or response sent
+// before request body completed, makes a zero phase
+func (entry *waterfallEntry) setPhases(exchange *Exchange, previousEnd time.Time) {
+	start := exchange.requestStart
+	if !previousEnd.IsZero() && previousEnd.Before(start) {
+		start = previousEnd
+	}
+	entry.Start = start
+	var last = start
+	next := func(t time.Time) float64 {
+		if t.IsZero() || t.Before(last) {
+			return 0
+		}
+		d := t.Sub(last)
+		last = t
+		return milliseconds(d)
+	}
+	entry.Phases.Queueing = next(exchange.requestStart)
+	entry.Phases.Send = next(exchange.requestEnd)
+	entry.Phases.Wait = next(exchange.responseStart)
+	entry.Phases.Receive = next(exchange.responseEnd)
+	entry.Total = milliseconds(last.Sub(start))
+	entry.end = last
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Close write the timeline to output file. connections are ordered by start time of first exchange
+func (sink *WaterfallSink) Close() error {
+	sink.lock.Lock()
+	var connections = make([]*waterfallConnection, 0, len(sink.connections))
+	for _, connection := range sink.connections {
+		connections = append(connections, connection)
+	}
+	sink.lock.Unlock()
+	sort.Slice(connections, func(i, j int) bool {
+		first, second := connections[i].Exchanges[0].Start, connections[j].Exchanges[0].Start
+		if !first.Equal(second) {
+			return first.Before(second)
+		}
+		return connections[i].Src < connections[j].Src
+	})
+
+	encoder := json.NewEncoder(sink.file)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(map[string]interface{}{"connections": connections})
+	if closeErr := sink.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
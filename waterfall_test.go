@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaterfallSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpdump")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "waterfall.json")
+
+	sink, err := newWaterfallSink(path)
+	assert.Nil(t, err)
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := ConnectionKey{Endpoint{"10.0.0.1", 50000}, Endpoint{"10.0.0.2", 80}}
+	assert.Nil(t, sink.write(&Exchange{
+		key:           key,
+		index:         1,
+		method:        "GET",
+		host:          "example.com",
+		url:           "/",
+		status:        200,
+		requestStart:  start,
+		requestEnd:    start.Add(time.Millisecond),
+		responseStart: start.Add(5 * time.Millisecond),
+		responseEnd:   start.Add(7 * time.Millisecond),
+	}))
+	// queueing after first exchange, response before request body completed
+	assert.Nil(t, sink.write(&Exchange{
+		key:           key,
+		index:         2,
+		method:        "POST",
+		host:          "example.com",
+		url:           "/upload",
+		status:        413,
+		requestStart:  start.Add(10 * time.Millisecond),
+		requestEnd:    start.Add(20 * time.Millisecond),
+		responseStart: start.Add(15 * time.Millisecond),
+		responseEnd:   start.Add(22 * time.Millisecond),
+	}))
+	// no response
+	other := ConnectionKey{Endpoint{"10.0.0.3", 50000}, Endpoint{"10.0.0.2", 80}}
+	assert.Nil(t, sink.write(&Exchange{key: other, index: 1, method: "GET", url: "/", requestStart: start.Add(-time.Second)}))
+	assert.Nil(t, sink.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	var timeline struct {
+		Connections []waterfallConnection `json:"connections"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &timeline))
+	assert.Equal(t, 2, len(timeline.Connections))
+	assert.Equal(t, "10.0.0.3:50000", timeline.Connections[0].Src)
+	assert.Equal(t, waterfallPhases{}, timeline.Connections[0].Exchanges[0].Phases)
+
+	connection := timeline.Connections[1]
+	assert.Equal(t, "10.0.0.2:80", connection.Dst)
+	assert.Equal(t, 2, len(connection.Exchanges))
+	first := connection.Exchanges[0]
+	assert.Equal(t, "example.com/", first.URL)
+	assert.True(t, first.Start.Equal(start))
+	assert.Equal(t, waterfallPhases{Send: 1, Wait: 4, Receive: 2}, first.Phases)
+	assert.Equal(t, 7.0, first.Total)
+
+	second := connection.Exchanges[1]
+	assert.True(t, second.Start.Equal(start.Add(7*time.Millisecond)))
+	assert.Equal(t, waterfallPhases{Queueing: 3, Send: 10, Receive: 2}, second.Phases)
+	assert.Equal(t, 15.0, second.Total)
+
+	for _, entry := range connection.Exchanges {
+		phases := entry.Phases
+		for _, phase := range []float64{phases.Queueing, phases.Send, phases.Wait, phases.Receive} {
+			assert.True(t, phase >= 0)
+		}
+		assert.Equal(t, entry.Total, phases.Queueing+phases.Send+phases.Wait+phases.Receive)
+	}
+}